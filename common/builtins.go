@@ -1,5 +1,7 @@
 package common
 
+import "fmt"
+
 var BuiltinFuncs = []*BuiltinFunction{
 	{
 		Name:  "len",
@@ -125,6 +127,38 @@ var BuiltinFuncs = []*BuiltinFunction{
 		Name:  "range",
 		Value: builtinRange,
 	},
+	{
+		Name:  "big_int",
+		Value: builtinBigInt,
+	},
+	{
+		Name:  "decimal",
+		Value: builtinDecimal,
+	},
+	{
+		Name:  "is_big_int",
+		Value: builtinIsBigInt,
+	},
+	{
+		Name:  "is_decimal",
+		Value: builtinIsDecimal,
+	},
+	{
+		Name:  "set",
+		Value: builtinSet,
+	},
+	{
+		Name:  "is_set",
+		Value: builtinIsSet,
+	},
+	{
+		Name:  "is_immutable_set",
+		Value: builtinIsImmutableSet,
+	},
+	{
+		Name:  "is_range",
+		Value: builtinIsRange,
+	},
 }
 
 // GetAllBuiltinFunctions returns all builtin function objects.
@@ -249,6 +283,56 @@ func builtinIsTime(args ...Object) (Object, error) {
 	return FalseValue, nil
 }
 
+func builtinIsBigInt(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	if _, ok := args[0].(*BigInt); ok {
+		return TrueValue, nil
+	}
+	return FalseValue, nil
+}
+
+func builtinIsDecimal(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	if _, ok := args[0].(*Decimal); ok {
+		return TrueValue, nil
+	}
+	return FalseValue, nil
+}
+
+func builtinIsSet(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	if _, ok := args[0].(*Set); ok {
+		return TrueValue, nil
+	}
+	return FalseValue, nil
+}
+
+func builtinIsImmutableSet(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	if _, ok := args[0].(*ImmutableSet); ok {
+		return TrueValue, nil
+	}
+	return FalseValue, nil
+}
+
+func builtinIsRange(args ...Object) (Object, error) {
+	if len(args) != 1 {
+		return nil, ErrWrongNumArguments
+	}
+	if _, ok := args[0].(*Range); ok {
+		return TrueValue, nil
+	}
+	return FalseValue, nil
+}
+
 func builtinIsError(args ...Object) (Object, error) {
 	if len(args) != 1 {
 		return nil, ErrWrongNumArguments
@@ -315,13 +399,19 @@ func builtinLen(args ...Object) (Object, error) {
 	case *Bytes:
 		return &Int{Value: int64(len(arg.Value))}, nil
 	case *Map:
-		return &Int{Value: int64(len(arg.Value))}, nil
+		return &Int{Value: int64(len(arg.Value) + len(arg.Entries))}, nil
 	case *ImmutableMap:
+		return &Int{Value: int64(len(arg.Value) + len(arg.Entries))}, nil
+	case *Set:
 		return &Int{Value: int64(len(arg.Value))}, nil
+	case *ImmutableSet:
+		return &Int{Value: int64(len(arg.Value))}, nil
+	case *Range:
+		return &Int{Value: arg.Len()}, nil
 	default:
 		return nil, ErrInvalidArgumentType{
 			Name:     "first",
-			Expected: "array/string/bytes/map",
+			Expected: "array/string/bytes/map/set/range",
 			Found:    arg.TypeName(),
 		}
 	}
@@ -371,25 +461,7 @@ func builtinRange(args ...Object) (Object, error) {
 		step = &Int{Value: int64(1)}
 	}
 
-	return buildRange(start.Value, stop.Value, step.Value), nil
-}
-
-func buildRange(start, stop, step int64) *Array {
-	array := &Array{}
-	if start <= stop {
-		for i := start; i < stop; i += step {
-			array.Value = append(array.Value, &Int{
-				Value: i,
-			})
-		}
-	} else {
-		for i := start; i > stop; i -= step {
-			array.Value = append(array.Value, &Int{
-				Value: i,
-			})
-		}
-	}
-	return array
+	return &Range{Start: start.Value, Stop: stop.Value, Step: step.Value}, nil
 }
 
 func builtinFormat(args ...Object) (Object, error) {
@@ -559,6 +631,57 @@ func builtinTime(args ...Object) (Object, error) {
 	return UndefinedValue, nil
 }
 
+func builtinBigInt(args ...Object) (Object, error) {
+	argsLen := len(args)
+	if !(argsLen == 1 || argsLen == 2) {
+		return nil, ErrWrongNumArguments
+	}
+	if _, ok := args[0].(*BigInt); ok {
+		return args[0], nil
+	}
+	v, ok := ToBigInt(args[0])
+	if ok {
+		return &BigInt{Value: v}, nil
+	}
+	if argsLen == 2 {
+		return args[1], nil
+	}
+	return UndefinedValue, nil
+}
+
+func builtinDecimal(args ...Object) (Object, error) {
+	argsLen := len(args)
+	if !(argsLen == 1 || argsLen == 2) {
+		return nil, ErrWrongNumArguments
+	}
+	if _, ok := args[0].(*Decimal); ok {
+		return args[0], nil
+	}
+	v, ok := ToDecimal(args[0])
+	if ok {
+		return v, nil
+	}
+	if argsLen == 2 {
+		return args[1], nil
+	}
+	return UndefinedValue, nil
+}
+
+// set(elems...)
+func builtinSet(args ...Object) (Object, error) {
+	for i, arg := range args {
+		if _, ok := HashKey(arg); !ok {
+			return nil, ErrInvalidArgumentType{
+				Name:     fmt.Sprintf("elems[%d]", i),
+				Expected: "int/string/char/bool/bytes/time",
+				Found:    arg.TypeName(),
+			}
+		}
+	}
+	s, _ := NewSet(args...)
+	return s, nil
+}
+
 // append(arr, items...)
 func builtinAppend(args ...Object) (Object, error) {
 	if len(args) < 2 {
@@ -569,6 +692,8 @@ func builtinAppend(args ...Object) (Object, error) {
 		return &Array{Value: append(arg.Value, args[1:]...)}, nil
 	case *ImmutableArray:
 		return &Array{Value: append(arg.Value, args[1:]...)}, nil
+	case *Range:
+		return &Array{Value: append(arg.Array().Value, args[1:]...)}, nil
 	default:
 		return nil, ErrInvalidArgumentType{
 			Name:     "first",
@@ -578,9 +703,9 @@ func builtinAppend(args ...Object) (Object, error) {
 	}
 }
 
-// builtinDelete deletes Map keys
-// usage: delete(map, "key")
-// key must be a string
+// builtinDelete deletes Map keys or Set elements
+// usage: delete(map, key) or delete(set, elem)
+// key must be a string, int, char, bool, float, bytes or time value
 func builtinDelete(args ...Object) (Object, error) {
 	argsLen := len(args)
 	if argsLen != 2 {
@@ -588,19 +713,23 @@ func builtinDelete(args ...Object) (Object, error) {
 	}
 	switch arg := args[0].(type) {
 	case *Map:
-		if key, ok := args[1].(*String); ok {
-			delete(arg.Value, key.Value)
+		if arg.Delete(args[1]) {
 			return UndefinedValue, nil
 		}
 		return nil, ErrInvalidArgumentType{
 			Name:     "second",
-			Expected: "string",
+			Expected: "map key",
 			Found:    args[1].TypeName(),
 		}
+	case *Set:
+		if key, ok := HashKey(args[1]); ok {
+			delete(arg.Value, key)
+		}
+		return UndefinedValue, nil
 	default:
 		return nil, ErrInvalidArgumentType{
 			Name:     "first",
-			Expected: "map",
+			Expected: "map/set",
 			Found:    arg.TypeName(),
 		}
 	}
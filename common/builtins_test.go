@@ -34,7 +34,7 @@ func Test_builtinDelete(t *testing.T) {
 			&common.String{}}}, wantErr: true,
 			wantedErr: common.ErrInvalidArgumentType{
 				Name:     "first",
-				Expected: "map",
+				Expected: "map/set",
 				Found:    "string"},
 		},
 		{name: "no-args",
@@ -50,11 +50,15 @@ func Test_builtinDelete(t *testing.T) {
 			args: args{[]common.Object{&common.Map{}, &common.String{}}},
 			want: common.UndefinedValue,
 		},
-		{name: "nil-map-nonstr-key",
+		{name: "nil-map-int-key",
+			args: args{[]common.Object{&common.Map{}, &common.Int{}}},
+			want: common.UndefinedValue,
+		},
+		{name: "nil-map-invalid-key",
 			args: args{[]common.Object{
-				&common.Map{}, &common.Int{}}}, wantErr: true,
+				&common.Map{}, &common.Array{}}}, wantErr: true,
 			wantedErr: common.ErrInvalidArgumentType{
-				Name: "second", Expected: "string", Found: "int"},
+				Name: "second", Expected: "map key", Found: "array"},
 		},
 		{name: "nil-map-no-key",
 			args: args{[]common.Object{&common.Map{}}}, wantErr: true,
@@ -95,6 +99,47 @@ func Test_builtinDelete(t *testing.T) {
 			target: &common.Map{Value: map[string]common.Object{
 				"key2": &common.Int{Value: 10}}},
 		},
+		{name: "map-int-key",
+			args: args{
+				[]common.Object{
+					&common.Map{
+						Value: map[string]common.Object{
+							"1": &common.Int{Value: 1},
+						},
+						Entries: map[string]common.MapEntry{
+							"i1": {
+								Key:   &common.Int{Value: 1},
+								Value: &common.Int{Value: 2},
+							},
+						}},
+					&common.Int{Value: 1}}},
+			want: common.UndefinedValue,
+			target: &common.Map{
+				Value: map[string]common.Object{
+					"1": &common.Int{Value: 1}},
+				Entries: map[string]common.MapEntry{}},
+		},
+		{name: "set-emptied",
+			args: args{
+				[]common.Object{
+					&common.Set{Value: map[string]common.Object{
+						"i1": &common.Int{Value: 1},
+					}},
+					&common.Int{Value: 1}}},
+			want:   common.UndefinedValue,
+			target: &common.Set{Value: map[string]common.Object{}},
+		},
+		{name: "set-unhashable-elem",
+			args: args{
+				[]common.Object{
+					&common.Set{Value: map[string]common.Object{
+						"i1": &common.Int{Value: 1},
+					}},
+					&common.Array{}}},
+			want: common.UndefinedValue,
+			target: &common.Set{Value: map[string]common.Object{
+				"i1": &common.Int{Value: 1}}},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -117,7 +162,7 @@ func Test_builtinDelete(t *testing.T) {
 			}
 			if !tt.wantErr && tt.target != nil {
 				switch v := tt.args.args[0].(type) {
-				case *common.Map, *common.Array:
+				case *common.Map, *common.Array, *common.Set:
 					if !reflect.DeepEqual(tt.target, tt.args.args[0]) {
 						t.Errorf("builtinDelete() common.Objects are not equal "+
 							"got: %+v, want: %+v", tt.args.args[0], tt.target)
@@ -520,9 +565,25 @@ func Test_builtinRange(t *testing.T) {
 				t.Errorf("builtinRange() error = %v, wantedErr %v",
 					err, tt.wantedErr)
 			}
-			if tt.result != nil && !reflect.DeepEqual(tt.result, got) {
+			if tt.result == nil {
+				return
+			}
+			r, ok := got.(*common.Range)
+			if !ok {
+				t.Fatalf("builtinRange() returned %s, want range",
+					got.TypeName())
+			}
+			arr := &common.Array{}
+			for it := r.Iterate(); it.Next(); {
+				arr.Value = append(arr.Value, it.Value())
+			}
+			if !reflect.DeepEqual(tt.result, arr) {
 				t.Errorf("builtinRange() arrays are not equal expected"+
-					" %s, got %s", tt.result, got.(*common.Array))
+					" %s, got %s", tt.result, arr)
+			}
+			if int64(len(tt.result.Value)) != r.Len() {
+				t.Errorf("builtinRange() len = %d, want %d",
+					r.Len(), len(tt.result.Value))
 			}
 		})
 	}
@@ -50,8 +50,39 @@ var (
 	// required method.
 	ErrNotImplemented = errors.New("not implemented")
 
+	// ErrNotBound is an error where a compiled function is called without
+	// being bound to a VM.
+	ErrNotBound = errors.New("compiled function not bound to a VM")
+
+	// ErrNotInCall is an error where a VM is invoked while it's not running a
+	// Go function.
+	ErrNotInCall = errors.New("VM not in a function call")
+
+	// ErrVMAborted is an error where a VM is aborted during an invocation.
+	ErrVMAborted = errors.New("VM aborted")
+
+	// ErrGeneratorRunning is an error where a generator is resumed while it's
+	// running.
+	ErrGeneratorRunning = errors.New("generator already running")
+
 	// ErrInvalidRangeStep is an error where the step parameter is less than or equal to 0 when using builtin range function.
 	ErrInvalidRangeStep = errors.New("range step must be greater than 0")
+
+	// ErrNegativeExponent is an error where an int value is raised to a
+	// negative int power.
+	ErrNegativeExponent = errors.New("negative exponent")
+
+	// ErrIntegerOverflow is an error where the result of an int operation
+	// overflows in the checked arithmetic mode.
+	ErrIntegerOverflow = errors.New("integer overflow")
+
+	// ErrDivisionByZero is an error where an int, big-int or decimal value
+	// is divided by zero.
+	ErrDivisionByZero = errors.New("division by zero")
+
+	// ErrBigNumLimit represents an error where the size of big-int or decimal
+	// value exceeds the limit.
+	ErrBigNumLimit = errors.New("exceeding big number size limit")
 )
 
 // ErrInvalidArgumentType represents an invalid argument value type error.
@@ -65,3 +96,29 @@ func (e ErrInvalidArgumentType) Error() string {
 	return fmt.Sprintf("invalid type for argument '%s': expected %s, found %s",
 		e.Name, e.Expected, e.Found)
 }
+
+// ErrOutOfGas represents an error where the run exhausts its gas budget.
+type ErrOutOfGas struct {
+	Limit int64
+	Used  int64
+}
+
+func (e ErrOutOfGas) Error() string {
+	return fmt.Sprintf("out of gas: used %d, limit %d", e.Used, e.Limit)
+}
+
+// ErrThrown represents an error thrown by the throw statement.
+type ErrThrown struct {
+	Value *Error
+}
+
+func (e ErrThrown) Error() string {
+	switch v := e.Value.Value.(type) {
+	case nil:
+		return e.Value.String()
+	case *String:
+		return v.Value
+	default:
+		return v.String()
+	}
+}
@@ -1,7 +1,9 @@
 package common
 
 import (
+	"math/big"
 	"strconv"
+	"strings"
 	"sync"
 	"unicode/utf8"
 )
@@ -143,6 +145,36 @@ func (f *formatter) padString(s string) {
 	}
 }
 
+// fmtNumber formats the digits of an arbitrary-precision number with the
+// sign and the prefix, e.g. "0x", padding it with zeros after the prefix if
+// the zero flag is set.
+func (f *formatter) fmtNumber(negative bool, prefix, digits string) {
+	if f.precPresent && !strings.Contains(digits, ".") {
+		if f.prec == 0 && digits == "0" {
+			digits = ""
+		} else if n := f.prec - len(digits); n > 0 {
+			digits = strings.Repeat("0", n) + digits
+		}
+	}
+	sign := ""
+	if negative {
+		sign = "-"
+	} else if f.plus {
+		sign = "+"
+	} else if f.space {
+		sign = " "
+	}
+	if f.zero && f.widPresent && !f.minus {
+		if n := f.wid - len(sign) - len(prefix) - len(digits); n > 0 {
+			digits = strings.Repeat("0", n) + digits
+		}
+	}
+	oldZero := f.zero
+	f.zero = false
+	f.padString(sign + prefix + digits)
+	f.zero = oldZero
+}
+
 // fmtBoolean formats a boolean.
 func (f *formatter) fmtBoolean(v bool) {
 	if v {
@@ -854,6 +886,56 @@ func (p *pp) fmtInteger(v uint64, isSigned bool, verb rune) {
 	}
 }
 
+// fmtBigInt formats a big-int value.
+func (p *pp) fmtBigInt(v *big.Int, verb rune) {
+	var base int
+	var prefix string
+	switch verb {
+	case 'd':
+		base = 10
+	case 'b':
+		base, prefix = 2, "0b"
+	case 'o':
+		base, prefix = 8, "0"
+	case 'O':
+		base = 8
+	case 'x':
+		base, prefix = 16, "0x"
+	case 'X':
+		base, prefix = 16, "0X"
+	default:
+		p.fmtString(v.String(), verb)
+		return
+	}
+	if !p.fmt.sharp {
+		prefix = ""
+	}
+	if verb == 'O' {
+		prefix = "0o"
+	}
+	digits := new(big.Int).Abs(v).Text(base)
+	if verb == 'X' {
+		digits = strings.ToUpper(digits)
+	}
+	p.fmt.fmtNumber(v.Sign() < 0, prefix, digits)
+}
+
+// fmtDecimal formats a decimal value. The precision of %f is the number of the
+// fractional digits that the value is rounded to, and, the value is formatted
+// exactly if the precision is not present.
+func (p *pp) fmtDecimal(v *Decimal, verb rune) {
+	switch verb {
+	case 'f', 'F':
+		if p.fmt.precPresent {
+			v = roundDecimal(v, p.fmt.prec)
+		}
+		abs := &Decimal{Value: new(big.Int).Abs(v.Value), Scale: v.Scale}
+		p.fmt.fmtNumber(v.Value.Sign() < 0, "", abs.String())
+	default:
+		p.fmtString(v.String(), verb)
+	}
+}
+
 // fmtFloat formats a float. The default precision for each verb
 // is specified as last argument in the call to fmt_float.
 func (p *pp) fmtFloat(v float64, size int, verb rune) {
@@ -957,6 +1039,10 @@ func (p *pp) printArg(arg Object, verb rune) {
 		p.fmtFloat(f.Value, 64, verb)
 	case *Int:
 		p.fmtInteger(uint64(f.Value), signed, verb)
+	case *BigInt:
+		p.fmtBigInt(f.Value, verb)
+	case *Decimal:
+		p.fmtDecimal(f, verb)
 	case *String:
 		p.fmtString(f.Value, verb)
 	case *Bytes:
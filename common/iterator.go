@@ -14,6 +14,16 @@ type Iterator interface {
 	Value() Object
 }
 
+// ErrorIterator is an iterator that can fail, e.g. by an error of the
+// function it calls. Next returns false when it fails, and, Err returns the
+// error. The VM stops with the error when it iterates the iterator.
+type ErrorIterator interface {
+	Iterator
+
+	// Err returns the error that stopped Next.
+	Err() error
+}
+
 // ArrayIterator is an iterator for an array.
 type ArrayIterator struct {
 	ObjectImpl
@@ -107,11 +117,14 @@ func (i *BytesIterator) Value() Object {
 	return &Int{Value: int64(i.v[i.i-1])}
 }
 
-// MapIterator represents an iterator for the map.
+// MapIterator represents an iterator for the map. The string keys are
+// iterated before the keys of the entries.
 type MapIterator struct {
 	ObjectImpl
 	v map[string]Object
+	e map[string]MapEntry
 	k []string
+	n int
 	i int
 	l int
 }
@@ -138,7 +151,43 @@ func (i *MapIterator) Equals(Object) bool {
 
 // Copy returns a copy of the type.
 func (i *MapIterator) Copy() Object {
-	return &MapIterator{v: i.v, k: i.k, i: i.i, l: i.l}
+	return &MapIterator{v: i.v, e: i.e, k: i.k, n: i.n, i: i.i, l: i.l}
+}
+
+// NewSortedMapIterator creates a map iterator that iterates the keys in
+// sorted order: the string keys in ascending order, and then, the keys of
+// the entries in the iteration order of the sets.
+func NewSortedMapIterator(
+	m map[string]Object,
+	entries map[string]MapEntry,
+) *MapIterator {
+	return newMapIterator(m, entries, true)
+}
+
+func newMapIterator(
+	m map[string]Object,
+	entries map[string]MapEntry,
+	sorted bool,
+) *MapIterator {
+	var keys []string
+	if sorted {
+		keys = append(sortedKeys(m), sortedEntryKeys(entries)...)
+	} else {
+		keys = make([]string, 0, len(m)+len(entries))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		for k := range entries {
+			keys = append(keys, k)
+		}
+	}
+	return &MapIterator{
+		v: m,
+		e: entries,
+		k: keys,
+		n: len(m),
+		l: len(keys),
+	}
 }
 
 // Next returns true if there are more elements to iterate.
@@ -150,15 +199,119 @@ func (i *MapIterator) Next() bool {
 // Key returns the key or index value of the current element.
 func (i *MapIterator) Key() Object {
 	k := i.k[i.i-1]
+	if i.i > i.n {
+		return i.e[k].Key
+	}
 	return &String{Value: k}
 }
 
 // Value returns the value of the current element.
 func (i *MapIterator) Value() Object {
 	k := i.k[i.i-1]
+	if i.i > i.n {
+		return i.e[k].Value
+	}
 	return i.v[k]
 }
 
+// RangeIterator represents an iterator for the range.
+type RangeIterator struct {
+	ObjectImpl
+	r *Range
+	i int64
+	l int64
+}
+
+// TypeName returns the name of the type.
+func (i *RangeIterator) TypeName() string {
+	return "range-iterator"
+}
+
+func (i *RangeIterator) String() string {
+	return "<range-iterator>"
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (i *RangeIterator) IsFalsy() bool {
+	return true
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (i *RangeIterator) Equals(Object) bool {
+	return false
+}
+
+// Copy returns a copy of the type.
+func (i *RangeIterator) Copy() Object {
+	return &RangeIterator{r: i.r, i: i.i, l: i.l}
+}
+
+// Next returns true if there are more elements to iterate.
+func (i *RangeIterator) Next() bool {
+	i.i++
+	return i.i <= i.l
+}
+
+// Key returns the key or index value of the current element.
+func (i *RangeIterator) Key() Object {
+	return &Int{Value: i.i - 1}
+}
+
+// Value returns the value of the current element.
+func (i *RangeIterator) Value() Object {
+	return &Int{Value: i.r.At(i.i - 1)}
+}
+
+// SetIterator represents an iterator for the set.
+type SetIterator struct {
+	ObjectImpl
+	v []Object
+	i int
+	l int
+}
+
+// TypeName returns the name of the type.
+func (i *SetIterator) TypeName() string {
+	return "set-iterator"
+}
+
+func (i *SetIterator) String() string {
+	return "<set-iterator>"
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (i *SetIterator) IsFalsy() bool {
+	return true
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (i *SetIterator) Equals(Object) bool {
+	return false
+}
+
+// Copy returns a copy of the type.
+func (i *SetIterator) Copy() Object {
+	return &SetIterator{v: i.v, i: i.i, l: i.l}
+}
+
+// Next returns true if there are more elements to iterate.
+func (i *SetIterator) Next() bool {
+	i.i++
+	return i.i <= i.l
+}
+
+// Key returns the key or index value of the current element.
+func (i *SetIterator) Key() Object {
+	return &Int{Value: int64(i.i - 1)}
+}
+
+// Value returns the value of the current element.
+func (i *SetIterator) Value() Object {
+	return i.v[i.i-1]
+}
+
 // StringIterator represents an iterator for a string.
 type StringIterator struct {
 	ObjectImpl
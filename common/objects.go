@@ -2,8 +2,12 @@ package common
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
+	"math/big"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -170,6 +174,12 @@ func (o *Array) String() string {
 // BinaryOp returns another object that is the result of a given binary
 // operator and a right-hand side object.
 func (o *Array) BinaryOp(op token.Token, rhs Object) (Object, error) {
+	if op == token.In {
+		return arrayContains(o.Value, rhs), nil
+	}
+	if r, ok := rhs.(*Range); ok {
+		rhs = r.Array()
+	}
 	if rhs, ok := rhs.(*Array); ok {
 		switch op {
 		case token.Add:
@@ -205,6 +215,8 @@ func (o *Array) Equals(x Object) bool {
 		xVal = x.Value
 	case *ImmutableArray:
 		xVal = x.Value
+	case *Range:
+		return x.equalsElements(o.Value)
 	default:
 		return false
 	}
@@ -263,6 +275,81 @@ func (o *Array) CanIterate() bool {
 	return true
 }
 
+func arrayContains(elems []Object, x Object) Object {
+	for _, elem := range elems {
+		if elem.Equals(x) {
+			return TrueValue
+		}
+	}
+	return FalseValue
+}
+
+// BigInt represents an arbitrary-precision integer value. The value must not
+// be modified once the object is created.
+type BigInt struct {
+	ObjectImpl
+	Value *big.Int
+}
+
+// TypeName returns the name of the type.
+func (o *BigInt) TypeName() string {
+	return "big-int"
+}
+
+func (o *BigInt) String() string {
+	return o.Value.String()
+}
+
+// BinaryOp returns another object that is the result of a given binary
+// operator and a right-hand side object. An int operand is promoted to
+// big-int, and, a decimal operand promotes the value to decimal.
+func (o *BigInt) BinaryOp(op token.Token, rhs Object) (Object, error) {
+	switch rhs := rhs.(type) {
+	case *BigInt:
+		return bigIntOp(op, o.Value, rhs.Value)
+	case *Int:
+		return bigIntOp(op, o.Value, big.NewInt(rhs.Value))
+	case *Decimal:
+		return (&Decimal{Value: o.Value}).BinaryOp(op, rhs)
+	}
+	return nil, ErrInvalidOperator
+}
+
+// Copy returns a copy of the type.
+func (o *BigInt) Copy() Object {
+	return &BigInt{Value: new(big.Int).Set(o.Value)}
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (o *BigInt) IsFalsy() bool {
+	return o.Value.Sign() == 0
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object. Int and decimal values of the same number are equal.
+func (o *BigInt) Equals(x Object) bool {
+	switch x := x.(type) {
+	case *BigInt:
+		return o.Value.Cmp(x.Value) == 0
+	case *Int:
+		return o.Value.IsInt64() && o.Value.Int64() == x.Value
+	case *Decimal:
+		return x.Equals(o)
+	}
+	return false
+}
+
+// GobDecode decodes big-int value from input bytes.
+func (o *BigInt) GobDecode(b []byte) error {
+	o.Value = new(big.Int)
+	return o.Value.GobDecode(b)
+}
+
+// GobEncode encodes big-int value into bytes.
+func (o *BigInt) GobEncode() ([]byte, error) {
+	return o.Value.GobEncode()
+}
+
 // Bool represents a boolean value.
 type Bool struct {
 	ObjectImpl
@@ -317,6 +404,50 @@ func (o *Bool) GobEncode() (b []byte, err error) {
 	return
 }
 
+// BoundMethod represents a method of a class bound to the instance it's
+// selected from. The instance is passed to the method as the first argument.
+type BoundMethod struct {
+	ObjectImpl
+	Receiver *Instance
+	Name     string
+	Method   Object
+}
+
+// TypeName returns the name of the type.
+func (o *BoundMethod) TypeName() string {
+	return "method"
+}
+
+func (o *BoundMethod) String() string {
+	return "<method " + o.Receiver.Class.Name + "." + o.Name + ">"
+}
+
+// Copy returns a copy of the type.
+func (o *BoundMethod) Copy() Object {
+	return &BoundMethod{
+		Receiver: o.Receiver,
+		Name:     o.Name,
+		Method:   o.Method,
+	}
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (o *BoundMethod) Equals(x Object) bool {
+	t, ok := x.(*BoundMethod)
+	return ok && o.Receiver == t.Receiver && o.Method == t.Method
+}
+
+// Call calls the method with the receiver and the arguments.
+func (o *BoundMethod) Call(args ...Object) (Object, error) {
+	return o.Method.Call(append([]Object{o.Receiver}, args...)...)
+}
+
+// CanCall returns whether the Object can be Called.
+func (o *BoundMethod) CanCall() bool {
+	return true
+}
+
 // BuiltinFunction represents a builtin function.
 type BuiltinFunction struct {
 	ObjectImpl
@@ -357,6 +488,11 @@ func (o *BuiltinFunction) CanCall() bool {
 // BuiltinModule is an importable module that's written in Go.
 type BuiltinModule struct {
 	Attrs map[string]Object
+
+	// NonDeterministic marks the module whose functions can return different
+	// results for the same inputs (e.g. current time or random numbers). It
+	// cannot be imported in the deterministic mode.
+	NonDeterministic bool
 }
 
 // Import returns an immutable map for the module.
@@ -368,6 +504,15 @@ func (m *BuiltinModule) Import(moduleName string) (interface{}, error) {
 func (m *BuiltinModule) AsImmutableMap(moduleName string) *ImmutableMap {
 	attrs := make(map[string]Object, len(m.Attrs))
 	for k, v := range m.Attrs {
+		if fn, ok := v.(*UserFunction); ok {
+			// the module functions can be restored by the encoding ID
+			attrs[k] = &UserFunction{
+				Name:       fn.Name,
+				Value:      fn.Value,
+				EncodingID: moduleName + "." + k,
+			}
+			continue
+		}
 		attrs[k] = v.Copy()
 	}
 	attrs["__module_name__"] = &String{Value: moduleName}
@@ -567,6 +712,96 @@ func (o *Char) Equals(x Object) bool {
 	return o.Value == t.Value
 }
 
+// Class represents a record type declared by a class statement. Calling the
+// class creates an instance: the arguments are passed to Init, the
+// constructor function that takes the fields as its parameters. The VM binds
+// Init and the methods to itself when it creates the class.
+type Class struct {
+	ObjectImpl
+	Name    string
+	Fields  []string
+	Init    *CompiledFunction
+	Methods map[string]Object
+}
+
+// TypeName returns the name of the type.
+func (o *Class) TypeName() string {
+	return "class"
+}
+
+func (o *Class) String() string {
+	return "<class " + o.Name + ">"
+}
+
+// Copy returns a copy of the type.
+func (o *Class) Copy() Object {
+	return o
+}
+
+// Equals returns true if x is the same class. A class restored from the
+// storage is equal to the class it was stored from.
+func (o *Class) Equals(x Object) bool {
+	t, ok := x.(*Class)
+	if !ok {
+		return false
+	}
+	if o == t {
+		return true
+	}
+	if o.Name != t.Name || len(o.Fields) != len(t.Fields) ||
+		len(o.Methods) != len(t.Methods) || !sameCode(o.Init, t.Init) {
+		return false
+	}
+	for i, f := range o.Fields {
+		if t.Fields[i] != f {
+			return false
+		}
+	}
+	for name, m := range o.Methods {
+		f, _ := m.(*CompiledFunction)
+		g, _ := t.Methods[name].(*CompiledFunction)
+		if !sameCode(f, g) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameCode returns true if f and g are compiled functions of the same
+// instructions and parameters.
+func sameCode(f, g *CompiledFunction) bool {
+	if f == nil || g == nil {
+		return false
+	}
+	return f.NumParameters == g.NumParameters && f.VarArgs == g.VarArgs &&
+		f.NumDefaults == g.NumDefaults &&
+		bytes.Equal(f.Instructions, g.Instructions)
+}
+
+// Call creates an instance of the class on the VM the class is bound to.
+func (o *Class) Call(args ...Object) (Object, error) {
+	if o.Init == nil || o.Init.invoker == nil {
+		return nil, ErrNotBound
+	}
+	return o.Init.invoker.Invoke(o, args...)
+}
+
+// CanCall returns whether the Object can be Called.
+func (o *Class) CanCall() bool {
+	return true
+}
+
+// FieldIndex returns the index of the field name, or -1 if the class does not
+// have the field.
+func (o *Class) FieldIndex(name string) int {
+	for i, f := range o.Fields {
+		if f == name {
+			return i
+		}
+	}
+	return -1
+}
+
 // CompiledFunction represents a compiled function.
 type CompiledFunction struct {
 	ObjectImpl
@@ -574,8 +809,12 @@ type CompiledFunction struct {
 	NumLocals     int // number of local variables (including function parameters)
 	NumParameters int
 	VarArgs       bool
+	ParamNames    []string // names of the parameters
+	NumDefaults   int      // number of the last parameters with defaults
+	Generator     bool     // calling the function creates a generator
 	SourceMap     map[int]parser.Pos
 	Free          []*ObjectPtr
+	invoker       Invoker
 }
 
 // TypeName returns the name of the type.
@@ -594,7 +833,11 @@ func (o *CompiledFunction) Copy() Object {
 		NumLocals:     o.NumLocals,
 		NumParameters: o.NumParameters,
 		VarArgs:       o.VarArgs,
+		ParamNames:    o.ParamNames,
+		NumDefaults:   o.NumDefaults,
+		Generator:     o.Generator,
 		Free:          append([]*ObjectPtr{}, o.Free...), // DO NOT Copy() of elements; these are variable pointers
+		invoker:       o.invoker,
 	}
 }
 
@@ -615,15 +858,145 @@ func (o *CompiledFunction) SourcePos(ip int) parser.Pos {
 	return parser.NoPos
 }
 
+// ParamIndex returns the index of the parameter that can be passed as a
+// keyword argument of the name, or, -1 if there is no such parameter. The
+// variadic parameter can not be passed as a keyword argument.
+func (o *CompiledFunction) ParamIndex(name string) int {
+	n := len(o.ParamNames)
+	if o.VarArgs {
+		n--
+	}
+	for i := 0; i < n; i++ {
+		if o.ParamNames[i] == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Bind returns a copy of the function that is bound to the invoker. The copy
+// shares the instructions and the free variables with the function.
+func (o *CompiledFunction) Bind(invoker Invoker) *CompiledFunction {
+	bound := *o
+	bound.invoker = invoker
+	return &bound
+}
+
+// Call calls the function on the VM it's bound to. The VM binds the compiled
+// functions passed to a Go function, so they can be called while the Go
+// function is running. It returns ErrNotBound if the function is not bound.
+func (o *CompiledFunction) Call(args ...Object) (Object, error) {
+	if o.invoker == nil {
+		return nil, ErrNotBound
+	}
+	return o.invoker.Invoke(o, args...)
+}
+
 // CanCall returns whether the Object can be Called.
 func (o *CompiledFunction) CanCall() bool {
 	return true
 }
 
+// Decimal represents an arbitrary-precision decimal value: the unscaled value
+// Value multiplied by 10 to the power of -Scale. Scale must not be negative,
+// and, the value must not be modified once the object is created.
+type Decimal struct {
+	ObjectImpl
+	Value *big.Int
+	Scale int
+}
+
+// TypeName returns the name of the type.
+func (o *Decimal) TypeName() string {
+	return "decimal"
+}
+
+func (o *Decimal) String() string {
+	digits := new(big.Int).Abs(o.Value).String()
+	if o.Scale > 0 {
+		if len(digits) <= o.Scale {
+			digits = strings.Repeat("0", o.Scale-len(digits)+1) + digits
+		}
+		point := len(digits) - o.Scale
+		digits = digits[:point] + "." + digits[point:]
+	}
+	if o.Value.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// BinaryOp returns another object that is the result of a given binary
+// operator and a right-hand side object. Int and big-int operands are
+// promoted to decimal.
+func (o *Decimal) BinaryOp(op token.Token, rhs Object) (Object, error) {
+	switch rhs := rhs.(type) {
+	case *Decimal:
+		return decimalOp(op, o, rhs)
+	case *BigInt:
+		return decimalOp(op, o, &Decimal{Value: rhs.Value})
+	case *Int:
+		return decimalOp(op, o, &Decimal{Value: big.NewInt(rhs.Value)})
+	}
+	return nil, ErrInvalidOperator
+}
+
+// Copy returns a copy of the type.
+func (o *Decimal) Copy() Object {
+	return &Decimal{Value: new(big.Int).Set(o.Value), Scale: o.Scale}
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (o *Decimal) IsFalsy() bool {
+	return o.Value.Sign() == 0
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object. The values of the same number are equal regardless of
+// their scales, e.g. 1.10 and 1.1, and, so are int and big-int values.
+func (o *Decimal) Equals(x Object) bool {
+	var y *Decimal
+	switch x := x.(type) {
+	case *Decimal:
+		y = x
+	case *BigInt:
+		y = &Decimal{Value: x.Value}
+	case *Int:
+		y = &Decimal{Value: big.NewInt(x.Value)}
+	default:
+		return false
+	}
+	a, b, _ := alignDecimals(o, y)
+	return a.Cmp(b) == 0
+}
+
+// GobDecode decodes decimal value from input bytes.
+func (o *Decimal) GobDecode(b []byte) error {
+	scale, n := binary.Uvarint(b)
+	if n <= 0 {
+		return errors.New("invalid decimal encoding")
+	}
+	o.Scale = int(scale)
+	o.Value = new(big.Int)
+	return o.Value.GobDecode(b[n:])
+}
+
+// GobEncode encodes decimal value into bytes.
+func (o *Decimal) GobEncode() ([]byte, error) {
+	v, err := o.Value.GobEncode()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(v))
+	b = b[:binary.PutUvarint(b, uint64(o.Scale))]
+	return append(b, v...), nil
+}
+
 // Error represents an error value.
 type Error struct {
 	ObjectImpl
 	Value Object
+	Pos   parser.SourceFilePos // position where the error is thrown, if any
 }
 
 // TypeName returns the name of the type.
@@ -645,7 +1018,7 @@ func (o *Error) IsFalsy() bool {
 
 // Copy returns a copy of the type.
 func (o *Error) Copy() Object {
-	return &Error{Value: o.Value.Copy()}
+	return &Error{Value: o.Value.Copy(), Pos: o.Pos}
 }
 
 // Equals returns true if the value of the type is equal to the value of
@@ -656,11 +1029,18 @@ func (o *Error) Equals(x Object) bool {
 
 // IndexGet returns an element at a given index.
 func (o *Error) IndexGet(index Object) (res Object, err error) {
-	if strIdx, _ := ToString(index); strIdx != "value" {
+	switch strIdx, _ := ToString(index); strIdx {
+	case "value":
+		res = o.Value
+	case "pos":
+		if !o.Pos.IsValid() {
+			res = UndefinedValue
+			return
+		}
+		res = &String{Value: o.Pos.String()}
+	default:
 		err = ErrInvalidIndexOnError
-		return
 	}
-	res = o.Value
 	return
 }
 
@@ -671,7 +1051,7 @@ type Float struct {
 }
 
 func (o *Float) String() string {
-	return strconv.FormatFloat(o.Value, 'f', -1, 64)
+	return FormatFloat(o.Value)
 }
 
 // TypeName returns the name of the type.
@@ -709,6 +1089,12 @@ func (o *Float) BinaryOp(op token.Token, rhs Object) (Object, error) {
 				return o, nil
 			}
 			return &Float{Value: r}, nil
+		case token.Pow:
+			r := math.Pow(o.Value, rhs.Value)
+			if r == o.Value {
+				return o, nil
+			}
+			return &Float{Value: r}, nil
 		case token.Less:
 			if o.Value < rhs.Value {
 				return TrueValue, nil
@@ -756,6 +1142,12 @@ func (o *Float) BinaryOp(op token.Token, rhs Object) (Object, error) {
 				return o, nil
 			}
 			return &Float{Value: r}, nil
+		case token.Pow:
+			r := math.Pow(o.Value, float64(rhs.Value))
+			if r == o.Value {
+				return o, nil
+			}
+			return &Float{Value: r}, nil
 		case token.Less:
 			if o.Value < float64(rhs.Value) {
 				return TrueValue, nil
@@ -823,6 +1215,12 @@ func (o *ImmutableArray) String() string {
 // BinaryOp returns another object that is the result of a given binary
 // operator and a right-hand side object.
 func (o *ImmutableArray) BinaryOp(op token.Token, rhs Object) (Object, error) {
+	if op == token.In {
+		return arrayContains(o.Value, rhs), nil
+	}
+	if r, ok := rhs.(*Range); ok {
+		rhs = &ImmutableArray{Value: r.Array().Value}
+	}
 	if rhs, ok := rhs.(*ImmutableArray); ok {
 		switch op {
 		case token.Add:
@@ -855,6 +1253,8 @@ func (o *ImmutableArray) Equals(x Object) bool {
 		xVal = x.Value
 	case *ImmutableArray:
 		xVal = x.Value
+	case *Range:
+		return x.equalsElements(o.Value)
 	default:
 		return false
 	}
@@ -901,7 +1301,8 @@ func (o *ImmutableArray) CanIterate() bool {
 // ImmutableMap represents an immutable map object.
 type ImmutableMap struct {
 	ObjectImpl
-	Value map[string]Object
+	Value   map[string]Object
+	Entries map[string]MapEntry
 }
 
 // TypeName returns the name of the type.
@@ -910,11 +1311,13 @@ func (o *ImmutableMap) TypeName() string {
 }
 
 func (o *ImmutableMap) String() string {
-	var pairs []string
-	for k, v := range o.Value {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", k, v.String()))
-	}
-	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+	return mapString(o.Value, o.Entries)
+}
+
+// BinaryOp returns another object that is the result of a given binary
+// operator and a right-hand side object.
+func (o *ImmutableMap) BinaryOp(op token.Token, rhs Object) (Object, error) {
+	return mapBinaryOp(o.Value, o.Entries, op, rhs)
 }
 
 // Copy returns a copy of the type.
@@ -923,63 +1326,28 @@ func (o *ImmutableMap) Copy() Object {
 	for k, v := range o.Value {
 		c[k] = v.Copy()
 	}
-	return &Map{Value: c}
+	return &Map{Value: c, Entries: copyEntries(o.Entries)}
 }
 
 // IsFalsy returns true if the value of the type is falsy.
 func (o *ImmutableMap) IsFalsy() bool {
-	return len(o.Value) == 0
+	return len(o.Value) == 0 && len(o.Entries) == 0
 }
 
 // IndexGet returns the value for the given key.
 func (o *ImmutableMap) IndexGet(index Object) (res Object, err error) {
-	strIdx, ok := ToString(index)
-	if !ok {
-		err = ErrInvalidIndexType
-		return
-	}
-	res, ok = o.Value[strIdx]
-	if !ok {
-		res = UndefinedValue
-	}
-	return
+	return mapIndexGet(o.Value, o.Entries, index)
 }
 
 // Equals returns true if the value of the type is equal to the value of
 // another object.
 func (o *ImmutableMap) Equals(x Object) bool {
-	var xVal map[string]Object
-	switch x := x.(type) {
-	case *Map:
-		xVal = x.Value
-	case *ImmutableMap:
-		xVal = x.Value
-	default:
-		return false
-	}
-	if len(o.Value) != len(xVal) {
-		return false
-	}
-	for k, v := range o.Value {
-		tv := xVal[k]
-		if !v.Equals(tv) {
-			return false
-		}
-	}
-	return true
+	return mapEquals(o.Value, o.Entries, x)
 }
 
 // Iterate creates an immutable map iterator.
 func (o *ImmutableMap) Iterate() Iterator {
-	var keys []string
-	for k := range o.Value {
-		keys = append(keys, k)
-	}
-	return &MapIterator{
-		v: o.Value,
-		k: keys,
-		l: len(keys),
-	}
+	return newMapIterator(o.Value, o.Entries, false)
 }
 
 // CanIterate returns whether the Object can be Iterated.
@@ -987,31 +1355,274 @@ func (o *ImmutableMap) CanIterate() bool {
 	return true
 }
 
-// Int represents an integer value.
-type Int struct {
+// ImmutableSet represents an immutable set of hashable objects.
+type ImmutableSet struct {
 	ObjectImpl
-	Value int64
+	Value map[string]Object
 }
 
-func (o *Int) String() string {
-	return strconv.FormatInt(o.Value, 10)
+// TypeName returns the name of the type.
+func (o *ImmutableSet) TypeName() string {
+	return "immutable-set"
+}
+
+func (o *ImmutableSet) String() string {
+	return setString(o.Value)
+}
+
+// BinaryOp returns another object that is the result of a given binary
+// operator and a right-hand side object.
+func (o *ImmutableSet) BinaryOp(op token.Token, rhs Object) (Object, error) {
+	return setBinaryOp(o.Value, op, rhs)
+}
+
+// Copy returns a copy of the type.
+func (o *ImmutableSet) Copy() Object {
+	c := make(map[string]Object, len(o.Value))
+	for k, v := range o.Value {
+		c[k] = v.Copy()
+	}
+	return &Set{Value: c}
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (o *ImmutableSet) IsFalsy() bool {
+	return len(o.Value) == 0
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (o *ImmutableSet) Equals(x Object) bool {
+	return setEquals(o.Value, x)
+}
+
+// Iterate creates an immutable set iterator.
+func (o *ImmutableSet) Iterate() Iterator {
+	elems := sortedElements(o.Value)
+	return &SetIterator{v: elems, l: len(elems)}
+}
+
+// CanIterate returns whether the Object can be Iterated.
+func (o *ImmutableSet) CanIterate() bool {
+	return true
+}
+
+// Instance represents an instance of a class. Its type name is the name of
+// the class. The protocol methods of the class (e.g. "__add", "__eq",
+// "__index" and "__str") implement the operators, the equality, the indexing
+// and the string of the instance.
+type Instance struct {
+	ObjectImpl
+	Class  *Class
+	Values []Object // values of the fields of the class
 }
 
 // TypeName returns the name of the type.
-func (o *Int) TypeName() string {
-	return "int"
+func (o *Instance) TypeName() string {
+	return o.Class.Name
+}
+
+// String returns the result of the "__str" method if the class has one, or,
+// the fields of the instance.
+func (o *Instance) String() string {
+	if m := o.Method("__str"); m != nil {
+		if ret, err := m.Call(o); err == nil {
+			return MethodString(ret)
+		}
+	}
+	var fields []string
+	for i, name := range o.Class.Fields {
+		fields = append(fields,
+			fmt.Sprintf("%s: %s", name, o.Values[i].String()))
+	}
+	return fmt.Sprintf("%s{%s}", o.Class.Name, strings.Join(fields, ", "))
 }
 
 // BinaryOp returns another object that is the result of a given binary
 // operator and a right-hand side object.
-func (o *Int) BinaryOp(op token.Token, rhs Object) (Object, error) {
-	switch rhs := rhs.(type) {
-	case *Int:
-		switch op {
-		case token.Add:
-			r := o.Value + rhs.Value
-			if r == o.Value {
-				return o, nil
+func (o *Instance) BinaryOp(op token.Token, rhs Object) (Object, error) {
+	m, recv, arg := OperatorMethod(o, op, rhs)
+	if m == nil {
+		return nil, ErrInvalidOperator
+	}
+	return m.Call(recv, arg)
+}
+
+// Copy returns a copy of the type.
+func (o *Instance) Copy() Object {
+	values := make([]Object, len(o.Values))
+	for i, v := range o.Values {
+		values[i] = v.Copy()
+	}
+	return &Instance{Class: o.Class, Values: values}
+}
+
+// Equals returns the result of the "__eq" method if the class has one, or,
+// true if x is an instance of the same class with the equal fields.
+func (o *Instance) Equals(x Object) bool {
+	if m, recv, arg := EqualsMethod(o, x); m != nil {
+		ret, err := m.Call(recv, arg)
+		return err == nil && !ret.IsFalsy()
+	}
+	t, ok := x.(*Instance)
+	if !ok || !o.Class.Equals(t.Class) {
+		return false
+	}
+	for i, v := range o.Values {
+		if !v.Equals(t.Values[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// IndexGet returns the field or the bound method of the given name. Other
+// indexes are passed to the "__index" method if the class has one.
+func (o *Instance) IndexGet(index Object) (Object, error) {
+	if res, ok := o.Member(index); ok {
+		return res, nil
+	}
+	if m := o.Method("__index"); m != nil {
+		return m.Call(o, index)
+	}
+	return UndefinedValue, nil
+}
+
+// IndexSet sets the value of the field of the given name.
+func (o *Instance) IndexSet(index, value Object) error {
+	name, ok := index.(*String)
+	if !ok {
+		return ErrInvalidIndexType
+	}
+	i := o.Class.FieldIndex(name.Value)
+	if i < 0 {
+		return fmt.Errorf("unknown field '%s' of %s", name.Value,
+			o.Class.Name)
+	}
+	o.Values[i] = value
+	return nil
+}
+
+// Member returns the field or the bound method of the name index. It returns
+// false if index is not the name of a field or a method.
+func (o *Instance) Member(index Object) (Object, bool) {
+	name, ok := index.(*String)
+	if !ok {
+		return nil, false
+	}
+	if i := o.Class.FieldIndex(name.Value); i >= 0 {
+		return o.Values[i], true
+	}
+	if m := o.Method(name.Value); m != nil {
+		return &BoundMethod{Receiver: o, Name: name.Value, Method: m}, true
+	}
+	return nil, false
+}
+
+// Method returns the method name of the class of the instance, or nil if the
+// class does not have the method.
+func (o *Instance) Method(name string) Object {
+	return o.Class.Methods[name]
+}
+
+// operatorMethods are the names of the protocol methods of the binary
+// operators.
+var operatorMethods = map[token.Token]string{
+	token.Add:       "__add",
+	token.Sub:       "__sub",
+	token.Mul:       "__mul",
+	token.Quo:       "__div",
+	token.Rem:       "__mod",
+	token.Pow:       "__pow",
+	token.And:       "__and",
+	token.Or:        "__or",
+	token.Xor:       "__xor",
+	token.AndNot:    "__andnot",
+	token.Shl:       "__shl",
+	token.Shr:       "__shr",
+	token.Greater:   "__gt",
+	token.GreaterEq: "__ge",
+}
+
+// OperatorMethod returns the protocol method of the binary operation, and,
+// the receiver and the argument to call it with. The left-hand side instance
+// implements the operator. As "a < b" and "a <= b" are compiled to "b > a"
+// and "b >= a", the "__lt" and "__le" methods of the right-hand side instance
+// are used if the left-hand side does not implement "__gt" or "__ge". It
+// returns nil if the operation has no protocol method.
+func OperatorMethod(lhs Object, op token.Token, rhs Object) (
+	method, recv, arg Object,
+) {
+	if o, ok := lhs.(*Instance); ok {
+		if m := o.Method(operatorMethods[op]); m != nil {
+			return m, lhs, rhs
+		}
+	}
+	if o, ok := rhs.(*Instance); ok {
+		var m Object
+		switch op {
+		case token.Greater:
+			m = o.Method("__lt")
+		case token.GreaterEq:
+			m = o.Method("__le")
+		}
+		if m != nil {
+			return m, rhs, lhs
+		}
+	}
+	return nil, nil, nil
+}
+
+// EqualsMethod returns the "__eq" method of the instance operand of the
+// equality, and, the receiver and the argument to call it with. It returns
+// nil if none of the operands has the method.
+func EqualsMethod(lhs, rhs Object) (method, recv, arg Object) {
+	if o, ok := lhs.(*Instance); ok {
+		if m := o.Method("__eq"); m != nil {
+			return m, lhs, rhs
+		}
+	}
+	if o, ok := rhs.(*Instance); ok {
+		if m := o.Method("__eq"); m != nil {
+			return m, rhs, lhs
+		}
+	}
+	return nil, nil, nil
+}
+
+// MethodString returns the string of the value returned by a "__str" method.
+func MethodString(ret Object) string {
+	if s, ok := ret.(*String); ok {
+		return s.Value
+	}
+	return ret.String()
+}
+
+// Int represents an integer value.
+type Int struct {
+	ObjectImpl
+	Value int64
+}
+
+func (o *Int) String() string {
+	return strconv.FormatInt(o.Value, 10)
+}
+
+// TypeName returns the name of the type.
+func (o *Int) TypeName() string {
+	return "int"
+}
+
+// BinaryOp returns another object that is the result of a given binary
+// operator and a right-hand side object.
+func (o *Int) BinaryOp(op token.Token, rhs Object) (Object, error) {
+	switch rhs := rhs.(type) {
+	case *Int:
+		switch op {
+		case token.Add:
+			r := o.Value + rhs.Value
+			if r == o.Value {
+				return o, nil
 			}
 			return &Int{Value: r}, nil
 		case token.Sub:
@@ -1027,12 +1638,18 @@ func (o *Int) BinaryOp(op token.Token, rhs Object) (Object, error) {
 			}
 			return &Int{Value: r}, nil
 		case token.Quo:
+			if rhs.Value == 0 {
+				return nil, ErrDivisionByZero
+			}
 			r := o.Value / rhs.Value
 			if r == o.Value {
 				return o, nil
 			}
 			return &Int{Value: r}, nil
 		case token.Rem:
+			if rhs.Value == 0 {
+				return nil, ErrDivisionByZero
+			}
 			r := o.Value % rhs.Value
 			if r == o.Value {
 				return o, nil
@@ -1074,6 +1691,15 @@ func (o *Int) BinaryOp(op token.Token, rhs Object) (Object, error) {
 				return o, nil
 			}
 			return &Int{Value: r}, nil
+		case token.Pow:
+			r, err := intPow(o.Value, rhs.Value, false)
+			if err != nil {
+				return nil, err
+			}
+			if r == o.Value {
+				return o, nil
+			}
+			return &Int{Value: r}, nil
 		case token.Less:
 			if o.Value < rhs.Value {
 				return TrueValue, nil
@@ -1105,6 +1731,8 @@ func (o *Int) BinaryOp(op token.Token, rhs Object) (Object, error) {
 			return &Float{Value: float64(o.Value) * rhs.Value}, nil
 		case token.Quo:
 			return &Float{Value: float64(o.Value) / rhs.Value}, nil
+		case token.Pow:
+			return &Float{Value: math.Pow(float64(o.Value), rhs.Value)}, nil
 		case token.Less:
 			if float64(o.Value) < rhs.Value {
 				return TrueValue, nil
@@ -1126,6 +1754,10 @@ func (o *Int) BinaryOp(op token.Token, rhs Object) (Object, error) {
 			}
 			return FalseValue, nil
 		}
+	case *BigInt:
+		return bigIntOp(op, big.NewInt(o.Value), rhs.Value)
+	case *Decimal:
+		return (&Decimal{Value: big.NewInt(o.Value)}).BinaryOp(op, rhs)
 	case *Char:
 		switch op {
 		case token.Add:
@@ -1170,17 +1802,28 @@ func (o *Int) IsFalsy() bool {
 // Equals returns true if the value of the type is equal to the value of
 // another object.
 func (o *Int) Equals(x Object) bool {
-	t, ok := x.(*Int)
-	if !ok {
-		return false
+	switch x := x.(type) {
+	case *Int:
+		return o.Value == x.Value
+	case *BigInt, *Decimal:
+		return x.Equals(o)
 	}
-	return o.Value == t.Value
+	return false
 }
 
-// Map represents a map of objects.
+// Map represents a map of objects. The values of string keys are in Value,
+// and, the entries of int, char, bool, float, bytes and time keys are in
+// Entries by the keys returned by MapKey.
 type Map struct {
 	ObjectImpl
-	Value map[string]Object
+	Value   map[string]Object
+	Entries map[string]MapEntry
+}
+
+// MapEntry represents an entry of a map with a non-string key.
+type MapEntry struct {
+	Key   Object
+	Value Object
 }
 
 // TypeName returns the name of the type.
@@ -1189,11 +1832,13 @@ func (o *Map) TypeName() string {
 }
 
 func (o *Map) String() string {
-	var pairs []string
-	for k, v := range o.Value {
-		pairs = append(pairs, fmt.Sprintf("%s: %s", k, v.String()))
-	}
-	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+	return mapString(o.Value, o.Entries)
+}
+
+// BinaryOp returns another object that is the result of a given binary
+// operator and a right-hand side object.
+func (o *Map) BinaryOp(op token.Token, rhs Object) (Object, error) {
+	return mapBinaryOp(o.Value, o.Entries, op, rhs)
 }
 
 // Copy returns a copy of the type.
@@ -1202,79 +1847,205 @@ func (o *Map) Copy() Object {
 	for k, v := range o.Value {
 		c[k] = v.Copy()
 	}
-	return &Map{Value: c}
+	return &Map{Value: c, Entries: copyEntries(o.Entries)}
 }
 
 // IsFalsy returns true if the value of the type is falsy.
 func (o *Map) IsFalsy() bool {
-	return len(o.Value) == 0
+	return len(o.Value) == 0 && len(o.Entries) == 0
 }
 
 // Equals returns true if the value of the type is equal to the value of
 // another object.
 func (o *Map) Equals(x Object) bool {
+	return mapEquals(o.Value, o.Entries, x)
+}
+
+// IndexGet returns the value for the given key.
+func (o *Map) IndexGet(index Object) (res Object, err error) {
+	return mapIndexGet(o.Value, o.Entries, index)
+}
+
+// IndexSet sets the value for the given key.
+func (o *Map) IndexSet(index, value Object) (err error) {
+	if s, ok := index.(*String); ok {
+		o.Value[s.Value] = value
+		return nil
+	}
+	key, ok := MapKey(index)
+	if !ok {
+		return ErrInvalidIndexType
+	}
+	if o.Entries == nil {
+		o.Entries = make(map[string]MapEntry)
+	}
+	o.Entries[key] = MapEntry{Key: index, Value: value}
+	return nil
+}
+
+// Delete deletes the value for the given key. It returns false if the key
+// cannot be a key of the map.
+func (o *Map) Delete(index Object) bool {
+	if s, ok := index.(*String); ok {
+		delete(o.Value, s.Value)
+		return true
+	}
+	key, ok := MapKey(index)
+	if ok {
+		delete(o.Entries, key)
+	}
+	return ok
+}
+
+// Iterate creates a map iterator.
+func (o *Map) Iterate() Iterator {
+	return newMapIterator(o.Value, o.Entries, false)
+}
+
+// CanIterate returns whether the Object can be Iterated.
+func (o *Map) CanIterate() bool {
+	return true
+}
+
+// MapKey returns the key of a non-string key o in the entries of a map. Int,
+// char, bool, float, bytes and time values can be the keys, except NaN, and,
+// the keys of the values of different types never collide. Negative zero is
+// the same key as zero.
+func MapKey(o Object) (key string, ok bool) {
+	switch o := o.(type) {
+	case *String:
+		return "", false
+	case *Float:
+		if math.IsNaN(o.Value) {
+			return "", false
+		}
+		v := o.Value
+		if v == 0 {
+			v = 0
+		}
+		return "f" + strconv.FormatFloat(v, 'g', -1, 64), true
+	}
+	return HashKey(o)
+}
+
+func mapIndexGet(
+	m map[string]Object,
+	entries map[string]MapEntry,
+	index Object,
+) (Object, error) {
+	if s, ok := index.(*String); ok {
+		if res, ok := m[s.Value]; ok {
+			return res, nil
+		}
+		return UndefinedValue, nil
+	}
+	key, ok := MapKey(index)
+	if !ok {
+		return nil, ErrInvalidIndexType
+	}
+	if e, ok := entries[key]; ok {
+		return e.Value, nil
+	}
+	return UndefinedValue, nil
+}
+
+func mapString(m map[string]Object, entries map[string]MapEntry) string {
+	var pairs []string
+	for _, k := range sortedKeys(m) {
+		pairs = append(pairs, fmt.Sprintf("%s: %s", k, m[k].String()))
+	}
+	for _, k := range sortedEntryKeys(entries) {
+		e := entries[k]
+		pairs = append(pairs, fmt.Sprintf("%s: %s",
+			e.Key.String(), e.Value.String()))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
+}
+
+func mapEquals(
+	m map[string]Object,
+	entries map[string]MapEntry,
+	x Object,
+) bool {
 	var xVal map[string]Object
+	var xEntries map[string]MapEntry
 	switch x := x.(type) {
 	case *Map:
-		xVal = x.Value
+		xVal, xEntries = x.Value, x.Entries
 	case *ImmutableMap:
-		xVal = x.Value
+		xVal, xEntries = x.Value, x.Entries
 	default:
 		return false
 	}
-	if len(o.Value) != len(xVal) {
+	if len(m) != len(xVal) || len(entries) != len(xEntries) {
 		return false
 	}
-	for k, v := range o.Value {
-		tv := xVal[k]
-		if !v.Equals(tv) {
+	for k, v := range m {
+		tv, ok := xVal[k]
+		if !ok || !v.Equals(tv) {
+			return false
+		}
+	}
+	for k, e := range entries {
+		te, ok := xEntries[k]
+		if !ok || !e.Value.Equals(te.Value) {
 			return false
 		}
 	}
 	return true
 }
 
-// IndexGet returns the value for the given key.
-func (o *Map) IndexGet(index Object) (res Object, err error) {
-	strIdx, ok := ToString(index)
-	if !ok {
-		err = ErrInvalidIndexType
-		return
+func copyEntries(entries map[string]MapEntry) map[string]MapEntry {
+	if entries == nil {
+		return nil
 	}
-	res, ok = o.Value[strIdx]
-	if !ok {
-		res = UndefinedValue
+	c := make(map[string]MapEntry, len(entries))
+	for k, e := range entries {
+		c[k] = MapEntry{Key: e.Key.Copy(), Value: e.Value.Copy()}
 	}
-	return
+	return c
 }
 
-// IndexSet sets the value for the given key.
-func (o *Map) IndexSet(index, value Object) (err error) {
-	strIdx, ok := ToString(index)
-	if !ok {
-		err = ErrInvalidIndexType
-		return
+func mapBinaryOp(
+	m map[string]Object,
+	entries map[string]MapEntry,
+	op token.Token,
+	rhs Object,
+) (Object, error) {
+	if op == token.In {
+		if s, ok := rhs.(*String); ok {
+			_, ok = m[s.Value]
+			return boolObject(ok), nil
+		}
+		key, ok := MapKey(rhs)
+		if !ok {
+			return FalseValue, nil
+		}
+		_, ok = entries[key]
+		return boolObject(ok), nil
 	}
-	o.Value[strIdx] = value
-	return nil
+	return nil, ErrInvalidOperator
 }
 
-// Iterate creates a map iterator.
-func (o *Map) Iterate() Iterator {
-	var keys []string
-	for k := range o.Value {
-		keys = append(keys, k)
-	}
-	return &MapIterator{
-		v: o.Value,
-		k: keys,
-		l: len(keys),
+// sortedEntryKeys returns the keys of the entries in the iteration order of
+// the sets: the keys of the same type are ordered by value, and, the keys of
+// different types are ordered by type.
+func sortedEntryKeys(entries map[string]MapEntry) []string {
+	keys := make(map[string]Object, len(entries))
+	for k, e := range entries {
+		keys[k] = e.Key
 	}
+	return sortedHashKeys(keys)
 }
 
-// CanIterate returns whether the Object can be Iterated.
-func (o *Map) CanIterate() bool {
-	return true
+// sortedKeys returns the keys of the map in sorted order.
+func sortedKeys(m map[string]Object) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // ObjectPtr represents a free variable.
@@ -1308,6 +2079,372 @@ func (o *ObjectPtr) Equals(x Object) bool {
 	return o == x
 }
 
+// Range represents a lazy sequence of ints from Start toward Stop, excluding
+// Stop, by Step. The sequence is descending if Start is greater than Stop,
+// and, Step is always positive. The elements are computed when they are
+// indexed or iterated, so the length and the indexing take constant time.
+type Range struct {
+	ObjectImpl
+	Start int64
+	Stop  int64
+	Step  int64
+}
+
+// TypeName returns the name of the type.
+func (o *Range) TypeName() string {
+	return "range"
+}
+
+func (o *Range) String() string {
+	if o.Step == 1 {
+		return fmt.Sprintf("range(%d, %d)", o.Start, o.Stop)
+	}
+	return fmt.Sprintf("range(%d, %d, %d)", o.Start, o.Stop, o.Step)
+}
+
+// BinaryOp returns another object that is the result of a given binary
+// operator and a right-hand side object. "x in r" tests whether int x is an
+// element of the range, and, "r + x" concatenates the elements of the range
+// and array or range x into an array.
+func (o *Range) BinaryOp(op token.Token, rhs Object) (Object, error) {
+	if op == token.Add {
+		switch rhs.(type) {
+		case *Array, *ImmutableArray, *Range:
+			return o.Array().BinaryOp(op, rhs)
+		}
+	}
+	if op != token.In {
+		return nil, ErrInvalidOperator
+	}
+	x, ok := rhs.(*Int)
+	if !ok || o.Step <= 0 {
+		return FalseValue, nil
+	}
+	if o.Start <= o.Stop {
+		return boolObject(x.Value >= o.Start && x.Value < o.Stop &&
+			uint64(x.Value-o.Start)%uint64(o.Step) == 0), nil
+	}
+	return boolObject(x.Value <= o.Start && x.Value > o.Stop &&
+		uint64(o.Start-x.Value)%uint64(o.Step) == 0), nil
+}
+
+// Copy returns a copy of the type.
+func (o *Range) Copy() Object {
+	return &Range{Start: o.Start, Stop: o.Stop, Step: o.Step}
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (o *Range) IsFalsy() bool {
+	return o.Len() == 0
+}
+
+// Equals returns true if x is a range or an array with the same elements.
+func (o *Range) Equals(x Object) bool {
+	var t *Range
+	switch x := x.(type) {
+	case *Range:
+		t = x
+	case *Array:
+		return o.equalsElements(x.Value)
+	case *ImmutableArray:
+		return o.equalsElements(x.Value)
+	default:
+		return false
+	}
+	n := o.Len()
+	if n != t.Len() {
+		return false
+	}
+	return n == 0 || o.At(0) == t.At(0) && (n == 1 || o.At(1) == t.At(1))
+}
+
+func (o *Range) equalsElements(elems []Object) bool {
+	if o.Len() != int64(len(elems)) {
+		return false
+	}
+	for i, e := range elems {
+		if x, ok := e.(*Int); !ok || x.Value != o.At(int64(i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// IndexGet returns the element at the given index, or, undefined if the
+// index is out of range.
+func (o *Range) IndexGet(index Object) (Object, error) {
+	idx, ok := index.(*Int)
+	if !ok {
+		return nil, ErrInvalidIndexType
+	}
+	if idx.Value < 0 || idx.Value >= o.Len() {
+		return UndefinedValue, nil
+	}
+	return &Int{Value: o.At(idx.Value)}, nil
+}
+
+// Iterate creates a range iterator.
+func (o *Range) Iterate() Iterator {
+	return &RangeIterator{r: o, l: o.Len()}
+}
+
+// CanIterate returns whether the Object can be Iterated.
+func (o *Range) CanIterate() bool {
+	return true
+}
+
+// Len returns the number of the elements. It's capped at the maximum int
+// value.
+func (o *Range) Len() int64 {
+	if o.Step <= 0 {
+		return 0
+	}
+	var d uint64
+	if o.Start <= o.Stop {
+		d = uint64(o.Stop - o.Start)
+	} else {
+		d = uint64(o.Start - o.Stop)
+	}
+	n := d / uint64(o.Step)
+	if d%uint64(o.Step) != 0 {
+		n++
+	}
+	if n > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(n)
+}
+
+// At returns the element at index i, which must be less than Len.
+func (o *Range) At(i int64) int64 {
+	if o.Start <= o.Stop {
+		return o.Start + i*o.Step
+	}
+	return o.Start - i*o.Step
+}
+
+// Array returns an array of the elements.
+func (o *Range) Array() *Array {
+	var elems []Object
+	for i, n := int64(0), o.Len(); i < n; i++ {
+		elems = append(elems, &Int{Value: o.At(i)})
+	}
+	return &Array{Value: elems}
+}
+
+// Slice returns the range of the elements from index low up to index high,
+// excluding high. The indexes must be in [0, Len] and low must not be greater
+// than high.
+func (o *Range) Slice(low, high int64) *Range {
+	if low == high {
+		return &Range{Start: o.Stop, Stop: o.Stop, Step: o.Step}
+	}
+	stop := o.Stop
+	if high < o.Len() {
+		stop = o.At(high)
+	}
+	return &Range{Start: o.At(low), Stop: stop, Step: o.Step}
+}
+
+// Set represents a set of hashable objects.
+type Set struct {
+	ObjectImpl
+	Value map[string]Object
+}
+
+// TypeName returns the name of the type.
+func (o *Set) TypeName() string {
+	return "set"
+}
+
+func (o *Set) String() string {
+	return setString(o.Value)
+}
+
+// BinaryOp returns another object that is the result of a given binary
+// operator and a right-hand side object.
+func (o *Set) BinaryOp(op token.Token, rhs Object) (Object, error) {
+	return setBinaryOp(o.Value, op, rhs)
+}
+
+// Copy returns a copy of the type.
+func (o *Set) Copy() Object {
+	c := make(map[string]Object, len(o.Value))
+	for k, v := range o.Value {
+		c[k] = v.Copy()
+	}
+	return &Set{Value: c}
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (o *Set) IsFalsy() bool {
+	return len(o.Value) == 0
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (o *Set) Equals(x Object) bool {
+	return setEquals(o.Value, x)
+}
+
+// Iterate creates a set iterator.
+func (o *Set) Iterate() Iterator {
+	elems := sortedElements(o.Value)
+	return &SetIterator{v: elems, l: len(elems)}
+}
+
+// CanIterate returns whether the Object can be Iterated.
+func (o *Set) CanIterate() bool {
+	return true
+}
+
+// NewSet creates a set of the given elements. It returns false if any of the
+// elements is not hashable.
+func NewSet(elems ...Object) (*Set, bool) {
+	m := make(map[string]Object, len(elems))
+	for _, elem := range elems {
+		key, ok := HashKey(elem)
+		if !ok {
+			return nil, false
+		}
+		if b, isBytes := elem.(*Bytes); isBytes {
+			elem = b.Copy()
+		}
+		m[key] = elem
+	}
+	return &Set{Value: m}, true
+}
+
+func setString(m map[string]Object) string {
+	var elements []string
+	for _, e := range sortedElements(m) {
+		elements = append(elements, e.String())
+	}
+	return fmt.Sprintf("set(%s)", strings.Join(elements, ", "))
+}
+
+func setEquals(m map[string]Object, x Object) bool {
+	var xVal map[string]Object
+	switch x := x.(type) {
+	case *Set:
+		xVal = x.Value
+	case *ImmutableSet:
+		xVal = x.Value
+	default:
+		return false
+	}
+	if len(m) != len(xVal) {
+		return false
+	}
+	for k := range m {
+		if _, ok := xVal[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func setBinaryOp(
+	m map[string]Object,
+	op token.Token,
+	rhs Object,
+) (Object, error) {
+	if op == token.In {
+		key, ok := HashKey(rhs)
+		if !ok {
+			return FalseValue, nil
+		}
+		return boolObject(m[key] != nil), nil
+	}
+
+	var r map[string]Object
+	switch rhs := rhs.(type) {
+	case *Set:
+		r = rhs.Value
+	case *ImmutableSet:
+		r = rhs.Value
+	default:
+		return nil, ErrInvalidOperator
+	}
+	res := make(map[string]Object)
+	switch op {
+	case token.Or: // union
+		for k, v := range m {
+			res[k] = v
+		}
+		for k, v := range r {
+			res[k] = v
+		}
+	case token.And: // intersection
+		for k, v := range m {
+			if _, ok := r[k]; ok {
+				res[k] = v
+			}
+		}
+	case token.Sub: // difference
+		for k, v := range m {
+			if _, ok := r[k]; !ok {
+				res[k] = v
+			}
+		}
+	case token.Xor: // symmetric difference
+		for k, v := range m {
+			if _, ok := r[k]; !ok {
+				res[k] = v
+			}
+		}
+		for k, v := range r {
+			if _, ok := m[k]; !ok {
+				res[k] = v
+			}
+		}
+	default:
+		return nil, ErrInvalidOperator
+	}
+	return &Set{Value: res}, nil
+}
+
+// sortedElements returns the elements of the set in a deterministic order:
+// the values of the same type are ordered by value, and, the values of
+// different types are ordered by type.
+func sortedElements(m map[string]Object) []Object {
+	keys := sortedHashKeys(m)
+	elems := make([]Object, len(keys))
+	for i, k := range keys {
+		elems[i] = m[k]
+	}
+	return elems
+}
+
+// sortedHashKeys returns the keys of the elements of the set in the order of
+// sortedElements.
+func sortedHashKeys(m map[string]Object) []string {
+	keys := sortedKeys(m)
+	sort.SliceStable(keys, func(i, j int) bool {
+		a, b := m[keys[i]], m[keys[j]]
+		switch a := a.(type) {
+		case *Int:
+			if b, ok := b.(*Int); ok {
+				return a.Value < b.Value
+			}
+		case *Char:
+			if b, ok := b.(*Char); ok {
+				return a.Value < b.Value
+			}
+		case *Float:
+			if b, ok := b.(*Float); ok {
+				return a.Value < b.Value
+			}
+		case *Time:
+			if b, ok := b.(*Time); ok {
+				return a.Value.Before(b.Value)
+			}
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
 // String represents a string value.
 type String struct {
 	ObjectImpl
@@ -1374,6 +2511,13 @@ func (o *String) BinaryOp(op token.Token, rhs Object) (Object, error) {
 			}
 			return FalseValue, nil
 		}
+	case token.In:
+		switch rhs := rhs.(type) {
+		case *String:
+			return boolObject(strings.Contains(o.Value, rhs.Value)), nil
+		case *Char:
+			return boolObject(strings.ContainsRune(o.Value, rhs.Value)), nil
+		}
 	}
 	return nil, ErrInvalidOperator
 }
@@ -1577,8 +2721,12 @@ func (o *Undefined) Value() Object {
 // UserFunction represents a user function.
 type UserFunction struct {
 	ObjectImpl
-	Name       string
-	Value      CallableFunc
+	Name  string
+	Value CallableFunc
+
+	// EncodingID identifies the function when it's encoded, e.g.
+	// "text.to_upper" for the functions of the builtin modules. A function
+	// without an ID cannot be encoded.
 	EncodingID string
 }
 
@@ -1593,7 +2741,11 @@ func (o *UserFunction) String() string {
 
 // Copy returns a copy of the type.
 func (o *UserFunction) Copy() Object {
-	return &UserFunction{Value: o.Value}
+	return &UserFunction{
+		Name:       o.Name,
+		Value:      o.Value,
+		EncodingID: o.EncodingID,
+	}
 }
 
 // Equals returns true if the value of the type is equal to the value of
@@ -1,7 +1,10 @@
 package common_test
 
 import (
+	"math"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/d5/tengo/v2/common"
 	"github.com/d5/tengo/v2/require"
@@ -41,6 +44,24 @@ func TestObject_TypeName(t *testing.T) {
 	require.Equal(t, "error", o.TypeName())
 	o = &common.Bytes{}
 	require.Equal(t, "bytes", o.TypeName())
+	o = &common.BigInt{}
+	require.Equal(t, "big-int", o.TypeName())
+	o = &common.Decimal{}
+	require.Equal(t, "decimal", o.TypeName())
+	o = &common.Set{}
+	require.Equal(t, "set", o.TypeName())
+	o = &common.ImmutableSet{}
+	require.Equal(t, "immutable-set", o.TypeName())
+	o = &common.Class{Name: "Point"}
+	require.Equal(t, "class", o.TypeName())
+	o = &common.Instance{Class: &common.Class{Name: "Point"}}
+	require.Equal(t, "Point", o.TypeName())
+	o = &common.BoundMethod{}
+	require.Equal(t, "method", o.TypeName())
+	o = &common.Range{}
+	require.Equal(t, "range", o.TypeName())
+	o = &common.RangeIterator{}
+	require.Equal(t, "range-iterator", o.TypeName())
 }
 
 func TestObject_IsFalsy(t *testing.T) {
@@ -86,6 +107,22 @@ func TestObject_IsFalsy(t *testing.T) {
 	require.True(t, o.IsFalsy())
 	o = &common.Bytes{Value: []byte{1, 2}}
 	require.False(t, o.IsFalsy())
+	o = &common.BigInt{Value: big.NewInt(0)}
+	require.True(t, o.IsFalsy())
+	o = &common.BigInt{Value: big.NewInt(-1)}
+	require.False(t, o.IsFalsy())
+	o = &common.Decimal{Value: big.NewInt(0), Scale: 2}
+	require.True(t, o.IsFalsy())
+	o = &common.Decimal{Value: big.NewInt(1), Scale: 2}
+	require.False(t, o.IsFalsy())
+	o = &common.Set{}
+	require.True(t, o.IsFalsy())
+	o = &common.ImmutableSet{Value: map[string]common.Object{
+		"i0": &common.Int{Value: 0},
+	}}
+	require.False(t, o.IsFalsy())
+	o = &common.SetIterator{}
+	require.True(t, o.IsFalsy())
 }
 
 func TestObject_String(t *testing.T) {
@@ -109,6 +146,12 @@ func TestObject_String(t *testing.T) {
 	require.Equal(t, "[]", o.String())
 	o = &common.Map{Value: nil}
 	require.Equal(t, "{}", o.String())
+	o = &common.Map{Value: map[string]common.Object{
+		"b": &common.Int{Value: 2},
+		"a": &common.Int{Value: 1},
+		"c": &common.Int{Value: 3},
+	}}
+	require.Equal(t, "{a: 1, b: 2, c: 3}", o.String())
 	o = &common.Error{Value: nil}
 	require.Equal(t, "error", o.String())
 	o = &common.Error{Value: &common.String{Value: "error 1"}}
@@ -125,6 +168,37 @@ func TestObject_String(t *testing.T) {
 	require.Equal(t, "", o.String())
 	o = &common.Bytes{Value: []byte("foo")}
 	require.Equal(t, "foo", o.String())
+	o = &common.BigInt{Value: big.NewInt(-123)}
+	require.Equal(t, "-123", o.String())
+	o = &common.Decimal{Value: big.NewInt(110), Scale: 2}
+	require.Equal(t, "1.10", o.String())
+	o = &common.Decimal{Value: big.NewInt(-5), Scale: 3}
+	require.Equal(t, "-0.005", o.String())
+	o = &common.Decimal{Value: big.NewInt(42)}
+	require.Equal(t, "42", o.String())
+	o, _ = common.NewSet()
+	require.Equal(t, "set()", o.String())
+	o, _ = common.NewSet(&common.String{Value: "a"}, &common.Int{Value: 10},
+		&common.Int{Value: 9})
+	require.Equal(t, `set(9, 10, "a")`, o.String())
+	o = &common.SetIterator{}
+	require.Equal(t, "<set-iterator>", o.String())
+	o = &common.Class{Name: "Point", Fields: []string{"x", "y"}}
+	require.Equal(t, "<class Point>", o.String())
+	o = &common.Instance{
+		Class: o.(*common.Class),
+		Values: []common.Object{
+			&common.Int{Value: 1},
+			&common.String{Value: "a"},
+		},
+	}
+	require.Equal(t, `Point{x: 1, y: "a"}`, o.String())
+	o = &common.BoundMethod{Receiver: o.(*common.Instance), Name: "norm"}
+	require.Equal(t, "<method Point.norm>", o.String())
+	o = &common.Range{Start: 0, Stop: 5, Step: 1}
+	require.Equal(t, "range(0, 5)", o.String())
+	o = &common.Range{Start: 5, Stop: 0, Step: 2}
+	require.Equal(t, "range(5, 0, 2)", o.String())
 }
 
 func TestObject_BinaryOp(t *testing.T) {
@@ -214,6 +288,126 @@ func TestArray_BinaryOp(t *testing.T) {
 	}})
 }
 
+func TestBigInt_BinaryOp(t *testing.T) {
+	bigInt := func(s string) *common.BigInt {
+		v, _ := new(big.Int).SetString(s, 10)
+		return &common.BigInt{Value: v}
+	}
+	max := bigInt("9223372036854775807")
+
+	// big-int op big-int, big-int op int
+	testBinaryOp(t, max, token.Add, bigInt("1"),
+		bigInt("9223372036854775808"))
+	testBinaryOp(t, max, token.Mul, &common.Int{Value: 2},
+		bigInt("18446744073709551614"))
+	testBinaryOp(t, max, token.Quo, &common.Int{Value: -2},
+		bigInt("-4611686018427387903"))
+	testBinaryOp(t, bigInt("-7"), token.Rem, &common.Int{Value: 2},
+		bigInt("-1"))
+	testBinaryOp(t, bigInt("6"), token.AndNot, &common.Int{Value: 3},
+		bigInt("4"))
+	testBinaryOp(t, bigInt("1"), token.Shl, &common.Int{Value: 100},
+		bigInt("1267650600228229401496703205376"))
+	testBinaryOp(t, bigInt("-5"), token.Shr, &common.Int{Value: 100},
+		bigInt("-1"))
+	testBinaryOp(t, bigInt("2"), token.Pow, &common.Int{Value: 100},
+		bigInt("1267650600228229401496703205376"))
+	testBinaryOp(t, max, token.Greater, &common.Int{Value: 1},
+		common.TrueValue)
+	testBinaryOp(t, max, token.LessEq, bigInt("9223372036854775806"),
+		common.FalseValue)
+
+	// int op big-int is promoted to big-int
+	testBinaryOp(t, &common.Int{Value: 1}, token.Sub, max,
+		bigInt("-9223372036854775806"))
+	testBinaryOp(t, &common.Int{Value: 1}, token.Less, max,
+		common.TrueValue)
+
+	// big-int op decimal is promoted to decimal
+	testBinaryOp(t, bigInt("1"), token.Add,
+		&common.Decimal{Value: big.NewInt(5), Scale: 1},
+		&common.Decimal{Value: big.NewInt(15), Scale: 1})
+
+	for _, c := range []struct {
+		lhs common.Object
+		op  token.Token
+		rhs common.Object
+		err error
+	}{
+		{max, token.Quo, bigInt("0"), common.ErrDivisionByZero},
+		{max, token.Rem, &common.Int{Value: 0}, common.ErrDivisionByZero},
+		{max, token.Pow, &common.Int{Value: -1}, common.ErrNegativeExponent},
+		{max, token.Pow, &common.Int{Value: 1 << 20}, common.ErrBigNumLimit},
+		{max, token.Shl, &common.Int{Value: 1 << 20}, common.ErrBigNumLimit},
+		{max, token.Shl, &common.Int{Value: -1}, common.ErrInvalidOperator},
+		{max, token.Add, &common.Float{Value: 1}, common.ErrInvalidOperator},
+		{&common.Float{Value: 1}, token.Add, max, common.ErrInvalidOperator},
+	} {
+		_, err := c.lhs.BinaryOp(c.op, c.rhs)
+		require.Equal(t, c.err, err)
+	}
+
+	require.True(t, max.Equals(&common.Int{Value: math.MaxInt64}))
+	require.True(t, (&common.Int{Value: math.MaxInt64}).Equals(max))
+	require.False(t, max.Equals(bigInt("1")))
+	require.False(t, max.Equals(&common.Float{Value: math.MaxInt64}))
+}
+
+func TestDecimal_BinaryOp(t *testing.T) {
+	dec := func(s string) *common.Decimal {
+		v, ok := common.ParseDecimal(s)
+		require.True(t, ok, s)
+		return v
+	}
+	testDecimal := func(lhs common.Object, op token.Token, rhs common.Object,
+		expected string) {
+		t.Helper()
+		res, err := lhs.BinaryOp(op, rhs)
+		require.NoError(t, err)
+		require.Equal(t, expected, res.String())
+	}
+
+	testDecimal(dec("1.10"), token.Add, dec("2.205"), "3.305")
+	testDecimal(dec("0.1"), token.Add, dec("0.2"), "0.3")
+	testDecimal(dec("1.10"), token.Sub, dec("3"), "-1.90")
+	testDecimal(dec("1.10"), token.Mul, dec("-0.5"), "-0.550")
+	testDecimal(dec("10"), token.Quo, dec("4"), "2.5")
+	testDecimal(dec("1.10"), token.Quo, dec("1"), "1.10")
+	testDecimal(dec("1"), token.Quo, dec("3"), "0.333333333333333333")
+	testDecimal(dec("2"), token.Quo, dec("3"), "0.666666666666666667")
+	testDecimal(dec("-2"), token.Quo, dec("3"), "-0.666666666666666667")
+	testDecimal(dec("5.5"), token.Rem, dec("2"), "1.5")
+	testDecimal(dec("1.5"), token.Add, &common.Int{Value: 1}, "2.5")
+	testDecimal(&common.Int{Value: 1}, token.Sub, dec("0.25"), "0.75")
+	testDecimal(dec("1.5"), token.Mul,
+		&common.BigInt{Value: big.NewInt(3)}, "4.5")
+	testBinaryOp(t, dec("1.10"), token.Greater, dec("1.1"),
+		common.FalseValue)
+	testBinaryOp(t, dec("1.10"), token.GreaterEq, dec("1.1"),
+		common.TrueValue)
+	testBinaryOp(t, dec("0.5"), token.Less, &common.Int{Value: 1},
+		common.TrueValue)
+
+	_, err := dec("1").BinaryOp(token.Quo, dec("0.00"))
+	require.Equal(t, common.ErrDivisionByZero, err)
+	_, err = dec("1").BinaryOp(token.Add, &common.Float{Value: 1})
+	require.Equal(t, common.ErrInvalidOperator, err)
+
+	require.True(t, dec("1.10").Equals(dec("1.1")))
+	require.True(t, dec("2.00").Equals(&common.Int{Value: 2}))
+	require.True(t, (&common.Int{Value: 2}).Equals(dec("2.00")))
+	require.False(t, dec("2.01").Equals(&common.Int{Value: 2}))
+
+	for _, s := range []string{"", ".", "-", "1.2.3", "1e", "a", "1,5"} {
+		_, ok := common.ParseDecimal(s)
+		require.False(t, ok, s)
+	}
+	require.Equal(t, "0.0025", dec("2.5e-3").String())
+	require.Equal(t, "1200", dec("1.2E3").String())
+	require.Equal(t, "0.5", dec(".5").String())
+	require.Equal(t, "-5", dec("-5.").String())
+}
+
 func TestError_Equals(t *testing.T) {
 	err1 := &common.Error{Value: &common.String{Value: "some error"}}
 	err2 := err1
@@ -580,6 +774,21 @@ func TestInt_BinaryOp(t *testing.T) {
 			&common.Int{Value: int64(0xffffffff) >> uint(s)})
 	}
 
+	// int ** int
+	for l := int64(-3); l <= 3; l++ {
+		for r := int64(0); r <= 5; r++ {
+			testBinaryOp(t, &common.Int{Value: l}, token.Pow,
+				&common.Int{Value: r},
+				&common.Int{Value: int64(math.Pow(float64(l), float64(r)))})
+		}
+	}
+	_, err := (&common.Int{Value: 2}).BinaryOp(token.Pow, &common.Int{Value: -1})
+	require.Equal(t, common.ErrNegativeExponent, err)
+
+	// int ** float
+	testBinaryOp(t, &common.Int{Value: 4}, token.Pow,
+		&common.Float{Value: 0.5}, &common.Float{Value: 2})
+
 	// int < int
 	for l := int64(-2); l <= 2; l++ {
 		for r := int64(-2); r <= 2; r++ {
@@ -683,6 +892,44 @@ func TestInt_BinaryOp(t *testing.T) {
 	}
 }
 
+func TestCheckedIntOp(t *testing.T) {
+	for _, c := range []struct {
+		op       token.Token
+		x, y     int64
+		expected int64
+		err      error
+	}{
+		{token.Add, math.MaxInt64 - 1, 1, math.MaxInt64, nil},
+		{token.Add, math.MaxInt64, 1, 0, common.ErrIntegerOverflow},
+		{token.Add, math.MinInt64, -1, 0, common.ErrIntegerOverflow},
+		{token.Sub, math.MinInt64 + 1, 1, math.MinInt64, nil},
+		{token.Sub, math.MinInt64, 1, 0, common.ErrIntegerOverflow},
+		{token.Sub, 0, math.MinInt64, 0, common.ErrIntegerOverflow},
+		{token.Mul, math.MinInt64, 1, math.MinInt64, nil},
+		{token.Mul, math.MinInt64, -1, 0, common.ErrIntegerOverflow},
+		{token.Mul, -1, math.MinInt64, 0, common.ErrIntegerOverflow},
+		{token.Mul, 1 << 32, 1 << 31, 0, common.ErrIntegerOverflow},
+		{token.Shl, -1, 63, math.MinInt64, nil},
+		{token.Shl, 1, 63, 0, common.ErrIntegerOverflow},
+		{token.Shl, 1, 64, 0, common.ErrIntegerOverflow},
+		{token.Pow, -2, 63, math.MinInt64, nil},
+		{token.Pow, 2, 63, 0, common.ErrIntegerOverflow},
+		{token.Pow, 3, 40, 0, common.ErrIntegerOverflow},
+		{token.Pow, 2, -1, 0, common.ErrNegativeExponent},
+		{token.Quo, math.MinInt64, 2, math.MinInt64 / 2, nil},
+		{token.Quo, math.MinInt64, -1, 0, common.ErrIntegerOverflow},
+		{token.Quo, 1, 0, 0, common.ErrDivisionByZero},
+		{token.Rem, math.MinInt64, 3, math.MinInt64 % 3, nil},
+		{token.Rem, math.MinInt64, -1, 0, common.ErrIntegerOverflow},
+		{token.Rem, 1, 0, 0, common.ErrDivisionByZero},
+		{token.And, 1, 1, 0, common.ErrInvalidOperator},
+	} {
+		r, err := common.CheckedIntOp(c.op, c.x, c.y)
+		require.Equal(t, c.err, err, c)
+		require.Equal(t, c.expected, r, c)
+	}
+}
+
 func TestMap_Index(t *testing.T) {
 	m := &common.Map{Value: make(map[string]common.Object)}
 	k := &common.Int{Value: 1}
@@ -694,6 +941,165 @@ func TestMap_Index(t *testing.T) {
 	res, err := m.IndexGet(k)
 	require.NoError(t, err)
 	require.Equal(t, v, res)
+
+	// the keys of different types do not collide
+	res, err = m.IndexGet(&common.String{Value: "1"})
+	require.NoError(t, err)
+	require.Equal(t, common.UndefinedValue, res)
+	require.NoError(t, m.IndexSet(&common.Float{Value: 1}, v))
+	require.Equal(t, 2, len(m.Entries))
+
+	err = m.IndexSet(&common.Array{}, v)
+	require.Equal(t, common.ErrInvalidIndexType, err)
+	_, err = m.IndexGet(&common.Float{Value: math.NaN()})
+	require.Equal(t, common.ErrInvalidIndexType, err)
+}
+
+func TestMapKey(t *testing.T) {
+	k1, ok := common.MapKey(&common.Float{Value: 0})
+	require.True(t, ok)
+	k2, _ := common.MapKey(&common.Float{Value: math.Copysign(0, -1)})
+	require.Equal(t, k1, k2)
+	k3, _ := common.MapKey(&common.Int{Value: 0})
+	require.True(t, k1 != k3)
+
+	_, ok = common.MapKey(&common.String{Value: "a"})
+	require.False(t, ok)
+	_, ok = common.MapKey(&common.Float{Value: math.NaN()})
+	require.False(t, ok)
+}
+
+func TestMap_Interface(t *testing.T) {
+	m := &common.Map{Value: map[string]common.Object{
+		"a": &common.Int{Value: 1}}}
+	sm, ok := common.ToInterface(m).(map[string]interface{})
+	require.True(t, ok)
+	require.Equal(t, int64(1), sm["a"])
+
+	require.NoError(t, m.IndexSet(&common.Int{Value: 2}, common.TrueValue))
+	require.NoError(t, m.IndexSet(&common.Bytes{Value: []byte("b")},
+		&common.Int{Value: 3}))
+	im, ok := common.ToInterface(m).(map[interface{}]interface{})
+	require.True(t, ok)
+	require.Equal(t, 3, len(im))
+	require.Equal(t, int64(1), im["a"])
+	require.Equal(t, true, im[int64(2)])
+	require.Equal(t, int64(3), im["b"])
+
+	o, err := common.FromInterface(map[interface{}]interface{}{
+		"a": 1, 2: true, 'c': 1.5})
+	require.NoError(t, err)
+	require.Equal(t, `{a: 1, c: 1.5, 2: true}`, o.String())
+	_, err = common.FromInterface(map[interface{}]interface{}{
+		math.NaN(): 1})
+	require.Equal(t, common.ErrInvalidIndexType, err)
+}
+
+func TestRange(t *testing.T) {
+	r := &common.Range{Start: 10, Stop: -3, Step: 4}
+	require.Equal(t, int64(4), r.Len())
+	require.False(t, r.IsFalsy())
+	res, err := r.IndexGet(&common.Int{Value: 3})
+	require.NoError(t, err)
+	require.Equal(t, &common.Int{Value: -2}, res)
+	res, err = r.IndexGet(&common.Int{Value: 4})
+	require.NoError(t, err)
+	require.Equal(t, common.UndefinedValue, res)
+	_, err = r.IndexGet(&common.String{Value: "0"})
+	require.Equal(t, common.ErrInvalidIndexType, err)
+
+	testBinaryOp(t, r, token.In, &common.Int{Value: 6}, common.TrueValue)
+	testBinaryOp(t, r, token.In, &common.Int{Value: 4}, common.FalseValue)
+	testBinaryOp(t, r, token.In, &common.Int{Value: -3}, common.FalseValue)
+	testBinaryOp(t, r, token.In, &common.Float{Value: 6}, common.FalseValue)
+
+	require.Equal(t, &common.Range{Start: 6, Stop: -2, Step: 4},
+		r.Slice(1, 3))
+	require.Equal(t, &common.Range{Start: 2, Stop: -3, Step: 4},
+		r.Slice(2, 4))
+	require.True(t, r.Slice(2, 2).IsFalsy())
+	require.True(t, r.Equals(&common.Range{Start: 10, Stop: -4, Step: 4}))
+	require.False(t, r.Equals(&common.Range{Start: 10, Stop: -3, Step: 5}))
+	require.True(t, (&common.Range{Start: 1, Stop: 1, Step: 1}).Equals(
+		&common.Range{Start: 5, Stop: 5, Step: 3}))
+
+	big := &common.Range{Start: math.MinInt64, Stop: math.MaxInt64, Step: 1}
+	require.Equal(t, int64(math.MaxInt64), big.Len())
+	require.Equal(t, int64(0), (&common.Range{Stop: 5}).Len())
+
+	arr := &common.Array{}
+	for it := r.Iterate(); it.Next(); {
+		arr.Value = append(arr.Value, it.Value())
+	}
+	require.Equal(t, "[10, 6, 2, -2]", arr.String())
+	vals, ok := common.ToInterface(r).([]interface{})
+	require.True(t, ok)
+	require.Equal(t, 4, len(vals))
+	require.Equal(t, int64(-2), vals[3])
+}
+
+func TestSet_BinaryOp(t *testing.T) {
+	set := func(v ...int64) *common.Set {
+		var elems []common.Object
+		for _, e := range v {
+			elems = append(elems, &common.Int{Value: e})
+		}
+		s, _ := common.NewSet(elems...)
+		return s
+	}
+	testBinaryOp(t, set(1, 2), token.Or, set(2, 3), set(1, 2, 3))
+	testBinaryOp(t, set(1, 2), token.And, set(2, 3), set(2))
+	testBinaryOp(t, set(1, 2), token.Sub, set(2, 3), set(1))
+	testBinaryOp(t, set(1, 2), token.Xor, set(2, 3), set(1, 3))
+	testBinaryOp(t, set(1, 2), token.Or,
+		&common.ImmutableSet{Value: set(3).Value}, set(1, 2, 3))
+	testBinaryOp(t, &common.ImmutableSet{Value: set(1).Value}, token.Or,
+		set(2), set(1, 2))
+	testBinaryOp(t, set(1, 2), token.In, &common.Int{Value: 2},
+		common.TrueValue)
+	testBinaryOp(t, set(1, 2), token.In, &common.String{Value: "2"},
+		common.FalseValue)
+	testBinaryOp(t, set(1, 2), token.In, &common.Array{}, common.FalseValue)
+
+	_, err := set(1).BinaryOp(token.Add, set(2))
+	require.Equal(t, common.ErrInvalidOperator, err)
+	_, err = set(1).BinaryOp(token.Or, &common.Array{})
+	require.Equal(t, common.ErrInvalidOperator, err)
+
+	b, ok := common.NewSet(&common.Bytes{Value: []byte("a")})
+	require.True(t, ok)
+	require.True(t, b.Equals(b.Copy()))
+	_, ok = common.NewSet(&common.Float{Value: 1})
+	require.False(t, ok)
+}
+
+func TestHashKey(t *testing.T) {
+	keys := make(map[string]common.Object)
+	for _, o := range []common.Object{
+		&common.Int{Value: 1},
+		&common.String{Value: "1"},
+		&common.Char{Value: '1'},
+		&common.Bytes{Value: []byte("1")},
+		common.TrueValue,
+		common.FalseValue,
+		&common.Time{Value: time.Unix(1, 0)},
+	} {
+		k, ok := common.HashKey(o)
+		require.True(t, ok)
+		_, dup := keys[k]
+		require.False(t, dup, o.TypeName())
+		keys[k] = o
+	}
+
+	k1, _ := common.HashKey(&common.Time{Value: time.Unix(1, 0).UTC()})
+	k2, _ := common.HashKey(&common.Time{
+		Value: time.Unix(1, 0).In(time.FixedZone("x", 3600))})
+	require.Equal(t, k1, k2)
+
+	_, ok := common.HashKey(&common.Float{Value: 1})
+	require.False(t, ok)
+	_, ok = common.HashKey(&common.Array{})
+	require.False(t, ok)
 }
 
 func TestString_BinaryOp(t *testing.T) {
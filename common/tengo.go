@@ -3,8 +3,13 @@ package common
 import (
 	"errors"
 	"fmt"
+	"math"
+	"math/big"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/d5/tengo/v2/token"
 )
 
 var (
@@ -15,12 +20,30 @@ var (
 	// MaxBytesLen is the maximum length for bytes value. Note this limit
 	// applies to all compiler/VM instances in the process.
 	MaxBytesLen = 2147483647
+
+	// MaxBigNumBits is the maximum bit-length for big-int value and for the
+	// unscaled value of decimal value, and, the maximum scale of decimal
+	// value. Note this limit applies to all compiler/VM instances in the
+	// process.
+	MaxBigNumBits = 65536
+
+	// DecimalQuoScale is the number of the fractional digits that an inexact
+	// quotient of decimal values is rounded to. Note this applies to all
+	// compiler/VM instances in the process.
+	DecimalQuoScale = 18
 )
 
 const (
 	// GlobalsSize is the maximum number of global variables for a VM.
 	GlobalsSize = 1024
 
+	// TempGlobals is the number of the global indexes at the end of the
+	// globals that are reserved for the hidden temporary values of the
+	// top-level statements, e.g. the value being destructured. The VM keeps
+	// the temporaries apart from the globals, and, they are never persisted.
+	// The user variables take at most GlobalsSize - TempGlobals indexes.
+	TempGlobals = 64
+
 	// StackSize is the maximum stack size for a VM.
 	StackSize = 2048
 
@@ -31,6 +54,13 @@ const (
 // CallableFunc is a function signature for the callable functions.
 type CallableFunc = func(args ...Object) (ret Object, err error)
 
+// Invoker calls the callable objects on a running VM. The compiled functions
+// passed to a Go function are bound to the Invoker of the VM that calls the Go
+// function, so that the Go function can call them with CompiledFunction.Call.
+type Invoker interface {
+	Invoke(fn Object, args ...Object) (Object, error)
+}
+
 // CountObjects returns the number of objects that a given object o contains.
 // For scalar value types, it will always be 1. For compound value types,
 // this will include its elements and all of their elements recursively.
@@ -49,16 +79,400 @@ func CountObjects(o Object) (c int) {
 		for _, v := range o.Value {
 			c += CountObjects(v)
 		}
+		for _, e := range o.Entries {
+			c += CountObjects(e.Key) + CountObjects(e.Value)
+		}
 	case *ImmutableMap:
 		for _, v := range o.Value {
 			c += CountObjects(v)
 		}
+		for _, e := range o.Entries {
+			c += CountObjects(e.Key) + CountObjects(e.Value)
+		}
+	case *Set:
+		c += len(o.Value)
+	case *ImmutableSet:
+		c += len(o.Value)
 	case *Error:
 		c += CountObjects(o.Value)
 	}
 	return
 }
 
+// FormatFloat returns the string representation of a float value used by all
+// the float to string conversions: the shortest decimal representation (no
+// exponent) that converts back to the exact same value, "NaN", "+Inf" or
+// "-Inf". The result does not depend on the platform.
+func FormatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// CheckedIntOp returns the result of the int operation x op y, or,
+// ErrIntegerOverflow if the result does not fit in an int value. Only the
+// token.Add, token.Sub, token.Mul, token.Quo, token.Rem, token.Shl and
+// token.Pow operators are checked, the other operators return
+// ErrInvalidOperator. The quotient and the remainder of the minimum int value
+// divided by -1 overflow, and, the division by zero returns ErrDivisionByZero.
+func CheckedIntOp(op token.Token, x, y int64) (int64, error) {
+	switch op {
+	case token.Add:
+		r := x + y
+		if (r > x) != (y > 0) {
+			return 0, ErrIntegerOverflow
+		}
+		return r, nil
+	case token.Sub:
+		r := x - y
+		if (r < x) != (y > 0) {
+			return 0, ErrIntegerOverflow
+		}
+		return r, nil
+	case token.Mul:
+		return checkedMul(x, y)
+	case token.Quo, token.Rem:
+		if y == 0 {
+			return 0, ErrDivisionByZero
+		}
+		if x == math.MinInt64 && y == -1 {
+			return 0, ErrIntegerOverflow
+		}
+		if op == token.Quo {
+			return x / y, nil
+		}
+		return x % y, nil
+	case token.Shl:
+		if x == 0 {
+			return 0, nil
+		}
+		if y < 0 || y >= 64 {
+			return 0, ErrIntegerOverflow
+		}
+		r := x << uint64(y)
+		if r>>uint64(y) != x {
+			return 0, ErrIntegerOverflow
+		}
+		return r, nil
+	case token.Pow:
+		return intPow(x, y, true)
+	}
+	return 0, ErrInvalidOperator
+}
+
+func checkedMul(x, y int64) (int64, error) {
+	if x == 0 || y == 0 {
+		return 0, nil
+	}
+	r := x * y
+	if r/y != x || (x == -1 && y == math.MinInt64) ||
+		(y == -1 && x == math.MinInt64) {
+		return 0, ErrIntegerOverflow
+	}
+	return r, nil
+}
+
+// intPow returns x raised to the power of y by squaring. The result wraps
+// around on overflow unless checked is true.
+func intPow(x, y int64, checked bool) (int64, error) {
+	if y < 0 {
+		return 0, ErrNegativeExponent
+	}
+	r := int64(1)
+	for y > 0 {
+		var err error
+		if y&1 == 1 {
+			if checked {
+				r, err = checkedMul(r, x)
+			} else {
+				r *= x
+			}
+		}
+		y >>= 1
+		if y > 0 && err == nil {
+			if checked {
+				x, err = checkedMul(x, x)
+			} else {
+				x *= x
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return r, nil
+}
+
+// bigIntOp returns the result of the big-int operation x op y.
+func bigIntOp(op token.Token, x, y *big.Int) (Object, error) {
+	r := new(big.Int)
+	switch op {
+	case token.Add:
+		r.Add(x, y)
+	case token.Sub:
+		r.Sub(x, y)
+	case token.Mul:
+		r.Mul(x, y)
+	case token.Quo:
+		if y.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		r.Quo(x, y)
+	case token.Rem:
+		if y.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		r.Rem(x, y)
+	case token.And:
+		r.And(x, y)
+	case token.Or:
+		r.Or(x, y)
+	case token.Xor:
+		r.Xor(x, y)
+	case token.AndNot:
+		r.AndNot(x, y)
+	case token.Shl, token.Shr:
+		if y.Sign() < 0 {
+			return nil, ErrInvalidOperator
+		}
+		if x.Sign() == 0 {
+			break
+		}
+		if op == token.Shl {
+			if !y.IsInt64() || y.Int64() > int64(MaxBigNumBits) {
+				return nil, ErrBigNumLimit
+			}
+			r.Lsh(x, uint(y.Int64()))
+		} else if !y.IsInt64() || y.Int64() > int64(x.BitLen()) {
+			r.Rsh(x, uint(x.BitLen()+1))
+		} else {
+			r.Rsh(x, uint(y.Int64()))
+		}
+	case token.Pow:
+		if y.Sign() < 0 {
+			return nil, ErrNegativeExponent
+		}
+		// the result has at least (bits(x)-1)*y+1 bits if |x| > 1
+		if bits := int64(x.BitLen() - 1); bits > 0 && (!y.IsInt64() ||
+			y.Int64() > int64(MaxBigNumBits)/bits) {
+			return nil, ErrBigNumLimit
+		}
+		r.Exp(x, y, nil)
+	case token.Less:
+		return boolObject(x.Cmp(y) < 0), nil
+	case token.Greater:
+		return boolObject(x.Cmp(y) > 0), nil
+	case token.LessEq:
+		return boolObject(x.Cmp(y) <= 0), nil
+	case token.GreaterEq:
+		return boolObject(x.Cmp(y) >= 0), nil
+	default:
+		return nil, ErrInvalidOperator
+	}
+	if r.BitLen() > MaxBigNumBits {
+		return nil, ErrBigNumLimit
+	}
+	return &BigInt{Value: r}, nil
+}
+
+// decimalOp returns the result of the decimal operation x op y.
+func decimalOp(op token.Token, x, y *Decimal) (Object, error) {
+	a, b, scale := alignDecimals(x, y)
+	r := &Decimal{Value: new(big.Int), Scale: scale}
+	switch op {
+	case token.Add:
+		r.Value.Add(a, b)
+	case token.Sub:
+		r.Value.Sub(a, b)
+	case token.Mul:
+		r.Value.Mul(x.Value, y.Value)
+		r.Scale = x.Scale + y.Scale
+	case token.Quo:
+		if y.Value.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		// the inexact quotient is rounded to DecimalQuoScale digits, and,
+		// the trailing zeros are trimmed down to the scale of the operands
+		if scale < DecimalQuoScale {
+			r.Scale = DecimalQuoScale
+		}
+		num := new(big.Int).Mul(x.Value, pow10(r.Scale+y.Scale-x.Scale))
+		quoRoundHalfEven(r.Value, num, y.Value)
+		trimDecimal(r, scale)
+	case token.Rem:
+		if y.Value.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		r.Value.Rem(a, b)
+	case token.Less:
+		return boolObject(a.Cmp(b) < 0), nil
+	case token.Greater:
+		return boolObject(a.Cmp(b) > 0), nil
+	case token.LessEq:
+		return boolObject(a.Cmp(b) <= 0), nil
+	case token.GreaterEq:
+		return boolObject(a.Cmp(b) >= 0), nil
+	default:
+		return nil, ErrInvalidOperator
+	}
+	if r.Value.BitLen() > MaxBigNumBits || r.Scale > MaxBigNumBits {
+		return nil, ErrBigNumLimit
+	}
+	return r, nil
+}
+
+// alignDecimals returns the unscaled values of x and y at their larger scale.
+func alignDecimals(x, y *Decimal) (a, b *big.Int, scale int) {
+	switch {
+	case x.Scale < y.Scale:
+		a = new(big.Int).Mul(x.Value, pow10(y.Scale-x.Scale))
+		return a, y.Value, y.Scale
+	case x.Scale > y.Scale:
+		b = new(big.Int).Mul(y.Value, pow10(x.Scale-y.Scale))
+		return x.Value, b, x.Scale
+	}
+	return x.Value, y.Value, x.Scale
+}
+
+// quoRoundHalfEven sets z to x/y rounded to the nearest integer, and, to the
+// even one if x/y is halfway between two integers.
+func quoRoundHalfEven(z, x, y *big.Int) {
+	r := new(big.Int)
+	z.QuoRem(x, y, r)
+	r.Abs(r).Lsh(r, 1)
+	if c := r.CmpAbs(y); c > 0 || c == 0 && z.Bit(0) == 1 {
+		if x.Sign() == y.Sign() {
+			z.Add(z, big.NewInt(1))
+		} else {
+			z.Sub(z, big.NewInt(1))
+		}
+	}
+}
+
+// roundDecimal returns decimal value d rounded half to even to the scale.
+func roundDecimal(d *Decimal, scale int) *Decimal {
+	r := &Decimal{Value: new(big.Int), Scale: scale}
+	if scale >= d.Scale {
+		r.Value.Mul(d.Value, pow10(scale-d.Scale))
+	} else {
+		quoRoundHalfEven(r.Value, d.Value, pow10(d.Scale-scale))
+	}
+	return r
+}
+
+// trimDecimal removes the trailing zeros of d down to the scale.
+func trimDecimal(d *Decimal, scale int) {
+	ten := big.NewInt(10)
+	q, r := new(big.Int), new(big.Int)
+	for d.Scale > scale {
+		q.QuoRem(d.Value, ten, r)
+		if r.Sign() != 0 {
+			return
+		}
+		d.Value.Set(q)
+		d.Scale--
+	}
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func boolObject(b bool) Object {
+	if b {
+		return TrueValue
+	}
+	return FalseValue
+}
+
+// ParseDecimal parses a decimal value from string s in the form of
+// [+-]digits[.digits][e[+-]digits], e.g. "1.10", "-0.5" or "2.5e-3". The
+// scale of the result is the number of the fractional digits less the
+// exponent, or, 0 if that's negative.
+func ParseDecimal(s string) (*Decimal, bool) {
+	mantissa, exp := s, int64(0)
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		e, err := strconv.ParseInt(s[i+1:], 10, 32)
+		if err != nil {
+			return nil, false
+		}
+		mantissa, exp = s[:i], e
+	}
+	intPart, fracPart := mantissa, ""
+	if i := strings.IndexByte(mantissa, '.'); i >= 0 {
+		intPart, fracPart = mantissa[:i], mantissa[i+1:]
+	}
+	sign := ""
+	if len(intPart) > 0 && (intPart[0] == '+' || intPart[0] == '-') {
+		sign, intPart = intPart[:1], intPart[1:]
+	}
+	if intPart == "" && fracPart == "" || !isDigits(intPart) ||
+		!isDigits(fracPart) {
+		return nil, false
+	}
+	v, ok := new(big.Int).SetString(sign+intPart+fracPart, 10)
+	if !ok {
+		return nil, false
+	}
+	scale := int64(len(fracPart)) - exp
+	if scale < 0 {
+		if -scale > int64(MaxBigNumBits) {
+			return nil, false
+		}
+		v.Mul(v, pow10(int(-scale)))
+		scale = 0
+	}
+	if v.BitLen() > MaxBigNumBits || scale > int64(MaxBigNumBits) {
+		return nil, false
+	}
+	return &Decimal{Value: v, Scale: int(scale)}, true
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// SwitchKey returns the key of object o in the jump table of a switch
+// statement. Only int and string values have keys, and, the keys of the values
+// of different types never collide.
+func SwitchKey(o Object) (key string, ok bool) {
+	switch o := o.(type) {
+	case *Int:
+		return "i" + strconv.FormatInt(o.Value, 10), true
+	case *String:
+		return "s" + o.Value, true
+	}
+	return "", false
+}
+
+// HashKey returns the key of a hashable object o in a set. Int, string, char,
+// bool, bytes and time values are hashable, and, the keys of the values of
+// different types never collide.
+func HashKey(o Object) (key string, ok bool) {
+	switch o := o.(type) {
+	case *Int:
+		return "i" + strconv.FormatInt(o.Value, 10), true
+	case *String:
+		return "s" + o.Value, true
+	case *Char:
+		return "c" + strconv.FormatInt(int64(o.Value), 10), true
+	case *Bool:
+		if o.value {
+			return "b1", true
+		}
+		return "b0", true
+	case *Bytes:
+		return "y" + string(o.Value), true
+	case *Time:
+		t := o.Value
+		return fmt.Sprintf("t%d.%09d", t.Unix(), t.Nanosecond()), true
+	}
+	return "", false
+}
+
 // ToString will try to convert object o to string value.
 func ToString(o Object) (v string, ok bool) {
 	if o == UndefinedValue {
@@ -85,6 +499,16 @@ func ToInt(o Object) (v int, ok bool) {
 	case *Char:
 		v = int(o.Value)
 		ok = true
+	case *BigInt:
+		if o.Value.IsInt64() {
+			v = int(o.Value.Int64())
+			ok = true
+		}
+	case *Decimal:
+		if i := decimalToBigInt(o); i.IsInt64() {
+			v = int(i.Int64())
+			ok = true
+		}
 	case *Bool:
 		if o == TrueValue {
 			v = 1
@@ -112,6 +536,16 @@ func ToInt64(o Object) (v int64, ok bool) {
 	case *Char:
 		v = int64(o.Value)
 		ok = true
+	case *BigInt:
+		if o.Value.IsInt64() {
+			v = o.Value.Int64()
+			ok = true
+		}
+	case *Decimal:
+		if i := decimalToBigInt(o); i.IsInt64() {
+			v = i.Int64()
+			ok = true
+		}
 	case *Bool:
 		if o == TrueValue {
 			v = 1
@@ -136,6 +570,12 @@ func ToFloat64(o Object) (v float64, ok bool) {
 	case *Float:
 		v = o.Value
 		ok = true
+	case *BigInt:
+		v, _ = new(big.Float).SetInt(o.Value).Float64()
+		ok = true
+	case *Decimal:
+		v, _ = strconv.ParseFloat(o.String(), 64)
+		ok = true
 	case *String:
 		c, err := strconv.ParseFloat(o.Value, 64)
 		if err == nil {
@@ -192,11 +632,81 @@ func ToTime(o Object) (v time.Time, ok bool) {
 	return
 }
 
+// ToBigInt will try to convert object o to *big.Int value. The fractional
+// part of float and decimal values is truncated.
+func ToBigInt(o Object) (v *big.Int, ok bool) {
+	switch o := o.(type) {
+	case *BigInt:
+		v = o.Value
+		ok = true
+	case *Int:
+		v = big.NewInt(o.Value)
+		ok = true
+	case *Decimal:
+		v = decimalToBigInt(o)
+		ok = true
+	case *Float:
+		if !math.IsNaN(o.Value) && !math.IsInf(o.Value, 0) {
+			v, _ = big.NewFloat(o.Value).Int(nil)
+			ok = true
+		}
+	case *Char:
+		v = big.NewInt(int64(o.Value))
+		ok = true
+	case *Bool:
+		v = new(big.Int)
+		if o == TrueValue {
+			v.SetInt64(1)
+		}
+		ok = true
+	case *String:
+		v, ok = new(big.Int).SetString(o.Value, 10)
+		if ok && v.BitLen() > MaxBigNumBits {
+			v, ok = nil, false
+		}
+	}
+	return
+}
+
+// ToDecimal will try to convert object o to decimal value. A float value is
+// converted from its string representation, e.g. 0.1 to 0.1 (not to its exact
+// binary value).
+func ToDecimal(o Object) (v *Decimal, ok bool) {
+	switch o := o.(type) {
+	case *Decimal:
+		v = o
+		ok = true
+	case *Int:
+		v = &Decimal{Value: big.NewInt(o.Value)}
+		ok = true
+	case *BigInt:
+		v = &Decimal{Value: o.Value}
+		ok = true
+	case *Float:
+		if !math.IsNaN(o.Value) && !math.IsInf(o.Value, 0) {
+			v, ok = ParseDecimal(FormatFloat(o.Value))
+		}
+	case *String:
+		v, ok = ParseDecimal(o.Value)
+	}
+	return
+}
+
+// decimalToBigInt returns the integer part of decimal value d.
+func decimalToBigInt(d *Decimal) *big.Int {
+	if d.Scale == 0 {
+		return d.Value
+	}
+	return new(big.Int).Quo(d.Value, pow10(d.Scale))
+}
+
 // ToInterface attempts to convert an object o to an interface{} value
 func ToInterface(o Object) (res interface{}) {
 	switch o := o.(type) {
 	case *Int:
 		res = o.Value
+	case *BigInt:
+		res = o.Value
 	case *String:
 		res = o.Value
 	case *Float:
@@ -218,14 +728,17 @@ func ToInterface(o Object) (res interface{}) {
 			res.([]interface{})[i] = ToInterface(val)
 		}
 	case *Map:
-		res = make(map[string]interface{})
-		for key, v := range o.Value {
-			res.(map[string]interface{})[key] = ToInterface(v)
-		}
+		res = mapToInterface(o.Value, o.Entries)
 	case *ImmutableMap:
-		res = make(map[string]interface{})
-		for key, v := range o.Value {
-			res.(map[string]interface{})[key] = ToInterface(v)
+		res = mapToInterface(o.Value, o.Entries)
+	case *Set:
+		res = setToInterface(o.Value)
+	case *ImmutableSet:
+		res = setToInterface(o.Value)
+	case *Range:
+		res = make([]interface{}, o.Len())
+		for i := range res.([]interface{}) {
+			res.([]interface{})[i] = o.At(int64(i))
 		}
 	case *Time:
 		res = o.Value
@@ -239,6 +752,44 @@ func ToInterface(o Object) (res interface{}) {
 	return
 }
 
+// mapToInterface converts a map to map[string]interface{}, or, to
+// map[interface{}]interface{} if it has non-string keys. The bytes keys are
+// converted to string.
+func mapToInterface(
+	m map[string]Object,
+	entries map[string]MapEntry,
+) interface{} {
+	if len(entries) == 0 {
+		res := make(map[string]interface{}, len(m))
+		for key, v := range m {
+			res[key] = ToInterface(v)
+		}
+		return res
+	}
+	res := make(map[interface{}]interface{}, len(m)+len(entries))
+	for key, v := range m {
+		res[key] = ToInterface(v)
+	}
+	for _, e := range entries {
+		key := ToInterface(e.Key)
+		if b, ok := key.([]byte); ok {
+			key = string(b)
+		}
+		res[key] = ToInterface(e.Value)
+	}
+	return res
+}
+
+// setToInterface converts the elements of a set to a slice in the iteration
+// order of the set.
+func setToInterface(m map[string]Object) []interface{} {
+	res := make([]interface{}, 0, len(m))
+	for _, elem := range sortedElements(m) {
+		res = append(res, ToInterface(elem))
+	}
+	return res
+}
+
 // FromInterface will attempt to convert an interface{} v to a Tengo Object
 func FromInterface(v interface{}) (Object, error) {
 	switch v := v.(type) {
@@ -283,6 +834,22 @@ func FromInterface(v interface{}) (Object, error) {
 			kv[vk] = vo
 		}
 		return &Map{Value: kv}, nil
+	case map[interface{}]interface{}:
+		m := &Map{Value: make(map[string]Object)}
+		for vk, vv := range v {
+			ko, err := FromInterface(vk)
+			if err != nil {
+				return nil, err
+			}
+			vo, err := FromInterface(vv)
+			if err != nil {
+				return nil, err
+			}
+			if err := m.IndexSet(ko, vo); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
 	case []Object:
 		return &Array{Value: v}, nil
 	case []interface{}:
@@ -297,6 +864,8 @@ func FromInterface(v interface{}) (Object, error) {
 		return &Array{Value: arr}, nil
 	case time.Time:
 		return &Time{Value: v}, nil
+	case *big.Int:
+		return &BigInt{Value: v}, nil
 	case Object:
 		return v, nil
 	case CallableFunc:
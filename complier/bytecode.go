@@ -1,10 +1,12 @@
 package complier
 
 import (
+	"bufio"
 	"encoding/gob"
 	"fmt"
 	"io"
 	"reflect"
+	"strings"
 
 	"github.com/d5/tengo/v2/common"
 	"github.com/d5/tengo/v2/parser"
@@ -17,16 +19,18 @@ type Bytecode struct {
 	Constants    []common.Object
 }
 
-// Encode writes Bytecode data to the writer.
+// Encode writes Bytecode data to the writer in the binary bytecode format
+// (see BytecodeFormatVersion).
 func (b *Bytecode) Encode(w io.Writer) error {
-	enc := gob.NewEncoder(w)
-	if err := enc.Encode(b.FileSet); err != nil {
-		return err
-	}
-	if err := enc.Encode(b.MainFunction); err != nil {
-		return err
+	e := &encoder{w: bufio.NewWriter(w)}
+	e.writeHeader()
+	e.writeFileSet(b.FileSet)
+	e.writeObject(b.MainFunction)
+	e.writeObjects(b.Constants)
+	if e.err != nil {
+		return e.err
 	}
-	return enc.Encode(b.Constants)
+	return e.w.Flush()
 }
 
 // CountObjects returns the number of objects found in Constants.
@@ -63,27 +67,25 @@ func (b *Bytecode) FormatConstants() (output []string) {
 	return
 }
 
-// Decode reads Bytecode data from the reader.
+// Decode reads Bytecode data from the reader. It reads both the binary
+// bytecode format and the gob encoded bytecode of the older versions.
 func (b *Bytecode) Decode(r io.Reader, modules *common.ModuleMap) error {
 	if modules == nil {
 		modules = common.NewModuleMap()
 	}
 
-	dec := gob.NewDecoder(r)
-	if err := dec.Decode(&b.FileSet); err != nil {
-		return err
-	}
-	// TODO: files in b.FileSet.File does not have their 'set' field properly
-	//  set to b.FileSet as it's private field and not serialized by gob
-	//  encoder/decoder.
-	if err := dec.Decode(&b.MainFunction); err != nil {
-		return err
+	br := bufio.NewReader(r)
+	var err error
+	if isBinaryFormat(br) {
+		err = b.decodeBinary(br)
+	} else {
+		err = b.decodeGob(br)
 	}
-	if err := dec.Decode(&b.Constants); err != nil {
+	if err != nil {
 		return err
 	}
 	for i, v := range b.Constants {
-		fv, err := fixDecodedObject(v, modules)
+		fv, err := FixDecodedObject(v, modules)
 		if err != nil {
 			return err
 		}
@@ -92,6 +94,43 @@ func (b *Bytecode) Decode(r io.Reader, modules *common.ModuleMap) error {
 	return nil
 }
 
+func (b *Bytecode) decodeBinary(r *bufio.Reader) error {
+	version, err := readHeader(r)
+	if err != nil {
+		return err
+	}
+
+	d := &decoder{r: r, version: version}
+	if b.FileSet, err = d.readFileSet(); err != nil {
+		return err
+	}
+	main, err := d.readObject()
+	if err != nil {
+		return err
+	}
+	fn, ok := main.(*common.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("invalid main function: %s", main.TypeName())
+	}
+	b.MainFunction = fn
+	b.Constants, err = d.readObjects()
+	return err
+}
+
+func (b *Bytecode) decodeGob(r io.Reader) error {
+	dec := gob.NewDecoder(r)
+	if err := dec.Decode(&b.FileSet); err != nil {
+		return err
+	}
+	// TODO: files in b.FileSet.File does not have their 'set' field properly
+	//  set to b.FileSet as it's private field and not serialized by gob
+	//  encoder/decoder.
+	if err := dec.Decode(&b.MainFunction); err != nil {
+		return err
+	}
+	return dec.Decode(&b.Constants)
+}
+
 // RemoveDuplicates finds and remove the duplicate values in Constants.
 // Note this function mutates Bytecode.
 func (b *Bytecode) RemoveDuplicates() {
@@ -103,7 +142,8 @@ func (b *Bytecode) RemoveDuplicates() {
 	strings := make(map[string]int)
 	floats := make(map[float64]int)
 	chars := make(map[rune]int)
-	immutableMaps := make(map[string]int) // for modules
+	immutableMaps := make(map[string]int)   // for modules
+	immutableArrays := make(map[string]int) // for keyword argument names
 
 	for curIdx, c := range b.Constants {
 		switch c := c.(type) {
@@ -127,6 +167,16 @@ func (b *Bytecode) RemoveDuplicates() {
 				indexMap[curIdx] = newIdx
 				deduped = append(deduped, c)
 			}
+		case *common.ImmutableArray:
+			key := c.String()
+			if newIdx, ok := immutableArrays[key]; ok {
+				indexMap[curIdx] = newIdx
+			} else {
+				newIdx = len(deduped)
+				immutableArrays[key] = newIdx
+				indexMap[curIdx] = newIdx
+				deduped = append(deduped, c)
+			}
 		case *common.Int:
 			if newIdx, ok := ints[c.Value]; ok {
 				indexMap[curIdx] = newIdx
@@ -184,7 +234,11 @@ func (b *Bytecode) RemoveDuplicates() {
 	}
 }
 
-func fixDecodedObject(
+// FixDecodedObject restores the runtime invariants of an object decoded by
+// gob: singleton values (true, false, undefined) are replaced with their
+// canonical instances, builtin functions, builtin modules and the functions
+// of builtin modules are re-attached to their Go implementations.
+func FixDecodedObject(
 	o common.Object,
 	modules *common.ModuleMap,
 ) (common.Object, error) {
@@ -196,9 +250,24 @@ func fixDecodedObject(
 		return common.TrueValue, nil
 	case *common.Undefined:
 		return common.UndefinedValue, nil
+	case *common.BuiltinFunction:
+		for _, fn := range common.BuiltinFuncs {
+			if fn.Name == o.Name {
+				return fn, nil
+			}
+		}
+		return nil, fmt.Errorf("builtin function not found: %s", o.Name)
+	case *common.UserFunction:
+		return fixDecodedUserFunction(o, modules)
+	case *common.Error:
+		fv, err := FixDecodedObject(o.Value, modules)
+		if err != nil {
+			return nil, err
+		}
+		o.Value = fv
 	case *common.Array:
 		for i, v := range o.Value {
-			fv, err := fixDecodedObject(v, modules)
+			fv, err := FixDecodedObject(v, modules)
 			if err != nil {
 				return nil, err
 			}
@@ -206,7 +275,7 @@ func fixDecodedObject(
 		}
 	case *common.ImmutableArray:
 		for i, v := range o.Value {
-			fv, err := fixDecodedObject(v, modules)
+			fv, err := FixDecodedObject(v, modules)
 			if err != nil {
 				return nil, err
 			}
@@ -214,12 +283,15 @@ func fixDecodedObject(
 		}
 	case *common.Map:
 		for k, v := range o.Value {
-			fv, err := fixDecodedObject(v, modules)
+			fv, err := FixDecodedObject(v, modules)
 			if err != nil {
 				return nil, err
 			}
 			o.Value[k] = fv
 		}
+		if err := fixDecodedEntries(o.Entries, modules); err != nil {
+			return nil, err
+		}
 	case *common.ImmutableMap:
 		modName := inferModuleName(o)
 		if mod := modules.GetBuiltinModule(modName); mod != nil {
@@ -227,12 +299,38 @@ func fixDecodedObject(
 		}
 
 		for k, v := range o.Value {
-			// encoding of user function not supported
-			if _, isUserFunction := v.(*common.UserFunction); isUserFunction {
-				return nil, fmt.Errorf("user function not decodable")
+			fv, err := FixDecodedObject(v, modules)
+			if err != nil {
+				return nil, err
 			}
-
-			fv, err := fixDecodedObject(v, modules)
+			o.Value[k] = fv
+		}
+		if err := fixDecodedEntries(o.Entries, modules); err != nil {
+			return nil, err
+		}
+	case *common.Instance:
+		for i, v := range o.Values {
+			fv, err := FixDecodedObject(v, modules)
+			if err != nil {
+				return nil, err
+			}
+			o.Values[i] = fv
+		}
+	case *common.BoundMethod:
+		if _, err := FixDecodedObject(o.Receiver, modules); err != nil {
+			return nil, err
+		}
+	case *common.Set:
+		for k, v := range o.Value {
+			fv, err := FixDecodedObject(v, modules)
+			if err != nil {
+				return nil, err
+			}
+			o.Value[k] = fv
+		}
+	case *common.ImmutableSet:
+		for k, v := range o.Value {
+			fv, err := FixDecodedObject(v, modules)
 			if err != nil {
 				return nil, err
 			}
@@ -242,6 +340,45 @@ func fixDecodedObject(
 	return o, nil
 }
 
+// fixDecodedUserFunction restores the function of a builtin module by its
+// encoding ID, "<module name>.<attribute name>".
+func fixDecodedUserFunction(
+	o *common.UserFunction,
+	modules *common.ModuleMap,
+) (common.Object, error) {
+	if i := strings.LastIndex(o.EncodingID, "."); i > 0 {
+		modName, name := o.EncodingID[:i], o.EncodingID[i+1:]
+		if mod := modules.GetBuiltinModule(modName); mod != nil {
+			if fn, ok := mod.Attrs[name].(*common.UserFunction); ok {
+				return &common.UserFunction{
+					Name:       fn.Name,
+					Value:      fn.Value,
+					EncodingID: o.EncodingID,
+				}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("user function not decodable: %s", o.Name)
+}
+
+func fixDecodedEntries(
+	entries map[string]common.MapEntry,
+	modules *common.ModuleMap,
+) error {
+	for k, e := range entries {
+		key, err := FixDecodedObject(e.Key, modules)
+		if err != nil {
+			return err
+		}
+		val, err := FixDecodedObject(e.Value, modules)
+		if err != nil {
+			return err
+		}
+		entries[k] = common.MapEntry{Key: key, Value: val}
+	}
+	return nil
+}
+
 func updateConstIndexes(insts []byte, indexMap map[int]int) {
 	i := 0
 	for i < len(insts) {
@@ -250,7 +387,7 @@ func updateConstIndexes(insts []byte, indexMap map[int]int) {
 		_, read := parser.ReadOperands(numOperands, insts[i+1:])
 
 		switch op {
-		case parser.OpConstant:
+		case parser.OpConstant, parser.OpClass:
 			curIdx := int(insts[i+2]) | int(insts[i+1])<<8
 			newIdx, ok := indexMap[curIdx]
 			if !ok {
@@ -265,6 +402,22 @@ func updateConstIndexes(insts []byte, indexMap map[int]int) {
 				panic(fmt.Errorf("constant index not found: %d", curIdx))
 			}
 			copy(insts[i:], MakeInstruction(op, newIdx, numFree))
+		case parser.OpSwitch:
+			curIdx := int(insts[i+2]) | int(insts[i+1])<<8
+			numCases := int(insts[i+4]) | int(insts[i+3])<<8
+			newIdx, ok := indexMap[curIdx]
+			if !ok {
+				panic(fmt.Errorf("constant index not found: %d", curIdx))
+			}
+			copy(insts[i:], MakeInstruction(op, newIdx, numCases))
+		case parser.OpCallKw, parser.OpDeferKw:
+			numArgs := int(insts[i+1])
+			curIdx := int(insts[i+3]) | int(insts[i+2])<<8
+			newIdx, ok := indexMap[curIdx]
+			if !ok {
+				panic(fmt.Errorf("constant index not found: %d", curIdx))
+			}
+			copy(insts[i:], MakeInstruction(op, numArgs, newIdx))
 		}
 
 		i += 1 + read
@@ -282,16 +435,25 @@ func init() {
 	gob.Register(&parser.SourceFileSet{})
 	gob.Register(&parser.SourceFile{})
 	gob.Register(&common.Array{})
+	gob.Register(&common.BigInt{})
 	gob.Register(&common.Bool{})
+	gob.Register(&common.BoundMethod{})
+	gob.Register(&common.BuiltinFunction{})
 	gob.Register(&common.Bytes{})
 	gob.Register(&common.Char{})
+	gob.Register(&common.Class{})
 	gob.Register(&common.CompiledFunction{})
+	gob.Register(&common.Decimal{})
 	gob.Register(&common.Error{})
 	gob.Register(&common.Float{})
 	gob.Register(&common.ImmutableArray{})
 	gob.Register(&common.ImmutableMap{})
+	gob.Register(&common.ImmutableSet{})
+	gob.Register(&common.Instance{})
 	gob.Register(&common.Int{})
 	gob.Register(&common.Map{})
+	gob.Register(&common.Range{})
+	gob.Register(&common.Set{})
 	gob.Register(&common.String{})
 	gob.Register(&common.Time{})
 	gob.Register(&common.Undefined{})
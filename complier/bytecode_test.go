@@ -2,6 +2,8 @@ package complier_test
 
 import (
 	"bytes"
+	"encoding/gob"
+	"math/big"
 	"testing"
 	"time"
 
@@ -127,6 +129,147 @@ func TestBytecode(t *testing.T) {
 			srcfile{name: "file2", size: 200})))
 }
 
+func TestBytecode_Format(t *testing.T) {
+	fn := compiledFunction(2, 2,
+		complier.MakeInstruction(parser.OpConstant, 0),
+		complier.MakeInstruction(parser.OpReturn, 1))
+	fn.ParamNames = []string{"a", "b"}
+	fn.NumDefaults = 1
+	fn.Generator = true
+	b := bytecodeFileSet(
+		concatInsts(
+			complier.MakeInstruction(parser.OpConstant, 0),
+			complier.MakeInstruction(parser.OpPop)),
+		objectsArray(
+			&common.Map{Value: map[string]common.Object{
+				"a": &common.Int{Value: 1},
+				"b": &common.String{Value: "foo"},
+				"c": &common.Float{Value: 1.5},
+				"d": common.TrueValue,
+			}},
+			fn),
+		fileSet(srcfile{name: "file1", size: 100}))
+	b.MainFunction.SourceMap = map[int]parser.Pos{0: 1, 3: 5}
+
+	var buf1, buf2 bytes.Buffer
+	require.NoError(t, b.Encode(&buf1))
+	require.NoError(t, b.Encode(&buf2))
+	require.Equal(t, "TNGO", string(buf1.Bytes()[:4]))
+	require.Equal(t, []byte{0, complier.BytecodeFormatVersion},
+		buf1.Bytes()[4:6])
+	require.True(t, bytes.Equal(buf1.Bytes(), buf2.Bytes()))
+
+	r := &complier.Bytecode{}
+	require.NoError(t, r.Decode(bytes.NewReader(buf1.Bytes()), nil))
+	require.Equal(t, b.MainFunction, r.MainFunction)
+	require.Equal(t, 2, len(r.MainFunction.SourceMap))
+	require.Equal(t, parser.Pos(5), r.MainFunction.SourceMap[3])
+	require.Equal(t, b.Constants, r.Constants)
+	rfn := r.Constants[1].(*common.CompiledFunction)
+	require.Equal(t, 2, rfn.NumParameters)
+	require.Equal(t, []string{"a", "b"}, rfn.ParamNames)
+	require.Equal(t, 1, rfn.NumDefaults)
+	require.True(t, rfn.Generator)
+	require.True(t, r.FileSet.Files[0].Set() == r.FileSet)
+	require.Equal(t, "file1",
+		r.FileSet.File(r.FileSet.Files[0].FileSetPos(10)).Name)
+
+	// newer format version
+	data := append([]byte{}, buf1.Bytes()...)
+	data[5] = complier.BytecodeFormatVersion + 1
+	err := (&complier.Bytecode{}).Decode(bytes.NewReader(data), nil)
+	require.Equal(t, complier.ErrUnsupportedFormatVersion, err)
+
+	// truncated
+	data = buf1.Bytes()[:buf1.Len()-3]
+	err = (&complier.Bytecode{}).Decode(bytes.NewReader(data), nil)
+	require.Error(t, err)
+
+	// free variables only exist at run time
+	fn = compiledFunction(0, 0, complier.MakeInstruction(parser.OpGetFree, 0))
+	fn.Free = []*common.ObjectPtr{{}}
+	err = bytecode(concatInsts(), objectsArray(fn)).Encode(&bytes.Buffer{})
+	require.Error(t, err)
+}
+
+func TestBytecode_DecodeGob(t *testing.T) {
+	b := bytecodeFileSet(
+		concatInsts(
+			complier.MakeInstruction(parser.OpConstant, 0),
+			complier.MakeInstruction(parser.OpPop)),
+		objectsArray(
+			&common.Int{Value: 55},
+			&common.ImmutableMap{Value: map[string]common.Object{
+				"a": &common.String{Value: "foo"},
+			}},
+			compiledFunction(1, 0,
+				complier.MakeInstruction(parser.OpConstant, 0),
+				complier.MakeInstruction(parser.OpReturn, 1))),
+		fileSet(srcfile{name: "file1", size: 100}))
+
+	// bytecode encoded by the older versions
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	require.NoError(t, enc.Encode(b.FileSet))
+	require.NoError(t, enc.Encode(b.MainFunction))
+	require.NoError(t, enc.Encode(b.Constants))
+
+	r := &complier.Bytecode{}
+	require.NoError(t, r.Decode(bytes.NewReader(buf.Bytes()), nil))
+	require.Equal(t, b.MainFunction, r.MainFunction)
+	require.Equal(t, b.Constants, r.Constants)
+
+	// re-encoded in the binary format
+	buf.Reset()
+	require.NoError(t, r.Encode(&buf))
+	require.Equal(t, "TNGO", string(buf.Bytes()[:4]))
+}
+
+func TestEncodeObject(t *testing.T) {
+	m := &common.Map{Value: map[string]common.Object{}}
+	for i := 0; i < 20; i++ {
+		require.NoError(t, m.IndexSet(&common.Int{Value: int64(i)},
+			&common.String{Value: "i"}))
+		require.NoError(t, m.IndexSet(&common.String{Value: string(rune('a' + i))},
+			&common.Int{Value: int64(i)}))
+	}
+	set, _ := common.NewSet(&common.Int{Value: 1}, &common.String{Value: "a"},
+		&common.Char{Value: 'c'}, common.TrueValue)
+	class := &common.Class{
+		Name:   "P",
+		Fields: []string{"x"},
+		Init:   compiledFunction(1, 1, complier.MakeInstruction(parser.OpReturn, 0)),
+		Methods: map[string]common.Object{
+			"f": compiledFunction(1, 1, complier.MakeInstruction(parser.OpReturn, 0)),
+		},
+	}
+	objs := []common.Object{
+		m,
+		set,
+		&common.ImmutableSet{Value: set.Value},
+		&common.Range{Start: -1, Stop: 10, Step: 3},
+		&common.BigInt{Value: new(big.Int).Lsh(big.NewInt(-3), 100)},
+		&common.Decimal{Value: big.NewInt(-125), Scale: 2},
+		class,
+		&common.Instance{Class: class, Values: []common.Object{set}},
+	}
+	for _, o := range objs {
+		var buf1, buf2 bytes.Buffer
+		require.NoError(t, complier.EncodeObject(&buf1, o))
+		d, err := complier.DecodeObject(bytes.NewReader(buf1.Bytes()), nil)
+		require.NoError(t, err)
+		require.True(t, o.Equals(d), o.String())
+
+		// the decoded maps and sets are iterated in a different order
+		require.NoError(t, complier.EncodeObject(&buf2, d))
+		require.True(t, bytes.Equal(buf1.Bytes(), buf2.Bytes()), o.String())
+	}
+
+	// user functions without an encoding ID cannot be restored
+	err := complier.EncodeObject(&bytes.Buffer{}, &common.UserFunction{})
+	require.Error(t, err)
+}
+
 func TestBytecode_RemoveDuplicates(t *testing.T) {
 	testBytecodeRemoveDuplicates(t,
 		bytecode(
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"path/filepath"
 	"reflect"
 	"strings"
@@ -19,6 +20,8 @@ type compilationScope struct {
 	Instructions []byte
 	SymbolInit   map[string]bool
 	SourceMap    map[int]parser.Pos
+	Tries        []*tryBlock
+	Generator    bool // the function has yield statements
 }
 
 // loop represents a loop construct that the compiler uses to track the current
@@ -26,6 +29,27 @@ type compilationScope struct {
 type loop struct {
 	Continues []int
 	Breaks    []int
+	Tries     int  // number of the try blocks outside the loop
+	Switch    bool // switch statement takes break but not continue
+}
+
+// tryBlock represents a try statement that the compiler uses to leave the
+// statement with return, break or continue.
+type tryBlock struct {
+	Handlers int               // number of the error handlers in the VM
+	Finally  *parser.BlockStmt // finally clause yet to run; or nil
+}
+
+// typePatterns maps the type conversion builtin functions to the builtin
+// functions that test the types for the type patterns of switch statements.
+var typePatterns = map[string]string{
+	"int":    "is_int",
+	"float":  "is_float",
+	"string": "is_string",
+	"bool":   "is_bool",
+	"char":   "is_char",
+	"bytes":  "is_bytes",
+	"time":   "is_time",
 }
 
 // CompilerError represents a compiler error.
@@ -53,6 +77,8 @@ type Compiler struct {
 	modules         *common.ModuleMap
 	compiledModules map[string]*common.CompiledFunction
 	allowFileImport bool
+	deterministic   bool
+	exportName      string
 	loops           []*loop
 	loopIndex       int
 	trace           io.Writer
@@ -135,7 +161,8 @@ func (c *Compiler) Compile(node parser.Node) error {
 			return err
 		}
 	case *parser.BinaryExpr:
-		if node.Token == token.LAnd || node.Token == token.LOr {
+		if node.Token == token.LAnd || node.Token == token.LOr ||
+			node.Token == token.Coalesce {
 			return c.compileLogical(node)
 		}
 		if node.Token == token.Less {
@@ -195,6 +222,10 @@ func (c *Compiler) Compile(node parser.Node) error {
 			c.emit(node, parser.OpBinaryOp, int(token.Shl))
 		case token.Shr:
 			c.emit(node, parser.OpBinaryOp, int(token.Shr))
+		case token.Pow:
+			c.emit(node, parser.OpBinaryOp, int(token.Pow))
+		case token.In:
+			c.emit(node, parser.OpContains)
 		default:
 			return c.errorf(node, "invalid binary operator: %s",
 				node.Token.String())
@@ -217,6 +248,18 @@ func (c *Compiler) Compile(node parser.Node) error {
 		}
 		c.emit(node, parser.OpConstant,
 			c.addConstant(&common.String{Value: node.Value}))
+	case *parser.FStringLit:
+		if len(node.Parts) == 1 {
+			if lit, ok := node.Parts[0].(*parser.StringLit); ok {
+				return c.Compile(lit)
+			}
+		}
+		for _, part := range node.Parts {
+			if err := c.Compile(part); err != nil {
+				return err
+			}
+		}
+		c.emit(node, parser.OpConcat, len(node.Parts))
 	case *parser.CharLit:
 		c.emit(node, parser.OpConstant,
 			c.addConstant(&common.Char{Value: node.Value}))
@@ -284,19 +327,27 @@ func (c *Compiler) Compile(node parser.Node) error {
 		return c.compileForStmt(node)
 	case *parser.ForInStmt:
 		return c.compileForInStmt(node)
+	case *parser.SwitchStmt:
+		return c.compileSwitchStmt(node)
 	case *parser.BranchStmt:
 		if node.Token == token.Break {
 			curLoop := c.currentLoop()
 			if curLoop == nil {
 				return c.errorf(node, "break not allowed outside loop")
 			}
+			if err := c.compileTryExits(node, curLoop.Tries); err != nil {
+				return err
+			}
 			pos := c.emit(node, parser.OpJump, 0)
 			curLoop.Breaks = append(curLoop.Breaks, pos)
 		} else if node.Token == token.Continue {
-			curLoop := c.currentLoop()
+			curLoop := c.continueLoop()
 			if curLoop == nil {
 				return c.errorf(node, "continue not allowed outside loop")
 			}
+			if err := c.compileTryExits(node, curLoop.Tries); err != nil {
+				return err
+			}
 			pos := c.emit(node, parser.OpJump, 0)
 			curLoop.Continues = append(curLoop.Continues, pos)
 		} else {
@@ -363,127 +414,15 @@ func (c *Compiler) Compile(node parser.Node) error {
 		c.emit(node, parser.OpMap, len(node.Elements)*2)
 
 	case *parser.SelectorExpr: // selector on RHS side
-		if err := c.Compile(node.Expr); err != nil {
-			return err
-		}
-		if err := c.Compile(node.Sel); err != nil {
-			return err
-		}
-		c.emit(node, parser.OpIndex)
+		return c.compileChain(node)
 	case *parser.IndexExpr:
-		if err := c.Compile(node.Expr); err != nil {
-			return err
-		}
-		if err := c.Compile(node.Index); err != nil {
-			return err
-		}
-		c.emit(node, parser.OpIndex)
+		return c.compileChain(node)
 	case *parser.SliceExpr:
-		if err := c.Compile(node.Expr); err != nil {
-			return err
-		}
-		if node.Low != nil {
-			if err := c.Compile(node.Low); err != nil {
-				return err
-			}
-		} else {
-			c.emit(node, parser.OpNull)
-		}
-		if node.High != nil {
-			if err := c.Compile(node.High); err != nil {
-				return err
-			}
-		} else {
-			c.emit(node, parser.OpNull)
-		}
-		c.emit(node, parser.OpSliceIndex)
+		return c.compileChain(node)
 	case *parser.FuncLit:
-		c.enterScope()
-
-		for _, p := range node.Type.Params.List {
-			s := c.symbolTable.Define(p.Name)
-
-			// function arguments is not assigned directly.
-			s.LocalAssigned = true
-		}
-
-		if err := c.Compile(node.Body); err != nil {
-			return err
-		}
-
-		// code optimization
-		c.optimizeFunc(node)
-
-		freeSymbols := c.symbolTable.FreeSymbols()
-		numLocals := c.symbolTable.MaxSymbols()
-		instructions, sourceMap := c.leaveScope()
-
-		for _, s := range freeSymbols {
-			switch s.Scope {
-			case ScopeLocal:
-				if !s.LocalAssigned {
-					// Here, the closure is capturing a local variable that's
-					// not yet assigned its value. One example is a local
-					// recursive function:
-					//
-					//   func() {
-					//     foo := func(x) {
-					//       // ..
-					//       return foo(x-1)
-					//     }
-					//   }
-					//
-					// which translate into
-					//
-					//   0000 GETL    0
-					//   0002 CLOSURE ?     1
-					//   0006 DEFL    0
-					//
-					// . So the local variable (0) is being captured before
-					// it's assigned the value.
-					//
-					// Solution is to transform the code into something like
-					// this:
-					//
-					//   func() {
-					//     foo := undefined
-					//     foo = func(x) {
-					//       // ..
-					//       return foo(x-1)
-					//     }
-					//   }
-					//
-					// that is equivalent to
-					//
-					//   0000 NULL
-					//   0001 DEFL    0
-					//   0003 GETL    0
-					//   0005 CLOSURE ?     1
-					//   0009 SETL    0
-					//
-					c.emit(node, parser.OpNull)
-					c.emit(node, parser.OpDefineLocal, s.Index)
-					s.LocalAssigned = true
-				}
-				c.emit(node, parser.OpGetLocalPtr, s.Index)
-			case ScopeFree:
-				c.emit(node, parser.OpGetFreePtr, s.Index)
-			}
-		}
-
-		compiledFunction := &common.CompiledFunction{
-			Instructions:  instructions,
-			NumLocals:     numLocals,
-			NumParameters: len(node.Type.Params.List),
-			VarArgs:       node.Type.Params.VarArgs,
-			SourceMap:     sourceMap,
-		}
-		if len(freeSymbols) > 0 {
-			c.emit(node, parser.OpClosure,
-				c.addConstant(compiledFunction), len(freeSymbols))
-		} else {
-			c.emit(node, parser.OpConstant, c.addConstant(compiledFunction))
-		}
+		return c.compileFunction(node, node.Type.Params, func() error {
+			return c.Compile(node.Body)
+		})
 	case *parser.ReturnStmt:
 		if c.symbolTable.Parent(true) == nil {
 			// outside the function
@@ -491,33 +430,80 @@ func (c *Compiler) Compile(node parser.Node) error {
 		}
 
 		if node.Result == nil {
+			if err := c.compileTryExits(node, 0); err != nil {
+				return err
+			}
 			c.emit(node, parser.OpReturn, 0)
 		} else {
 			if err := c.Compile(node.Result); err != nil {
 				return err
 			}
+			if err := c.compileTryExits(node, 0); err != nil {
+				return err
+			}
 			c.emit(node, parser.OpReturn, 1)
 		}
-	case *parser.CallExpr:
-		if err := c.Compile(node.Func); err != nil {
+	case *parser.YieldStmt:
+		if c.scopeIndex == 0 {
+			// outside the function
+			return c.errorf(node, "yield not allowed outside function")
+		}
+
+		if node.Result == nil {
+			c.emit(node, parser.OpNull)
+		} else if err := c.Compile(node.Result); err != nil {
 			return err
 		}
-		for _, arg := range node.Args {
+		c.emit(node, parser.OpYield)
+		c.scopes[c.scopeIndex].Generator = true
+	case *parser.ClassStmt:
+		return c.compileClassStmt(node)
+	case *parser.DeferStmt:
+		if c.symbolTable.Parent(true) == nil {
+			// outside the function
+			return c.errorf(node, "defer not allowed outside function")
+		}
+
+		// the function and the arguments are evaluated now, and, the call
+		// is recorded on the frame until the function returns
+		call := node.Call
+		if err := c.Compile(call.Func); err != nil {
+			return err
+		}
+		for _, arg := range call.Args {
 			if err := c.Compile(arg); err != nil {
 				return err
 			}
 		}
+		if len(call.Keywords) > 0 {
+			return c.compileKeywordCall(call, parser.OpDeferKw)
+		}
 		ellipsis := 0
-		if node.Ellipsis.IsValid() {
+		if call.Ellipsis.IsValid() {
 			ellipsis = 1
 		}
-		c.emit(node, parser.OpCall, len(node.Args), ellipsis)
+		c.emit(node, parser.OpDefer, len(call.Args), ellipsis)
+	case *parser.TryStmt:
+		return c.compileTryStmt(node)
+	case *parser.ThrowStmt:
+		if err := c.Compile(node.Result); err != nil {
+			return err
+		}
+		c.emit(node, parser.OpThrow)
+	case *parser.CallExpr:
+		return c.compileChain(node)
 	case *parser.ImportExpr:
 		if node.ModuleName == "" {
 			return c.errorf(node, "empty module name")
 		}
 
 		if mod := c.modules.Get(node.ModuleName); mod != nil {
+			if bm, ok := mod.(*common.BuiltinModule); ok &&
+				bm.NonDeterministic && c.deterministic {
+				return c.errorf(node,
+					"module '%s' not allowed in deterministic mode",
+					node.ModuleName)
+			}
 			v, err := mod.Import(node.ModuleName)
 			if err != nil {
 				return err
@@ -571,14 +557,33 @@ func (c *Compiler) Compile(node parser.Node) error {
 			return c.errorf(node, "export not allowed inside function")
 		}
 
-		// export statement is simply ignore when compiling non-module code
+		// export statement is simply ignore when compiling non-module code,
+		// unless the exported value is assigned to a global variable
 		if c.parent == nil {
+			if c.exportName == "" {
+				break
+			}
+			if err := c.Compile(node.Result); err != nil {
+				return err
+			}
+			c.emit(node, parser.OpImmutable)
+			symbol, _, ok := c.symbolTable.Resolve(c.exportName, false)
+			if !ok || symbol.Scope != ScopeGlobal {
+				var err error
+				if symbol, err = c.define(node, c.exportName); err != nil {
+					return err
+				}
+			}
+			c.emit(node, parser.OpSetGlobal, symbol.Index)
 			break
 		}
 		if err := c.Compile(node.Result); err != nil {
 			return err
 		}
 		c.emit(node, parser.OpImmutable)
+		if err := c.compileTryExits(node, 0); err != nil {
+			return err
+		}
 		c.emit(node, parser.OpReturn, 1)
 	case *parser.ErrorExpr:
 		if err := c.Compile(node.Expr); err != nil {
@@ -636,6 +641,20 @@ func (c *Compiler) EnableFileImport(enable bool) {
 	c.allowFileImport = enable
 }
 
+// EnableDeterministic enables or disables the deterministic mode. In the
+// deterministic mode, the modules marked as non-deterministic cannot be
+// imported.
+func (c *Compiler) EnableDeterministic(enable bool) {
+	c.deterministic = enable
+}
+
+// SetExportName makes the export statement of the main code assign the
+// exported value to the global variable name. By default, the export
+// statement is ignored when compiling non-module code.
+func (c *Compiler) SetExportName(name string) {
+	c.exportName = name
+}
+
 // SetImportDir sets the initial import directory path for file imports.
 func (c *Compiler) SetImportDir(dir string) {
 	c.importDir = dir
@@ -647,29 +666,21 @@ func (c *Compiler) compileAssign(
 	op token.Token,
 ) error {
 	numLHS, numRHS := len(lhs), len(rhs)
-	if numLHS > 1 || numRHS > 1 {
+	if numRHS > 1 {
 		return c.errorf(node, "tuple assignment not allowed")
 	}
-
-	// resolve and compile left-hand side
-	ident, selectors := resolveAssignLHS(lhs[0])
-	numSel := len(selectors)
-
-	if op == token.Define && numSel > 0 {
-		// using selector on new variable does not make sense
-		return c.errorf(node, "operator ':=' not allowed with selector")
+	switch lhs[0].(type) {
+	case *parser.ArrayPattern, *parser.MapPattern:
+		return c.compileDestructuring(node, lhs, rhs[0], op)
+	}
+	if numLHS > 1 {
+		return c.compileDestructuring(node, lhs, rhs[0], op)
 	}
 
-	symbol, depth, exists := c.symbolTable.Resolve(ident, false)
-	if op == token.Define {
-		if depth == 0 && exists {
-			return c.errorf(node, "'%s' redeclared in this block", ident)
-		}
-		symbol = c.symbolTable.Define(ident)
-	} else {
-		if !exists {
-			return c.errorf(node, "unresolved reference '%s'", ident)
-		}
+	// resolve and compile left-hand side
+	symbol, selectors, err := c.resolveAssign(node, lhs[0], op)
+	if err != nil {
+		return err
 	}
 
 	// +=, -=, *=, /=
@@ -709,9 +720,92 @@ func (c *Compiler) compileAssign(
 		c.emit(node, parser.OpBinaryOp, int(token.Shl))
 	case token.ShrAssign:
 		c.emit(node, parser.OpBinaryOp, int(token.Shr))
+	case token.PowAssign:
+		c.emit(node, parser.OpBinaryOp, int(token.Pow))
 	}
+	return c.compileStore(node, symbol, selectors, op)
+}
 
+// resolveAssign resolves the variable and the selectors of the left-hand side
+// of an assignment. The variable is defined if the operator is ":=".
+func (c *Compiler) resolveAssign(
+	node parser.Node,
+	lhs parser.Expr,
+	op token.Token,
+) (*Symbol, []parser.Expr, error) {
+	if isOptionalChain(lhs) {
+		return nil, nil, c.errorf(node,
+			"optional chaining not allowed in assignment")
+	}
+	ident, selectors := resolveAssignLHS(lhs)
+	numSel := len(selectors)
+
+	if op == token.Define && numSel > 0 {
+		// using selector on new variable does not make sense
+		return nil, nil, c.errorf(node,
+			"operator ':=' not allowed with selector")
+	}
+
+	symbol, depth, exists := c.symbolTable.Resolve(ident, false)
+	if op == token.Define {
+		if depth == 0 && exists {
+			return nil, nil, c.errorf(node,
+				"'%s' redeclared in this block", ident)
+		}
+		var err error
+		if symbol, err = c.define(node, ident); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		if !exists {
+			return nil, nil, c.errorf(node,
+				"unresolved reference '%s'", ident)
+		}
+	}
+	return symbol, selectors, nil
+}
+
+// define defines the symbol of a variable. It fails if a global variable would
+// take the index of a temporary (see defineTemp).
+func (c *Compiler) define(node parser.Node, name string) (*Symbol, error) {
+	symbol := c.symbolTable.Define(name)
+	if symbol.Scope == ScopeGlobal &&
+		symbol.Index >= common.GlobalsSize-common.TempGlobals {
+		return nil, c.errorf(node, "too many global variables")
+	}
+	return symbol, nil
+}
+
+// defineTemp defines the symbol of a hidden temporary value of a statement,
+// and, stores the value on the stack to it. The name starts with ":" which is
+// not allowed in the variable names. At the top level, the temporary is a
+// global variable reserved for the temporaries, so it does not take the index
+// of a user variable and it's never persisted. The caller must release the
+// symbol when the statement is compiled.
+func (c *Compiler) defineTemp(node parser.Node, name string) (*Symbol, error) {
+	symbol, ok := c.symbolTable.DefineTemp(name)
+	if !ok {
+		return nil, c.errorf(node, "too many nested statements")
+	}
+	if symbol.Scope == ScopeGlobal {
+		c.emit(node, parser.OpSetGlobal, symbol.Index)
+	} else {
+		symbol.LocalAssigned = true
+		c.emit(node, parser.OpDefineLocal, symbol.Index)
+	}
+	return symbol, nil
+}
+
+// compileStore stores the value on the stack to the variable, or, to the
+// element of the variable at the selectors.
+func (c *Compiler) compileStore(
+	node parser.Node,
+	symbol *Symbol,
+	selectors []parser.Expr,
+	op token.Token,
+) error {
 	// compile selector expressions (right to left)
+	numSel := len(selectors)
 	for i := numSel - 1; i >= 0; i-- {
 		if err := c.Compile(selectors[i]); err != nil {
 			return err
@@ -751,6 +845,405 @@ func (c *Compiler) compileAssign(
 	return nil
 }
 
+// compileClassStmt compiles a class statement like the definition of a
+// variable of the class. The class is created from the constructor function,
+// which takes the fields as its parameters and creates the instance, and, the
+// methods.
+func (c *Compiler) compileClassStmt(node *parser.ClassStmt) error {
+	names := []common.Object{&common.String{Value: node.Name.Name}}
+	declared := make(map[string]bool)
+	for _, f := range node.Fields.List {
+		if declared[f.Name] {
+			return c.errorf(f, "'%s' redeclared in this class", f.Name)
+		}
+		declared[f.Name] = true
+	}
+	for _, m := range node.Methods {
+		if declared[m.Name.Name] {
+			return c.errorf(m.Name, "'%s' redeclared in this class",
+				m.Name.Name)
+		}
+		declared[m.Name.Name] = true
+		if m.Func.Type.Params.NumFields() == 0 {
+			return c.errorf(m, "method '%s' has no receiver parameter",
+				m.Name.Name)
+		}
+		names = append(names, &common.String{Value: m.Name.Name})
+	}
+
+	symbol, _, err := c.resolveAssign(node, node.Name, token.Define)
+	if err != nil {
+		return err
+	}
+
+	fields := node.Fields
+	if err := c.compileFunction(node, fields, func() error {
+		for i := range fields.List {
+			c.emit(node, parser.OpGetLocal, i)
+		}
+		c.emit(node, parser.OpInstance, len(fields.List))
+		c.emit(node, parser.OpReturn, 1)
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, m := range node.Methods {
+		if err := c.Compile(m.Func); err != nil {
+			return err
+		}
+	}
+	c.emit(node, parser.OpClass,
+		c.addConstant(&common.ImmutableArray{Value: names}))
+	return c.compileStore(node, symbol, nil, token.Define)
+}
+
+// compileFunction compiles a function with the parameters params, and, the
+// body compiled by compileBody. The function, or its closure if it captures
+// free variables, is pushed on the stack.
+func (c *Compiler) compileFunction(
+	node parser.Node,
+	params *parser.IdentList,
+	compileBody func() error,
+) error {
+	c.enterScope()
+
+	paramNames := make([]string, len(params.List))
+	for i, p := range params.List {
+		s := c.symbolTable.Define(p.Name)
+
+		// function arguments is not assigned directly.
+		s.LocalAssigned = true
+		paramNames[i] = p.Name
+	}
+
+	// the missing arguments are undefined; replace them with the
+	// default values
+	numDefaults := 0
+	for i, def := range params.Defaults {
+		if def == nil {
+			continue
+		}
+		numDefaults++
+		c.emit(node, parser.OpGetLocal, i)
+		jumpPos := c.emit(node, parser.OpDefaultJump, 0)
+		if err := c.Compile(def); err != nil {
+			return err
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+		c.emit(node, parser.OpSetLocal, i)
+	}
+
+	if err := compileBody(); err != nil {
+		return err
+	}
+
+	// code optimization
+	c.optimizeFunc(node)
+
+	freeSymbols := c.symbolTable.FreeSymbols()
+	numLocals := c.symbolTable.MaxSymbols()
+	generator := c.scopes[c.scopeIndex].Generator
+	instructions, sourceMap := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		switch s.Scope {
+		case ScopeLocal:
+			if !s.LocalAssigned {
+				// Here, the closure is capturing a local variable that's
+				// not yet assigned its value. One example is a local
+				// recursive function:
+				//
+				//   func() {
+				//     foo := func(x) {
+				//       // ..
+				//       return foo(x-1)
+				//     }
+				//   }
+				//
+				// which translate into
+				//
+				//   0000 GETL    0
+				//   0002 CLOSURE ?     1
+				//   0006 DEFL    0
+				//
+				// . So the local variable (0) is being captured before
+				// it's assigned the value.
+				//
+				// Solution is to transform the code into something like
+				// this:
+				//
+				//   func() {
+				//     foo := undefined
+				//     foo = func(x) {
+				//       // ..
+				//       return foo(x-1)
+				//     }
+				//   }
+				//
+				// that is equivalent to
+				//
+				//   0000 NULL
+				//   0001 DEFL    0
+				//   0003 GETL    0
+				//   0005 CLOSURE ?     1
+				//   0009 SETL    0
+				//
+				c.emit(node, parser.OpNull)
+				c.emit(node, parser.OpDefineLocal, s.Index)
+				s.LocalAssigned = true
+			}
+			c.emit(node, parser.OpGetLocalPtr, s.Index)
+		case ScopeFree:
+			c.emit(node, parser.OpGetFreePtr, s.Index)
+		}
+	}
+
+	compiledFunction := &common.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     numLocals,
+		NumParameters: len(params.List),
+		VarArgs:       params.VarArgs,
+		ParamNames:    paramNames,
+		NumDefaults:   numDefaults,
+		Generator:     generator,
+		SourceMap:     sourceMap,
+	}
+	if len(freeSymbols) > 0 {
+		c.emit(node, parser.OpClosure,
+			c.addConstant(compiledFunction), len(freeSymbols))
+	} else {
+		c.emit(node, parser.OpConstant, c.addConstant(compiledFunction))
+	}
+	return nil
+}
+
+// compileKeywordCall compiles a call with keyword arguments, or, a deferred
+// call if op is OpDeferKw. The values of the keyword arguments follow the
+// positional arguments, and, the names are in an immutable array constant of
+// the instruction.
+func (c *Compiler) compileKeywordCall(
+	node *parser.CallExpr,
+	op parser.Opcode,
+) error {
+	names := make([]common.Object, len(node.Keywords))
+	for i, kw := range node.Keywords {
+		if err := c.Compile(kw.Value); err != nil {
+			return err
+		}
+		names[i] = &common.String{Value: kw.Name.Name}
+	}
+	c.emit(node, op, len(node.Args)+len(node.Keywords),
+		c.addConstant(&common.ImmutableArray{Value: names}))
+	return nil
+}
+
+func (c *Compiler) compileDestructuring(
+	node parser.Node,
+	lhs []parser.Expr,
+	rhs parser.Expr,
+	op token.Token,
+) error {
+	if op != token.Assign && op != token.Define {
+		return c.errorf(node, "operator '%s' not allowed with destructuring",
+			op.String())
+	}
+
+	// destructuring assignment is compiled like following:
+	//
+	//   :d := rhs
+	//   a := :d[0]               (a, b := rhs    or    [a, b] := rhs)
+	//   b := :d[1] ?? default    (DEFJMP if default)
+	//   rest := :d[2:]           (...rest; empty if :d is shorter)
+	//   name := :d["name"]       ({name} := rhs)
+	//
+	// The missing elements are undefined as the index of an array beyond its
+	// length is undefined. ":d" is a hidden temporary (see defineTemp): a
+	// local variable in a function, or, a reserved global variable that is
+	// never persisted at the top level.
+	targets := lhs
+	var defaults []parser.Expr
+	var keys []string
+	var rest *parser.Ident
+	switch pattern := lhs[0].(type) {
+	case *parser.ArrayPattern:
+		targets = nil
+		for _, elem := range pattern.Elements {
+			targets = append(targets, elem.Name)
+			defaults = append(defaults, elem.Default)
+		}
+		rest = pattern.Rest
+	case *parser.MapPattern:
+		targets = nil
+		for _, elem := range pattern.Elements {
+			targets = append(targets, elem.Name)
+			defaults = append(defaults, elem.Default)
+			keys = append(keys, elem.Key)
+		}
+	}
+
+	if err := c.Compile(rhs); err != nil {
+		return err
+	}
+	dSymbol, err := c.defineTemp(node, ":d")
+	if err != nil {
+		return err
+	}
+	defer c.symbolTable.ReleaseTemp(dSymbol)
+	getD := func() {
+		if dSymbol.Scope == ScopeGlobal {
+			c.emit(node, parser.OpGetGlobal, dSymbol.Index)
+		} else {
+			c.emit(node, parser.OpGetLocal, dSymbol.Index)
+		}
+	}
+
+	for i, target := range targets {
+		if ident, ok := target.(*parser.Ident); ok && ident.Name == "_" {
+			continue
+		}
+		symbol, selectors, err := c.resolveAssign(node, target, op)
+		if err != nil {
+			return err
+		}
+
+		// element value
+		getD()
+		var key common.Object = &common.Int{Value: int64(i)}
+		if keys != nil {
+			key = &common.String{Value: keys[i]}
+		}
+		c.emit(node, parser.OpConstant, c.addConstant(key))
+		c.emit(node, parser.OpIndex)
+		if defaults != nil && defaults[i] != nil {
+			jumpPos := c.emit(node, parser.OpDefaultJump, 0)
+			if err := c.Compile(defaults[i]); err != nil {
+				return err
+			}
+			c.changeOperand(jumpPos, len(c.currentInstructions()))
+		}
+		if err := c.compileStore(node, symbol, selectors, op); err != nil {
+			return err
+		}
+	}
+
+	if rest != nil && rest.Name != "_" {
+		symbol, _, err := c.resolveAssign(node, rest, op)
+		if err != nil {
+			return err
+		}
+		// the high index is not the length of :d so that the rest is empty
+		// rather than an invalid slice if :d is shorter than the pattern
+		getD()
+		c.emit(node, parser.OpConstant,
+			c.addConstant(&common.Int{Value: int64(len(targets))}))
+		c.emit(node, parser.OpConstant,
+			c.addConstant(&common.Int{Value: math.MaxInt64}))
+		c.emit(node, parser.OpSliceIndex)
+		return c.compileStore(node, symbol, nil, op)
+	}
+	return nil
+}
+
+// compileChain compiles a chain of selector, index, slice and call
+// expressions. If a link of the chain is optional ("?." or "?.[") and its
+// operand is undefined, the rest of the chain is skipped and the chain
+// evaluates to undefined.
+func (c *Compiler) compileChain(node parser.Expr) error {
+	var jumps []int
+	if err := c.compileChainLink(node, &jumps); err != nil {
+		return err
+	}
+	for _, pos := range jumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+func (c *Compiler) compileChainLink(expr parser.Expr, jumps *[]int) error {
+	switch node := expr.(type) {
+	case *parser.SelectorExpr:
+		if err := c.compileChainOperand(node, node.Expr, node.Optional,
+			jumps); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Sel); err != nil {
+			return err
+		}
+		c.emit(node, parser.OpIndex)
+	case *parser.IndexExpr:
+		if err := c.compileChainOperand(node, node.Expr, node.Optional,
+			jumps); err != nil {
+			return err
+		}
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.emit(node, parser.OpIndex)
+	case *parser.SliceExpr:
+		if err := c.compileChainOperand(node, node.Expr, node.Optional,
+			jumps); err != nil {
+			return err
+		}
+		if node.Low != nil {
+			if err := c.Compile(node.Low); err != nil {
+				return err
+			}
+		} else {
+			c.emit(node, parser.OpNull)
+		}
+		if node.High != nil {
+			if err := c.Compile(node.High); err != nil {
+				return err
+			}
+		} else {
+			c.emit(node, parser.OpNull)
+		}
+		c.emit(node, parser.OpSliceIndex)
+	case *parser.CallExpr:
+		if err := c.compileChainOperand(node, node.Func, false,
+			jumps); err != nil {
+			return err
+		}
+		for _, arg := range node.Args {
+			if err := c.Compile(arg); err != nil {
+				return err
+			}
+		}
+		if len(node.Keywords) > 0 {
+			return c.compileKeywordCall(node, parser.OpCallKw)
+		}
+		ellipsis := 0
+		if node.Ellipsis.IsValid() {
+			ellipsis = 1
+		}
+		c.emit(node, parser.OpCall, len(node.Args), ellipsis)
+	default:
+		return c.Compile(expr)
+	}
+	return nil
+}
+
+// compileChainOperand compiles the operand of a link of the chain. If the
+// link is optional, it jumps to the end of the chain with undefined when the
+// operand is undefined.
+func (c *Compiler) compileChainOperand(
+	node parser.Node,
+	operand parser.Expr,
+	optional bool,
+	jumps *[]int,
+) error {
+	if err := c.compileChainLink(operand, jumps); err != nil {
+		return err
+	}
+	if optional {
+		jumpPos := c.emit(node, parser.OpDefaultJump, 0)
+		c.emit(node, parser.OpNull)
+		*jumps = append(*jumps, c.emit(node, parser.OpJump, 0))
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
 func (c *Compiler) compileLogical(node *parser.BinaryExpr) error {
 	// left side term
 	if err := c.Compile(node.LHS); err != nil {
@@ -759,10 +1252,13 @@ func (c *Compiler) compileLogical(node *parser.BinaryExpr) error {
 
 	// jump position
 	var jumpPos int
-	if node.Token == token.LAnd {
+	switch node.Token {
+	case token.LAnd:
 		jumpPos = c.emit(node, parser.OpAndJump, 0)
-	} else {
+	case token.LOr:
 		jumpPos = c.emit(node, parser.OpOrJump, 0)
+	default: // token.Coalesce
+		jumpPos = c.emit(node, parser.OpDefaultJump, 0)
 	}
 
 	// right side term
@@ -854,21 +1350,19 @@ func (c *Compiler) compileForInStmt(stmt *parser.ForInStmt) error {
 	//     ... body ...
 	//   }
 	//
-	// ":it" is a local variable but it will not conflict with other user variables
-	// because character ":" is not allowed in the variable names.
+	// ":it" is a hidden temporary (see defineTemp).
 
 	// init
 	//   :it = iterator(iterable)
-	itSymbol := c.symbolTable.Define(":it")
 	if err := c.Compile(stmt.Iterable); err != nil {
 		return err
 	}
 	c.emit(stmt, parser.OpIteratorInit)
-	if itSymbol.Scope == ScopeGlobal {
-		c.emit(stmt, parser.OpSetGlobal, itSymbol.Index)
-	} else {
-		c.emit(stmt, parser.OpDefineLocal, itSymbol.Index)
+	itSymbol, err := c.defineTemp(stmt, ":it")
+	if err != nil {
+		return err
 	}
+	defer c.symbolTable.ReleaseTemp(itSymbol)
 
 	// pre-condition position
 	preCondPos := len(c.currentInstructions())
@@ -890,7 +1384,10 @@ func (c *Compiler) compileForInStmt(stmt *parser.ForInStmt) error {
 
 	// assign key variable
 	if stmt.Key.Name != "_" {
-		keySymbol := c.symbolTable.Define(stmt.Key.Name)
+		keySymbol, err := c.define(stmt, stmt.Key.Name)
+		if err != nil {
+			return err
+		}
 		if itSymbol.Scope == ScopeGlobal {
 			c.emit(stmt, parser.OpGetGlobal, itSymbol.Index)
 		} else {
@@ -907,7 +1404,10 @@ func (c *Compiler) compileForInStmt(stmt *parser.ForInStmt) error {
 
 	// assign value variable
 	if stmt.Value.Name != "_" {
-		valueSymbol := c.symbolTable.Define(stmt.Value.Name)
+		valueSymbol, err := c.define(stmt, stmt.Value.Name)
+		if err != nil {
+			return err
+		}
 		if itSymbol.Scope == ScopeGlobal {
 			c.emit(stmt, parser.OpGetGlobal, itSymbol.Index)
 		} else {
@@ -950,6 +1450,408 @@ func (c *Compiler) compileForInStmt(stmt *parser.ForInStmt) error {
 	return nil
 }
 
+func (c *Compiler) compileTryStmt(stmt *parser.TryStmt) error {
+	// try statement is compiled like following:
+	//
+	//     TRY     finally_error   (if finally)
+	//     TRY     catch           (if catch)
+	//     ... body ...
+	//     POPTRY  1               (if catch)
+	//     JMP     end_catch       (if catch)
+	//   catch:
+	//     e := error             (VM pushes the error on catch)
+	//     ... catch ...
+	//   end_catch:
+	//     POPTRY  1               (if finally)
+	//     ... finally ...
+	//     JMP     end
+	//   finally_error:
+	//     :err := error
+	//     ... finally ...
+	//     throw :err
+	//   end:
+	//
+	// return, break and continue statements leaving the try statement pop
+	// the error handlers, and, run the finally clause before they jump.
+	// ":err" is a hidden temporary (see defineTemp).
+	tb := &tryBlock{Finally: stmt.Finally}
+	var finallyPos, catchPos int
+	if stmt.Finally != nil {
+		finallyPos = c.emit(stmt, parser.OpTry, 0)
+		tb.Handlers++
+	}
+	if stmt.Catch != nil {
+		catchPos = c.emit(stmt, parser.OpTry, 0)
+		tb.Handlers++
+	}
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.Tries = append(scope.Tries, tb)
+	err := c.Compile(stmt.Body)
+	if err == nil && stmt.Catch != nil {
+		err = c.compileCatch(stmt, tb, catchPos)
+	}
+	scope = &c.scopes[c.scopeIndex]
+	scope.Tries = scope.Tries[:len(scope.Tries)-1]
+	if err != nil || stmt.Finally == nil {
+		return err
+	}
+
+	c.emit(stmt, parser.OpPopTry, 1)
+	if err := c.Compile(stmt.Finally); err != nil {
+		return err
+	}
+	endPos := c.emit(stmt, parser.OpJump, 0)
+	c.changeOperand(finallyPos, len(c.currentInstructions()))
+
+	c.symbolTable = c.symbolTable.Fork(true)
+	defer func() {
+		c.symbolTable = c.symbolTable.Parent(false)
+	}()
+	errSymbol, err := c.defineTemp(stmt, ":err")
+	if err != nil {
+		return err
+	}
+	defer c.symbolTable.ReleaseTemp(errSymbol)
+	if err := c.Compile(stmt.Finally); err != nil {
+		return err
+	}
+	if errSymbol.Scope == ScopeGlobal {
+		c.emit(stmt, parser.OpGetGlobal, errSymbol.Index)
+	} else {
+		c.emit(stmt, parser.OpGetLocal, errSymbol.Index)
+	}
+	c.emit(stmt, parser.OpThrow)
+	c.changeOperand(endPos, len(c.currentInstructions()))
+	return nil
+}
+
+func (c *Compiler) compileCatch(
+	stmt *parser.TryStmt,
+	tb *tryBlock,
+	catchPos int,
+) error {
+	c.emit(stmt, parser.OpPopTry, 1)
+	endPos := c.emit(stmt, parser.OpJump, 0)
+	c.changeOperand(catchPos, len(c.currentInstructions()))
+	tb.Handlers--
+
+	c.symbolTable = c.symbolTable.Fork(true)
+	defer func() {
+		c.symbolTable = c.symbolTable.Parent(false)
+	}()
+	if stmt.Ident == nil || stmt.Ident.Name == "_" {
+		c.emit(stmt, parser.OpPop)
+	} else {
+		symbol, err := c.define(stmt, stmt.Ident.Name)
+		if err != nil {
+			return err
+		}
+		if symbol.Scope == ScopeGlobal {
+			c.emit(stmt, parser.OpSetGlobal, symbol.Index)
+		} else {
+			symbol.LocalAssigned = true
+			c.emit(stmt, parser.OpDefineLocal, symbol.Index)
+		}
+	}
+	if err := c.Compile(stmt.Catch); err != nil {
+		return err
+	}
+	c.changeOperand(endPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileTryExits leaves the try statements of the current function from the
+// innermost one to the try statement at depth: it pops their error handlers,
+// and, runs their finally clauses.
+func (c *Compiler) compileTryExits(node parser.Node, depth int) error {
+	tries := c.scopes[c.scopeIndex].Tries
+	defer func() {
+		c.scopes[c.scopeIndex].Tries = tries
+	}()
+	for i := len(tries) - 1; i >= depth; i-- {
+		if tries[i].Handlers > 0 {
+			c.emit(node, parser.OpPopTry, tries[i].Handlers)
+		}
+		if tries[i].Finally != nil {
+			// the finally clause runs outside of its try statement
+			c.scopes[c.scopeIndex].Tries = tries[:i]
+			if err := c.Compile(tries[i].Finally); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileSwitchStmt(stmt *parser.SwitchStmt) error {
+	c.symbolTable = c.symbolTable.Fork(true)
+	defer func() {
+		c.symbolTable = c.symbolTable.Parent(false)
+	}()
+
+	// init statement
+	if stmt.Init != nil {
+		if err := c.Compile(stmt.Init); err != nil {
+			return err
+		}
+	}
+
+	// the switch statement is compiled to a jump table if all the cases are
+	// int or string literals without guards.
+	var cases []*parser.CaseClause
+	var defaultCase *parser.CaseClause
+	jumpTable := stmt.Tag != nil
+	keys := make(map[string]bool)
+	for _, s := range stmt.Body.Stmts {
+		clause := s.(*parser.CaseClause)
+		if clause.List == nil {
+			if defaultCase != nil {
+				return c.errorf(clause, "multiple defaults in switch")
+			}
+			defaultCase = clause
+			continue
+		}
+		cases = append(cases, clause)
+		if clause.Guard != nil {
+			jumpTable = false
+		}
+		for _, expr := range clause.List {
+			key, ok := switchKey(expr)
+			if !ok {
+				jumpTable = false
+			} else if stmt.Tag != nil && clause.Guard == nil {
+				if keys[key] {
+					return c.errorf(expr, "duplicate case %s in switch",
+						expr.String())
+				}
+				keys[key] = true
+			}
+		}
+	}
+
+	// enter loop: break statements leave the switch statement
+	loop := c.enterLoop()
+	loop.Switch = true
+
+	var err error
+	if jumpTable && len(cases) > 0 {
+		err = c.compileJumpTable(stmt, cases, defaultCase)
+	} else {
+		err = c.compileSwitchCases(stmt, cases, defaultCase)
+	}
+	c.leaveLoop()
+	if err != nil {
+		return err
+	}
+
+	// update all break jump positions
+	endPos := len(c.currentInstructions())
+	for _, pos := range loop.Breaks {
+		c.changeOperand(pos, endPos)
+	}
+	return nil
+}
+
+func (c *Compiler) compileJumpTable(
+	stmt *parser.SwitchStmt,
+	cases []*parser.CaseClause,
+	defaultCase *parser.CaseClause,
+) error {
+	// switch statement with int or string literal cases is compiled like
+	// following:
+	//
+	//     ... tag ...
+	//     SWITCH  table  n
+	//     JMP     case_0
+	//     ...
+	//     JMP     case_n-1
+	//     JMP     default        (or end)
+	//   case_0:
+	//     ... body ...
+	//     JMP     end
+	//   ...
+	//   default:
+	//     ... body ...
+	//   end:
+	//
+	// "table" is an immutable map constant from the case values to the case
+	// indexes, and, SWITCH takes the n-th jump for the values not in it.
+	if err := c.Compile(stmt.Tag); err != nil {
+		return err
+	}
+	table := &common.ImmutableMap{Value: make(map[string]common.Object)}
+	for i, clause := range cases {
+		for _, expr := range clause.List {
+			key, _ := switchKey(expr)
+			table.Value[key] = &common.Int{Value: int64(i)}
+		}
+	}
+	c.emit(stmt, parser.OpSwitch, c.addConstant(table), len(cases))
+
+	jumps := make([]int, len(cases)+1)
+	for i := range jumps {
+		jumps[i] = c.emit(stmt, parser.OpJump, 0)
+	}
+	if defaultCase != nil {
+		cases = append(cases, defaultCase)
+	} else {
+		c.currentLoop().Breaks = append(c.currentLoop().Breaks,
+			jumps[len(jumps)-1])
+	}
+	for i, clause := range cases {
+		c.changeOperand(jumps[i], len(c.currentInstructions()))
+		if err := c.compileCaseBody(clause, i == len(cases)-1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) compileSwitchCases(
+	stmt *parser.SwitchStmt,
+	cases []*parser.CaseClause,
+	defaultCase *parser.CaseClause,
+) error {
+	// switch statement is compiled like following:
+	//
+	//     :sw := tag
+	//   case_0:
+	//     :sw == v_0 || :sw == v_1 || is_int(:sw)
+	//     JMPF    case_1
+	//     ... guard ...          (if guard)
+	//     JMPF    case_1         (if guard)
+	//     ... body ...
+	//     JMP     end
+	//   case_1:
+	//     ...
+	//   default:
+	//     ... body ...
+	//   end:
+	//
+	// Without the tag, the case expressions are the conditions themselves.
+	// ":sw" is a hidden temporary (see defineTemp).
+	var swSymbol *Symbol
+	if stmt.Tag != nil {
+		if err := c.Compile(stmt.Tag); err != nil {
+			return err
+		}
+		var err error
+		swSymbol, err = c.defineTemp(stmt, ":sw")
+		if err != nil {
+			return err
+		}
+		defer c.symbolTable.ReleaseTemp(swSymbol)
+	}
+
+	for i, clause := range cases {
+		var orJumps []int
+		for j, expr := range clause.List {
+			if err := c.compileCaseExpr(expr, swSymbol); err != nil {
+				return err
+			}
+			if j < len(clause.List)-1 {
+				orJumps = append(orJumps,
+					c.emit(expr, parser.OpOrJump, 0))
+			}
+		}
+		for _, pos := range orJumps {
+			c.changeOperand(pos, len(c.currentInstructions()))
+		}
+		nextJumps := []int{c.emit(clause, parser.OpJumpFalsy, 0)}
+		if clause.Guard != nil {
+			if err := c.Compile(clause.Guard); err != nil {
+				return err
+			}
+			nextJumps = append(nextJumps,
+				c.emit(clause.Guard, parser.OpJumpFalsy, 0))
+		}
+		last := defaultCase == nil && i == len(cases)-1
+		if err := c.compileCaseBody(clause, last); err != nil {
+			return err
+		}
+		for _, pos := range nextJumps {
+			c.changeOperand(pos, len(c.currentInstructions()))
+		}
+	}
+	if defaultCase != nil {
+		return c.compileCaseBody(defaultCase, true)
+	}
+	return nil
+}
+
+// compileCaseExpr compiles the test of a case expression against the switch
+// tag stored in swSymbol, or, the case expression itself if the switch has no
+// tag.
+func (c *Compiler) compileCaseExpr(expr parser.Expr, swSymbol *Symbol) error {
+	if swSymbol == nil {
+		return c.Compile(expr)
+	}
+
+	builtin, isPattern := c.typePattern(expr)
+	if isPattern {
+		c.emit(expr, parser.OpGetBuiltin, builtin)
+	}
+	if swSymbol.Scope == ScopeGlobal {
+		c.emit(expr, parser.OpGetGlobal, swSymbol.Index)
+	} else {
+		c.emit(expr, parser.OpGetLocal, swSymbol.Index)
+	}
+	if isPattern {
+		c.emit(expr, parser.OpCall, 1, 0)
+		return nil
+	}
+	if err := c.Compile(expr); err != nil {
+		return err
+	}
+	c.emit(expr, parser.OpEqual)
+	return nil
+}
+
+// compileCaseBody compiles the body of a case clause followed by the jump to
+// the end of the switch statement unless it is the last one.
+func (c *Compiler) compileCaseBody(clause *parser.CaseClause, last bool) error {
+	c.symbolTable = c.symbolTable.Fork(true)
+	defer func() {
+		c.symbolTable = c.symbolTable.Parent(false)
+	}()
+
+	for _, stmt := range clause.Body {
+		if err := c.Compile(stmt); err != nil {
+			return err
+		}
+	}
+	if !last {
+		pos := c.emit(clause, parser.OpJump, 0)
+		c.currentLoop().Breaks = append(c.currentLoop().Breaks, pos)
+	}
+	return nil
+}
+
+// typePattern returns the index of the builtin function that tests the type
+// if the case expression is a type pattern: the name of a type conversion
+// builtin function such as "int" or "string".
+func (c *Compiler) typePattern(expr parser.Expr) (int, bool) {
+	ident, ok := expr.(*parser.Ident)
+	if !ok {
+		return 0, false
+	}
+	name, ok := typePatterns[ident.Name]
+	if !ok {
+		return 0, false
+	}
+	symbol, _, ok := c.symbolTable.Resolve(ident.Name, false)
+	if !ok || symbol.Scope != ScopeBuiltin {
+		return 0, false
+	}
+	for idx, fn := range common.GetAllBuiltinFunctions() {
+		if fn.Name == name {
+			return idx, true
+		}
+	}
+	return 0, false
+}
+
 func (c *Compiler) checkCyclicImports(
 	node parser.Node,
 	modulePath string,
@@ -1028,7 +1930,7 @@ func (c *Compiler) storeCompiledModule(
 }
 
 func (c *Compiler) enterLoop() *loop {
-	loop := &loop{}
+	loop := &loop{Tries: len(c.scopes[c.scopeIndex].Tries)}
 	c.loops = append(c.loops, loop)
 	c.loopIndex++
 	if c.trace != nil {
@@ -1052,6 +1954,16 @@ func (c *Compiler) currentLoop() *loop {
 	return nil
 }
 
+// continueLoop returns the innermost loop that is not a switch statement.
+func (c *Compiler) continueLoop() *loop {
+	for i := c.loopIndex; i >= 0; i-- {
+		if !c.loops[i].Switch {
+			return c.loops[i]
+		}
+	}
+	return nil
+}
+
 func (c *Compiler) currentInstructions() []byte {
 	return c.scopes[c.scopeIndex].Instructions
 }
@@ -1098,6 +2010,7 @@ func (c *Compiler) fork(
 	child.modulePath = modulePath // module file path
 	child.parent = c              // parent to set to current compiler
 	child.allowFileImport = c.allowFileImport
+	child.deterministic = c.deterministic
 	child.importDir = c.importDir
 	if isFile && c.importDir != "" {
 		child.importDir = filepath.Dir(modulePath)
@@ -1173,7 +2086,8 @@ func (c *Compiler) optimizeFunc(node parser.Node) {
 		func(pos int, opcode parser.Opcode, operands []int) bool {
 			switch opcode {
 			case parser.OpJump, parser.OpJumpFalsy,
-				parser.OpAndJump, parser.OpOrJump:
+				parser.OpAndJump, parser.OpOrJump, parser.OpTry,
+				parser.OpDefaultJump:
 				dsts[operands[0]] = true
 			}
 			return true
@@ -1213,7 +2127,7 @@ func (c *Compiler) optimizeFunc(node parser.Node) {
 		func(pos int, opcode parser.Opcode, operands []int) bool {
 			switch opcode {
 			case parser.OpJump, parser.OpJumpFalsy, parser.OpAndJump,
-				parser.OpOrJump:
+				parser.OpOrJump, parser.OpTry, parser.OpDefaultJump:
 				newDst, ok := posMap[operands[0]]
 				if ok {
 					copy(newInsts[pos:],
@@ -1305,6 +2219,30 @@ func resolveAssignLHS(
 	return
 }
 
+// isOptionalChain returns true if a link of the selector and index chain is
+// optional.
+func isOptionalChain(expr parser.Expr) bool {
+	switch term := expr.(type) {
+	case *parser.SelectorExpr:
+		return term.Optional || isOptionalChain(term.Expr)
+	case *parser.IndexExpr:
+		return term.Optional || isOptionalChain(term.Expr)
+	}
+	return false
+}
+
+// switchKey returns the jump table key of a case expression if it is an int or
+// string literal.
+func switchKey(expr parser.Expr) (string, bool) {
+	switch expr := expr.(type) {
+	case *parser.IntLit:
+		return common.SwitchKey(&common.Int{Value: expr.Value})
+	case *parser.StringLit:
+		return common.SwitchKey(&common.String{Value: expr.Value})
+	}
+	return "", false
+}
+
 func iterateInstructions(
 	b []byte,
 	fn func(pos int, opcode parser.Opcode, operands []int) bool,
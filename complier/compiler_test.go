@@ -60,6 +60,30 @@ func TestCompiler_Compile(t *testing.T) {
 				intObject(1),
 				intObject(2))))
 
+	expectCompile(t, `2 ** 3`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConstant, 0),
+				complier.MakeInstruction(parser.OpConstant, 1),
+				complier.MakeInstruction(parser.OpBinaryOp, 60),
+				complier.MakeInstruction(parser.OpPop),
+				complier.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(2),
+				intObject(3))))
+
+	expectCompile(t, `"a" in "abc"`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConstant, 0),
+				complier.MakeInstruction(parser.OpConstant, 1),
+				complier.MakeInstruction(parser.OpContains),
+				complier.MakeInstruction(parser.OpPop),
+				complier.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				stringObject("a"),
+				stringObject("abc"))))
+
 	expectCompile(t, `2 / 1`,
 		bytecode(
 			concatInsts(
@@ -534,6 +558,21 @@ func TestCompiler_Compile(t *testing.T) {
 					complier.MakeInstruction(parser.OpPop),
 					complier.MakeInstruction(parser.OpReturn, 0)))))
 
+	expectCompile(t, `func() { yield 1; yield }`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConstant, 1),
+				complier.MakeInstruction(parser.OpPop),
+				complier.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				generatorFunction(0, 0,
+					complier.MakeInstruction(parser.OpConstant, 0),
+					complier.MakeInstruction(parser.OpYield),
+					complier.MakeInstruction(parser.OpNull),
+					complier.MakeInstruction(parser.OpYield),
+					complier.MakeInstruction(parser.OpReturn, 0)))))
+
 	expectCompile(t, `func() { 1; 2 }`,
 		bytecode(
 			concatInsts(
@@ -949,16 +988,16 @@ func() {
 				complier.MakeInstruction(parser.OpSetGlobal, 0),
 				complier.MakeInstruction(parser.OpGetGlobal, 0),
 				complier.MakeInstruction(parser.OpIteratorInit),
-				complier.MakeInstruction(parser.OpSetGlobal, 1),
-				complier.MakeInstruction(parser.OpGetGlobal, 1),
+				complier.MakeInstruction(parser.OpSetGlobal, 1023),
+				complier.MakeInstruction(parser.OpGetGlobal, 1023),
 				complier.MakeInstruction(parser.OpIteratorNext),
 				complier.MakeInstruction(parser.OpJumpFalsy, 37),
-				complier.MakeInstruction(parser.OpGetGlobal, 1),
+				complier.MakeInstruction(parser.OpGetGlobal, 1023),
 				complier.MakeInstruction(parser.OpIteratorKey),
-				complier.MakeInstruction(parser.OpSetGlobal, 2),
-				complier.MakeInstruction(parser.OpGetGlobal, 1),
+				complier.MakeInstruction(parser.OpSetGlobal, 1),
+				complier.MakeInstruction(parser.OpGetGlobal, 1023),
 				complier.MakeInstruction(parser.OpIteratorValue),
-				complier.MakeInstruction(parser.OpSetGlobal, 3),
+				complier.MakeInstruction(parser.OpSetGlobal, 2),
 				complier.MakeInstruction(parser.OpJump, 13),
 				complier.MakeInstruction(parser.OpSuspend)),
 			objectsArray()))
@@ -1007,6 +1046,8 @@ r["x"] = {
 
 	expectCompileError(t, `import("")`, "empty module name")
 
+	expectCompileError(t, `try {}`, "expected catch or finally")
+
 	// https://github.com/d5/tengo/issues/314
 	expectCompileError(t, `
 (func() {
@@ -1036,6 +1077,378 @@ func TestCompilerErrorReport(t *testing.T) {
 		"Compile Error: continue not allowed outside loop\n\tat test:1:10")
 	expectCompileError(t, `func() { export 5 }`,
 		"Compile Error: export not allowed inside function\n\tat test:1:10")
+	expectCompileError(t, `yield 5`,
+		"Compile Error: yield not allowed outside function\n\tat test:1:1")
+}
+
+func TestCompilerTry(t *testing.T) {
+	expectCompile(t, `try { throw 1 } catch e { 2 }`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpTry, 12),     // 0000
+				complier.MakeInstruction(parser.OpConstant, 0), // 0003
+				complier.MakeInstruction(parser.OpThrow),       // 0006
+				complier.MakeInstruction(parser.OpPopTry, 1),   // 0007
+				complier.MakeInstruction(parser.OpJump, 19),    // 0009
+				complier.MakeInstruction(parser.OpSetGlobal, 0),
+				complier.MakeInstruction(parser.OpConstant, 1), // 0015
+				complier.MakeInstruction(parser.OpPop),         // 0018
+				complier.MakeInstruction(parser.OpSuspend)),    // 0019
+			objectsArray(
+				intObject(1),
+				intObject(2))))
+
+	expectCompile(t, `try { 1 } finally { 2 }`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpTry, 16),     // 0000
+				complier.MakeInstruction(parser.OpConstant, 0), // 0003
+				complier.MakeInstruction(parser.OpPop),         // 0006
+				complier.MakeInstruction(parser.OpPopTry, 1),   // 0007
+				complier.MakeInstruction(parser.OpConstant, 1), // 0009
+				complier.MakeInstruction(parser.OpPop),         // 0012
+				complier.MakeInstruction(parser.OpJump, 27),    // 0013
+				complier.MakeInstruction(parser.OpSetGlobal, 1023),
+				complier.MakeInstruction(parser.OpConstant, 1), // 0019
+				complier.MakeInstruction(parser.OpPop),         // 0022
+				complier.MakeInstruction(parser.OpGetGlobal, 1023),
+				complier.MakeInstruction(parser.OpThrow),    // 0026
+				complier.MakeInstruction(parser.OpSuspend)), // 0027
+			objectsArray(
+				intObject(1),
+				intObject(2))))
+
+	// return pops the error handlers, and, the dead code is removed
+	expectCompile(t, `
+func() {
+	try { return 1 } catch e { return 2 }
+}`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConstant, 2),
+				complier.MakeInstruction(parser.OpPop),
+				complier.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				intObject(2),
+				compiledFunction(1, 0,
+					complier.MakeInstruction(parser.OpTry, 10),
+					complier.MakeInstruction(parser.OpConstant, 0),
+					complier.MakeInstruction(parser.OpPopTry, 1),
+					complier.MakeInstruction(parser.OpReturn, 1),
+					complier.MakeInstruction(parser.OpDefineLocal, 0),
+					complier.MakeInstruction(parser.OpConstant, 1),
+					complier.MakeInstruction(parser.OpReturn, 1)))))
+}
+
+func TestCompilerSwitch(t *testing.T) {
+	// int and string literal cases are compiled to a jump table
+	expectCompile(t, `switch 1 { case 1, 2: 3; case "a": 4 }`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConstant, 0),  // 0000
+				complier.MakeInstruction(parser.OpSwitch, 1, 2), // 0003
+				complier.MakeInstruction(parser.OpJump, 17),     // 0008
+				complier.MakeInstruction(parser.OpJump, 24),     // 0011
+				complier.MakeInstruction(parser.OpJump, 28),     // 0014
+				complier.MakeInstruction(parser.OpConstant, 2),  // 0017
+				complier.MakeInstruction(parser.OpPop),          // 0020
+				complier.MakeInstruction(parser.OpJump, 28),     // 0021
+				complier.MakeInstruction(parser.OpConstant, 3),  // 0024
+				complier.MakeInstruction(parser.OpPop),          // 0027
+				complier.MakeInstruction(parser.OpSuspend)),     // 0028
+			objectsArray(
+				intObject(1),
+				&common.ImmutableMap{Value: map[string]common.Object{
+					"i1": intObject(0),
+					"i2": intObject(0),
+					"sa": intObject(1),
+				}},
+				intObject(3),
+				intObject(4))))
+
+	// the other cases are tested one by one
+	expectCompile(t, `switch x := 1; x { case 1 if x: 2 }`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConstant, 0),     // 0000
+				complier.MakeInstruction(parser.OpSetGlobal, 0),    // 0003
+				complier.MakeInstruction(parser.OpGetGlobal, 0),    // 0006
+				complier.MakeInstruction(parser.OpSetGlobal, 1023), // 0009
+				complier.MakeInstruction(parser.OpGetGlobal, 1023), // 0012
+				complier.MakeInstruction(parser.OpConstant, 0),     // 0015
+				complier.MakeInstruction(parser.OpEqual),           // 0018
+				complier.MakeInstruction(parser.OpJumpFalsy, 32),
+				complier.MakeInstruction(parser.OpGetGlobal, 0), // 0022
+				complier.MakeInstruction(parser.OpJumpFalsy, 32),
+				complier.MakeInstruction(parser.OpConstant, 1), // 0028
+				complier.MakeInstruction(parser.OpPop),         // 0031
+				complier.MakeInstruction(parser.OpSuspend)),    // 0032
+			objectsArray(
+				intObject(1),
+				intObject(2))))
+
+	// type patterns test the types with the builtin functions
+	expectCompile(t, `switch 1 { case int: 2 }`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConstant, 0),     // 0000
+				complier.MakeInstruction(parser.OpSetGlobal, 1023), // 0003
+				complier.MakeInstruction(parser.OpGetBuiltin, 12),
+				complier.MakeInstruction(parser.OpGetGlobal, 1023), // 0008
+				complier.MakeInstruction(parser.OpCall, 1, 0),      // 0011
+				complier.MakeInstruction(parser.OpJumpFalsy, 21),
+				complier.MakeInstruction(parser.OpConstant, 1), // 0017
+				complier.MakeInstruction(parser.OpPop),         // 0020
+				complier.MakeInstruction(parser.OpSuspend)),    // 0021
+			objectsArray(
+				intObject(1),
+				intObject(2))))
+
+	expectCompileError(t, `switch 1 { case 1: case 2, 1: }`,
+		"Compile Error: duplicate case 1 in switch\n\tat test:1:28")
+	expectCompileError(t, `switch 1 { default: default: }`,
+		"Compile Error: multiple defaults in switch\n\tat test:1:21")
+	expectCompileError(t, `switch 1 { case 1: continue }`,
+		"Compile Error: continue not allowed outside loop\n\tat test:1:20")
+
+	// the temporaries of the top-level statements are limited
+	expectCompileError(t, strings.Repeat("switch 1 { case int: ", 65)+
+		strings.Repeat("}", 65), "Compile Error: too many nested statements")
+
+	// and, the user globals cannot take their indexes
+	var globals strings.Builder
+	for i := 0; i < common.GlobalsSize-common.TempGlobals; i++ {
+		fmt.Fprintf(&globals, "a%d := %d\n", i, i)
+	}
+	_, _, err := traceCompile(globals.String(), nil)
+	require.NoError(t, err)
+	expectCompileError(t, globals.String()+"b := 1",
+		"Compile Error: too many global variables\n\tat test:961:1")
+	expectCompileError(t, globals.String()+"for x in [1] {}",
+		"Compile Error: too many global variables")
+}
+
+func TestCompilerDestructuring(t *testing.T) {
+	expectCompile(t, `[a, b = 2] := 1`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConstant, 0),     // 0000
+				complier.MakeInstruction(parser.OpSetGlobal, 1023), // 0003
+				complier.MakeInstruction(parser.OpGetGlobal, 1023), // 0006
+				complier.MakeInstruction(parser.OpConstant, 1),     // 0009
+				complier.MakeInstruction(parser.OpIndex),           // 0012
+				complier.MakeInstruction(parser.OpSetGlobal, 0),    // 0013
+				complier.MakeInstruction(parser.OpGetGlobal, 1023), // 0016
+				complier.MakeInstruction(parser.OpConstant, 0),     // 0019
+				complier.MakeInstruction(parser.OpIndex),           // 0022
+				complier.MakeInstruction(parser.OpDefaultJump, 29),
+				complier.MakeInstruction(parser.OpConstant, 2),  // 0026
+				complier.MakeInstruction(parser.OpSetGlobal, 1), // 0029
+				complier.MakeInstruction(parser.OpSuspend)),     // 0032
+			objectsArray(
+				intObject(1),
+				intObject(0),
+				intObject(2))))
+
+	expectCompile(t, `func() { {a, _: b} := 1 }`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConstant, 3),
+				complier.MakeInstruction(parser.OpPop),
+				complier.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				stringObject("a"),
+				stringObject("_"),
+				compiledFunction(3, 0,
+					complier.MakeInstruction(parser.OpConstant, 0),
+					complier.MakeInstruction(parser.OpDefineLocal, 0),
+					complier.MakeInstruction(parser.OpGetLocal, 0),
+					complier.MakeInstruction(parser.OpConstant, 1),
+					complier.MakeInstruction(parser.OpIndex),
+					complier.MakeInstruction(parser.OpDefineLocal, 1),
+					complier.MakeInstruction(parser.OpGetLocal, 0),
+					complier.MakeInstruction(parser.OpConstant, 2),
+					complier.MakeInstruction(parser.OpIndex),
+					complier.MakeInstruction(parser.OpDefineLocal, 2),
+					complier.MakeInstruction(parser.OpReturn, 0)))))
+
+	expectCompileError(t, `a := 1; [a] := [2]`,
+		"Compile Error: 'a' redeclared in this block\n\tat test:1:9")
+	expectCompileError(t, `a, b := 1, 2`,
+		"Compile Error: tuple assignment not allowed\n\tat test:1:1")
+	expectCompileError(t, `[a] = [1]`,
+		"Compile Error: unresolved reference 'a'\n\tat test:1:1")
+	expectCompileError(t, `a.b, c := [1]`,
+		"Compile Error: operator ':=' not allowed with selector")
+}
+
+func TestCompilerFString(t *testing.T) {
+	expectCompile(t, `a := 1; f"a = ${a}, b = ${a + 1}"`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConstant, 0),
+				complier.MakeInstruction(parser.OpSetGlobal, 0),
+				complier.MakeInstruction(parser.OpConstant, 1),
+				complier.MakeInstruction(parser.OpGetGlobal, 0),
+				complier.MakeInstruction(parser.OpConstant, 2),
+				complier.MakeInstruction(parser.OpGetGlobal, 0),
+				complier.MakeInstruction(parser.OpConstant, 0),
+				complier.MakeInstruction(parser.OpBinaryOp, 11),
+				complier.MakeInstruction(parser.OpConcat, 4),
+				complier.MakeInstruction(parser.OpPop),
+				complier.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				stringObject("a = "),
+				stringObject(", b = "))))
+
+	expectCompile(t, `f"a \${b}"`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConstant, 0),
+				complier.MakeInstruction(parser.OpPop),
+				complier.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				stringObject("a ${b}"))))
+
+	expectCompile(t, `f""`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConcat, 0),
+				complier.MakeInstruction(parser.OpPop),
+				complier.MakeInstruction(parser.OpSuspend)),
+			objectsArray()))
+}
+
+func TestCompilerKeywordArgs(t *testing.T) {
+	expectCompile(t, `f := func(a, b = 2) { return b }; f(1, b: 3)`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConstant, 1),
+				complier.MakeInstruction(parser.OpSetGlobal, 0),
+				complier.MakeInstruction(parser.OpGetGlobal, 0),
+				complier.MakeInstruction(parser.OpConstant, 2),
+				complier.MakeInstruction(parser.OpConstant, 3),
+				complier.MakeInstruction(parser.OpCallKw, 2, 4),
+				complier.MakeInstruction(parser.OpPop),
+				complier.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(2),
+				compiledFunction(2, 2,
+					complier.MakeInstruction(parser.OpGetLocal, 1),
+					complier.MakeInstruction(parser.OpDefaultJump, 8),
+					complier.MakeInstruction(parser.OpConstant, 0),
+					complier.MakeInstruction(parser.OpSetLocal, 1),
+					complier.MakeInstruction(parser.OpGetLocal, 1),
+					complier.MakeInstruction(parser.OpReturn, 1)),
+				intObject(1),
+				intObject(3),
+				&common.ImmutableArray{
+					Value: []common.Object{stringObject("b")},
+				})))
+}
+
+func TestCompilerDefer(t *testing.T) {
+	expectCompile(t, `func(f) { defer f(1, [2]...) }`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConstant, 2),
+				complier.MakeInstruction(parser.OpPop),
+				complier.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				intObject(2),
+				compiledFunction(1, 1,
+					complier.MakeInstruction(parser.OpGetLocal, 0),
+					complier.MakeInstruction(parser.OpConstant, 0),
+					complier.MakeInstruction(parser.OpConstant, 1),
+					complier.MakeInstruction(parser.OpArray, 1),
+					complier.MakeInstruction(parser.OpDefer, 2, 1),
+					complier.MakeInstruction(parser.OpReturn, 0)))))
+
+	expectCompile(t, `func(f) { defer f(1, b: 3) }`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConstant, 3),
+				complier.MakeInstruction(parser.OpPop),
+				complier.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				intObject(1),
+				intObject(3),
+				&common.ImmutableArray{
+					Value: []common.Object{stringObject("b")},
+				},
+				compiledFunction(1, 1,
+					complier.MakeInstruction(parser.OpGetLocal, 0),
+					complier.MakeInstruction(parser.OpConstant, 0),
+					complier.MakeInstruction(parser.OpConstant, 1),
+					complier.MakeInstruction(parser.OpDeferKw, 2, 2),
+					complier.MakeInstruction(parser.OpReturn, 0)))))
+
+	expectCompileError(t, `defer f()`,
+		"Compile Error: defer not allowed outside function\n\tat test:1:1")
+}
+
+func TestCompilerClass(t *testing.T) {
+	expectCompile(t, `class A(x) { func f(self) { return self } }`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConstant, 0),
+				complier.MakeInstruction(parser.OpConstant, 1),
+				complier.MakeInstruction(parser.OpClass, 2),
+				complier.MakeInstruction(parser.OpSetGlobal, 0),
+				complier.MakeInstruction(parser.OpSuspend)),
+			objectsArray(
+				compiledFunction(1, 1,
+					complier.MakeInstruction(parser.OpGetLocal, 0),
+					complier.MakeInstruction(parser.OpInstance, 1),
+					complier.MakeInstruction(parser.OpReturn, 1)),
+				compiledFunction(1, 1,
+					complier.MakeInstruction(parser.OpGetLocal, 0),
+					complier.MakeInstruction(parser.OpReturn, 1)),
+				&common.ImmutableArray{
+					Value: []common.Object{
+						stringObject("A"),
+						stringObject("f"),
+					},
+				})))
+
+	expectCompileError(t, `class A(x) { func x(self) {} }`,
+		"Compile Error: 'x' redeclared in this class\n\tat test:1:19")
+	expectCompileError(t, `class A() { func f() {} }`,
+		"Compile Error: method 'f' has no receiver parameter\n\tat test:1:13")
+}
+
+func TestCompilerOptionalChain(t *testing.T) {
+	expectCompile(t, `a := 1; a?.b[0] ?? 2`,
+		bytecode(
+			concatInsts(
+				complier.MakeInstruction(parser.OpConstant, 0),     // 0000
+				complier.MakeInstruction(parser.OpSetGlobal, 0),    // 0003
+				complier.MakeInstruction(parser.OpGetGlobal, 0),    // 0006
+				complier.MakeInstruction(parser.OpDefaultJump, 16), // 0009
+				complier.MakeInstruction(parser.OpNull),            // 0012
+				complier.MakeInstruction(parser.OpJump, 24),        // 0013
+				complier.MakeInstruction(parser.OpConstant, 1),     // 0016
+				complier.MakeInstruction(parser.OpIndex),           // 0019
+				complier.MakeInstruction(parser.OpConstant, 2),     // 0020
+				complier.MakeInstruction(parser.OpIndex),           // 0023
+				complier.MakeInstruction(parser.OpDefaultJump, 30), // 0024
+				complier.MakeInstruction(parser.OpConstant, 3),     // 0027
+				complier.MakeInstruction(parser.OpPop),             // 0030
+				complier.MakeInstruction(parser.OpSuspend)),        // 0031
+			objectsArray(
+				intObject(1),
+				stringObject("b"),
+				intObject(0),
+				intObject(2))))
+
+	expectCompileError(t, `a := {}; a?.b = 1`,
+		"Compile Error: optional chaining not allowed in assignment\n\tat test:1:10")
+	expectCompileError(t, `a := {}; a.b?.[0] += 1`,
+		"Compile Error: optional chaining not allowed in assignment\n\tat test:1:10")
 }
 
 func TestCompilerDeadCode(t *testing.T) {
@@ -1365,3 +1778,12 @@ func compiledFunction(
 		NumParameters: numParams,
 	}
 }
+
+func generatorFunction(
+	numLocals, numParams int,
+	insts ...[]byte,
+) *common.CompiledFunction {
+	fn := compiledFunction(numLocals, numParams, insts...)
+	fn.Generator = true
+	return fn
+}
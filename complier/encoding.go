@@ -0,0 +1,954 @@
+package complier
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/d5/tengo/v2/common"
+	"github.com/d5/tengo/v2/parser"
+)
+
+// The binary bytecode format written by Bytecode.Encode is:
+//
+//	header      magic "TNGO", format version (uint16, big endian)
+//	file set    base, number of files, each file, index of the last file
+//	file        name, base, size, number of lines, each line offset
+//	main        object (compiled function)
+//	constants   number of constants, each object
+//
+// Unsigned integers (lengths, counts, offsets) are uvarints, signed integers
+// are varints, and, strings and byte slices are a uvarint length followed by
+// the bytes. Each object starts with its type tag (see the tag constants)
+// followed by:
+//
+//	undefined           nothing
+//	bool                1 byte, 0 or 1
+//	int, char           varint
+//	float               IEEE 754 bits (uint64, big endian)
+//	string              string
+//	bytes               byte slice
+//	array               number of elements, each object
+//	map                 number of entries, each key string and object, in the
+//	                    key order
+//	error               object
+//	time                byte slice of time.Time.MarshalBinary
+//	compiled function   instructions, number of locals, number of parameters,
+//	                    varargs (1 byte), each parameter name, number of
+//	                    parameters with defaults, generator (1 byte), number
+//	                    of source map entries, each instruction offset and
+//	                    position, in the offset order
+//	builtin function    name
+//	user function       name, encoding ID
+//	big int             sign (1 byte, 1 if negative), byte slice of the
+//	                    absolute value (big endian)
+//	decimal             big int without the tag, varint scale
+//	set                 number of elements, each object, in the key order
+//	range               varint start, stop and step
+//	class               name, number of fields, each field name, init
+//	                    (compiled function or undefined), number of methods,
+//	                    each name and object, in the name order
+//	instance            class, number of values, each object
+//	bound method        receiver (instance), name, method object
+//	map with entries    map without the tag, number of entries with
+//	                    non-string keys, each key object and value object, in
+//	                    the key order
+//
+// Version 1 does not have the parameter names and the number of parameters
+// with defaults of compiled functions, version 2 does not have the generator
+// flag of compiled functions, and, version 3 does not have the tags from big
+// int on.
+//
+// The same bytecode is always encoded to the same bytes, so the encoded
+// bytecode can be hashed or signed. Compiled functions with free variables
+// cannot be encoded as they only exist at run time, and, user functions can
+// only be encoded if they have an encoding ID to restore them with.
+//
+// EncodeObject writes a single object in the same format, so the values in
+// the storage are encoded to the same bytes as well.
+const (
+	// BytecodeFormatVersion is the version of the binary bytecode format
+	// written by Bytecode.Encode.
+	BytecodeFormatVersion = 4
+
+	bytecodeMagic = "TNGO"
+)
+
+// Type tags of the objects in the binary bytecode format. The values must not
+// be changed.
+const (
+	tagUndefined         byte = 0
+	tagFalse             byte = 1
+	tagTrue              byte = 2
+	tagInt               byte = 3
+	tagFloat             byte = 4
+	tagString            byte = 5
+	tagChar              byte = 6
+	tagBytes             byte = 7
+	tagArray             byte = 8
+	tagImmutableArray    byte = 9
+	tagMap               byte = 10
+	tagImmutableMap      byte = 11
+	tagError             byte = 12
+	tagTime              byte = 13
+	tagCompiledFunction  byte = 14
+	tagBuiltinFunction   byte = 15
+	tagUserFunction      byte = 16
+	tagBigInt            byte = 17
+	tagDecimal           byte = 18
+	tagSet               byte = 19
+	tagImmutableSet      byte = 20
+	tagRange             byte = 21
+	tagClass             byte = 22
+	tagInstance          byte = 23
+	tagBoundMethod       byte = 24
+	tagEntryMap          byte = 25
+	tagImmutableEntryMap byte = 26
+)
+
+// ErrUnsupportedFormatVersion is returned when decoding the bytecode of a
+// newer format version.
+var ErrUnsupportedFormatVersion = errors.New(
+	"unsupported bytecode format version")
+
+// EncodeObject writes the object to the writer in the binary bytecode format:
+// the header followed by the object.
+func EncodeObject(w io.Writer, o common.Object) error {
+	e := &encoder{w: bufio.NewWriter(w)}
+	e.writeHeader()
+	e.writeObject(o)
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+// DecodeObject reads an object written by EncodeObject, or, an object encoded
+// by gob as the older versions of Tengo stored them. Modules are used to
+// restore builtin module values (see FixDecodedObject).
+func DecodeObject(
+	r io.Reader,
+	modules *common.ModuleMap,
+) (common.Object, error) {
+	if modules == nil {
+		modules = common.NewModuleMap()
+	}
+	br := bufio.NewReader(r)
+	var o common.Object
+	if isBinaryFormat(br) {
+		version, err := readHeader(br)
+		if err != nil {
+			return nil, err
+		}
+		d := &decoder{r: br, version: version}
+		if o, err = d.readObject(); err != nil {
+			return nil, err
+		}
+	} else if err := gob.NewDecoder(br).Decode(&o); err != nil {
+		return nil, err
+	}
+	return FixDecodedObject(o, modules)
+}
+
+type encoder struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (e *encoder) write(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *encoder) writeByte(b byte) {
+	if e.err == nil {
+		e.err = e.w.WriteByte(b)
+	}
+}
+
+func (e *encoder) writeUvarint(v uint64) {
+	n := binary.PutUvarint(e.buf[:], v)
+	e.write(e.buf[:n])
+}
+
+func (e *encoder) writeVarint(v int64) {
+	n := binary.PutVarint(e.buf[:], v)
+	e.write(e.buf[:n])
+}
+
+func (e *encoder) writeInt(v int) {
+	e.writeUvarint(uint64(v))
+}
+
+func (e *encoder) writeBytes(b []byte) {
+	e.writeInt(len(b))
+	e.write(b)
+}
+
+func (e *encoder) writeString(s string) {
+	e.writeInt(len(s))
+	if e.err == nil {
+		_, e.err = e.w.WriteString(s)
+	}
+}
+
+func (e *encoder) writeHeader() {
+	var version [2]byte
+	binary.BigEndian.PutUint16(version[:], BytecodeFormatVersion)
+	e.write([]byte(bytecodeMagic))
+	e.write(version[:])
+}
+
+func (e *encoder) writeFileSet(s *parser.SourceFileSet) {
+	if s == nil {
+		s = parser.NewFileSet()
+	}
+	e.writeInt(s.Base)
+	e.writeInt(len(s.Files))
+	lastFile := -1
+	for i, f := range s.Files {
+		e.writeString(f.Name)
+		e.writeInt(f.Base)
+		e.writeInt(f.Size)
+		e.writeInt(len(f.Lines))
+		for _, l := range f.Lines {
+			e.writeInt(l)
+		}
+		if f == s.LastFile {
+			lastFile = i
+		}
+	}
+	e.writeVarint(int64(lastFile))
+}
+
+func (e *encoder) writeObject(o common.Object) {
+	if e.err != nil {
+		return
+	}
+	switch o := o.(type) {
+	case *common.Undefined:
+		e.writeByte(tagUndefined)
+	case *common.Bool:
+		if o.IsFalsy() {
+			e.writeByte(tagFalse)
+		} else {
+			e.writeByte(tagTrue)
+		}
+	case *common.Int:
+		e.writeByte(tagInt)
+		e.writeVarint(o.Value)
+	case *common.Float:
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], math.Float64bits(o.Value))
+		e.writeByte(tagFloat)
+		e.write(b[:])
+	case *common.String:
+		e.writeByte(tagString)
+		e.writeString(o.Value)
+	case *common.Char:
+		e.writeByte(tagChar)
+		e.writeVarint(int64(o.Value))
+	case *common.Bytes:
+		e.writeByte(tagBytes)
+		e.writeBytes(o.Value)
+	case *common.Array:
+		e.writeByte(tagArray)
+		e.writeObjects(o.Value)
+	case *common.ImmutableArray:
+		e.writeByte(tagImmutableArray)
+		e.writeObjects(o.Value)
+	case *common.Map:
+		if len(o.Entries) > 0 {
+			e.writeByte(tagEntryMap)
+			e.writeObjectMap(o.Value)
+			e.writeMapEntries(o.Entries)
+			return
+		}
+		e.writeByte(tagMap)
+		e.writeObjectMap(o.Value)
+	case *common.ImmutableMap:
+		if len(o.Entries) > 0 {
+			e.writeByte(tagImmutableEntryMap)
+			e.writeObjectMap(o.Value)
+			e.writeMapEntries(o.Entries)
+			return
+		}
+		e.writeByte(tagImmutableMap)
+		e.writeObjectMap(o.Value)
+	case *common.Error:
+		e.writeByte(tagError)
+		e.writeObject(o.Value)
+	case *common.Time:
+		b, err := o.Value.MarshalBinary()
+		if err != nil {
+			e.err = err
+			return
+		}
+		e.writeByte(tagTime)
+		e.writeBytes(b)
+	case *common.CompiledFunction:
+		e.writeCompiledFunction(o)
+	case *common.BuiltinFunction:
+		e.writeByte(tagBuiltinFunction)
+		e.writeString(o.Name)
+	case *common.UserFunction:
+		if o.EncodingID == "" {
+			e.err = fmt.Errorf("user function not encodable: %s", o.Name)
+			return
+		}
+		e.writeByte(tagUserFunction)
+		e.writeString(o.Name)
+		e.writeString(o.EncodingID)
+	case *common.BigInt:
+		e.writeByte(tagBigInt)
+		e.writeBigInt(o.Value)
+	case *common.Decimal:
+		e.writeByte(tagDecimal)
+		e.writeBigInt(o.Value)
+		e.writeVarint(int64(o.Scale))
+	case *common.Set:
+		e.writeByte(tagSet)
+		e.writeObjectSet(o.Value)
+	case *common.ImmutableSet:
+		e.writeByte(tagImmutableSet)
+		e.writeObjectSet(o.Value)
+	case *common.Range:
+		e.writeByte(tagRange)
+		e.writeVarint(o.Start)
+		e.writeVarint(o.Stop)
+		e.writeVarint(o.Step)
+	case *common.Class:
+		e.writeByte(tagClass)
+		e.writeString(o.Name)
+		e.writeInt(len(o.Fields))
+		for _, f := range o.Fields {
+			e.writeString(f)
+		}
+		if o.Init != nil {
+			e.writeCompiledFunction(o.Init)
+		} else {
+			e.writeByte(tagUndefined)
+		}
+		e.writeObjectMap(o.Methods)
+	case *common.Instance:
+		e.writeByte(tagInstance)
+		e.writeObject(o.Class)
+		e.writeObjects(o.Values)
+	case *common.BoundMethod:
+		e.writeByte(tagBoundMethod)
+		e.writeObject(o.Receiver)
+		e.writeString(o.Name)
+		e.writeObject(o.Method)
+	default:
+		e.err = fmt.Errorf("unsupported object type: %s", o.TypeName())
+	}
+}
+
+func (e *encoder) writeCompiledFunction(o *common.CompiledFunction) {
+	if len(o.Free) > 0 {
+		e.err = errors.New("compiled function with free variables " +
+			"not encodable")
+		return
+	}
+	e.writeByte(tagCompiledFunction)
+	e.writeBytes(o.Instructions)
+	e.writeInt(o.NumLocals)
+	e.writeInt(o.NumParameters)
+	if o.VarArgs {
+		e.writeByte(1)
+	} else {
+		e.writeByte(0)
+	}
+	for i := 0; i < o.NumParameters; i++ {
+		if i < len(o.ParamNames) {
+			e.writeString(o.ParamNames[i])
+		} else {
+			e.writeString("")
+		}
+	}
+	e.writeInt(o.NumDefaults)
+	if o.Generator {
+		e.writeByte(1)
+	} else {
+		e.writeByte(0)
+	}
+	ips := make([]int, 0, len(o.SourceMap))
+	for ip := range o.SourceMap {
+		ips = append(ips, ip)
+	}
+	sort.Ints(ips)
+	e.writeInt(len(ips))
+	for _, ip := range ips {
+		e.writeInt(ip)
+		e.writeInt(int(o.SourceMap[ip]))
+	}
+}
+
+func (e *encoder) writeObjects(objs []common.Object) {
+	e.writeInt(len(objs))
+	for _, o := range objs {
+		e.writeObject(o)
+	}
+}
+
+func (e *encoder) writeObjectMap(m map[string]common.Object) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	e.writeInt(len(keys))
+	for _, k := range keys {
+		e.writeString(k)
+		e.writeObject(m[k])
+	}
+}
+
+func (e *encoder) writeObjectSet(m map[string]common.Object) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	e.writeInt(len(keys))
+	for _, k := range keys {
+		e.writeObject(m[k])
+	}
+}
+
+func (e *encoder) writeMapEntries(entries map[string]common.MapEntry) {
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	e.writeInt(len(keys))
+	for _, k := range keys {
+		e.writeObject(entries[k].Key)
+		e.writeObject(entries[k].Value)
+	}
+}
+
+func (e *encoder) writeBigInt(v *big.Int) {
+	if v == nil {
+		v = new(big.Int)
+	}
+	if v.Sign() < 0 {
+		e.writeByte(1)
+	} else {
+		e.writeByte(0)
+	}
+	e.writeBytes(v.Bytes())
+}
+
+type decoder struct {
+	r       *bufio.Reader
+	version uint16
+}
+
+func (d *decoder) readByte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+func (d *decoder) readUvarint() (uint64, error) {
+	v, err := binary.ReadUvarint(d.r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return v, err
+}
+
+func (d *decoder) readVarint() (int64, error) {
+	v, err := binary.ReadVarint(d.r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return v, err
+}
+
+func (d *decoder) readInt() (int, error) {
+	v, err := d.readUvarint()
+	if err != nil {
+		return 0, err
+	}
+	if v > math.MaxInt32 {
+		return 0, fmt.Errorf("invalid length: %d", v)
+	}
+	return int(v), nil
+}
+
+func (d *decoder) readBytes() ([]byte, error) {
+	n, err := d.readInt()
+	if err != nil {
+		return nil, err
+	}
+	// the buffer grows with the data read, so a corrupted length cannot
+	// allocate more than the size of the input
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *decoder) readString() (string, error) {
+	b, err := d.readBytes()
+	return string(b), err
+}
+
+func (d *decoder) readFileSet() (*parser.SourceFileSet, error) {
+	base, err := d.readInt()
+	if err != nil {
+		return nil, err
+	}
+	numFiles, err := d.readInt()
+	if err != nil {
+		return nil, err
+	}
+	s := parser.NewFileSet()
+	for i := 0; i < numFiles; i++ {
+		name, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		fileBase, err := d.readInt()
+		if err != nil {
+			return nil, err
+		}
+		size, err := d.readInt()
+		if err != nil {
+			return nil, err
+		}
+		if fileBase < s.Base {
+			return nil, fmt.Errorf("invalid file base: %d", fileBase)
+		}
+		f := s.AddFile(name, fileBase, size)
+		numLines, err := d.readInt()
+		if err != nil {
+			return nil, err
+		}
+		f.Lines = make([]int, numLines)
+		for j := range f.Lines {
+			if f.Lines[j], err = d.readInt(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	lastFile, err := d.readVarint()
+	if err != nil {
+		return nil, err
+	}
+	s.LastFile = nil
+	if lastFile >= 0 && lastFile < int64(len(s.Files)) {
+		s.LastFile = s.Files[lastFile]
+	}
+	s.Base = base
+	return s, nil
+}
+
+func (d *decoder) readObject() (common.Object, error) {
+	tag, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	switch tag {
+	case tagUndefined:
+		return common.UndefinedValue, nil
+	case tagFalse:
+		return common.FalseValue, nil
+	case tagTrue:
+		return common.TrueValue, nil
+	case tagInt:
+		v, err := d.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		return &common.Int{Value: v}, nil
+	case tagFloat:
+		var b [8]byte
+		if _, err := io.ReadFull(d.r, b[:]); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return &common.Float{
+			Value: math.Float64frombits(binary.BigEndian.Uint64(b[:])),
+		}, nil
+	case tagString:
+		v, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		return &common.String{Value: v}, nil
+	case tagChar:
+		v, err := d.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		return &common.Char{Value: rune(v)}, nil
+	case tagBytes:
+		v, err := d.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return &common.Bytes{Value: v}, nil
+	case tagArray:
+		v, err := d.readObjects()
+		if err != nil {
+			return nil, err
+		}
+		return &common.Array{Value: v}, nil
+	case tagImmutableArray:
+		v, err := d.readObjects()
+		if err != nil {
+			return nil, err
+		}
+		return &common.ImmutableArray{Value: v}, nil
+	case tagMap:
+		v, err := d.readObjectMap()
+		if err != nil {
+			return nil, err
+		}
+		return &common.Map{Value: v}, nil
+	case tagImmutableMap:
+		v, err := d.readObjectMap()
+		if err != nil {
+			return nil, err
+		}
+		return &common.ImmutableMap{Value: v}, nil
+	case tagError:
+		v, err := d.readObject()
+		if err != nil {
+			return nil, err
+		}
+		return &common.Error{Value: v}, nil
+	case tagTime:
+		b, err := d.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		t := &common.Time{}
+		if err := t.Value.UnmarshalBinary(b); err != nil {
+			return nil, err
+		}
+		return t, nil
+	case tagCompiledFunction:
+		return d.readCompiledFunction()
+	case tagBuiltinFunction:
+		name, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		return &common.BuiltinFunction{Name: name}, nil
+	case tagUserFunction:
+		name, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		id, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		return &common.UserFunction{Name: name, EncodingID: id}, nil
+	case tagBigInt:
+		v, err := d.readBigInt()
+		if err != nil {
+			return nil, err
+		}
+		return &common.BigInt{Value: v}, nil
+	case tagDecimal:
+		v, err := d.readBigInt()
+		if err != nil {
+			return nil, err
+		}
+		scale, err := d.readVarint()
+		if err != nil {
+			return nil, err
+		}
+		return &common.Decimal{Value: v, Scale: int(scale)}, nil
+	case tagSet, tagImmutableSet:
+		elems, err := d.readObjects()
+		if err != nil {
+			return nil, err
+		}
+		s, ok := common.NewSet(elems...)
+		if !ok {
+			return nil, errors.New("invalid set element")
+		}
+		if tag == tagImmutableSet {
+			return &common.ImmutableSet{Value: s.Value}, nil
+		}
+		return s, nil
+	case tagRange:
+		var v [3]int64
+		for i := range v {
+			if v[i], err = d.readVarint(); err != nil {
+				return nil, err
+			}
+		}
+		return &common.Range{Start: v[0], Stop: v[1], Step: v[2]}, nil
+	case tagClass:
+		return d.readClass()
+	case tagInstance:
+		return d.readInstance()
+	case tagBoundMethod:
+		o, err := d.readObject()
+		if err != nil {
+			return nil, err
+		}
+		recv, ok := o.(*common.Instance)
+		if !ok {
+			return nil, fmt.Errorf("invalid bound method receiver: %s",
+				o.TypeName())
+		}
+		name, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		method, err := d.readObject()
+		if err != nil {
+			return nil, err
+		}
+		return &common.BoundMethod{
+			Receiver: recv,
+			Name:     name,
+			Method:   method,
+		}, nil
+	case tagEntryMap, tagImmutableEntryMap:
+		v, err := d.readObjectMap()
+		if err != nil {
+			return nil, err
+		}
+		entries, err := d.readMapEntries()
+		if err != nil {
+			return nil, err
+		}
+		if tag == tagImmutableEntryMap {
+			return &common.ImmutableMap{Value: v, Entries: entries}, nil
+		}
+		return &common.Map{Value: v, Entries: entries}, nil
+	default:
+		return nil, fmt.Errorf("unknown object type tag: %d", tag)
+	}
+}
+
+func (d *decoder) readCompiledFunction() (*common.CompiledFunction, error) {
+	var err error
+	fn := &common.CompiledFunction{}
+	if fn.Instructions, err = d.readBytes(); err != nil {
+		return nil, err
+	}
+	if fn.NumLocals, err = d.readInt(); err != nil {
+		return nil, err
+	}
+	if fn.NumParameters, err = d.readInt(); err != nil {
+		return nil, err
+	}
+	varArgs, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	fn.VarArgs = varArgs == 1
+	if d.version >= 2 {
+		fn.ParamNames = make([]string, fn.NumParameters)
+		for i := range fn.ParamNames {
+			if fn.ParamNames[i], err = d.readString(); err != nil {
+				return nil, err
+			}
+		}
+		if fn.NumDefaults, err = d.readInt(); err != nil {
+			return nil, err
+		}
+	}
+	if d.version >= 3 {
+		generator, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+		fn.Generator = generator == 1
+	}
+	n, err := d.readInt()
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		fn.SourceMap = make(map[int]parser.Pos, n)
+	}
+	for i := 0; i < n; i++ {
+		ip, err := d.readInt()
+		if err != nil {
+			return nil, err
+		}
+		pos, err := d.readInt()
+		if err != nil {
+			return nil, err
+		}
+		fn.SourceMap[ip] = parser.Pos(pos)
+	}
+	return fn, nil
+}
+
+func (d *decoder) readClass() (*common.Class, error) {
+	var err error
+	c := &common.Class{}
+	if c.Name, err = d.readString(); err != nil {
+		return nil, err
+	}
+	n, err := d.readInt()
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < n; i++ {
+		f, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		c.Fields = append(c.Fields, f)
+	}
+	init, err := d.readObject()
+	if err != nil {
+		return nil, err
+	}
+	switch init := init.(type) {
+	case *common.CompiledFunction:
+		c.Init = init
+	case *common.Undefined:
+	default:
+		return nil, fmt.Errorf("invalid class init: %s", init.TypeName())
+	}
+	if c.Methods, err = d.readObjectMap(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (d *decoder) readInstance() (*common.Instance, error) {
+	o, err := d.readObject()
+	if err != nil {
+		return nil, err
+	}
+	c, ok := o.(*common.Class)
+	if !ok {
+		return nil, fmt.Errorf("invalid instance class: %s", o.TypeName())
+	}
+	values, err := d.readObjects()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) != len(c.Fields) {
+		return nil, fmt.Errorf("invalid number of instance values: %d",
+			len(values))
+	}
+	return &common.Instance{Class: c, Values: values}, nil
+}
+
+func (d *decoder) readBigInt() (*big.Int, error) {
+	neg, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	b, err := d.readBytes()
+	if err != nil {
+		return nil, err
+	}
+	v := new(big.Int).SetBytes(b)
+	if neg == 1 {
+		v.Neg(v)
+	}
+	return v, nil
+}
+
+func (d *decoder) readMapEntries() (map[string]common.MapEntry, error) {
+	n, err := d.readInt()
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]common.MapEntry, n)
+	for i := 0; i < n; i++ {
+		k, err := d.readObject()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.readObject()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := common.MapKey(k)
+		if !ok {
+			return nil, fmt.Errorf("invalid map key: %s", k.TypeName())
+		}
+		entries[key] = common.MapEntry{Key: k, Value: v}
+	}
+	return entries, nil
+}
+
+func (d *decoder) readObjects() ([]common.Object, error) {
+	n, err := d.readInt()
+	if err != nil {
+		return nil, err
+	}
+	var objs []common.Object
+	for i := 0; i < n; i++ {
+		o, err := d.readObject()
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, o)
+	}
+	return objs, nil
+}
+
+func (d *decoder) readObjectMap() (map[string]common.Object, error) {
+	n, err := d.readInt()
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]common.Object)
+	for i := 0; i < n; i++ {
+		k, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		o, err := d.readObject()
+		if err != nil {
+			return nil, err
+		}
+		m[k] = o
+	}
+	return m, nil
+}
+
+// readHeader reads the header of the binary bytecode format, and, returns the
+// format version.
+func readHeader(r io.Reader) (uint16, error) {
+	var header [len(bytecodeMagic) + 2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, err
+	}
+	version := binary.BigEndian.Uint16(header[len(bytecodeMagic):])
+	if version > BytecodeFormatVersion {
+		return 0, ErrUnsupportedFormatVersion
+	}
+	return version, nil
+}
+
+// isBinaryFormat returns true if the reader starts with the magic header of
+// the binary bytecode format. Otherwise, it's a bytecode encoded by gob.
+func isBinaryFormat(r *bufio.Reader) bool {
+	b, _ := r.Peek(len(bytecodeMagic))
+	return bytes.Equal(b, []byte(bytecodeMagic))
+}
@@ -1,5 +1,7 @@
 package complier
 
+import "github.com/d5/tengo/v2/common"
+
 // SymbolScope represents a symbol scope.
 type SymbolScope string
 
@@ -28,6 +30,7 @@ type SymbolTable struct {
 	maxDefinition  int
 	freeSymbols    []*Symbol
 	builtinSymbols []*Symbol
+	numTemps       int
 }
 
 // NewSymbolTable creates a SymbolTable.
@@ -63,6 +66,48 @@ func (t *SymbolTable) Define(name string) *Symbol {
 	return symbol
 }
 
+// DefineTemp adds a symbol for a hidden temporary value of a statement. It's
+// not added to the scope, so it cannot be resolved by name. In the global
+// scope, the temporaries take the last common.TempGlobals global variables
+// instead of the indexes of the user variables, and, it returns false if
+// there are too many of them. ReleaseTemp must be called on the symbol when
+// the statement is compiled.
+func (t *SymbolTable) DefineTemp(name string) (*Symbol, bool) {
+	if t.Parent(true) != nil {
+		symbol := &Symbol{Name: name, Index: t.nextIndex(), Scope: ScopeLocal}
+		t.numDefinition++
+		t.updateMaxDefs(symbol.Index + 1)
+		return symbol, true
+	}
+	root := t
+	for root.parent != nil {
+		root = root.parent
+	}
+	if root.numTemps >= common.TempGlobals {
+		return nil, false
+	}
+	root.numTemps++
+	return &Symbol{
+		Name:  name,
+		Index: common.GlobalsSize - root.numTemps,
+		Scope: ScopeGlobal,
+	}, true
+}
+
+// ReleaseTemp frees the global variable of the temporary symbol defined by
+// DefineTemp, so it can be used by the next statement. The temporaries must
+// be released in the reverse order of the definitions.
+func (t *SymbolTable) ReleaseTemp(symbol *Symbol) {
+	if symbol.Scope != ScopeGlobal {
+		return
+	}
+	root := t
+	for root.parent != nil {
+		root = root.parent
+	}
+	root.numTemps--
+}
+
 // DefineBuiltin adds a symbol for builtin function.
 func (t *SymbolTable) DefineBuiltin(index int, name string) *Symbol {
 	if t.parent != nil {
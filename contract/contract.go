@@ -0,0 +1,321 @@
+package contract
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/d5/tengo/v2/common"
+	"github.com/d5/tengo/v2/complier"
+	"github.com/d5/tengo/v2/scripts"
+	"github.com/d5/tengo/v2/storage"
+	"github.com/d5/tengo/v2/vm"
+)
+
+// exportsName is the global variable that the exported value of a contract is
+// assigned to. It's the only variable added to the contract scripts, so its
+// global index is always exportsIndex.
+const (
+	exportsName  = "__exports__"
+	exportsIndex = 0
+)
+
+// DefaultMaxCallDepth is the default maximum depth of the nested contract
+// calls.
+const DefaultMaxCallDepth = 16
+
+var (
+	// ErrContractExists is returned when deploying a contract to an address
+	// that already has a contract.
+	ErrContractExists = errors.New("contract already exists")
+
+	// ErrContractNotFound is returned when invoking a contract that is not
+	// deployed.
+	ErrContractNotFound = errors.New("contract not found")
+
+	// ErrCallDepthExceeded is returned when the nested contract calls exceed
+	// the maximum call depth.
+	ErrCallDepthExceeded = errors.New("call depth exceeded")
+
+	// ErrReentrantCall is returned when a contract calls a contract that is
+	// already in the call stack.
+	ErrReentrantCall = errors.New("reentrant call")
+
+	// ErrNotPlainData is returned when a contract call passes or returns a
+	// value that cannot cross contracts, e.g. a function or a generator that
+	// runs on the VM of the contract that created it.
+	ErrNotPlainData = errors.New("value cannot be passed between contracts")
+)
+
+// Runtime deploys contracts to a DB and invokes their exported functions. A
+// contract is a script that exports a map of functions: the top-level code of
+// the script is run once on the deployment, and, the exported functions are
+// the entry points that can be invoked. The global variables of the contract
+// are persisted, and, every deployment and invocation is executed in a
+// storage transaction in the deterministic and the checked arithmetic modes.
+type Runtime struct {
+	db           storage.DB
+	modules      *common.ModuleMap
+	gasLimit     int64
+	gasSchedule  *vm.GasSchedule
+	gasUsed      int64
+	maxCallDepth int
+	lock         sync.Mutex
+}
+
+// NewRuntime creates a Runtime that stores the contracts in db. Modules are
+// the modules that the contracts can import, in addition to the "contract"
+// module which is always available.
+func NewRuntime(db storage.DB, modules *common.ModuleMap) *Runtime {
+	if modules == nil {
+		modules = common.NewModuleMap()
+	}
+	return &Runtime{
+		db:           db,
+		modules:      modules,
+		gasLimit:     -1,
+		maxCallDepth: DefaultMaxCallDepth,
+	}
+}
+
+// SetGasLimit sets the maximum amount of gas that a deployment or an
+// invocation can use, including the gas used by the contracts it calls. Set
+// this to a negative number (default) to disable the limit.
+func (r *Runtime) SetGasLimit(n int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.gasLimit = n
+}
+
+// SetGasSchedule sets the gas cost table. vm.DefaultGasSchedule is used if
+// it's not set.
+func (r *Runtime) SetGasSchedule(schedule *vm.GasSchedule) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.gasSchedule = schedule
+}
+
+// SetMaxCallDepth sets the maximum depth of the nested contract calls.
+func (r *Runtime) SetMaxCallDepth(n int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.maxCallDepth = n
+}
+
+// GasUsed returns the gas used by the last deployment or invocation.
+func (r *Runtime) GasUsed() int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.gasUsed
+}
+
+// Deploy compiles the contract source, stores its bytecode under the address,
+// and, runs its top-level code. Nothing is stored if the compilation or the
+// run fails.
+func (r *Runtime) Deploy(address string, src []byte) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.gasUsed = 0
+	c, err := r.newCall(nil, address)
+	if err != nil {
+		return err
+	}
+	err = c.deploy(src)
+	if c.vm != nil {
+		r.gasUsed = c.vm.GasUsed()
+	}
+	return err
+}
+
+// Invoke calls the exported function fn of the contract at the address with
+// args, and, returns its result. Args are converted by common.FromInterface.
+// The writes of the call are discarded if it fails.
+func (r *Runtime) Invoke(
+	address string,
+	fn string,
+	args ...interface{},
+) (common.Object, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.gasUsed = 0
+	objs := make([]common.Object, len(args))
+	for i, arg := range args {
+		obj, err := common.FromInterface(arg)
+		if err != nil {
+			return nil, err
+		}
+		objs[i] = obj
+	}
+
+	c, err := r.newCall(nil, address)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.invoke(fn, objs)
+	if c.vm != nil {
+		r.gasUsed = c.vm.GasUsed()
+	}
+	return res, err
+}
+
+// StateRoot returns the root hash of the Merkle tree over the storage of the
+// contract at the address, as of its last deployment or invocation that
+// wrote to the storage.
+func (r *Runtime) StateRoot(address string) ([]byte, error) {
+	st, err := storage.New(address, r.db)
+	if err != nil {
+		return nil, err
+	}
+	root, err := st.StateRoot()
+	if err == storage.NotFoundErr {
+		return nil, ErrContractNotFound
+	}
+	return root, err
+}
+
+// callContext is the host context of a deployment or an invocation. It's
+// bound to the "contract" module imported by the contract, so the calls to
+// other contracts share its gas budget and storage transaction.
+type callContext struct {
+	runtime *Runtime
+	parent  *callContext
+	address string
+	depth   int
+	storage *storage.Storage
+	modules *common.ModuleMap
+	vm      *vm.VM
+}
+
+// newCall creates the context of a call to the contract at the address. The
+// storage of a nested call writes to the transaction of its caller, so its
+// writes are discarded if any of the callers fails.
+func (r *Runtime) newCall(
+	parent *callContext,
+	address string,
+) (*callContext, error) {
+	c := &callContext{
+		runtime: r,
+		parent:  parent,
+		address: address,
+	}
+	db := r.db
+	if parent != nil {
+		c.depth = parent.depth + 1
+		if c.depth > r.maxCallDepth {
+			return nil, ErrCallDepthExceeded
+		}
+		for p := parent; p != nil; p = p.parent {
+			if p.address == address {
+				return nil, ErrReentrantCall
+			}
+		}
+		db = parent.storage.DB()
+	}
+
+	st, err := storage.New(address, db)
+	if err != nil {
+		return nil, err
+	}
+	c.storage = st
+	c.modules = r.modules.Copy()
+	c.modules.AddBuiltinModule(moduleName, c.module())
+	st.SetImports(c.modules)
+	return c, nil
+}
+
+func (c *callContext) deploy(src []byte) error {
+	if _, err := c.storage.LoadByteCode(); err == nil {
+		return ErrContractExists
+	} else if err != storage.NotFoundErr {
+		return err
+	}
+
+	s := scripts.NewScript(src)
+	if err := s.Add(exportsName, nil); err != nil {
+		return err
+	}
+	s.SetImports(c.modules)
+	s.SetExportName(exportsName)
+	s.EnableDeterministic(true)
+	s.EnableCheckedArithmetic(true)
+	compiled, err := s.Compile()
+	if err != nil {
+		return err
+	}
+
+	c.storage.Begin()
+	bytecode := compiled.Bytecode()
+	if err := c.storage.SaveBytecode(bytecode); err != nil {
+		c.storage.Rollback()
+		return err
+	}
+	if err := c.newVM(bytecode).Run(); err != nil {
+		c.storage.Rollback()
+		return err
+	}
+	exports, err := c.storage.GetGlobal(exportsIndex)
+	if err == nil || err == storage.NotFoundErr {
+		if _, ok := exports.(*common.ImmutableMap); !ok {
+			err = fmt.Errorf("contract must export a map of functions")
+		}
+	}
+	if err != nil {
+		c.storage.Rollback()
+		return err
+	}
+	return c.storage.Commit()
+}
+
+func (c *callContext) invoke(
+	fn string,
+	args []common.Object,
+) (common.Object, error) {
+	bytecode, err := c.storage.LoadBytecode(c.modules)
+	if err == storage.NotFoundErr {
+		return nil, ErrContractNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	exports, err := c.storage.GetGlobal(exportsIndex)
+	if err != nil {
+		return nil, err
+	}
+	var entry *common.CompiledFunction
+	if exports, ok := exports.(*common.ImmutableMap); ok {
+		entry, _ = exports.Value[fn].(*common.CompiledFunction)
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("function '%s' not exported", fn)
+	}
+	return c.newVM(bytecode).RunCompiled(entry, args...)
+}
+
+// newVM creates the VM that runs the bytecode of the contract. A nested call
+// can use up to the gas left to its caller.
+func (c *callContext) newVM(bytecode *complier.Bytecode) *vm.VM {
+	// globals that were never persisted are undefined
+	globals := make([]common.Object, common.GlobalsSize)
+	for i := range globals {
+		globals[i] = common.UndefinedValue
+	}
+	v := vm.NewVM(bytecode, globals, -1)
+	v.SetStorage(c.storage)
+	v.SetDeterministic(true)
+	v.SetCheckedArithmetic(true)
+	r := c.runtime
+	if r.gasSchedule != nil || r.gasLimit >= 0 {
+		limit := r.gasLimit
+		if c.parent != nil {
+			limit = c.parent.vm.GasLeft()
+		}
+		v.SetGasLimit(limit, r.gasSchedule)
+	}
+	c.vm = v
+	return v
+}
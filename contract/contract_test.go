@@ -0,0 +1,372 @@
+package contract_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/d5/tengo/v2/common"
+	"github.com/d5/tengo/v2/contract"
+	"github.com/d5/tengo/v2/require"
+	"github.com/d5/tengo/v2/stdlib"
+	"github.com/d5/tengo/v2/storage"
+)
+
+const tokenSrc = `
+text := import("text")
+
+balances := {}
+total := 0
+
+mint := func(to, amount) {
+	balances[to] = (balances[to] || 0) + amount
+	total += amount
+}
+
+mint("owner", 100)
+
+export {
+	transfer: func(from, to, amount) {
+		if (balances[from] || 0) < amount {
+			return error("insufficient balance")
+		}
+		balances[from] -= amount
+		balances[to] = (balances[to] || 0) + amount
+		return true
+	},
+	balance: func(owner) { return balances[owner] || 0 },
+	total: func() { return total },
+	name: func() { return text.to_upper("token") },
+	fail: func(to) {
+		mint(to, 1)
+		return "a" - 1
+	}
+}`
+
+func TestRuntime(t *testing.T) {
+	db := storage.NewMemDB()
+	r := contract.NewRuntime(db, stdlib.GetModuleMap("text"))
+	require.NoError(t, r.Deploy("token", []byte(tokenSrc)))
+	require.Equal(t, contract.ErrContractExists,
+		r.Deploy("token", []byte(tokenSrc)))
+
+	expectInvoke(t, r, "token", "balance", int64(100), "owner")
+	expectInvoke(t, r, "token", "name", "TOKEN")
+	expectInvoke(t, r, "token", "transfer", true, "owner", "bob", 30)
+	expectInvoke(t, r, "token", "balance", int64(70), "owner")
+	expectInvoke(t, r, "token", "balance", int64(30), "bob")
+	res, err := r.Invoke("token", "transfer", "bob", "alice", 50)
+	require.NoError(t, err)
+	require.Equal(t, `error: "insufficient balance"`, res.String())
+
+	// state is shared by the runtimes on the same DB
+	root, err := r.StateRoot("token")
+	require.NoError(t, err)
+	r = contract.NewRuntime(db, stdlib.GetModuleMap("text"))
+	expectInvoke(t, r, "token", "balance", int64(30), "bob")
+	expectInvoke(t, r, "token", "total", int64(100))
+	root2, err := r.StateRoot("token")
+	require.NoError(t, err)
+	require.Equal(t, root, root2)
+	_, err = r.StateRoot("none")
+	require.Equal(t, contract.ErrContractNotFound, err)
+
+	// writes of a failed call are discarded
+	_, err = r.Invoke("token", "fail", "bob")
+	require.Error(t, err)
+	expectInvoke(t, r, "token", "balance", int64(30), "bob")
+	expectInvoke(t, r, "token", "total", int64(100))
+
+	_, err = r.Invoke("token", "unknown")
+	require.Error(t, err)
+	_, err = r.Invoke("token", "balance")
+	require.Error(t, err)
+	_, err = r.Invoke("none", "balance", "bob")
+	require.Equal(t, contract.ErrContractNotFound, err)
+
+	// gas
+	r.SetGasLimit(20)
+	_, err = r.Invoke("token", "total")
+	require.NoError(t, err)
+	require.True(t, r.GasUsed() > 0)
+	_, err = r.Invoke("token", "transfer", "owner", "bob", 1)
+	require.True(t, errors.As(err, &common.ErrOutOfGas{}))
+	r.SetGasLimit(-1)
+	expectInvoke(t, r, "token", "balance", int64(70), "owner")
+}
+
+func TestRuntime_StateRoot(t *testing.T) {
+	// the maps and the sets have enough keys for Go to iterate them in
+	// different orders
+	src := []byte(`
+class P(x, y) {
+	func sum(self) { return self.x + self.y }
+}
+
+m := {}
+ints := {}
+elems := []
+for i := 0; i < 50; i++ {
+	m["k" + string(i)] = i
+	ints[i] = [i, float(i)]
+	elems = append(elems, "e" + string(i))
+}
+s := set(elems...)
+p := P(1, {a: 1, b: 2, c: 3, d: 4, e: 5, f: 6, g: 7, h: 8})
+r := range(0, 10, 2)
+b := big_int("123456789012345678901234567890")
+d := decimal("-1.25")
+
+export {
+	sum: func() { return p.sum() }
+}`)
+
+	var roots [2][]byte
+	for i := range roots {
+		r := contract.NewRuntime(storage.NewMemDB(), nil)
+		require.NoError(t, r.Deploy("c", src))
+		root, err := r.StateRoot("c")
+		require.NoError(t, err)
+		roots[i] = root
+	}
+	require.Equal(t, roots[0], roots[1])
+}
+
+func TestRuntime_ModuleFunction(t *testing.T) {
+	db := storage.NewMemDB()
+	r := contract.NewRuntime(db, stdlib.GetModuleMap("text"))
+	require.NoError(t, r.Deploy("c", []byte(`
+text := import("text")
+up := text.to_upper
+fns := {up: up, split: text.split}
+export {
+	up: func(s) { return up(s) },
+	split: func(s) { return fns.split(s, ",") }
+}`)))
+
+	// the functions are restored from the module after a reload
+	r = contract.NewRuntime(db, stdlib.GetModuleMap("text"))
+	expectInvoke(t, r, "c", "up", "ABC", "abc")
+	res, err := r.Invoke("c", "split", "a,b")
+	require.NoError(t, err)
+	require.Equal(t, `["a", "b"]`, res.String())
+}
+
+func TestRuntime_Deploy(t *testing.T) {
+	db := storage.NewMemDB()
+	r := contract.NewRuntime(db, stdlib.GetModuleMap("text", "rand"))
+
+	// no exports
+	require.Error(t, r.Deploy("c1", []byte(`a := 1`)))
+	// compile error
+	require.Error(t, r.Deploy("c1", []byte(`a := `)))
+	// non-deterministic module
+	require.Error(t, r.Deploy("c1", []byte(`
+rand := import("rand")
+export { f: func() { return rand.int() } }`)))
+	// runtime error
+	require.Error(t, r.Deploy("c1", []byte(`
+a := "a" - 1
+export { f: func() { return a } }`)))
+
+	// nothing is stored by the failed deployments
+	require.NoError(t, r.Deploy("c1", []byte(`
+a := 5
+export { f: func(x) { return a * x } }`)))
+	expectInvoke(t, r, "c1", "f", int64(10), 2)
+
+	// instances of classes are stored
+	require.NoError(t, r.Deploy("c2", []byte(`
+class Counter(n = 0) {
+	func inc(self) { self.n++; return self.n }
+}
+c := Counter()
+export {
+	inc: func() { return c.inc() },
+	same: func() { return c == Counter(c.n) }
+}`)))
+	expectInvoke(t, r, "c2", "inc", int64(1))
+	expectInvoke(t, r, "c2", "inc", int64(2))
+	expectInvoke(t, r, "c2", "same", true)
+}
+
+func TestRuntime_Class(t *testing.T) {
+	modules := common.NewModuleMap()
+	modules.AddBuiltinModule("fn", map[string]common.Object{
+		"apply": &common.UserFunction{
+			Name: "apply",
+			Value: func(args ...common.Object) (common.Object, error) {
+				return args[0].Call(args[1:]...)
+			},
+		},
+	})
+	db := storage.NewMemDB()
+	r := contract.NewRuntime(db, modules)
+	require.NoError(t, r.Deploy("c", []byte(`
+fn := import("fn")
+class V(x) {
+	func __str(self) { return "V(" + string(self.x) + ")" }
+}
+a := V(1)
+export {
+	a: func() { return string(a) },
+	b: func() { return string(V(2)) },
+	apply: func() { return string(fn.apply(V, 3)) }
+}`)))
+
+	// the classes loaded from the storage are bound to the VM
+	r = contract.NewRuntime(db, modules)
+	expectInvoke(t, r, "c", "a", "V(1)")
+	expectInvoke(t, r, "c", "b", "V(2)")
+	expectInvoke(t, r, "c", "apply", "V(3)")
+}
+
+func TestRuntime_Call(t *testing.T) {
+	db := storage.NewMemDB()
+	r := contract.NewRuntime(db, nil)
+	require.NoError(t, r.Deploy("counter", []byte(`
+contract := import("contract")
+count := 0
+export {
+	add: func(n) {
+		count += n
+		return [count, contract.address(), contract.caller()]
+	},
+	get: func() { return count },
+	fail: func() {
+		count += 100
+		return "a" - 1
+	},
+	loop: func() { for {} },
+	div: func(n) {
+		count += 1
+		return 1 / n
+	},
+	call: func(addr, fn) { return contract.call(addr, fn) }
+}`)))
+	require.NoError(t, r.Deploy("caller", []byte(`
+contract := import("contract")
+calls := 0
+export {
+	add: func(n) {
+		calls++
+		return contract.call("counter", "add", n)
+	},
+	addAndFail: func(n) {
+		contract.call("counter", "add", n)
+		return "a" - 1
+	},
+	fail: func() {
+		calls++
+		return contract.call("counter", "fail")
+	},
+	calls: func() { return calls },
+	call: func(addr, fn, ...args) {
+		return contract.call(addr, fn, args...)
+	},
+	loop: func() { return contract.call("counter", "loop") }
+}`)))
+
+	res, err := r.Invoke("caller", "add", 3)
+	require.NoError(t, err)
+	require.Equal(t, `[3, "counter", "caller"]`, res.String())
+	res, err = r.Invoke("counter", "add", 2)
+	require.NoError(t, err)
+	require.Equal(t, `[5, "counter", <undefined>]`, res.String())
+	expectInvoke(t, r, "caller", "calls", int64(1))
+
+	// writes of the callee are discarded if the caller fails
+	_, err = r.Invoke("caller", "addAndFail", 10)
+	require.Error(t, err)
+	expectInvoke(t, r, "counter", "get", int64(5))
+
+	// division by zero fails the call
+	_, err = r.Invoke("counter", "div", 0)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, common.ErrDivisionByZero), err.Error())
+	expectInvoke(t, r, "counter", "get", int64(5))
+
+	// failure of the callee is returned as an error value
+	res, err = r.Invoke("caller", "fail")
+	require.NoError(t, err)
+	_, ok := res.(*common.Error)
+	require.True(t, ok)
+	expectInvoke(t, r, "counter", "get", int64(5))
+	expectInvoke(t, r, "caller", "calls", int64(2))
+	res, err = r.Invoke("caller", "call", "none", "get")
+	require.NoError(t, err)
+	require.Equal(t, `error: "contract not found"`, res.String())
+
+	// reentrant calls are not allowed
+	_, err = r.Invoke("caller", "call", "counter", "call", "caller", "calls")
+	require.True(t, errors.Is(err, contract.ErrReentrantCall))
+	expectInvoke(t, r, "caller", "calls", int64(2))
+
+	// call depth
+	r.SetMaxCallDepth(1)
+	_, err = r.Invoke("caller", "call", "counter", "call", "x", "get")
+	require.True(t, errors.Is(err, contract.ErrCallDepthExceeded))
+	r.SetMaxCallDepth(contract.DefaultMaxCallDepth)
+
+	// gas is shared with the callee
+	r.SetGasLimit(1000)
+	_, err = r.Invoke("caller", "add", 1)
+	require.NoError(t, err)
+	used := r.GasUsed()
+	_, err = r.Invoke("counter", "add", 1)
+	require.NoError(t, err)
+	require.True(t, used > r.GasUsed())
+	var outOfGas common.ErrOutOfGas
+	_, err = r.Invoke("caller", "loop")
+	require.True(t, errors.As(err, &outOfGas))
+	require.Equal(t, int64(1000), outOfGas.Limit)
+	expectInvoke(t, r, "counter", "get", int64(7))
+
+	// functions, instances and generators cannot cross contracts
+	require.NoError(t, r.Deploy("leaky", []byte(`
+secret := "s"
+class C(x) {}
+gen := func() { yield secret }
+export {
+	closure: func() { return func() { return secret + "!" } },
+	nested: func() { return {a: [1, func() {}]} },
+	instance: func() { return C(1) },
+	generator: func() { return gen() },
+	data: func(x) { return [secret, x] }
+}`)))
+	for _, fn := range []string{"closure", "nested", "instance", "generator"} {
+		_, err = r.Invoke("caller", "call", "leaky", fn)
+		require.True(t, errors.Is(err, contract.ErrNotPlainData), fn)
+	}
+	_, err = r.Invoke("caller", "call", "leaky", "data", 1)
+	require.NoError(t, err)
+	res, err = r.Invoke("caller", "call", "leaky", "data", []interface{}{})
+	require.NoError(t, err)
+	require.Equal(t, `["s", []]`, res.String())
+	require.NoError(t, r.Deploy("leaky-caller", []byte(`
+contract := import("contract")
+export {
+	call: func() { return contract.call("leaky", "data", func() {}) }
+}`)))
+	_, err = r.Invoke("leaky-caller", "call")
+	require.True(t, errors.Is(err, contract.ErrNotPlainData))
+	expectInvoke(t, r, "caller", "calls", int64(3))
+
+	// int arithmetic is checked
+	r.SetGasLimit(-1)
+	_, err = r.Invoke("counter", "add", math.MaxInt64)
+	require.True(t, errors.Is(err, common.ErrIntegerOverflow))
+	expectInvoke(t, r, "counter", "get", int64(7))
+}
+
+func expectInvoke(
+	t *testing.T,
+	r *contract.Runtime,
+	address, fn string,
+	expected interface{},
+	args ...interface{},
+) {
+	res, err := r.Invoke(address, fn, args...)
+	require.NoError(t, err)
+	require.Equal(t, expected, common.ToInterface(res))
+}
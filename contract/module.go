@@ -0,0 +1,148 @@
+package contract
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/d5/tengo/v2/common"
+	"github.com/d5/tengo/v2/stdlib"
+)
+
+// moduleName is the name of the builtin module that the contracts use to
+// interact with the runtime.
+const moduleName = "contract"
+
+// module returns the attributes of the "contract" module bound to the call
+// context.
+func (c *callContext) module() map[string]common.Object {
+	return map[string]common.Object{
+		"call": &common.UserFunction{
+			Name:  "call",
+			Value: c.call,
+		}, // call(address, fn, args...) => object/error
+		"address": &common.UserFunction{
+			Name:  "address",
+			Value: stdlib.FuncARS(func() string { return c.address }),
+		}, // address() => string
+		"caller": &common.UserFunction{
+			Name:  "caller",
+			Value: c.caller,
+		}, // caller() => string/undefined
+	}
+}
+
+// call invokes the exported function of another contract. The failures of the
+// callee are returned as error values, and, its writes are discarded. The
+// arguments and the result must be plain data: passing a function, a class
+// instance or a generator fails all the callers. The gas
+// used by the callee is charged to the caller. Exceeding the limits of the
+// runtime fails all the callers.
+func (c *callContext) call(args ...common.Object) (common.Object, error) {
+	if len(args) < 2 {
+		return nil, common.ErrWrongNumArguments
+	}
+	address, ok := args[0].(*common.String)
+	if !ok {
+		return nil, common.ErrInvalidArgumentType{
+			Name:     "first",
+			Expected: "string",
+			Found:    args[0].TypeName(),
+		}
+	}
+	fn, ok := args[1].(*common.String)
+	if !ok {
+		return nil, common.ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "string",
+			Found:    args[1].TypeName(),
+		}
+	}
+
+	for i, arg := range args[2:] {
+		if err := checkPlainData(arg); err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i, err)
+		}
+	}
+
+	callee, err := c.runtime.newCall(c, address.Value)
+	if err != nil {
+		return nil, err
+	}
+	res, err := callee.invoke(fn.Value, args[2:])
+	if callee.vm != nil {
+		if err := c.vm.UseGas(callee.vm.GasUsed()); err != nil {
+			return nil, err
+		}
+	}
+	if errors.Is(err, ErrCallDepthExceeded) ||
+		errors.Is(err, ErrReentrantCall) ||
+		errors.As(err, &common.ErrOutOfGas{}) {
+		return nil, err
+	} else if err != nil {
+		return &common.Error{Value: &common.String{Value: err.Error()}}, nil
+	}
+	if err := checkPlainData(res); err != nil {
+		return nil, fmt.Errorf("result: %w", err)
+	}
+	return res, nil
+}
+
+// checkPlainData returns ErrNotPlainData if o is, or, contains a value that
+// refers to the VM or the globals of a contract: the functions, the classes
+// and their instances, and, the generators and the other iterators.
+func checkPlainData(o common.Object) error {
+	switch o := o.(type) {
+	case *common.Int, *common.Float, *common.String, *common.Char,
+		*common.Bool, *common.Bytes, *common.Time, *common.BigInt,
+		*common.Decimal, *common.Undefined, *common.Set,
+		*common.ImmutableSet, *common.Range:
+		return nil
+	case *common.Error:
+		return checkPlainData(o.Value)
+	case *common.Array:
+		return checkPlainElements(o.Value)
+	case *common.ImmutableArray:
+		return checkPlainElements(o.Value)
+	case *common.Map:
+		return checkPlainEntries(o.Value, o.Entries)
+	case *common.ImmutableMap:
+		return checkPlainEntries(o.Value, o.Entries)
+	}
+	return fmt.Errorf("%w: %s", ErrNotPlainData, o.TypeName())
+}
+
+func checkPlainElements(elems []common.Object) error {
+	for _, e := range elems {
+		if err := checkPlainData(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkPlainEntries(
+	m map[string]common.Object,
+	entries map[string]common.MapEntry,
+) error {
+	for _, v := range m {
+		if err := checkPlainData(v); err != nil {
+			return err
+		}
+	}
+	for _, e := range entries {
+		if err := checkPlainData(e.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *callContext) caller(args ...common.Object) (common.Object, error) {
+	if len(args) != 0 {
+		return nil, common.ErrWrongNumArguments
+	}
+	if c.parent == nil {
+		return common.UndefinedValue, nil
+	}
+	return &common.String{Value: c.parent.address}, nil
+}
@@ -20,10 +20,11 @@ type Node interface {
 
 // IdentList represents a list of identifiers.
 type IdentList struct {
-	LParen  Pos
-	VarArgs bool
-	List    []*Ident
-	RParen  Pos
+	LParen   Pos
+	VarArgs  bool
+	List     []*Ident
+	Defaults []Expr // default values, nil for the idents without a default
+	RParen   Pos
 }
 
 // Pos returns the position of first character belonging to the node.
@@ -61,6 +62,8 @@ func (n *IdentList) String() string {
 	for i, e := range n.List {
 		if n.VarArgs && i == len(n.List)-1 {
 			list = append(list, "..."+e.String())
+		} else if n.Defaults != nil && n.Defaults[i] != nil {
+			list = append(list, e.String()+" = "+n.Defaults[i].String())
 		} else {
 			list = append(list, e.String())
 		}
@@ -39,6 +39,37 @@ func (e *ArrayLit) String() string {
 	return "[" + strings.Join(elements, ", ") + "]"
 }
 
+// ArrayPattern represents an array destructuring pattern.
+type ArrayPattern struct {
+	Elements []*PatternElement
+	Rest     *Ident // or nil
+	LBrack   Pos
+	RBrack   Pos
+}
+
+func (e *ArrayPattern) exprNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (e *ArrayPattern) Pos() Pos {
+	return e.LBrack
+}
+
+// End returns the position of first character immediately after the node.
+func (e *ArrayPattern) End() Pos {
+	return e.RBrack + 1
+}
+
+func (e *ArrayPattern) String() string {
+	var elements []string
+	for _, m := range e.Elements {
+		elements = append(elements, m.String())
+	}
+	if e.Rest != nil {
+		elements = append(elements, "..."+e.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
 // BadExpr represents a bad expression.
 type BadExpr struct {
 	From Pos
@@ -115,6 +146,7 @@ type CallExpr struct {
 	LParen   Pos
 	Args     []Expr
 	Ellipsis Pos
+	Keywords []*KeywordArg
 	RParen   Pos
 }
 
@@ -138,6 +170,9 @@ func (e *CallExpr) String() string {
 	if len(args) > 0 && e.Ellipsis.IsValid() {
 		args[len(args)-1] = args[len(args)-1] + "..."
 	}
+	for _, kw := range e.Keywords {
+		args = append(args, kw.String())
+	}
 	return e.Func.String() + "(" + strings.Join(args, ", ") + ")"
 }
 
@@ -214,6 +249,30 @@ func (e *ErrorExpr) String() string {
 	return "error(" + e.Expr.String() + ")"
 }
 
+// FStringLit represents an interpolated string literal. Parts are the string
+// literals and the embedded expressions in the order of the source.
+type FStringLit struct {
+	Parts    []Expr
+	ValuePos Pos
+	Literal  string
+}
+
+func (e *FStringLit) exprNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (e *FStringLit) Pos() Pos {
+	return e.ValuePos
+}
+
+// End returns the position of first character immediately after the node.
+func (e *FStringLit) End() Pos {
+	return Pos(int(e.ValuePos) + len(e.Literal))
+}
+
+func (e *FStringLit) String() string {
+	return e.Literal
+}
+
 // FloatLit represents a floating point literal.
 type FloatLit struct {
 	Value    float64
@@ -356,10 +415,11 @@ func (e *ImportExpr) String() string {
 
 // IndexExpr represents an index expression.
 type IndexExpr struct {
-	Expr   Expr
-	LBrack Pos
-	Index  Expr
-	RBrack Pos
+	Expr     Expr
+	LBrack   Pos
+	Index    Expr
+	RBrack   Pos
+	Optional bool // "?.[": undefined if Expr is undefined
 }
 
 func (e *IndexExpr) exprNode() {}
@@ -379,6 +439,9 @@ func (e *IndexExpr) String() string {
 	if e.Index != nil {
 		index = e.Index.String()
 	}
+	if e.Optional {
+		return e.Expr.String() + "?.[" + index + "]"
+	}
 	return e.Expr.String() + "[" + index + "]"
 }
 
@@ -405,6 +468,29 @@ func (e *IntLit) String() string {
 	return e.Literal
 }
 
+// KeywordArg represents a keyword argument of a call expression.
+type KeywordArg struct {
+	Name  *Ident
+	Colon Pos
+	Value Expr
+}
+
+func (e *KeywordArg) exprNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (e *KeywordArg) Pos() Pos {
+	return e.Name.Pos()
+}
+
+// End returns the position of first character immediately after the node.
+func (e *KeywordArg) End() Pos {
+	return e.Value.End()
+}
+
+func (e *KeywordArg) String() string {
+	return e.Name.String() + ": " + e.Value.String()
+}
+
 // MapElementLit represents a map element.
 type MapElementLit struct {
 	Key      string
@@ -456,6 +542,33 @@ func (e *MapLit) String() string {
 	return "{" + strings.Join(elements, ", ") + "}"
 }
 
+// MapPattern represents a map destructuring pattern.
+type MapPattern struct {
+	LBrace   Pos
+	Elements []*PatternElement
+	RBrace   Pos
+}
+
+func (e *MapPattern) exprNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (e *MapPattern) Pos() Pos {
+	return e.LBrace
+}
+
+// End returns the position of first character immediately after the node.
+func (e *MapPattern) End() Pos {
+	return e.RBrace + 1
+}
+
+func (e *MapPattern) String() string {
+	var elements []string
+	for _, m := range e.Elements {
+		elements = append(elements, m.String())
+	}
+	return "{" + strings.Join(elements, ", ") + "}"
+}
+
 // ParenExpr represents a parenthesis wrapped expression.
 type ParenExpr struct {
 	Expr   Expr
@@ -479,10 +592,48 @@ func (e *ParenExpr) String() string {
 	return "(" + e.Expr.String() + ")"
 }
 
+// PatternElement represents an element of a destructuring pattern.
+type PatternElement struct {
+	Key     string // map key; or empty in array patterns
+	KeyPos  Pos
+	Name    *Ident
+	Default Expr // or nil
+}
+
+func (e *PatternElement) exprNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (e *PatternElement) Pos() Pos {
+	if e.KeyPos.IsValid() {
+		return e.KeyPos
+	}
+	return e.Name.Pos()
+}
+
+// End returns the position of first character immediately after the node.
+func (e *PatternElement) End() Pos {
+	if e.Default != nil {
+		return e.Default.End()
+	}
+	return e.Name.End()
+}
+
+func (e *PatternElement) String() string {
+	str := e.Name.String()
+	if e.Key != "" && e.Key != e.Name.Name {
+		str = e.Key + ": " + str
+	}
+	if e.Default != nil {
+		str += " = " + e.Default.String()
+	}
+	return str
+}
+
 // SelectorExpr represents a selector expression.
 type SelectorExpr struct {
-	Expr Expr
-	Sel  Expr
+	Expr     Expr
+	Sel      Expr
+	Optional bool // "?.": undefined if Expr is undefined
 }
 
 func (e *SelectorExpr) exprNode() {}
@@ -498,16 +649,20 @@ func (e *SelectorExpr) End() Pos {
 }
 
 func (e *SelectorExpr) String() string {
+	if e.Optional {
+		return e.Expr.String() + "?." + e.Sel.String()
+	}
 	return e.Expr.String() + "." + e.Sel.String()
 }
 
 // SliceExpr represents a slice expression.
 type SliceExpr struct {
-	Expr   Expr
-	LBrack Pos
-	Low    Expr
-	High   Expr
-	RBrack Pos
+	Expr     Expr
+	LBrack   Pos
+	Low      Expr
+	High     Expr
+	RBrack   Pos
+	Optional bool // "?.[": undefined if Expr is undefined
 }
 
 func (e *SliceExpr) exprNode() {}
@@ -530,6 +685,9 @@ func (e *SliceExpr) String() string {
 	if e.High != nil {
 		high = e.High.String()
 	}
+	if e.Optional {
+		return e.Expr.String() + "?.[" + low + ":" + high + "]"
+	}
 	return e.Expr.String() + "[" + low + ":" + high + "]"
 }
 
@@ -47,6 +47,19 @@ const (
 	OpIteratorValue               // Iterator value
 	OpBinaryOp                    // Binary operation
 	OpSuspend                     // Suspend VM
+	OpTry                         // Push error handler
+	OpPopTry                      // Pop error handlers
+	OpThrow                       // Throw error
+	OpSwitch                      // Jump table
+	OpDefaultJump                 // Jump if not undefined
+	OpConcat                      // Concatenate strings
+	OpCallKw                      // Call function with keyword arguments
+	OpContains                    // Membership test
+	OpYield                       // Yield from generator
+	OpDefer                       // Defer function call
+	OpDeferKw                     // Defer function call with keyword arguments
+	OpClass                       // Create class
+	OpInstance                    // Create class instance
 )
 
 // OpcodeNames are string representation of opcodes.
@@ -93,6 +106,19 @@ var OpcodeNames = [...]string{
 	OpIteratorValue: "ITVAL",
 	OpBinaryOp:      "BINARYOP",
 	OpSuspend:       "SUSPEND",
+	OpTry:           "TRY",
+	OpPopTry:        "POPTRY",
+	OpThrow:         "THROW",
+	OpSwitch:        "SWITCH",
+	OpDefaultJump:   "DEFJMP",
+	OpConcat:        "CONCAT",
+	OpCallKw:        "CALLKW",
+	OpContains:      "CONTAINS",
+	OpYield:         "YIELD",
+	OpDefer:         "DEFER",
+	OpDeferKw:       "DEFERKW",
+	OpClass:         "CLASS",
+	OpInstance:      "INSTANCE",
 }
 
 // OpcodeOperands is the number of operands.
@@ -139,6 +165,19 @@ var OpcodeOperands = [...][]int{
 	OpIteratorValue: {},
 	OpBinaryOp:      {1},
 	OpSuspend:       {},
+	OpTry:           {2},
+	OpPopTry:        {1},
+	OpThrow:         {},
+	OpSwitch:        {2, 2},
+	OpDefaultJump:   {2},
+	OpConcat:        {2},
+	OpCallKw:        {1, 2},
+	OpContains:      {},
+	OpYield:         {},
+	OpDefer:         {1, 1},
+	OpDeferKw:       {1, 2},
+	OpClass:         {2},
+	OpInstance:      {1},
 }
 
 // ReadOperands reads operands from the bytecode.
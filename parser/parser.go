@@ -18,6 +18,12 @@ var stmtStart = map[token.Token]bool{
 	token.If:       true,
 	token.Return:   true,
 	token.Export:   true,
+	token.Try:      true,
+	token.Throw:    true,
+	token.Switch:   true,
+	token.Yield:    true,
+	token.Defer:    true,
+	token.Class:    true,
 }
 
 // Error represents a parser error.
@@ -98,9 +104,10 @@ type Parser struct {
 	pos       Pos
 	token     token.Token
 	tokenLit  string
-	exprLevel int // < 0: in control clause, >= 0: in expression
-	syncPos   Pos // last sync position
-	syncCount int // number of advance calls without progress
+	exprLevel int  // < 0: in control clause, >= 0: in expression
+	noIn      bool // "in" ends the expression (for-in statement header)
+	syncPos   Pos  // last sync position
+	syncCount int  // number of advance calls without progress
 	trace     bool
 	indent    int
 	traceOut  io.Writer
@@ -177,13 +184,17 @@ func (p *Parser) parseBinaryExpr(prec1 int) Expr {
 
 	for {
 		op, prec := p.token, p.token.Precedence()
-		if prec < prec1 {
+		if prec < prec1 || (op == token.In && p.noIn) {
 			return x
 		}
 
 		pos := p.expect(op)
 
-		y := p.parseBinaryExpr(prec + 1)
+		// "**" is right-associative
+		if op != token.Pow {
+			prec++
+		}
+		y := p.parseBinaryExpr(prec)
 
 		x = &BinaryExpr{
 			LHS:      x,
@@ -238,12 +249,15 @@ func (p *Parser) parsePrimaryExpr() Expr {
 L:
 	for {
 		switch p.token {
-		case token.Period:
+		case token.Period, token.OptPeriod:
+			optional := p.token == token.OptPeriod
 			p.next()
 
-			switch p.token {
-			case token.Ident:
-				x = p.parseSelector(x)
+			switch {
+			case p.token == token.Ident:
+				x = p.parseSelector(x, optional)
+			case p.token == token.LBrack && optional:
+				x = p.parseIndexOrSlice(x, true)
 			default:
 				pos := p.pos
 				p.errorExpected(pos, "selector")
@@ -251,7 +265,7 @@ L:
 				return &BadExpr{From: pos, To: p.pos}
 			}
 		case token.LBrack:
-			x = p.parseIndexOrSlice(x)
+			x = p.parseIndexOrSlice(x, false)
 		case token.LParen:
 			x = p.parseCall(x)
 		default:
@@ -270,12 +284,34 @@ func (p *Parser) parseCall(x Expr) *CallExpr {
 	p.exprLevel++
 
 	var list []Expr
+	var keywords []*KeywordArg
 	var ellipsis Pos
 	for p.token != token.RParen && p.token != token.EOF && !ellipsis.IsValid() {
-		list = append(list, p.parseExpr())
-		if p.token == token.Ellipsis {
-			ellipsis = p.pos
+		arg := p.parseExpr()
+		if name, ok := arg.(*Ident); ok && p.token == token.Colon {
+			for _, kw := range keywords {
+				if kw.Name.Name == name.Name {
+					p.error(name.Pos(), fmt.Sprintf(
+						"duplicate keyword argument '%s'", name.Name))
+				}
+			}
+			colon := p.pos
 			p.next()
+			keywords = append(keywords, &KeywordArg{
+				Name:  name,
+				Colon: colon,
+				Value: p.parseExpr(),
+			})
+		} else {
+			if len(keywords) > 0 {
+				p.error(arg.Pos(),
+					"positional argument follows keyword argument")
+			}
+			list = append(list, arg)
+			if p.token == token.Ellipsis {
+				ellipsis = p.pos
+				p.next()
+			}
 		}
 		if !p.expectComma(token.RParen, "call argument") {
 			break
@@ -290,6 +326,7 @@ func (p *Parser) parseCall(x Expr) *CallExpr {
 		RParen:   rparen,
 		Ellipsis: ellipsis,
 		Args:     list,
+		Keywords: keywords,
 	}
 }
 
@@ -310,7 +347,7 @@ func (p *Parser) expectComma(closing token.Token, want string) bool {
 	return false
 }
 
-func (p *Parser) parseIndexOrSlice(x Expr) Expr {
+func (p *Parser) parseIndexOrSlice(x Expr, optional bool) Expr {
 	if p.trace {
 		defer untracep(tracep(p, "IndexOrSlice"))
 	}
@@ -338,22 +375,24 @@ func (p *Parser) parseIndexOrSlice(x Expr) Expr {
 	if numColons > 0 {
 		// slice expression
 		return &SliceExpr{
-			Expr:   x,
-			LBrack: lbrack,
-			RBrack: rbrack,
-			Low:    index[0],
-			High:   index[1],
+			Expr:     x,
+			LBrack:   lbrack,
+			RBrack:   rbrack,
+			Low:      index[0],
+			High:     index[1],
+			Optional: optional,
 		}
 	}
 	return &IndexExpr{
-		Expr:   x,
-		LBrack: lbrack,
-		RBrack: rbrack,
-		Index:  index[0],
+		Expr:     x,
+		LBrack:   lbrack,
+		RBrack:   rbrack,
+		Index:    index[0],
+		Optional: optional,
 	}
 }
 
-func (p *Parser) parseSelector(x Expr) Expr {
+func (p *Parser) parseSelector(x Expr, optional bool) Expr {
 	if p.trace {
 		defer untracep(tracep(p, "Selector"))
 	}
@@ -363,7 +402,7 @@ func (p *Parser) parseSelector(x Expr) Expr {
 		Value:    sel.Name,
 		ValuePos: sel.NamePos,
 		Literal:  sel.Name,
-	}}
+	}, Optional: optional}
 }
 
 func (p *Parser) parseOperand() Expr {
@@ -395,6 +434,9 @@ func (p *Parser) parseOperand() Expr {
 	case token.Char:
 		return p.parseCharLit()
 	case token.String:
+		if p.tokenLit[0] == 'f' {
+			return p.parseFStringLit()
+		}
 		v, _ := strconv.Unquote(p.tokenLit)
 		x := &StringLit{
 			Value:    v,
@@ -459,7 +501,7 @@ func (p *Parser) parseImportExpr() Expr {
 	pos := p.pos
 	p.next()
 	p.expect(token.LParen)
-	if p.token != token.String {
+	if !p.isPlainString() {
 		p.errorExpected(p.pos, "module name")
 		p.advance(stmtStart)
 		return &BadExpr{From: pos, To: p.pos}
@@ -501,6 +543,97 @@ func (p *Parser) parseCharLit() Expr {
 	}
 }
 
+func (p *Parser) parseFStringLit() Expr {
+	if p.trace {
+		defer untracep(tracep(p, "FStringLit"))
+	}
+
+	x := &FStringLit{ValuePos: p.pos, Literal: p.tokenLit}
+	lit := p.tokenLit
+	offs := p.file.Offset(p.pos)
+
+	// the literal is f"..." with the closing quote unless it is not
+	// terminated, which the scanner already reported
+	end := len(lit)
+	if end < 3 || lit[end-1] != '"' {
+		end = len(lit) + 1
+	}
+
+	var raw []byte
+	rawPos := 2
+	addString := func(next int) {
+		if len(raw) > 0 {
+			v, _ := strconv.Unquote("\"" + string(raw) + "\"")
+			x.Parts = append(x.Parts, &StringLit{
+				Value:    v,
+				ValuePos: p.pos + Pos(rawPos),
+				Literal:  "\"" + string(raw) + "\"",
+			})
+		}
+		raw = raw[:0]
+		rawPos = next
+	}
+	for i := 2; i < end-1; {
+		switch {
+		case lit[i] == '\\' && i+1 < len(lit) && lit[i+1] == '$':
+			raw = append(raw, '$')
+			i += 2
+		case lit[i] == '\\' && i+1 < len(lit):
+			raw = append(raw, lit[i], lit[i+1])
+			i += 2
+		case lit[i] == '$' && i+1 < len(lit) && lit[i+1] == '{':
+			e, rbrace := p.parseEmbeddedExpr(offs + i + 2)
+			addString(rbrace - offs + 1)
+			x.Parts = append(x.Parts, e)
+			i = rbrace - offs + 1
+		default:
+			raw = append(raw, lit[i])
+			i++
+		}
+	}
+	addString(0)
+
+	p.next()
+	return x
+}
+
+// isPlainString returns true if the current token is a string literal without
+// interpolation.
+func (p *Parser) isPlainString() bool {
+	return p.token == token.String && p.tokenLit[0] != 'f'
+}
+
+// parseEmbeddedExpr parses the expression embedded in an interpolated string
+// literal at the offset, and, returns the offset of its closing brace.
+func (p *Parser) parseEmbeddedExpr(offset int) (Expr, int) {
+	sub := &Parser{
+		file:     p.file,
+		trace:    p.trace,
+		indent:   p.indent,
+		traceOut: p.traceOut,
+	}
+	// the scanner already reported the errors in the embedded expression
+	sub.scanner = &Scanner{
+		file:       p.file,
+		src:        p.scanner.src,
+		ch:         ' ',
+		readOffset: offset,
+		mode:       DontInsertSemis,
+	}
+	sub.scanner.next()
+	sub.next()
+	defer func() {
+		p.errors = append(p.errors, sub.errors...)
+	}()
+
+	x := sub.parseExpr()
+	if sub.token != token.RBrace {
+		sub.errorExpected(sub.pos, "'}'")
+		return x, len(p.scanner.src) - 1
+	}
+	return x, p.file.Offset(sub.pos)
+}
+
 func (p *Parser) parseFuncLit() Expr {
 	if p.trace {
 		defer untracep(tracep(p, "FuncLit"))
@@ -633,31 +766,45 @@ func (p *Parser) parseIdentList() *IdentList {
 	}
 
 	var params []*Ident
+	var defaults []Expr
 	lparen := p.expect(token.LParen)
 	isVarArgs := false
-	if p.token != token.RParen {
+	parseParam := func() {
 		if p.token == token.Ellipsis {
 			isVarArgs = true
 			p.next()
 		}
-
-		params = append(params, p.parseIdent())
-		for !isVarArgs && p.token == token.Comma {
+		ident := p.parseIdent()
+		params = append(params, ident)
+		if p.token == token.Assign && !isVarArgs {
 			p.next()
-			if p.token == token.Ellipsis {
-				isVarArgs = true
-				p.next()
+			if defaults == nil {
+				defaults = make([]Expr, len(params)-1, len(params))
 			}
-			params = append(params, p.parseIdent())
+			defaults = append(defaults, p.parseExpr())
+		} else if defaults != nil {
+			if !isVarArgs {
+				p.error(ident.Pos(), fmt.Sprintf(
+					"missing default value for parameter '%s'", ident.Name))
+			}
+			defaults = append(defaults, nil)
+		}
+	}
+	if p.token != token.RParen {
+		parseParam()
+		for !isVarArgs && p.token == token.Comma {
+			p.next()
+			parseParam()
 		}
 	}
 
 	rparen := p.expect(token.RParen)
 	return &IdentList{
-		LParen:  lparen,
-		RParen:  rparen,
-		VarArgs: isVarArgs,
-		List:    params,
+		LParen:   lparen,
+		RParen:   rparen,
+		VarArgs:  isVarArgs,
+		List:     params,
+		Defaults: defaults,
 	}
 }
 
@@ -684,6 +831,18 @@ func (p *Parser) parseStmt() (stmt Stmt) {
 		return p.parseIfStmt()
 	case token.For:
 		return p.parseForStmt()
+	case token.Switch:
+		return p.parseSwitchStmt()
+	case token.Try:
+		return p.parseTryStmt()
+	case token.Throw:
+		return p.parseThrowStmt()
+	case token.Yield:
+		return p.parseYieldStmt()
+	case token.Defer:
+		return p.parseDeferStmt()
+	case token.Class:
+		return p.parseClassStmt()
 	case token.Break, token.Continue:
 		return p.parseBranchStmt(p.token)
 	case token.Semicolon:
@@ -911,6 +1070,211 @@ func (p *Parser) parseReturnStmt() Stmt {
 	}
 }
 
+func (p *Parser) parseSwitchStmt() Stmt {
+	if p.trace {
+		defer untracep(tracep(p, "SwitchStmt"))
+	}
+
+	pos := p.expect(token.Switch)
+	init, tag := p.parseSwitchHeader()
+	lbrace := p.expect(token.LBrace)
+	var list []Stmt
+	for p.token == token.Case || p.token == token.Default {
+		list = append(list, p.parseCaseClause())
+	}
+	rbrace := p.expect(token.RBrace)
+	p.expectSemi()
+	return &SwitchStmt{
+		SwitchPos: pos,
+		Init:      init,
+		Tag:       tag,
+		Body: &BlockStmt{
+			LBrace: lbrace,
+			RBrace: rbrace,
+			Stmts:  list,
+		},
+	}
+}
+
+func (p *Parser) parseSwitchHeader() (init Stmt, tag Expr) {
+	if p.token == token.LBrace {
+		return
+	}
+
+	outer := p.exprLevel
+	p.exprLevel = -1
+
+	var tagStmt Stmt
+	if p.token != token.Semicolon {
+		tagStmt = p.parseSimpleStmt(false)
+	}
+	if p.token == token.Semicolon {
+		p.next()
+
+		init = tagStmt
+		tagStmt = nil
+		if p.token != token.LBrace {
+			tagStmt = p.parseSimpleStmt(false)
+		}
+	}
+	tag = p.makeExpr(tagStmt, "switch expression")
+	p.exprLevel = outer
+	return
+}
+
+func (p *Parser) parseCaseClause() *CaseClause {
+	if p.trace {
+		defer untracep(tracep(p, "CaseClause"))
+	}
+
+	s := &CaseClause{Case: p.pos}
+	if p.token == token.Case {
+		p.next()
+		s.List = p.parseExprList()
+		if p.token == token.If {
+			p.next()
+			s.Guard = p.parseExpr()
+		}
+	} else {
+		p.expect(token.Default)
+	}
+	s.Colon = p.expect(token.Colon)
+	for p.token != token.Case && p.token != token.Default &&
+		p.token != token.RBrace && p.token != token.EOF {
+		s.Body = append(s.Body, p.parseStmt())
+	}
+	return s
+}
+
+func (p *Parser) parseThrowStmt() Stmt {
+	if p.trace {
+		defer untracep(tracep(p, "ThrowStmt"))
+	}
+
+	pos := p.expect(token.Throw)
+	x := p.parseExpr()
+	p.expectSemi()
+	return &ThrowStmt{
+		ThrowPos: pos,
+		Result:   x,
+	}
+}
+
+func (p *Parser) parseYieldStmt() Stmt {
+	if p.trace {
+		defer untracep(tracep(p, "YieldStmt"))
+	}
+
+	pos := p.expect(token.Yield)
+	var x Expr
+	if p.token != token.Semicolon && p.token != token.RBrace {
+		x = p.parseExpr()
+	}
+	p.expectSemi()
+	return &YieldStmt{
+		YieldPos: pos,
+		Result:   x,
+	}
+}
+
+func (p *Parser) parseClassStmt() Stmt {
+	if p.trace {
+		defer untracep(tracep(p, "ClassStmt"))
+	}
+
+	pos := p.expect(token.Class)
+	name := p.parseIdent()
+	fields := p.parseIdentList()
+	lbrace := p.expect(token.LBrace)
+	var methods []*MethodDecl
+	for p.token != token.RBrace && p.token != token.EOF {
+		if p.token == token.Semicolon {
+			p.next()
+			continue
+		}
+		if p.token != token.Func {
+			p.errorExpected(p.pos, "method")
+			for p.token != token.Func && p.token != token.RBrace &&
+				p.token != token.EOF {
+				p.next()
+			}
+			continue
+		}
+		funcPos := p.expect(token.Func)
+		methodName := p.parseIdent()
+		params := p.parseIdentList()
+		p.exprLevel++
+		body := p.parseBody()
+		p.exprLevel--
+		methods = append(methods, &MethodDecl{
+			Name: methodName,
+			Func: &FuncLit{
+				Type: &FuncType{FuncPos: funcPos, Params: params},
+				Body: body,
+			},
+		})
+		if p.token != token.RBrace {
+			p.expectSemi()
+		}
+	}
+	rbrace := p.expect(token.RBrace)
+	p.expectSemi()
+	return &ClassStmt{
+		ClassPos: pos,
+		Name:     name,
+		Fields:   fields,
+		LBrace:   lbrace,
+		Methods:  methods,
+		RBrace:   rbrace,
+	}
+}
+
+func (p *Parser) parseDeferStmt() Stmt {
+	if p.trace {
+		defer untracep(tracep(p, "DeferStmt"))
+	}
+
+	pos := p.expect(token.Defer)
+	x := p.parseExpr()
+	p.expectSemi()
+	call, ok := x.(*CallExpr)
+	if !ok {
+		p.error(x.Pos(), "expression in defer must be function call")
+		return &BadStmt{From: pos, To: x.End()}
+	}
+	return &DeferStmt{
+		DeferPos: pos,
+		Call:     call,
+	}
+}
+
+func (p *Parser) parseTryStmt() Stmt {
+	if p.trace {
+		defer untracep(tracep(p, "TryStmt"))
+	}
+
+	s := &TryStmt{TryPos: p.expect(token.Try)}
+	s.Body = p.parseBlockStmt()
+	if p.token == token.Catch {
+		s.CatchPos = p.pos
+		p.next()
+		if p.token == token.Ident {
+			s.Ident = p.parseIdent()
+		}
+		s.Catch = p.parseBlockStmt()
+	}
+	if p.token == token.Finally {
+		s.FinallyPos = p.pos
+		p.next()
+		s.Finally = p.parseBlockStmt()
+	}
+	if s.Catch == nil && s.Finally == nil {
+		p.errorExpected(p.pos, "catch or finally")
+	}
+	p.expectSemi()
+	return s
+}
+
 func (p *Parser) parseExportStmt() Stmt {
 	if p.trace {
 		defer untracep(tracep(p, "ExportStmt"))
@@ -931,7 +1295,14 @@ func (p *Parser) parseSimpleStmt(forIn bool) Stmt {
 		defer untracep(tracep(p, "SimpleStmt"))
 	}
 
+	if (p.token == token.LBrack || p.token == token.LBrace) && p.isPattern() {
+		return p.parseDestructuring()
+	}
+
+	prevNoIn := p.noIn
+	p.noIn = forIn
 	x := p.parseExprList()
+	p.noIn = prevNoIn
 
 	switch p.token {
 	case token.Assign, token.Define: // assignment statement
@@ -989,7 +1360,8 @@ func (p *Parser) parseSimpleStmt(forIn bool) Stmt {
 	case token.Define,
 		token.AddAssign, token.SubAssign, token.MulAssign, token.QuoAssign,
 		token.RemAssign, token.AndAssign, token.OrAssign, token.XorAssign,
-		token.ShlAssign, token.ShrAssign, token.AndNotAssign:
+		token.ShlAssign, token.ShrAssign, token.AndNotAssign,
+		token.PowAssign:
 		pos, tok := p.pos, p.token
 		p.next()
 		y := p.parseExpr()
@@ -1008,6 +1380,115 @@ func (p *Parser) parseSimpleStmt(forIn bool) Stmt {
 	return &ExprStmt{Expr: x[0]}
 }
 
+// isPattern returns true if the array or map at the current token is followed
+// by "=" or ":=", that is, it is a destructuring pattern. It scans ahead with a
+// copy of the scanner so the parser state does not change.
+func (p *Parser) isPattern() bool {
+	s := *p.scanner
+	s.errorHandler = nil
+	tok, depth := p.token, 0
+	for {
+		switch tok {
+		case token.LBrack, token.LBrace, token.LParen:
+			depth++
+		case token.RBrack, token.RBrace, token.RParen:
+			depth--
+		case token.EOF:
+			return false
+		}
+		tok, _, _ = s.Scan()
+		if depth == 0 {
+			return tok == token.Assign || tok == token.Define
+		}
+	}
+}
+
+func (p *Parser) parseDestructuring() Stmt {
+	if p.trace {
+		defer untracep(tracep(p, "Destructuring"))
+	}
+
+	var x Expr
+	if p.token == token.LBrack {
+		x = p.parseArrayPattern()
+	} else {
+		x = p.parseMapPattern()
+	}
+
+	pos, tok := p.pos, p.token
+	if tok != token.Assign && tok != token.Define {
+		p.errorExpected(pos, "'=' or ':='")
+	}
+	p.next()
+	y := p.parseExprList()
+	return &AssignStmt{
+		LHS:      []Expr{x},
+		RHS:      y,
+		Token:    tok,
+		TokenPos: pos,
+	}
+}
+
+func (p *Parser) parseArrayPattern() *ArrayPattern {
+	if p.trace {
+		defer untracep(tracep(p, "ArrayPattern"))
+	}
+
+	x := &ArrayPattern{LBrack: p.expect(token.LBrack)}
+	for p.token != token.RBrack && p.token != token.EOF {
+		if p.token == token.Ellipsis {
+			p.next()
+			x.Rest = p.parseIdent()
+			break
+		}
+		elem := &PatternElement{Name: p.parseIdent()}
+		if p.token == token.Assign {
+			p.next()
+			elem.Default = p.parseExpr()
+		}
+		x.Elements = append(x.Elements, elem)
+		if !p.expectComma(token.RBrack, "array pattern element") {
+			break
+		}
+	}
+	x.RBrack = p.expect(token.RBrack)
+	return x
+}
+
+func (p *Parser) parseMapPattern() *MapPattern {
+	if p.trace {
+		defer untracep(tracep(p, "MapPattern"))
+	}
+
+	x := &MapPattern{LBrace: p.expect(token.LBrace)}
+	for p.token != token.RBrace && p.token != token.EOF {
+		elem := &PatternElement{KeyPos: p.pos}
+		if p.isPlainString() {
+			elem.Key, _ = strconv.Unquote(p.tokenLit)
+			p.next()
+			p.expect(token.Colon)
+			elem.Name = p.parseIdent()
+		} else {
+			elem.Name = p.parseIdent()
+			elem.Key = elem.Name.Name
+			if p.token == token.Colon {
+				p.next()
+				elem.Name = p.parseIdent()
+			}
+		}
+		if p.token == token.Assign {
+			p.next()
+			elem.Default = p.parseExpr()
+		}
+		x.Elements = append(x.Elements, elem)
+		if !p.expectComma(token.RBrace, "map pattern element") {
+			break
+		}
+	}
+	x.RBrace = p.expect(token.RBrace)
+	return x
+}
+
 func (p *Parser) parseExprList() (list []Expr) {
 	if p.trace {
 		defer untracep(tracep(p, "ExpressionList"))
@@ -1030,7 +1511,7 @@ func (p *Parser) parseMapElementLit() *MapElementLit {
 	name := "_"
 	if p.token == token.Ident {
 		name = p.tokenLit
-	} else if p.token == token.String {
+	} else if p.isPlainString() {
 		v, _ := strconv.Unquote(p.tokenLit)
 		name = v
 	} else {
@@ -251,6 +251,52 @@ func TestParseAssignment(t *testing.T) {
 	})
 }
 
+func TestParseDestructuring(t *testing.T) {
+	expectParse(t, "[a, b = 1, ...c] := x", func(p pfn) []Stmt {
+		return stmts(
+			assignStmt(
+				exprs(arrayPattern(p(1, 1), p(1, 16),
+					ident("c", p(1, 15)),
+					patternElement("", NoPos, ident("a", p(1, 2)), nil),
+					patternElement("", NoPos, ident("b", p(1, 5)),
+						intLit(1, p(1, 9))))),
+				exprs(ident("x", p(1, 21))),
+				token.Define,
+				p(1, 18)))
+	})
+
+	expectParse(t, `{name, n: m = 2, "k": v} = y`, func(p pfn) []Stmt {
+		return stmts(
+			assignStmt(
+				exprs(mapPattern(p(1, 1), p(1, 24),
+					patternElement("name", p(1, 2),
+						ident("name", p(1, 2)), nil),
+					patternElement("n", p(1, 8),
+						ident("m", p(1, 11)), intLit(2, p(1, 15))),
+					patternElement("k", p(1, 18),
+						ident("v", p(1, 23)), nil))),
+				exprs(ident("y", p(1, 28))),
+				token.Assign,
+				p(1, 26)))
+	})
+
+	expectParseString(t, "[a, _, ...b] := f()", "[a, _, ...b] := f()")
+	expectParseString(t, "[\n\ta,\n\tb = [1]\n] = x", "[a, b = [1]] = x")
+	expectParseString(t, "{a: b = {c: 1}} := x", "{a: b = {c: 1}} := x")
+	expectParseString(t, "if [a] := x; a {}", "if [a] := x; a {}")
+
+	// array and map literals are not patterns
+	expectParseString(t, "[1, 2][0]", "[1, 2][0]")
+	expectParseString(t, "{a: 1}", "{a: 1}")
+	expectParseString(t, "[a] == [b]", "([a] == [b])")
+
+	expectParseError(t, "[1] := x")
+	expectParseError(t, "[...a, b] := x")
+	expectParseError(t, "[a.b] = x")
+	expectParseError(t, "{a: 1} := x")
+	expectParseError(t, "{...a} := x")
+}
+
 func TestParseBoolean(t *testing.T) {
 	expectParse(t, "true", func(p pfn) []Stmt {
 		return stmts(
@@ -440,6 +486,32 @@ func TestParseCall(t *testing.T) {
 	expectParseError(t, `add(1, ...)`)
 	expectParseError(t, `add(1, ..., )`)
 	expectParseError(t, `add(...a)`)
+
+	expectParse(t, `add(1, b: 2, c: x ? 3 : 4)`, func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				keywordCallExpr(
+					callExpr(
+						ident("add", p(1, 1)),
+						p(1, 4), p(1, 26), NoPos,
+						intLit(1, p(1, 5))),
+					keywordArg(ident("b", p(1, 8)), p(1, 9),
+						intLit(2, p(1, 11))),
+					keywordArg(ident("c", p(1, 14)), p(1, 15),
+						condExpr(
+							ident("x", p(1, 17)),
+							intLit(3, p(1, 21)),
+							intLit(4, p(1, 25)),
+							p(1, 19), p(1, 23))))))
+	})
+
+	expectParseString(t, `add(1, b: 2)`, `add(1, b: 2)`)
+
+	expectParseError(t, `add(b: 1, 2)`)
+	expectParseError(t, `add(b: 1, b: 2)`)
+	expectParseError(t, `add(a..., b: 1)`)
+	expectParseError(t, `add(b: 1, a...)`)
+	expectParseError(t, `add(a.b: 1)`)
 }
 
 func TestParseChar(t *testing.T) {
@@ -600,6 +672,20 @@ func TestParseForIn(t *testing.T) {
 				blockStmt(p(1, 28), p(1, 29)),
 				p(1, 1)))
 	})
+
+	expectParse(t, "for x in a in b {}", func(p pfn) []Stmt {
+		return stmts(
+			forInStmt(
+				ident("_", p(1, 5)),
+				ident("x", p(1, 5)),
+				binaryExpr(
+					ident("a", p(1, 10)),
+					ident("b", p(1, 15)),
+					token.In,
+					p(1, 12)),
+				blockStmt(p(1, 17), p(1, 18)),
+				p(1, 1)))
+	})
 }
 
 func TestParseFor(t *testing.T) {
@@ -790,6 +876,40 @@ func TestParseVariadicFunctionWithArgs(t *testing.T) {
 	expectParseError(t, "a = func(...args, invalid) { return args }")
 }
 
+func TestParseFunctionDefaults(t *testing.T) {
+	expectParse(t, "a = func(x, y = 1, ...z) {}", func(p pfn) []Stmt {
+		return stmts(
+			assignStmt(
+				exprs(
+					ident("a", p(1, 1))),
+				exprs(
+					funcLit(
+						funcType(
+							identListDefaults(
+								identList(
+									p(1, 9), p(1, 24),
+									true,
+									ident("x", p(1, 10)),
+									ident("y", p(1, 13)),
+									ident("z", p(1, 23)),
+								),
+								nil, intLit(1, p(1, 17)), nil,
+							), p(1, 5)),
+						blockStmt(p(1, 26), p(1, 27)),
+					),
+				),
+				token.Assign,
+				p(1, 3)))
+	})
+
+	expectParseString(t, "a = func(x, y = 1 + 2) {}",
+		"a = func(x, y = (1 + 2)) {}")
+
+	expectParseError(t, "a = func(x = 1, y) {}")
+	expectParseError(t, "a = func(x, ...y = 1) {}")
+	expectParseError(t, "a = func(x = ) {}")
+}
+
 func TestParseIf(t *testing.T) {
 	expectParse(t, "if a == 5 {}", func(p pfn) []Stmt {
 		return stmts(
@@ -1173,6 +1293,24 @@ func TestParseLogical(t *testing.T) {
 					token.LAnd,
 					p(1, 3))))
 	})
+
+	expectParse(t, "a ?? b || c ?? d", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				binaryExpr(
+					binaryExpr(
+						ident("a", p(1, 1)),
+						binaryExpr(
+							ident("b", p(1, 6)),
+							ident("c", p(1, 11)),
+							token.LOr,
+							p(1, 8)),
+						token.Coalesce,
+						p(1, 3)),
+					ident("d", p(1, 16)),
+					token.Coalesce,
+					p(1, 13))))
+	})
 }
 
 func TestParseMap(t *testing.T) {
@@ -1267,6 +1405,64 @@ func TestParsePrecedence(t *testing.T) {
 	expectParseString(t, `a + b + c`, `((a + b) + c)`)
 	expectParseString(t, `a + b * c`, `(a + (b * c))`)
 	expectParseString(t, `x = 2 * 1 + 3 / 4`, `x = ((2 * 1) + (3 / 4))`)
+	expectParseString(t, `a * b ** c`, `(a * (b ** c))`)
+	expectParseString(t, `a ** b ** c`, `(a ** (b ** c))`)
+	expectParseString(t, `-a ** b`, `((-a) ** b)`)
+	expectParseString(t, `a **= b ** 2`, `a **= (b ** 2)`)
+	expectParseString(t, `a in b == c`, `((a in b) == c)`)
+	expectParseString(t, `a + b in c`, `((a + b) in c)`)
+	expectParseString(t, `a in b && c in d`, `((a in b) && (c in d))`)
+	expectParseString(t, `x := a in b`, `x := (a in b)`)
+}
+
+func TestParseOptionalChain(t *testing.T) {
+	expectParse(t, "a?.b[c]?.[d]?.[1:]", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				optional(sliceExpr(
+					optional(indexExpr(
+						indexExpr(
+							optional(selectorExpr(
+								ident("a", p(1, 1)),
+								stringLit("b", p(1, 4)))),
+							ident("c", p(1, 6)),
+							p(1, 5), p(1, 7)),
+						ident("d", p(1, 11)),
+						p(1, 10), p(1, 12))),
+					intLit(1, p(1, 16)), nil,
+					p(1, 15), p(1, 18)))))
+	})
+
+	expectParse(t, "a?.b()", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				callExpr(
+					optional(selectorExpr(
+						ident("a", p(1, 1)),
+						stringLit("b", p(1, 4)))),
+					p(1, 5), p(1, 6), NoPos)))
+	})
+
+	// "?" followed by a float
+	expectParse(t, "a?.5:1", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				condExpr(
+					ident("a", p(1, 1)),
+					floatLit(0.5, p(1, 3)),
+					intLit(1, p(1, 6)),
+					p(1, 2), p(1, 5))))
+	})
+
+	expectParseString(t, "a?.b?.[c]?.[:d]", "a?.b?.[c]?.[:d]")
+
+	// "?" followed by "[" is a ternary expression
+	expectParseString(t, "x := c ?[1, 2] : [3]", "x := (c ? [1, 2] : [3])")
+	expectParseString(t, "c?[1]:[2]", "(c ? [1] : [2])")
+
+	expectParseError(t, "a?.1")
+	expectParseError(t, "a?.(b)")
+	expectParseError(t, "a.[0]")
 }
 
 func TestParseSelector(t *testing.T) {
@@ -1505,6 +1701,222 @@ func TestParseString(t *testing.T) {
 	})
 }
 
+func TestParseFString(t *testing.T) {
+	expectParse(t, `a = f"x ${b + 1}!"`, func(p pfn) []Stmt {
+		return stmts(
+			assignStmt(
+				exprs(ident("a", p(1, 1))),
+				exprs(fstringLit(p(1, 5),
+					stringLit("x ", p(1, 7)),
+					binaryExpr(
+						ident("b", p(1, 11)),
+						intLit(1, p(1, 15)),
+						token.Add,
+						p(1, 13)),
+					stringLit("!", p(1, 17)))),
+				token.Assign,
+				p(1, 3)))
+	})
+
+	expectParse(t, `a = f"${b}${"}"}\${c}"`, func(p pfn) []Stmt {
+		return stmts(
+			assignStmt(
+				exprs(ident("a", p(1, 1))),
+				exprs(fstringLit(p(1, 5),
+					ident("b", p(1, 9)),
+					stringLit("}", p(1, 13)),
+					stringLit("${c}", p(1, 17)))),
+				token.Assign,
+				p(1, 3)))
+	})
+
+	expectParse(t, `a = f""`, func(p pfn) []Stmt {
+		return stmts(
+			assignStmt(
+				exprs(ident("a", p(1, 1))),
+				exprs(fstringLit(p(1, 5))),
+				token.Assign,
+				p(1, 3)))
+	})
+
+	expectParseString(t, `a = f"x ${b}"`, `a = f"x ${b}"`)
+
+	expectParseError(t, `a = f"${}"`)
+	expectParseError(t, `a = f"${b"`)
+	expectParseError(t, `a = f"${b c}"`)
+	expectParseError(t, `a = f"\q"`)
+	expectParseError(t, `a = {f"b": 1}`)
+	expectParseError(t, `a = import(f"b")`)
+}
+
+func TestParseSwitch(t *testing.T) {
+	expectParse(t, "switch x { case 1, 2: a; default: b }",
+		func(p pfn) []Stmt {
+			return stmts(
+				switchStmt(nil, ident("x", p(1, 8)),
+					blockStmt(p(1, 10), p(1, 37),
+						caseClause(
+							exprs(intLit(1, p(1, 17)), intLit(2, p(1, 20))),
+							nil, p(1, 12), p(1, 21),
+							exprStmt(ident("a", p(1, 23)))),
+						caseClause(nil, nil, p(1, 26), p(1, 33),
+							exprStmt(ident("b", p(1, 35))))),
+					p(1, 1)))
+		})
+
+	expectParse(t, "switch a := 1; { case a > 0 if b: }",
+		func(p pfn) []Stmt {
+			return stmts(
+				switchStmt(
+					assignStmt(
+						exprs(ident("a", p(1, 8))),
+						exprs(intLit(1, p(1, 13))),
+						token.Define, p(1, 10)),
+					nil,
+					blockStmt(p(1, 16), p(1, 35),
+						caseClause(
+							exprs(binaryExpr(
+								ident("a", p(1, 23)),
+								intLit(0, p(1, 27)),
+								token.Greater,
+								p(1, 25))),
+							ident("b", p(1, 32)), p(1, 18), p(1, 33))),
+					p(1, 1)))
+		})
+
+	expectParseString(t, "switch {}", "switch {}")
+	expectParseString(t, `switch x := f(); x { case int, "a": g() }`,
+		`switch x := f(); x {case int, "a": g()}`)
+	expectParseString(t, `switch x {
+case 1 if y > 0:
+	a()
+	b()
+default:
+}`, `switch x {case 1 if (y > 0): a(); b(); default: }`)
+
+	expectParseError(t, "switch x { a() }")
+	expectParseError(t, "switch x { case: }")
+	expectParseError(t, "switch x { case 1 }")
+	expectParseError(t, "switch x; y := 1 {}")
+}
+
+func TestParseTry(t *testing.T) {
+	expectParse(t, "try { a() } catch e { throw e }", func(p pfn) []Stmt {
+		return stmts(
+			tryStmt(
+				blockStmt(p(1, 5), p(1, 11),
+					exprStmt(callExpr(ident("a", p(1, 7)),
+						p(1, 8), p(1, 9), NoPos))),
+				ident("e", p(1, 19)),
+				blockStmt(p(1, 21), p(1, 31),
+					throwStmt(p(1, 23), ident("e", p(1, 29)))),
+				nil,
+				p(1, 1), p(1, 13), NoPos))
+	})
+
+	expectParse(t, "try {} catch {} finally {}", func(p pfn) []Stmt {
+		return stmts(
+			tryStmt(
+				blockStmt(p(1, 5), p(1, 6)),
+				nil,
+				blockStmt(p(1, 14), p(1, 15)),
+				blockStmt(p(1, 25), p(1, 26)),
+				p(1, 1), p(1, 8), p(1, 17)))
+	})
+
+	expectParse(t, "try {} finally {}", func(p pfn) []Stmt {
+		return stmts(
+			tryStmt(
+				blockStmt(p(1, 5), p(1, 6)),
+				nil,
+				nil,
+				blockStmt(p(1, 16), p(1, 17)),
+				p(1, 1), NoPos, p(1, 8)))
+	})
+
+	expectParseString(t, "try { a() } catch e { throw e } finally { b() }",
+		"try {a()} catch e {throw e} finally {b()}")
+	expectParseString(t, `throw error("foo")`, `throw error("foo")`)
+
+	expectParseError(t, "try {}")
+	expectParseError(t, "try {} finally {} catch {}")
+	expectParseError(t, "throw")
+}
+
+func TestParseYield(t *testing.T) {
+	expectParse(t, "func() { yield 1 }", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				funcLit(
+					funcType(
+						identList(p(1, 5), p(1, 6), false),
+						p(1, 1)),
+					blockStmt(p(1, 8), p(1, 18),
+						yieldStmt(p(1, 10), intLit(1, p(1, 16)))))))
+	})
+
+	expectParseString(t, "func() { yield }", "func() {yield}")
+	expectParseString(t, "func() { yield a + 1; yield }",
+		"func() {yield (a + 1); yield}")
+}
+
+func TestParseDefer(t *testing.T) {
+	expectParse(t, "func() { defer a(b) }", func(p pfn) []Stmt {
+		return stmts(
+			exprStmt(
+				funcLit(
+					funcType(
+						identList(p(1, 5), p(1, 6), false),
+						p(1, 1)),
+					blockStmt(p(1, 8), p(1, 21),
+						deferStmt(p(1, 10),
+							callExpr(ident("a", p(1, 16)),
+								p(1, 17), p(1, 19), NoPos,
+								ident("b", p(1, 18))))))))
+	})
+
+	expectParseString(t, "defer a.b(c...)", "defer a.b(c...)")
+	expectParseString(t, "defer f(1, x: 2)", "defer f(1, x: 2)")
+
+	expectParseError(t, "defer")
+	expectParseError(t, "defer a")
+	expectParseError(t, "defer (a + b)")
+}
+
+func TestParseClass(t *testing.T) {
+	expectParse(t, "class A(x) { func f(self) {} }", func(p pfn) []Stmt {
+		return stmts(
+			classStmt(
+				ident("A", p(1, 7)),
+				identList(p(1, 8), p(1, 10), false,
+					ident("x", p(1, 9))),
+				p(1, 1), p(1, 12), p(1, 30),
+				methodDecl(ident("f", p(1, 19)),
+					funcLit(
+						funcType(
+							identList(p(1, 20), p(1, 25), false,
+								ident("self", p(1, 21))),
+							p(1, 14)),
+						blockStmt(p(1, 27), p(1, 28))))))
+	})
+
+	expectParseString(t, "class A() {}", "class A() {}")
+	expectParseString(t, "class A(x, y = 1, ...z) {}",
+		"class A(x, y = 1, ...z) {}")
+	expectParseString(t, `
+class A(x) {
+	func f(self) { return self.x }
+
+	func g(self, y) {}
+}`, "class A(x) {func f(self) {return self.x}; func g(self, y) {}}")
+
+	expectParseError(t, "class {}")
+	expectParseError(t, "class A {}")
+	expectParseError(t, "class A() { x := 1 }")
+	expectParseError(t, "class A() { func (self) {} }")
+	expectParseError(t, "class A() { func f(self) {}")
+}
+
 type pfn func(int, int) Pos          // position conversion function
 type expectedFn func(pos pfn) []Stmt // callback function to return expected results
 
@@ -1622,6 +2034,100 @@ func returnStmt(pos Pos, result Expr) *ReturnStmt {
 	return &ReturnStmt{Result: result, ReturnPos: pos}
 }
 
+func switchStmt(
+	init Stmt,
+	tag Expr,
+	body *BlockStmt,
+	pos Pos,
+) *SwitchStmt {
+	return &SwitchStmt{Init: init, Tag: tag, Body: body, SwitchPos: pos}
+}
+
+func caseClause(
+	list []Expr,
+	guard Expr,
+	pos, colon Pos,
+	body ...Stmt,
+) *CaseClause {
+	return &CaseClause{
+		Case: pos, List: list, Guard: guard, Colon: colon, Body: body,
+	}
+}
+
+func arrayPattern(
+	lbrack, rbrack Pos,
+	rest *Ident,
+	list ...*PatternElement,
+) *ArrayPattern {
+	return &ArrayPattern{
+		LBrack: lbrack, RBrack: rbrack, Rest: rest, Elements: list,
+	}
+}
+
+func mapPattern(lbrace, rbrace Pos, list ...*PatternElement) *MapPattern {
+	return &MapPattern{LBrace: lbrace, RBrace: rbrace, Elements: list}
+}
+
+func patternElement(
+	key string,
+	keyPos Pos,
+	name *Ident,
+	def Expr,
+) *PatternElement {
+	return &PatternElement{
+		Key: key, KeyPos: keyPos, Name: name, Default: def,
+	}
+}
+
+func throwStmt(pos Pos, result Expr) *ThrowStmt {
+	return &ThrowStmt{Result: result, ThrowPos: pos}
+}
+
+func classStmt(
+	name *Ident,
+	fields *IdentList,
+	pos, lbrace, rbrace Pos,
+	methods ...*MethodDecl,
+) *ClassStmt {
+	return &ClassStmt{
+		Name:     name,
+		Fields:   fields,
+		Methods:  methods,
+		ClassPos: pos,
+		LBrace:   lbrace,
+		RBrace:   rbrace,
+	}
+}
+
+func methodDecl(name *Ident, fn *FuncLit) *MethodDecl {
+	return &MethodDecl{Name: name, Func: fn}
+}
+
+func deferStmt(pos Pos, call *CallExpr) *DeferStmt {
+	return &DeferStmt{Call: call, DeferPos: pos}
+}
+
+func yieldStmt(pos Pos, result Expr) *YieldStmt {
+	return &YieldStmt{Result: result, YieldPos: pos}
+}
+
+func tryStmt(
+	body *BlockStmt,
+	ident *Ident,
+	catch, finally *BlockStmt,
+	pos, catchPos, finallyPos Pos,
+) *TryStmt {
+	return &TryStmt{
+		TryPos:     pos,
+		Body:       body,
+		CatchPos:   catchPos,
+		Ident:      ident,
+		Catch:      catch,
+		FinallyPos: finallyPos,
+		Finally:    finally,
+	}
+}
+
 func forStmt(
 	init Stmt,
 	cond Expr,
@@ -1687,6 +2193,11 @@ func identList(
 	}
 }
 
+func identListDefaults(list *IdentList, defaults ...Expr) *IdentList {
+	list.Defaults = defaults
+	return list
+}
+
 func binaryExpr(
 	x, y Expr,
 	op token.Token,
@@ -1731,6 +2242,10 @@ func stringLit(value string, pos Pos) *StringLit {
 	return &StringLit{Value: value, ValuePos: pos}
 }
 
+func fstringLit(pos Pos, parts ...Expr) *FStringLit {
+	return &FStringLit{Parts: parts, ValuePos: pos}
+}
+
 func charLit(value rune, pos Pos) *CharLit {
 	return &CharLit{
 		Value: value, ValuePos: pos, Literal: fmt.Sprintf("'%c'", value),
@@ -1780,6 +2295,15 @@ func callExpr(
 		Ellipsis: ellipsis, Args: args}
 }
 
+func keywordCallExpr(call *CallExpr, keywords ...*KeywordArg) *CallExpr {
+	call.Keywords = keywords
+	return call
+}
+
+func keywordArg(name *Ident, colon Pos, value Expr) *KeywordArg {
+	return &KeywordArg{Name: name, Colon: colon, Value: value}
+}
+
 func indexExpr(
 	x, index Expr,
 	lbrack, rbrack Pos,
@@ -1812,6 +2336,18 @@ func selectorExpr(x, sel Expr) *SelectorExpr {
 	return &SelectorExpr{Expr: x, Sel: sel}
 }
 
+func optional(x Expr) Expr {
+	switch x := x.(type) {
+	case *SelectorExpr:
+		x.Optional = true
+	case *IndexExpr:
+		x.Optional = true
+	case *SliceExpr:
+		x.Optional = true
+	}
+	return x
+}
+
 func equalStmt(t *testing.T, expected, actual Stmt) {
 	if expected == nil || reflect.ValueOf(expected).IsNil() {
 		require.Nil(t, actual, "expected nil, but got not nil")
@@ -1879,6 +2415,58 @@ func equalStmt(t *testing.T, expected, actual Stmt) {
 			actual.(*ReturnStmt).Result)
 		require.Equal(t, expected.ReturnPos,
 			actual.(*ReturnStmt).ReturnPos)
+	case *ThrowStmt:
+		equalExpr(t, expected.Result,
+			actual.(*ThrowStmt).Result)
+		require.Equal(t, expected.ThrowPos,
+			actual.(*ThrowStmt).ThrowPos)
+	case *ClassStmt:
+		equalExpr(t, expected.Name, actual.(*ClassStmt).Name)
+		equalFuncType(t, &FuncType{Params: expected.Fields},
+			&FuncType{Params: actual.(*ClassStmt).Fields})
+		require.Equal(t, len(expected.Methods),
+			len(actual.(*ClassStmt).Methods))
+		for i, m := range expected.Methods {
+			equalExpr(t, m.Name, actual.(*ClassStmt).Methods[i].Name)
+			equalExpr(t, m.Func, actual.(*ClassStmt).Methods[i].Func)
+		}
+		require.Equal(t, expected.ClassPos,
+			actual.(*ClassStmt).ClassPos)
+		require.Equal(t, expected.LBrace,
+			actual.(*ClassStmt).LBrace)
+		require.Equal(t, expected.RBrace,
+			actual.(*ClassStmt).RBrace)
+	case *DeferStmt:
+		equalExpr(t, expected.Call,
+			actual.(*DeferStmt).Call)
+		require.Equal(t, expected.DeferPos,
+			actual.(*DeferStmt).DeferPos)
+	case *YieldStmt:
+		equalExpr(t, expected.Result,
+			actual.(*YieldStmt).Result)
+		require.Equal(t, expected.YieldPos,
+			actual.(*YieldStmt).YieldPos)
+	case *SwitchStmt:
+		equalStmt(t, expected.Init, actual.(*SwitchStmt).Init)
+		equalExpr(t, expected.Tag, actual.(*SwitchStmt).Tag)
+		equalStmt(t, expected.Body, actual.(*SwitchStmt).Body)
+		require.Equal(t, expected.SwitchPos,
+			actual.(*SwitchStmt).SwitchPos)
+	case *CaseClause:
+		equalExprs(t, expected.List, actual.(*CaseClause).List)
+		equalExpr(t, expected.Guard, actual.(*CaseClause).Guard)
+		equalStmts(t, expected.Body, actual.(*CaseClause).Body)
+		require.Equal(t, expected.Case, actual.(*CaseClause).Case)
+		require.Equal(t, expected.Colon, actual.(*CaseClause).Colon)
+	case *TryStmt:
+		equalStmt(t, expected.Body, actual.(*TryStmt).Body)
+		equalExpr(t, expected.Ident, actual.(*TryStmt).Ident)
+		equalStmt(t, expected.Catch, actual.(*TryStmt).Catch)
+		equalStmt(t, expected.Finally, actual.(*TryStmt).Finally)
+		require.Equal(t, expected.TryPos, actual.(*TryStmt).TryPos)
+		require.Equal(t, expected.CatchPos, actual.(*TryStmt).CatchPos)
+		require.Equal(t, expected.FinallyPos,
+			actual.(*TryStmt).FinallyPos)
 	case *BranchStmt:
 		equalExpr(t, expected.Label,
 			actual.(*BranchStmt).Label)
@@ -1930,6 +2518,10 @@ func equalExpr(t *testing.T, expected, actual Expr) {
 			actual.(*StringLit).Value)
 		require.Equal(t, int(expected.ValuePos),
 			int(actual.(*StringLit).ValuePos))
+	case *FStringLit:
+		require.Equal(t, int(expected.ValuePos),
+			int(actual.(*FStringLit).ValuePos))
+		equalExprs(t, expected.Parts, actual.(*FStringLit).Parts)
 	case *ArrayLit:
 		require.Equal(t, expected.LBrack,
 			actual.(*ArrayLit).LBrack)
@@ -1937,6 +2529,25 @@ func equalExpr(t *testing.T, expected, actual Expr) {
 			actual.(*ArrayLit).RBrack)
 		equalExprs(t, expected.Elements,
 			actual.(*ArrayLit).Elements)
+	case *ArrayPattern:
+		require.Equal(t, expected.LBrack,
+			actual.(*ArrayPattern).LBrack)
+		require.Equal(t, expected.RBrack,
+			actual.(*ArrayPattern).RBrack)
+		if expected.Rest == nil {
+			require.Nil(t, actual.(*ArrayPattern).Rest)
+		} else {
+			equalExpr(t, expected.Rest, actual.(*ArrayPattern).Rest)
+		}
+		equalPatternElements(t, expected.Elements,
+			actual.(*ArrayPattern).Elements)
+	case *MapPattern:
+		require.Equal(t, expected.LBrace,
+			actual.(*MapPattern).LBrace)
+		require.Equal(t, expected.RBrace,
+			actual.(*MapPattern).RBrace)
+		equalPatternElements(t, expected.Elements,
+			actual.(*MapPattern).Elements)
 	case *MapLit:
 		require.Equal(t, expected.LBrace,
 			actual.(*MapLit).LBrace)
@@ -1974,6 +2585,15 @@ func equalExpr(t *testing.T, expected, actual Expr) {
 			actual.(*CallExpr).RParen)
 		equalExprs(t, expected.Args,
 			actual.(*CallExpr).Args)
+		require.Equal(t, len(expected.Keywords),
+			len(actual.(*CallExpr).Keywords))
+		for i, kw := range expected.Keywords {
+			equalExpr(t, kw, actual.(*CallExpr).Keywords[i])
+		}
+	case *KeywordArg:
+		equalExpr(t, expected.Name, actual.(*KeywordArg).Name)
+		require.Equal(t, expected.Colon, actual.(*KeywordArg).Colon)
+		equalExpr(t, expected.Value, actual.(*KeywordArg).Value)
 	case *ParenExpr:
 		equalExpr(t, expected.Expr,
 			actual.(*ParenExpr).Expr)
@@ -1990,6 +2610,8 @@ func equalExpr(t *testing.T, expected, actual Expr) {
 			actual.(*IndexExpr).LBrack)
 		require.Equal(t, expected.RBrack,
 			actual.(*IndexExpr).RBrack)
+		require.Equal(t, expected.Optional,
+			actual.(*IndexExpr).Optional)
 	case *SliceExpr:
 		equalExpr(t, expected.Expr,
 			actual.(*SliceExpr).Expr)
@@ -2001,11 +2623,15 @@ func equalExpr(t *testing.T, expected, actual Expr) {
 			actual.(*SliceExpr).LBrack)
 		require.Equal(t, expected.RBrack,
 			actual.(*SliceExpr).RBrack)
+		require.Equal(t, expected.Optional,
+			actual.(*SliceExpr).Optional)
 	case *SelectorExpr:
 		equalExpr(t, expected.Expr,
 			actual.(*SelectorExpr).Expr)
 		equalExpr(t, expected.Sel,
 			actual.(*SelectorExpr).Sel)
+		require.Equal(t, expected.Optional,
+			actual.(*SelectorExpr).Optional)
 	case *ImportExpr:
 		require.Equal(t, expected.ModuleName,
 			actual.(*ImportExpr).ModuleName)
@@ -2042,6 +2668,7 @@ func equalFuncType(t *testing.T, expected, actual *FuncType) {
 	require.Equal(t, expected.Params.LParen, actual.Params.LParen)
 	require.Equal(t, expected.Params.RParen, actual.Params.RParen)
 	equalIdents(t, expected.Params.List, actual.Params.List)
+	equalExprs(t, expected.Params.Defaults, actual.Params.Defaults)
 }
 
 func equalIdents(t *testing.T, expected, actual []*Ident) {
@@ -2078,6 +2705,19 @@ func equalMapElements(
 	}
 }
 
+func equalPatternElements(
+	t *testing.T,
+	expected, actual []*PatternElement,
+) {
+	require.Equal(t, len(expected), len(actual))
+	for i := 0; i < len(expected); i++ {
+		require.Equal(t, expected[i].Key, actual[i].Key)
+		require.Equal(t, expected[i].KeyPos, actual[i].KeyPos)
+		equalExpr(t, expected[i].Name, actual[i].Name)
+		equalExpr(t, expected[i].Default, actual[i].Default)
+	}
+}
+
 func parseSource(
 	filename string,
 	src []byte,
@@ -85,6 +85,10 @@ func (s *Scanner) Scan() (
 
 	// determine token value
 	switch ch := s.ch; {
+	case ch == 'f' && s.peek() == '"':
+		insertSemi = true
+		tok = token.String
+		literal = s.scanFString()
 	case isLetter(ch):
 		literal = s.scanIdentifier()
 		tok = token.Lookup(literal)
@@ -139,7 +143,17 @@ func (s *Scanner) Scan() (
 		case ',':
 			tok = token.Comma
 		case '?':
-			tok = token.Question
+			switch {
+			case s.ch == '?':
+				s.next()
+				tok = token.Coalesce
+			case s.ch == '.' && !isDigit(rune(s.peek())):
+				// "?.5" is "?" followed by a float
+				s.next()
+				tok = token.OptPeriod
+			default:
+				tok = token.Question
+			}
 		case ';':
 			tok = token.Semicolon
 			literal = ";"
@@ -169,7 +183,8 @@ func (s *Scanner) Scan() (
 				insertSemi = true
 			}
 		case '*':
-			tok = s.switch2(token.Mul, token.MulAssign)
+			tok = s.switch4(token.Mul, token.MulAssign, '*', token.Pow,
+				token.PowAssign)
 		case '/':
 			if s.ch == '/' || s.ch == '*' {
 				// comment
@@ -568,6 +583,65 @@ func (s *Scanner) scanString() string {
 	return string(s.src[offs:s.offset])
 }
 
+// scanFString scans an interpolated string literal such as f"a = ${a}". The
+// embedded expressions are scanned as tokens up to their closing braces, so
+// they can contain strings, chars and braces of their own.
+func (s *Scanner) scanFString() string {
+	offs := s.offset
+	s.next() // 'f'
+	s.next() // '"'
+
+	for {
+		ch := s.ch
+		if ch == '\n' || ch < 0 {
+			s.error(offs, "string literal not terminated")
+			break
+		}
+		s.next()
+		if ch == '"' {
+			break
+		}
+		if ch == '\\' {
+			if s.ch == '$' {
+				s.next()
+			} else {
+				s.scanEscape('"')
+			}
+		}
+		if ch == '$' && s.ch == '{' {
+			s.next()
+			if !s.scanEmbedded() {
+				s.error(offs, "string literal not terminated")
+				break
+			}
+		}
+	}
+	return string(s.src[offs:s.offset])
+}
+
+// scanEmbedded skips the tokens of an embedded expression including its
+// closing brace. It returns false if the source ends before the closing brace.
+func (s *Scanner) scanEmbedded() bool {
+	mode := s.mode
+	s.mode |= DontInsertSemis
+	s.insertSemi = false
+	defer func() { s.mode = mode }()
+
+	for depth := 1; ; {
+		switch tok, _, _ := s.Scan(); tok {
+		case token.EOF:
+			return false
+		case token.LBrace:
+			depth++
+		case token.RBrace:
+			depth--
+			if depth == 0 {
+				return true
+			}
+		}
+	}
+}
+
 func (s *Scanner) scanRawString() string {
 	offs := s.offset - 1 // '`' opening already consumed
 
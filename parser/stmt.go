@@ -124,6 +124,102 @@ func (s *BranchStmt) String() string {
 	return s.Token.String() + label
 }
 
+// CaseClause represents a case clause of a switch statement.
+type CaseClause struct {
+	Case  Pos    // position of "case" or "default" keyword
+	List  []Expr // list of expressions; nil means default case
+	Guard Expr   // guard expression; or nil
+	Colon Pos
+	Body  []Stmt
+}
+
+func (s *CaseClause) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *CaseClause) Pos() Pos {
+	return s.Case
+}
+
+// End returns the position of first character immediately after the node.
+func (s *CaseClause) End() Pos {
+	if n := len(s.Body); n > 0 {
+		return s.Body[n-1].End()
+	}
+	return s.Colon + 1
+}
+
+func (s *CaseClause) String() string {
+	str := "default"
+	if s.List != nil {
+		var list []string
+		for _, e := range s.List {
+			list = append(list, e.String())
+		}
+		str = "case " + strings.Join(list, ", ")
+	}
+	if s.Guard != nil {
+		str += " if " + s.Guard.String()
+	}
+	var body []string
+	for _, e := range s.Body {
+		body = append(body, e.String())
+	}
+	return str + ": " + strings.Join(body, "; ")
+}
+
+// ClassStmt represents a class statement.
+type ClassStmt struct {
+	ClassPos Pos
+	Name     *Ident
+	Fields   *IdentList
+	LBrace   Pos
+	Methods  []*MethodDecl
+	RBrace   Pos
+}
+
+func (s *ClassStmt) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *ClassStmt) Pos() Pos {
+	return s.ClassPos
+}
+
+// End returns the position of first character immediately after the node.
+func (s *ClassStmt) End() Pos {
+	return s.RBrace + 1
+}
+
+func (s *ClassStmt) String() string {
+	var methods []string
+	for _, m := range s.Methods {
+		methods = append(methods, m.String())
+	}
+	return "class " + s.Name.String() + s.Fields.String() + " {" +
+		strings.Join(methods, "; ") + "}"
+}
+
+// DeferStmt represents a defer statement.
+type DeferStmt struct {
+	DeferPos Pos
+	Call     *CallExpr
+}
+
+func (s *DeferStmt) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *DeferStmt) Pos() Pos {
+	return s.DeferPos
+}
+
+// End returns the position of first character immediately after the node.
+func (s *DeferStmt) End() Pos {
+	return s.Call.End()
+}
+
+func (s *DeferStmt) String() string {
+	return "defer " + s.Call.String()
+}
+
 // EmptyStmt represents an empty statement.
 type EmptyStmt struct {
 	Semicolon Pos
@@ -320,6 +416,27 @@ func (s *IncDecStmt) String() string {
 	return s.Expr.String() + s.Token.String()
 }
 
+// MethodDecl represents a method declaration of a class statement.
+type MethodDecl struct {
+	Name *Ident
+	Func *FuncLit
+}
+
+// Pos returns the position of first character belonging to the node.
+func (d *MethodDecl) Pos() Pos {
+	return d.Func.Pos()
+}
+
+// End returns the position of first character immediately after the node.
+func (d *MethodDecl) End() Pos {
+	return d.Func.End()
+}
+
+func (d *MethodDecl) String() string {
+	return "func " + d.Name.String() + d.Func.Type.Params.String() + " " +
+		d.Func.Body.String()
+}
+
 // ReturnStmt represents a return statement.
 type ReturnStmt struct {
 	ReturnPos Pos
@@ -347,3 +464,128 @@ func (s *ReturnStmt) String() string {
 	}
 	return "return"
 }
+
+// SwitchStmt represents a switch statement.
+type SwitchStmt struct {
+	SwitchPos Pos
+	Init      Stmt
+	Tag       Expr       // or nil
+	Body      *BlockStmt // CaseClauses only
+}
+
+func (s *SwitchStmt) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *SwitchStmt) Pos() Pos {
+	return s.SwitchPos
+}
+
+// End returns the position of first character immediately after the node.
+func (s *SwitchStmt) End() Pos {
+	return s.Body.End()
+}
+
+func (s *SwitchStmt) String() string {
+	str := "switch "
+	if s.Init != nil {
+		str += s.Init.String() + "; "
+	}
+	if s.Tag != nil {
+		str += s.Tag.String() + " "
+	}
+	return str + s.Body.String()
+}
+
+// ThrowStmt represents a throw statement.
+type ThrowStmt struct {
+	ThrowPos Pos
+	Result   Expr
+}
+
+func (s *ThrowStmt) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *ThrowStmt) Pos() Pos {
+	return s.ThrowPos
+}
+
+// End returns the position of first character immediately after the node.
+func (s *ThrowStmt) End() Pos {
+	return s.Result.End()
+}
+
+func (s *ThrowStmt) String() string {
+	return "throw " + s.Result.String()
+}
+
+// TryStmt represents a try statement.
+type TryStmt struct {
+	TryPos     Pos
+	Body       *BlockStmt
+	CatchPos   Pos
+	Ident      *Ident     // error variable of catch clause; or nil
+	Catch      *BlockStmt // catch clause; or nil
+	FinallyPos Pos
+	Finally    *BlockStmt // finally clause; or nil
+}
+
+func (s *TryStmt) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *TryStmt) Pos() Pos {
+	return s.TryPos
+}
+
+// End returns the position of first character immediately after the node.
+func (s *TryStmt) End() Pos {
+	if s.Finally != nil {
+		return s.Finally.End()
+	}
+	if s.Catch != nil {
+		return s.Catch.End()
+	}
+	return s.Body.End()
+}
+
+func (s *TryStmt) String() string {
+	str := "try " + s.Body.String()
+	if s.Catch != nil {
+		str += " catch "
+		if s.Ident != nil {
+			str += s.Ident.String() + " "
+		}
+		str += s.Catch.String()
+	}
+	if s.Finally != nil {
+		str += " finally " + s.Finally.String()
+	}
+	return str
+}
+
+// YieldStmt represents a yield statement.
+type YieldStmt struct {
+	YieldPos Pos
+	Result   Expr
+}
+
+func (s *YieldStmt) stmtNode() {}
+
+// Pos returns the position of first character belonging to the node.
+func (s *YieldStmt) Pos() Pos {
+	return s.YieldPos
+}
+
+// End returns the position of first character immediately after the node.
+func (s *YieldStmt) End() Pos {
+	if s.Result != nil {
+		return s.Result.End()
+	}
+	return s.YieldPos + 5
+}
+
+func (s *YieldStmt) String() string {
+	if s.Result != nil {
+		return "yield " + s.Result.String()
+	}
+	return "yield"
+}
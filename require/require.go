@@ -161,9 +161,13 @@ func Equal(
 	case *common.Map:
 		equalObjectMap(t, expected.Value,
 			actual.(*common.Map).Value, msg...)
+		equalMapEntries(t, expected.Entries,
+			actual.(*common.Map).Entries, msg...)
 	case *common.ImmutableMap:
 		equalObjectMap(t, expected.Value,
 			actual.(*common.ImmutableMap).Value, msg...)
+		equalMapEntries(t, expected.Entries,
+			actual.(*common.ImmutableMap).Entries, msg...)
 	case *common.CompiledFunction:
 		equalCompiledFunction(t, expected,
 			actual.(*common.CompiledFunction), msg...)
@@ -296,6 +300,19 @@ func equalObjectMap(
 	}
 }
 
+func equalMapEntries(
+	t *testing.T,
+	expected, actual map[string]common.MapEntry,
+	msg ...interface{},
+) {
+	Equal(t, len(expected), len(actual), msg...)
+	for key, expectedEntry := range expected {
+		actualEntry := actual[key]
+		Equal(t, expectedEntry.Key, actualEntry.Key, msg...)
+		Equal(t, expectedEntry.Value, actualEntry.Value, msg...)
+	}
+}
+
 func equalCompiledFunction(
 	t *testing.T,
 	expected, actual common.Object,
@@ -4,11 +4,13 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"sync"
 
 	"github.com/d5/tengo/v2/common"
 	"github.com/d5/tengo/v2/complier"
 	"github.com/d5/tengo/v2/parser"
+	"github.com/d5/tengo/v2/storage"
 	"github.com/d5/tengo/v2/vm"
 )
 
@@ -21,6 +23,12 @@ type Script struct {
 	maxConstObjects  int
 	enableFileImport bool
 	importDir        string
+	storage          *storage.Storage
+	gasLimit         int64
+	gasSchedule      *vm.GasSchedule
+	deterministic    bool
+	checkedArith     bool
+	exportName       string
 }
 
 // NewScript creates a Script instance with an input script.
@@ -30,6 +38,7 @@ func NewScript(input []byte) *Script {
 		input:           input,
 		maxAllocs:       -1,
 		maxConstObjects: -1,
+		gasLimit:        -1,
 	}
 }
 
@@ -75,6 +84,19 @@ func (s *Script) SetMaxAllocs(n int64) {
 	s.maxAllocs = n
 }
 
+// SetGasLimit sets the maximum amount of gas that a run can use. Compiled
+// script will return common.ErrOutOfGas error if it exceeds this limit. Set
+// this to a negative number (default) to disable the limit.
+func (s *Script) SetGasLimit(n int64) {
+	s.gasLimit = n
+}
+
+// SetGasSchedule sets the gas cost table for the gas metering. If the gas
+// limit is set and the schedule is not, vm.DefaultGasSchedule is used.
+func (s *Script) SetGasSchedule(schedule *vm.GasSchedule) {
+	s.gasSchedule = schedule
+}
+
 // SetMaxConstObjects sets the maximum number of objects in the compiled
 // constants.
 func (s *Script) SetMaxConstObjects(n int) {
@@ -87,6 +109,36 @@ func (s *Script) EnableFileImport(enable bool) {
 	s.enableFileImport = enable
 }
 
+// SetStorage enables the persistent globals mode for the compiled script.
+// Global variables are loaded from the storage on their first access during
+// the run, and, the changed ones are written back when the run succeeds.
+func (s *Script) SetStorage(st *storage.Storage) {
+	s.storage = st
+}
+
+// EnableDeterministic enables or disables the deterministic mode, in which the
+// same compiled script with the same inputs and state always produces the
+// same results. Non-deterministic modules (see common.BuiltinModule) are
+// rejected at compile time, maps are iterated in sorted key order, and, NaN
+// float values are canonicalized. It's disabled by default.
+func (s *Script) EnableDeterministic(enable bool) {
+	s.deterministic = enable
+}
+
+// EnableCheckedArithmetic enables or disables the checked arithmetic mode, in
+// which the int add, sub, mul, shl and "**" operations fail with a runtime
+// error on overflow instead of wrapping around. It's disabled by default.
+func (s *Script) EnableCheckedArithmetic(enable bool) {
+	s.checkedArith = enable
+}
+
+// SetExportName makes the export statement of the script assign the exported
+// value to the global variable name, so it can be accessed by Compiled.Get
+// after the run. By default, the export statement is ignored for scripts.
+func (s *Script) SetExportName(name string) {
+	s.exportName = name
+}
+
 // Compile compiles the script with all the defined variables, and, returns
 // Compiled object.
 func (s *Script) Compile() (*Compiled, error) {
@@ -105,6 +157,8 @@ func (s *Script) Compile() (*Compiled, error) {
 
 	c := complier.NewCompiler(srcFile, symbolTable, nil, s.modules, nil)
 	c.EnableFileImport(s.enableFileImport)
+	c.EnableDeterministic(s.deterministic)
+	c.SetExportName(s.exportName)
 	c.SetImportDir(s.importDir)
 	if err := c.Compile(file); err != nil {
 		return nil, err
@@ -133,11 +187,19 @@ func (s *Script) Compile() (*Compiled, error) {
 			return nil, fmt.Errorf("exceeding constant objects limit: %d", cnt)
 		}
 	}
+	if s.storage != nil && s.modules != nil {
+		s.storage.SetImports(s.modules)
+	}
 	return &Compiled{
 		globalIndexes: globalIndexes,
 		bytecode:      bytecode,
 		globals:       globals,
 		maxAllocs:     s.maxAllocs,
+		storage:       s.storage,
+		gasLimit:      s.gasLimit,
+		gasSchedule:   s.gasSchedule,
+		deterministic: s.deterministic,
+		checkedArith:  s.checkedArith,
 	}, nil
 }
 
@@ -173,6 +235,8 @@ func (s *Script) prepCompile() (
 	for name := range s.variables {
 		names = append(names, name)
 	}
+	// stable global indexes are needed to persist the globals
+	sort.Strings(names)
 
 	symbolTable = complier.NewSymbolTable()
 	for idx, fn := range common.GetAllBuiltinFunctions() {
@@ -187,7 +251,7 @@ func (s *Script) prepCompile() (
 			panic(fmt.Errorf("wrong symbol index: %d != %d",
 				idx, symbol.Index))
 		}
-		globals[symbol.Index] = s.variables[name].Value().(common.Object)
+		globals[symbol.Index] = s.variables[name].Object()
 	}
 	return
 }
@@ -199,6 +263,12 @@ type Compiled struct {
 	bytecode      *complier.Bytecode
 	globals       []common.Object
 	maxAllocs     int64
+	storage       *storage.Storage
+	gasLimit      int64
+	gasSchedule   *vm.GasSchedule
+	gasUsed       int64
+	deterministic bool
+	checkedArith  bool
 	lock          sync.RWMutex
 }
 
@@ -207,7 +277,10 @@ func (c *Compiled) Run() error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	v := vm.NewVM(c.bytecode, c.globals, c.maxAllocs)
+	v := c.newVM()
+	defer func() {
+		c.gasUsed = v.GasUsed()
+	}()
 	return v.Run()
 }
 
@@ -216,7 +289,10 @@ func (c *Compiled) RunContext(ctx context.Context) (err error) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	v := vm.NewVM(c.bytecode, c.globals, c.maxAllocs)
+	v := c.newVM()
+	defer func() {
+		c.gasUsed = v.GasUsed()
+	}()
 	ch := make(chan error, 1)
 	go func() {
 		ch <- v.Run()
@@ -232,6 +308,31 @@ func (c *Compiled) RunContext(ctx context.Context) (err error) {
 	return
 }
 
+// Bytecode returns the compiled bytecode of the script.
+func (c *Compiled) Bytecode() *complier.Bytecode {
+	return c.bytecode
+}
+
+// GasUsed returns the gas used by the last run. It's always 0 if the gas
+// metering is not enabled.
+func (c *Compiled) GasUsed() int64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.gasUsed
+}
+
+func (c *Compiled) newVM() *vm.VM {
+	v := vm.NewVM(c.bytecode, c.globals, c.maxAllocs)
+	v.SetStorage(c.storage)
+	v.SetDeterministic(c.deterministic)
+	v.SetCheckedArithmetic(c.checkedArith)
+	if c.gasSchedule != nil || c.gasLimit >= 0 {
+		v.SetGasLimit(c.gasLimit, c.gasSchedule)
+	}
+	return v
+}
+
 // Clone creates a new copy of Compiled. Cloned copies are safe for concurrent
 // use by multiple goroutines.
 func (c *Compiled) Clone() *Compiled {
@@ -243,6 +344,11 @@ func (c *Compiled) Clone() *Compiled {
 		bytecode:      c.bytecode,
 		globals:       make([]common.Object, len(c.globals)),
 		maxAllocs:     c.maxAllocs,
+		storage:       c.storage,
+		gasLimit:      c.gasLimit,
+		gasSchedule:   c.gasSchedule,
+		deterministic: c.deterministic,
+		checkedArith:  c.checkedArith,
 	}
 	// copy global objects
 	for idx, g := range c.globals {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"strings"
 	"sync"
@@ -11,10 +12,13 @@ import (
 	"time"
 
 	"github.com/d5/tengo/v2/common"
+	"github.com/d5/tengo/v2/parser"
 	"github.com/d5/tengo/v2/require"
 	"github.com/d5/tengo/v2/scripts"
 	"github.com/d5/tengo/v2/stdlib"
+	"github.com/d5/tengo/v2/storage"
 	"github.com/d5/tengo/v2/token"
+	"github.com/d5/tengo/v2/vm"
 )
 
 func TestScript_Add(t *testing.T) {
@@ -60,6 +64,34 @@ func TestScript_Run(t *testing.T) {
 	compiledGet(t, c, "a", int64(5))
 }
 
+func TestScript_SetExportName(t *testing.T) {
+	s := scripts.NewScript([]byte(`a := 5; export {a: a}`))
+	c, err := s.Run()
+	require.NoError(t, err)
+	require.False(t, c.IsDefined("exports"))
+
+	s.SetExportName("exports")
+	c, err = s.Run()
+	require.NoError(t, err)
+	require.True(t, c.IsDefined("exports"))
+	exports, ok := c.Get("exports").Object().(*common.ImmutableMap)
+	require.True(t, ok)
+	require.Equal(t, int64(5), exports.Value["a"].(*common.Int).Value)
+}
+
+func TestScript_EnableCheckedArithmetic(t *testing.T) {
+	s := scripts.NewScript([]byte(`a := b + 1`))
+	err := s.Add("b", math.MaxInt64)
+	require.NoError(t, err)
+	c, err := s.Run()
+	require.NoError(t, err)
+	compiledGet(t, c, "a", int64(math.MinInt64))
+
+	s.EnableCheckedArithmetic(true)
+	_, err = s.Run()
+	require.True(t, errors.Is(err, common.ErrIntegerOverflow))
+}
+
 func TestScript_BuiltinModules(t *testing.T) {
 	s := scripts.NewScript([]byte(`math := import("math"); a := math.abs(-19.84)`))
 	s.SetImports(stdlib.GetModuleMap("math"))
@@ -508,6 +540,157 @@ func compiledRun(t *testing.T, c *scripts.Compiled) {
 	require.NoError(t, err)
 }
 
+func TestCompiled_GasUsed(t *testing.T) {
+	s := scripts.NewScript([]byte(`a := 0; for i := 0; i < n; i++ { a += i }`))
+	require.NoError(t, s.Add("n", 10))
+	c, err := s.Compile()
+	require.NoError(t, err)
+	require.NoError(t, c.Run())
+	require.Equal(t, int64(0), c.GasUsed()) // metering not enabled
+
+	s.SetGasLimit(10000)
+	c, err = s.Compile()
+	require.NoError(t, err)
+	require.NoError(t, c.Run())
+	used := c.GasUsed()
+	require.True(t, used > 0)
+
+	// gas used grows with the number of iterations
+	require.NoError(t, c.Set("n", 20))
+	require.NoError(t, c.Run())
+	require.True(t, c.GasUsed() > used)
+
+	// same result for the cloned copies
+	clone := c.Clone()
+	require.NoError(t, clone.Run())
+	require.Equal(t, c.GasUsed(), clone.GasUsed())
+
+	require.NoError(t, c.Set("n", 100000))
+	err = c.Run()
+	require.True(t, errors.As(err, &common.ErrOutOfGas{}))
+	require.True(t, c.GasUsed() > 10000)
+
+	// custom schedule without the limit
+	schedule := vm.DefaultGasSchedule()
+	schedule.Opcodes[parser.OpBinaryOp] = 1000
+	s.SetGasLimit(-1)
+	s.SetGasSchedule(schedule)
+	c, err = s.Compile()
+	require.NoError(t, err)
+	require.NoError(t, c.Run())
+	require.True(t, c.GasUsed() > 30*1000)
+}
+
+type memDB struct {
+	storage.DB
+	sets int
+}
+
+func (db *memDB) Set(key string, value []byte) error {
+	db.sets++
+	return db.DB.Set(key, value)
+}
+
+func TestCompiled_Storage(t *testing.T) {
+	db := &memDB{DB: storage.NewMemDB()}
+	compile := func(src string) *scripts.Compiled {
+		st, err := storage.New("contract", db)
+		require.NoError(t, err)
+		s := scripts.NewScript([]byte(src))
+		require.NoError(t, s.Add("count", 0))
+		require.NoError(t, s.Add("m", map[string]interface{}{}))
+		s.SetStorage(st)
+		c, err := s.Compile()
+		require.NoError(t, err)
+		return c
+	}
+
+	c := compile(`count += 1; m.last = count`)
+	require.NoError(t, c.Run())
+	compiledGet(t, c, "count", int64(1))
+	require.Equal(t, 3, db.sets) // 'count', 'm' and the state root
+
+	// globals are loaded from the storage by a new compiled script
+	c = compile(`count += 1; m.last = count`)
+	require.NoError(t, c.Run())
+	compiledGet(t, c, "count", int64(2))
+	require.Equal(t, int64(2), c.Get("m").Map()["last"])
+	require.Equal(t, 6, db.sets)
+
+	// and by the same compiled script
+	require.NoError(t, c.Run())
+	compiledGet(t, c, "count", int64(3))
+	require.Equal(t, 9, db.sets)
+
+	// unchanged globals are not written
+	c = compile(`a := count; m.last = count`)
+	require.NoError(t, c.Run())
+	compiledGet(t, c, "a", int64(3))
+	require.Equal(t, 11, db.sets) // 'a' and the state root only
+
+	// temporaries of the top-level statements are not written
+	c = compile(`
+x, y := [count * 2, 1]
+switch y { case 1: m.last = y }
+try { m.last += 1 } finally {}`)
+	require.NoError(t, c.Run())
+	compiledGet(t, c, "x", int64(6))
+	require.Equal(t, 15, db.sets) // 'x', 'y', 'm' and the state root
+	st, err := storage.New("contract", db)
+	require.NoError(t, err)
+	v, err := st.GetGlobal(3)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), v.(*common.Int).Value) // 'y'
+	_, err = st.GetGlobal(common.GlobalsSize - 1)
+	require.Equal(t, storage.NotFoundErr, err)
+
+	// nothing is written if the run fails
+	c = compile(`count += 1; m.last = count; a := [1]; a[2] = 3`)
+	require.Error(t, c.Run())
+	require.Equal(t, 15, db.sets)
+	c = compile(`b := count; c := m.last`)
+	require.NoError(t, c.Run())
+	compiledGet(t, c, "b", int64(3))
+	compiledGet(t, c, "c", int64(2))
+
+	// generators cannot be stored, but the iterators of the top-level for-in
+	// statements are temporaries
+	c = compile(`count += 1; g := func() { yield 1 }()`)
+	err = c.Run()
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(),
+		"generator cannot be stored"), err.Error())
+	require.Equal(t, 18, db.sets)
+	c = compile(`for x in func() { yield 1 }() { m.last += x }`)
+	require.NoError(t, c.Run())
+	require.Equal(t, 21, db.sets) // 'x', 'm' and the state root
+	require.Equal(t, int64(3), c.Get("m").Map()["last"])
+
+	// nor closures, whose captured variables would not be written back; a
+	// counter is kept in a global variable instead
+	c = compile(`
+inc := func() { n := 0; return func() { n++; return n } }()
+m.last = inc()`)
+	err = c.Run()
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(),
+		"closure cannot be stored"), err.Error())
+	require.Equal(t, 21, db.sets)
+	for i := int64(4); i < 7; i++ {
+		c = compile(`inc := func() { count++; return count }; m.last = inc()`)
+		require.NoError(t, c.Run())
+		require.Equal(t, i, c.Get("m").Map()["last"])
+	}
+
+	// nor if the run is aborted
+	sets := db.sets
+	c = compile(`count += 1; m.last = count; for {}`)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, c.RunContext(ctx))
+	require.Equal(t, sets, db.sets)
+}
+
 func compiledGet(
 	t *testing.T,
 	c *scripts.Compiled,
@@ -13,4 +13,14 @@ var BuiltinModules = map[string]map[string]common.Object{
 	"json":   jsonModule,
 	"base64": base64Module,
 	"hex":    hexModule,
+	"iter":   iterModule,
+}
+
+// NonDeterministicModules are the names of the builtin modules that can
+// return different results for the same inputs. They cannot be imported in
+// the deterministic mode.
+var NonDeterministicModules = map[string]bool{
+	"os":    true,
+	"rand":  true,
+	"times": true,
 }
@@ -0,0 +1,362 @@
+package stdlib
+
+import (
+	"fmt"
+
+	"github.com/d5/tengo/v2/common"
+)
+
+var iterModule = map[string]common.Object{
+	"map": &common.UserFunction{
+		Name:  "map",
+		Value: iterMap,
+	},
+	"filter": &common.UserFunction{
+		Name:  "filter",
+		Value: iterFilter,
+	},
+	"take": &common.UserFunction{
+		Name:  "take",
+		Value: iterTake,
+	},
+	"zip": &common.UserFunction{
+		Name:  "zip",
+		Value: iterZip,
+	},
+	"enumerate": &common.UserFunction{
+		Name:  "enumerate",
+		Value: iterEnumerate,
+	},
+	"chain": &common.UserFunction{
+		Name:  "chain",
+		Value: iterChain,
+	},
+}
+
+// nextFunc returns the next element, or, false if there are no more elements
+// or the iteration fails with an error.
+type nextFunc func() (common.Object, bool, error)
+
+// lazyIterable is the iterable object returned by the iter functions. Its
+// elements are computed when it's iterated, and, every iteration starts over
+// from the sources, so it can be iterated again if its sources can.
+type lazyIterable struct {
+	common.ObjectImpl
+	name  string
+	start func() nextFunc
+}
+
+// TypeName returns the name of the type.
+func (o *lazyIterable) TypeName() string {
+	return "iterable"
+}
+
+func (o *lazyIterable) String() string {
+	return "<iter." + o.name + ">"
+}
+
+// Copy returns the iterable itself: it's immutable.
+func (o *lazyIterable) Copy() common.Object {
+	return o
+}
+
+// Equals returns true if x is the same iterable.
+func (o *lazyIterable) Equals(x common.Object) bool {
+	return o == x
+}
+
+// Iterate creates an iterator that computes the elements.
+func (o *lazyIterable) Iterate() common.Iterator {
+	return &lazyIterator{next: o.start()}
+}
+
+// CanIterate returns whether the Object can be Iterated.
+func (o *lazyIterable) CanIterate() bool {
+	return true
+}
+
+// lazyIterator iterates the elements of a lazy iterable. The keys are the
+// indexes of the elements.
+type lazyIterator struct {
+	common.ObjectImpl
+	next  nextFunc
+	i     int64
+	value common.Object
+	done  bool
+	err   error
+}
+
+// TypeName returns the name of the type.
+func (i *lazyIterator) TypeName() string {
+	return "iterable-iterator"
+}
+
+func (i *lazyIterator) String() string {
+	return "<iterable-iterator>"
+}
+
+// IsFalsy returns true if the value of the type is falsy.
+func (i *lazyIterator) IsFalsy() bool {
+	return true
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (i *lazyIterator) Equals(common.Object) bool {
+	return false
+}
+
+// Copy returns the iterator itself: the sources cannot be copied.
+func (i *lazyIterator) Copy() common.Object {
+	return i
+}
+
+// Next returns true if there are more elements to iterate.
+func (i *lazyIterator) Next() bool {
+	if i.done {
+		return false
+	}
+	v, ok, err := i.next()
+	if !ok {
+		i.done = true
+		i.err = err
+		return false
+	}
+	i.value = v
+	i.i++
+	return true
+}
+
+// Key returns the index of the current element.
+func (i *lazyIterator) Key() common.Object {
+	return &common.Int{Value: i.i - 1}
+}
+
+// Value returns the current element.
+func (i *lazyIterator) Value() common.Object {
+	return i.value
+}
+
+// Err returns the error of the source or the function that stopped Next.
+func (i *lazyIterator) Err() error {
+	return i.err
+}
+
+// iterate returns an iterator of the elements of x. The values of a map are
+// its elements, and, they are iterated in the order of the keys.
+func iterate(x common.Object) common.Iterator {
+	switch x := x.(type) {
+	case *common.Map:
+		return common.NewSortedMapIterator(x.Value, x.Entries)
+	case *common.ImmutableMap:
+		return common.NewSortedMapIterator(x.Value, x.Entries)
+	}
+	return x.Iterate()
+}
+
+// nextValue advances the iterator, and, returns the value of the element.
+func nextValue(it common.Iterator) (common.Object, bool, error) {
+	if it.Next() {
+		return it.Value(), true, nil
+	}
+	if it, ok := it.(common.ErrorIterator); ok {
+		return nil, false, it.Err()
+	}
+	return nil, false, nil
+}
+
+func checkIterable(name string, x common.Object) error {
+	if !x.CanIterate() {
+		return common.ErrInvalidArgumentType{
+			Name:     name,
+			Expected: "iterable",
+			Found:    x.TypeName(),
+		}
+	}
+	return nil
+}
+
+func checkCallable(name string, x common.Object) error {
+	if !x.CanCall() {
+		return common.ErrInvalidArgumentType{
+			Name:     name,
+			Expected: "callable",
+			Found:    x.TypeName(),
+		}
+	}
+	return nil
+}
+
+// map(x iterable, fn func(v)) => iterable
+func iterMap(args ...common.Object) (common.Object, error) {
+	if len(args) != 2 {
+		return nil, common.ErrWrongNumArguments
+	}
+	x, fn := args[0], args[1]
+	if err := checkIterable("first", x); err != nil {
+		return nil, err
+	}
+	if err := checkCallable("second", fn); err != nil {
+		return nil, err
+	}
+	return &lazyIterable{name: "map", start: func() nextFunc {
+		it := iterate(x)
+		return func() (common.Object, bool, error) {
+			v, ok, err := nextValue(it)
+			if !ok {
+				return nil, false, err
+			}
+			v, err = fn.Call(v)
+			if err != nil {
+				return nil, false, err
+			}
+			if v == nil {
+				v = common.UndefinedValue
+			}
+			return v, true, nil
+		}
+	}}, nil
+}
+
+// filter(x iterable, fn func(v)) => iterable
+func iterFilter(args ...common.Object) (common.Object, error) {
+	if len(args) != 2 {
+		return nil, common.ErrWrongNumArguments
+	}
+	x, fn := args[0], args[1]
+	if err := checkIterable("first", x); err != nil {
+		return nil, err
+	}
+	if err := checkCallable("second", fn); err != nil {
+		return nil, err
+	}
+	return &lazyIterable{name: "filter", start: func() nextFunc {
+		it := iterate(x)
+		return func() (common.Object, bool, error) {
+			for {
+				v, ok, err := nextValue(it)
+				if !ok {
+					return nil, false, err
+				}
+				res, err := fn.Call(v)
+				if err != nil {
+					return nil, false, err
+				}
+				if res != nil && !res.IsFalsy() {
+					return v, true, nil
+				}
+			}
+		}
+	}}, nil
+}
+
+// take(x iterable, n int) => iterable
+func iterTake(args ...common.Object) (common.Object, error) {
+	if len(args) != 2 {
+		return nil, common.ErrWrongNumArguments
+	}
+	x := args[0]
+	if err := checkIterable("first", x); err != nil {
+		return nil, err
+	}
+	n, ok := common.ToInt64(args[1])
+	if !ok {
+		return nil, common.ErrInvalidArgumentType{
+			Name:     "second",
+			Expected: "int(compatible)",
+			Found:    args[1].TypeName(),
+		}
+	}
+	return &lazyIterable{name: "take", start: func() nextFunc {
+		it := iterate(x)
+		var taken int64
+		return func() (common.Object, bool, error) {
+			if taken >= n {
+				return nil, false, nil
+			}
+			taken++
+			return nextValue(it)
+		}
+	}}, nil
+}
+
+// zip(x iterable...) => iterable
+func iterZip(args ...common.Object) (common.Object, error) {
+	for i, x := range args {
+		if err := checkIterable(fmt.Sprintf("args[%d]", i), x); err != nil {
+			return nil, err
+		}
+	}
+	return &lazyIterable{name: "zip", start: func() nextFunc {
+		its := make([]common.Iterator, len(args))
+		for i, x := range args {
+			its[i] = iterate(x)
+		}
+		return func() (common.Object, bool, error) {
+			if len(its) == 0 {
+				return nil, false, nil
+			}
+			vals := make([]common.Object, len(its))
+			for i, it := range its {
+				v, ok, err := nextValue(it)
+				if !ok {
+					return nil, false, err
+				}
+				vals[i] = v
+			}
+			return &common.Array{Value: vals}, true, nil
+		}
+	}}, nil
+}
+
+// enumerate(x iterable) => iterable
+func iterEnumerate(args ...common.Object) (common.Object, error) {
+	if len(args) != 1 {
+		return nil, common.ErrWrongNumArguments
+	}
+	x := args[0]
+	if err := checkIterable("first", x); err != nil {
+		return nil, err
+	}
+	return &lazyIterable{name: "enumerate", start: func() nextFunc {
+		it := iterate(x)
+		var idx int64
+		return func() (common.Object, bool, error) {
+			v, ok, err := nextValue(it)
+			if !ok {
+				return nil, false, err
+			}
+			idx++
+			return &common.Array{Value: []common.Object{
+				&common.Int{Value: idx - 1}, v,
+			}}, true, nil
+		}
+	}}, nil
+}
+
+// chain(x iterable...) => iterable
+func iterChain(args ...common.Object) (common.Object, error) {
+	for i, x := range args {
+		if err := checkIterable(fmt.Sprintf("args[%d]", i), x); err != nil {
+			return nil, err
+		}
+	}
+	return &lazyIterable{name: "chain", start: func() nextFunc {
+		var it common.Iterator
+		var idx int
+		return func() (common.Object, bool, error) {
+			for idx < len(args) {
+				if it == nil {
+					it = iterate(args[idx])
+				}
+				v, ok, err := nextValue(it)
+				if ok || err != nil {
+					return v, ok, err
+				}
+				it = nil
+				idx++
+			}
+			return nil, false, nil
+		}
+	}}, nil
+}
@@ -13,6 +13,10 @@ var jsonModule = map[string]common.Object{
 		Name:  "decode",
 		Value: jsonDecode,
 	},
+	"decode_exact": &common.UserFunction{
+		Name:  "decode_exact",
+		Value: jsonDecodeExact,
+	},
 	"encode": &common.UserFunction{
 		Name:  "encode",
 		Value: jsonEncode,
@@ -28,13 +32,24 @@ var jsonModule = map[string]common.Object{
 }
 
 func jsonDecode(args ...common.Object) (ret common.Object, err error) {
+	return decodeJSON(json.Decode, args...)
+}
+
+func jsonDecodeExact(args ...common.Object) (ret common.Object, err error) {
+	return decodeJSON(json.DecodeExact, args...)
+}
+
+func decodeJSON(
+	decode func(data []byte) (common.Object, error),
+	args ...common.Object,
+) (ret common.Object, err error) {
 	if len(args) != 1 {
 		return nil, common.ErrWrongNumArguments
 	}
 
 	switch o := args[0].(type) {
 	case *common.Bytes:
-		v, err := json.Decode(o.Value)
+		v, err := decode(o.Value)
 		if err != nil {
 			return &common.Error{
 				Value: &common.String{Value: err.Error()},
@@ -42,7 +57,7 @@ func jsonDecode(args ...common.Object) (ret common.Object, err error) {
 		}
 		return v, nil
 	case *common.String:
-		v, err := json.Decode([]byte(o.Value))
+		v, err := decode([]byte(o.Value))
 		if err != nil {
 			return &common.Error{
 				Value: &common.String{Value: err.Error()},
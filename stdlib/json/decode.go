@@ -8,6 +8,7 @@ package json
 
 import (
 	"strconv"
+	"strings"
 	"unicode"
 	"unicode/utf16"
 	"unicode/utf8"
@@ -15,9 +16,21 @@ import (
 	"github.com/d5/tengo/v2/common"
 )
 
-// Decode parses the JSON-encoded data and returns the result object.
+// Decode parses the JSON-encoded data and returns the result object. Numbers
+// are decoded as float values.
 func Decode(data []byte) (common.Object, error) {
-	var d decodeState
+	return decode(data, false)
+}
+
+// DecodeExact is like Decode but decodes numbers without loss of precision:
+// integers are decoded as int values, or, as big-int values if they don't fit
+// in int, and, the other numbers as decimal values.
+func DecodeExact(data []byte) (common.Object, error) {
+	return decode(data, true)
+}
+
+func decode(data []byte, exact bool) (common.Object, error) {
+	d := decodeState{exact: exact}
 	err := checkValid(data, &d.scan)
 	if err != nil {
 		return nil, err
@@ -34,6 +47,7 @@ type decodeState struct {
 	off    int // next read offset in data
 	opcode int // last read result
 	scan   scanner
+	exact  bool // decode numbers without loss of precision
 }
 
 // readIndex returns the position of the last byte read.
@@ -210,11 +224,29 @@ func (d *decodeState) literal() (common.Object, error) {
 		if c != '-' && (c < '0' || c > '9') {
 			panic(phasePanicMsg)
 		}
+		if d.exact {
+			return exactNumber(string(item))
+		}
 		n, _ := strconv.ParseFloat(string(item), 10)
 		return &common.Float{Value: n}, nil
 	}
 }
 
+// exactNumber returns the int, big-int or decimal value of number literal s.
+func exactNumber(s string) (common.Object, error) {
+	if !strings.ContainsAny(s, ".eE") {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return &common.Int{Value: n}, nil
+		}
+		if n, ok := common.ToBigInt(&common.String{Value: s}); ok {
+			return &common.BigInt{Value: n}, nil
+		}
+	} else if n, ok := common.ParseDecimal(s); ok {
+		return n, nil
+	}
+	return nil, common.ErrBigNumLimit
+}
+
 // getu4 decodes \uXXXX from the beginning of s, returning the hex value,
 // or it returns -1.
 func getu4(s []byte) rune {
@@ -157,42 +157,24 @@ func Encode(o common.Object) ([]byte, error) {
 			}
 		}
 		b = append(b, ']')
-	case *common.Map:
-		b = append(b, '{')
-		len1 := len(o.Value) - 1
-		idx := 0
-		for key, value := range o.Value {
-			b = encodeString(b, key)
-			b = append(b, ':')
-			eb, err := Encode(value)
-			if err != nil {
-				return nil, err
-			}
-			b = append(b, eb...)
-			if idx < len1 {
+	case *common.Set, *common.ImmutableSet, *common.Range:
+		b = append(b, '[')
+		it := o.Iterate()
+		for idx := 0; it.Next(); idx++ {
+			if idx > 0 {
 				b = append(b, ',')
 			}
-			idx++
-		}
-		b = append(b, '}')
-	case *common.ImmutableMap:
-		b = append(b, '{')
-		len1 := len(o.Value) - 1
-		idx := 0
-		for key, value := range o.Value {
-			b = encodeString(b, key)
-			b = append(b, ':')
-			eb, err := Encode(value)
+			eb, err := Encode(it.Value())
 			if err != nil {
 				return nil, err
 			}
 			b = append(b, eb...)
-			if idx < len1 {
-				b = append(b, ',')
-			}
-			idx++
 		}
-		b = append(b, '}')
+		b = append(b, ']')
+	case *common.Map:
+		return encodeMap(b, o.Value, o.Entries)
+	case *common.ImmutableMap:
+		return encodeMap(b, o.Value, o.Entries)
 	case *common.Bool:
 		if o.IsFalsy() {
 			b = strconv.AppendBool(b, false)
@@ -238,6 +220,10 @@ func Encode(o common.Object) ([]byte, error) {
 		b = append(b, y...)
 	case *common.Int:
 		b = strconv.AppendInt(b, o.Value, 10)
+	case *common.BigInt:
+		b = o.Value.Append(b, 10)
+	case *common.Decimal:
+		b = append(b, o.String()...)
 	case *common.String:
 		// string encoding bug is fixed with newly introduced function
 		// encodeString(). See: https://github.com/d5/tengo/issues/268
@@ -331,3 +317,55 @@ func encodeStringSlowPath(buf *bytes.Buffer, i int, val string, valLen int) {
 		buf.WriteString(val[start:])
 	}
 }
+
+// encodeMap encodes the map in the sorted order of the keys so the encoded
+// output does not depend on the map iteration order. The non-string keys are
+// encoded as the strings of their JSON encodings, e.g. 1 as "1".
+func encodeMap(
+	b []byte,
+	m map[string]common.Object,
+	entries map[string]common.MapEntry,
+) ([]byte, error) {
+	b = append(b, '{')
+	// the encodings of the non-string keys can be the same as the other keys,
+	// e.g. 1 and "1", so the names are checked if there are such keys.
+	var names map[string]bool
+	if len(entries) > 0 {
+		names = make(map[string]bool, len(m)+len(entries))
+	}
+	it := common.NewSortedMapIterator(m, entries)
+	for idx := 0; it.Next(); idx++ {
+		if idx > 0 {
+			b = append(b, ',')
+		}
+		start := len(b)
+		switch key := it.Key().(type) {
+		case *common.String:
+			b = encodeString(b, key.Value)
+		default:
+			kb, err := Encode(key)
+			if err != nil {
+				return nil, err
+			}
+			if len(kb) > 0 && kb[0] == '"' {
+				b = append(b, kb...)
+			} else {
+				b = encodeString(b, string(kb))
+			}
+		}
+		if names != nil {
+			name := string(b[start:])
+			if names[name] {
+				return nil, errors.New("duplicate map key: " + name)
+			}
+			names[name] = true
+		}
+		b = append(b, ':')
+		eb, err := Encode(it.Value())
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, eb...)
+	}
+	return append(b, '}'), nil
+}
@@ -2,6 +2,7 @@ package json_test
 
 import (
 	gojson "encoding/json"
+	"math/big"
 	"testing"
 
 	"github.com/d5/tengo/v2/common"
@@ -59,6 +60,78 @@ func TestJSON(t *testing.T) {
 		"arr": ARR{1, 2, 3, MAP{"a": false, "b": 109.4}}})
 }
 
+func TestEncodeSortedKeys(t *testing.T) {
+	o, err := common.FromInterface(MAP{"c": 3, "a": 1,
+		"b": MAP{"z": 0, "y": 1}})
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		b, err := json.Encode(o)
+		require.NoError(t, err)
+		require.Equal(t, `{"a":1,"b":{"y":1,"z":0},"c":3}`, string(b))
+	}
+
+	// non-string keys are encoded as the strings of their encodings
+	m := &common.Map{Value: map[string]common.Object{"b": common.TrueValue}}
+	for _, k := range []common.Object{
+		&common.Int{Value: 2},
+		&common.Float{Value: 1.5},
+		&common.Char{Value: 'a'},
+		common.FalseValue,
+		&common.Bytes{Value: []byte("x")},
+	} {
+		require.NoError(t, m.IndexSet(k, &common.Int{Value: 0}))
+	}
+	b, err := json.Encode(m)
+	require.NoError(t, err)
+	require.Equal(t,
+		`{"b":true,"false":0,"97":0,"1.5":0,"2":0,"eA==":0}`, string(b))
+
+	// but they cannot collide with the other keys
+	for k, name := range map[common.Object]string{
+		&common.String{Value: "2"}:     `"2"`,
+		&common.String{Value: "false"}: `"false"`,
+		&common.String{Value: "eA=="}:  `"eA=="`,
+		&common.Int{Value: 97}:         `"97"`, // 'a'
+	} {
+		m := m.Copy().(*common.Map)
+		require.NoError(t, m.IndexSet(k, common.TrueValue))
+		_, err = json.Encode(m)
+		require.Error(t, err)
+		require.Equal(t, "duplicate map key: "+name, err.Error())
+	}
+}
+
+func TestBigNumbers(t *testing.T) {
+	n, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	b, err := json.Encode(&common.Array{Value: []common.Object{
+		&common.BigInt{Value: n},
+		&common.Decimal{Value: big.NewInt(-110), Scale: 2},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, `[123456789012345678901234567890,-1.10]`, string(b))
+
+	o, err := json.DecodeExact(b)
+	require.NoError(t, err)
+	arr := o.(*common.Array).Value
+	require.Equal(t, "123456789012345678901234567890", arr[0].String())
+	require.Equal(t, "big-int", arr[0].TypeName())
+	require.Equal(t, "-1.10", arr[1].String())
+	require.Equal(t, "decimal", arr[1].TypeName())
+
+	o, err = json.DecodeExact([]byte(`{"a": 1, "b": 2.5e-3, "c": -0}`))
+	require.NoError(t, err)
+	m := o.(*common.Map).Value
+	require.Equal(t, &common.Int{Value: 1}, m["a"])
+	require.Equal(t, "0.0025", m["b"].String())
+	require.Equal(t, &common.Int{Value: 0}, m["c"])
+
+	// numbers are decoded as floats by default
+	o, err = json.Decode(b)
+	require.NoError(t, err)
+	_, ok := o.(*common.Array).Value[0].(*common.Float)
+	require.True(t, ok)
+}
+
 func TestDecode(t *testing.T) {
 	testDecodeError(t, `{`)
 	testDecodeError(t, `}`)
@@ -1,6 +1,11 @@
 package stdlib_test
 
-import "testing"
+import (
+	"math/big"
+	"testing"
+
+	"github.com/d5/tengo/v2/common"
+)
 
 func TestJSON(t *testing.T) {
 	module(t, "json").call("encode", 5).
@@ -15,6 +20,16 @@ func TestJSON(t *testing.T) {
 		expect([]byte("[1,2,3]"))
 	module(t, "json").call("encode", IARR{1, 2, 3}).
 		expect([]byte("[1,2,3]"))
+	module(t, "json").call("encode", &common.Set{
+		Value: map[string]common.Object{
+			"s3": &common.String{Value: "3"},
+			"i2": &common.Int{Value: 2},
+			"i1": &common.Int{Value: 1},
+		}}).
+		expect([]byte(`[1,2,"3"]`))
+	module(t, "json").call("encode", &common.Range{
+		Start: 5, Stop: 0, Step: 2}).
+		expect([]byte("[5,3,1]"))
 	module(t, "json").call("encode", MAP{"foo": "bar"}).
 		expect([]byte("{\"foo\":\"bar\"}"))
 	module(t, "json").call("encode", MAP{"foo": 1.8}).
@@ -57,6 +72,13 @@ func TestJSON(t *testing.T) {
 		expect(MAP{"foo": 5.0})
 	module(t, "json").call("decode", `{"foo":2.5}`).
 		expect(MAP{"foo": 2.5})
+	module(t, "json").call("decode_exact", `{"foo":5}`).
+		expect(MAP{"foo": 5})
+	module(t, "json").call("decode_exact", `[1, 12345678901234567890]`).
+		expect(ARR{1, &common.BigInt{Value: new(big.Int).SetUint64(
+			12345678901234567890)}})
+	module(t, "json").call("decode_exact", `{"foo":2.50}`).
+		expect(MAP{"foo": &common.Decimal{Value: big.NewInt(250), Scale: 2}})
 	module(t, "json").call("decode", `{"foo":true}`).
 		expect(MAP{"foo": true})
 	module(t, "json").call("decode", `{"foo":"bar"}`).
@@ -82,3 +104,22 @@ func TestJSON(t *testing.T) {
 		expect([]byte(
 			`{"M":"\u003chtml\u003efoo \u0026\u2028 \u2029\u003c/html\u003e"}`))
 }
+
+func TestJSONMapKeys(t *testing.T) {
+	expect(t, `
+json := import("json")
+m := {}
+m[1] = "i"
+m[true] = 2
+out := string(json.encode(m))
+`, `{"true":2,"1":"i"}`)
+
+	// the non-string keys cannot collide with the string keys
+	expect(t, `
+json := import("json")
+m := {}
+m[1] = "i"
+m["1"] = "s"
+out := string(json.encode(m))
+`, `error: "duplicate map key: \"1\""`)
+}
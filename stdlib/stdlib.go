@@ -24,7 +24,10 @@ func GetModuleMap(names ...string) *common.ModuleMap {
 	modules := common.NewModuleMap()
 	for _, name := range names {
 		if mod := BuiltinModules[name]; mod != nil {
-			modules.AddBuiltinModule(name, mod)
+			modules.Add(name, &common.BuiltinModule{
+				Attrs:            mod,
+				NonDeterministic: NonDeterministicModules[name],
+			})
 		}
 		if mod := SourceModules[name]; mod != "" {
 			modules.AddSourceModule(name, []byte(mod))
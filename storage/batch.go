@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+)
+
+// BatchWriter is implemented by a DB that can apply all the writes of a Batch
+// atomically.
+type BatchWriter interface {
+	WriteBatch(b *Batch) error
+}
+
+// Batch is a DB that buffers the writes to an underlying DB. Buffered writes
+// are visible to the reads of the batch. They are written to the underlying
+// DB by Commit, or, discarded by Rollback.
+type Batch struct {
+	db     DB
+	writes map[string][]byte // nil value for the deleted keys
+}
+
+// NewBatch creates a Batch on top of db.
+func NewBatch(db DB) *Batch {
+	return &Batch{
+		db:     db,
+		writes: make(map[string][]byte),
+	}
+}
+
+// Set buffers the value for the key.
+func (b *Batch) Set(key string, value []byte) error {
+	b.writes[key] = append([]byte{}, value...)
+	return nil
+}
+
+// Get returns the buffered value for the key or the value from the
+// underlying DB if the key was not written in the batch.
+func (b *Batch) Get(key string) ([]byte, error) {
+	if v, ok := b.writes[key]; ok {
+		if v == nil {
+			return nil, NotFoundErr
+		}
+		return v, nil
+	}
+	return b.db.Get(key)
+}
+
+// Delete buffers the deletion of the key.
+func (b *Batch) Delete(key string) error {
+	b.writes[key] = nil
+	return nil
+}
+
+// Has returns true if the key exists in the batch or the underlying DB.
+func (b *Batch) Has(key string) (bool, error) {
+	if v, ok := b.writes[key]; ok {
+		return v != nil, nil
+	}
+	return b.db.Has(key)
+}
+
+// Iterate calls fn for each key that has the prefix in the batch or the
+// underlying DB, in the key order.
+func (b *Batch) Iterate(
+	prefix string,
+	fn func(key string, value []byte) error,
+) error {
+	kv := make(map[string][]byte)
+	err := b.db.Iterate(prefix, func(key string, value []byte) error {
+		kv[key] = value
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for k, v := range b.writes {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if v == nil {
+			delete(kv, k)
+		} else {
+			kv[k] = v
+		}
+	}
+	for _, k := range sortedKeys(kv) {
+		if err := fn(k, kv[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close discards the buffered writes. It does not close the underlying DB.
+func (b *Batch) Close() error {
+	b.Rollback()
+	return nil
+}
+
+// Len returns the number of buffered writes.
+func (b *Batch) Len() int {
+	return len(b.writes)
+}
+
+// Replay calls fn for each buffered write in the key order. The value is nil
+// for the deleted keys.
+func (b *Batch) Replay(fn func(key string, value []byte) error) error {
+	for _, k := range sortedKeys(b.writes) {
+		if err := fn(k, b.writes[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteBatch applies the writes of another batch to this batch.
+func (b *Batch) WriteBatch(o *Batch) error {
+	return o.Replay(func(key string, value []byte) error {
+		b.writes[key] = value
+		return nil
+	})
+}
+
+// Commit writes the buffered writes to the underlying DB and resets the
+// batch. The writes are applied atomically if the underlying DB implements
+// BatchWriter.
+func (b *Batch) Commit() error {
+	var err error
+	if w, ok := b.db.(BatchWriter); ok {
+		err = w.WriteBatch(b)
+	} else {
+		err = b.Replay(func(key string, value []byte) error {
+			if value == nil {
+				return b.db.Delete(key)
+			}
+			return b.db.Set(key, value)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	b.Rollback()
+	return nil
+}
+
+// Rollback discards all the buffered writes.
+func (b *Batch) Rollback() {
+	b.writes = make(map[string][]byte)
+}
+
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
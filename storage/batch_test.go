@@ -0,0 +1,62 @@
+package storage_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/d5/tengo/v2/require"
+	"github.com/d5/tengo/v2/storage"
+)
+
+func TestBatch(t *testing.T) {
+	db := storage.NewMemDB()
+	require.NoError(t, db.Set("a", []byte("1")))
+
+	b := storage.NewBatch(db)
+	require.NoError(t, b.Set("a", []byte("2")))
+	require.NoError(t, b.Set("b", []byte("3")))
+	require.Equal(t, 2, b.Len())
+	testGet(t, b, "a", "2")
+	testGet(t, b, "b", "3")
+	testGet(t, db, "a", "1")
+	testGet(t, db, "b", "")
+
+	b.Rollback()
+	require.Equal(t, 0, b.Len())
+	testGet(t, b, "a", "1")
+	testGet(t, b, "b", "")
+
+	require.NoError(t, b.Set("b", []byte("4")))
+	require.NoError(t, b.Commit())
+	require.Equal(t, 0, b.Len())
+	testGet(t, db, "a", "1")
+	testGet(t, db, "b", "4")
+}
+
+func TestLevelDB_WriteBatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tengo-leveldb")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	db, err := storage.NewLevelDB(dir)
+	require.NoError(t, err)
+
+	b := storage.NewBatch(db)
+	require.NoError(t, b.Set("a", []byte("1")))
+	require.NoError(t, b.Set("b", []byte("2")))
+	testGet(t, db, "a", "")
+	require.NoError(t, b.Commit())
+	testGet(t, db, "a", "1")
+	testGet(t, db, "b", "2")
+}
+
+func testGet(t *testing.T, db storage.DB, key, expected string) {
+	v, err := db.Get(key)
+	if expected == "" {
+		require.Equal(t, storage.NotFoundErr, err)
+		return
+	}
+	require.NoError(t, err)
+	require.Equal(t, expected, string(v))
+}
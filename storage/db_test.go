@@ -0,0 +1,175 @@
+package storage_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/d5/tengo/v2/require"
+	"github.com/d5/tengo/v2/storage"
+)
+
+func TestMemDB(t *testing.T) {
+	testDB(t, storage.NewMemDB())
+}
+
+func TestLevelDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tengo-leveldb")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	db, err := storage.NewLevelDB(dir)
+	require.NoError(t, err)
+	defer func() { _ = db.Close() }()
+	testDB(t, db)
+}
+
+func TestFileDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tengo-filedb")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "data.db")
+	db, err := storage.NewFileDB(path)
+	require.NoError(t, err)
+	testDB(t, db)
+
+	b := storage.NewBatch(db)
+	require.NoError(t, b.Set("x", []byte("1")))
+	require.NoError(t, b.Delete("a/1"))
+	require.NoError(t, b.Commit())
+	require.NoError(t, db.Close())
+
+	// data is loaded from the file
+	db, err = storage.NewFileDB(path)
+	require.NoError(t, err)
+	testGet(t, db, "x", "1")
+	testGet(t, db, "a/1", "")
+	testGet(t, db, "a/2", "2")
+
+	// the writes are appended to the file
+	size := fileSize(t, path)
+	require.NoError(t, db.Set("y", []byte("2")))
+	require.Equal(t, size+13, fileSize(t, path)) // header, op, key and value
+	require.NoError(t, db.Close())
+
+	// a partially written record at the end is discarded
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 0, 9, 1, 2})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	db, err = storage.NewFileDB(path)
+	require.NoError(t, err)
+	testGet(t, db, "y", "2")
+	require.NoError(t, db.Set("z", []byte("3")))
+	require.NoError(t, db.Close())
+	db, err = storage.NewFileDB(path)
+	require.NoError(t, err)
+	testGet(t, db, "y", "2")
+	testGet(t, db, "z", "3")
+
+	// the file is compacted when the records outgrow the data
+	value := make([]byte, 64*1024)
+	for i := 0; i < 40; i++ {
+		value[0] = byte(i)
+		require.NoError(t, db.Set("big", value))
+	}
+	require.True(t, fileSize(t, path) < 1<<20)
+	require.NoError(t, db.Close())
+	db, err = storage.NewFileDB(path)
+	require.NoError(t, err)
+	v, err := db.Get("big")
+	require.NoError(t, err)
+	require.True(t, v[0] == 39)
+	testGet(t, db, "z", "3")
+	require.NoError(t, db.Close())
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	return fi.Size()
+}
+
+func TestPrefixDB(t *testing.T) {
+	db := storage.NewMemDB()
+	require.NoError(t, db.Set("p/", []byte("0")))
+	require.NoError(t, db.Set("q/a/1", []byte("9")))
+
+	p := storage.NewPrefixDB(db, "p/")
+	testDB(t, p)
+	testGet(t, db, "p/a/2", "2")
+	testGet(t, p, "", "0")
+	testGet(t, p, "q/a/1", "")
+
+	// batch writes are prefixed
+	b := storage.NewBatch(p)
+	require.NoError(t, b.Set("y", []byte("1")))
+	require.NoError(t, b.Commit())
+	testGet(t, db, "p/y", "1")
+}
+
+func TestBatch_DB(t *testing.T) {
+	db := storage.NewMemDB()
+	require.NoError(t, db.Set("a/0", []byte("0")))
+	require.NoError(t, db.Set("a/3", []byte("3")))
+
+	b := storage.NewBatch(db)
+	testDB(t, b)
+	testGet(t, db, "a/2", "")
+	require.NoError(t, b.Commit())
+	testGet(t, db, "a/0", "0")
+	testGet(t, db, "a/1", "")
+	testGet(t, db, "a/2", "2")
+	testGet(t, db, "a/3", "")
+}
+
+// testDB tests the DB that has no keys with the prefix "a/", other than "a/0"
+// and "a/3".
+func testDB(t *testing.T, db storage.DB) {
+	require.NoError(t, db.Set("a/1", []byte("1")))
+	require.NoError(t, db.Set("a/2", []byte("2")))
+	require.NoError(t, db.Set("a/3", []byte("3")))
+	require.NoError(t, db.Set("b/1", []byte("b")))
+	require.NoError(t, db.Set("empty", []byte{}))
+	testGet(t, db, "a/1", "1")
+
+	ok, err := db.Has("a/1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = db.Has("empty")
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = db.Has("a/4")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, db.Delete("a/1"))
+	require.NoError(t, db.Delete("a/3"))
+	require.NoError(t, db.Delete("a/4"))
+	testGet(t, db, "a/1", "")
+	ok, err = db.Has("a/1")
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	var keys []string
+	err = db.Iterate("a/", func(key string, value []byte) error {
+		keys = append(keys, key+"="+string(value))
+		return nil
+	})
+	require.NoError(t, err)
+	if len(keys) > 0 && keys[0] == "a/0=0" {
+		keys = keys[1:]
+	}
+	require.Equal(t, "a/2=2", strings.Join(keys, ","))
+
+	stop := errors.New("stop")
+	err = db.Iterate("", func(key string, value []byte) error {
+		return stop
+	})
+	require.Equal(t, stop, err)
+}
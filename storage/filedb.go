@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+const (
+	fileDBSet    byte = 1
+	fileDBDelete byte = 2
+
+	// fileDBHeaderSize is the size of the header of a record: the length and
+	// the checksum of the payload.
+	fileDBHeaderSize = 8
+
+	// fileDBCompactSize is the size of the file that the file is not
+	// compacted below.
+	fileDBCompactSize = 1 << 20
+)
+
+var errCorruptRecord = errors.New("corrupt record")
+
+// FileDB is a DB that keeps all the data in a single file. The data is held
+// in memory, and, the writes are appended to the file as records: a record
+// holds the writes of a Set, a Delete or a Batch, so the writes of a batch are
+// applied atomically. A partially written record at the end of the file, e.g.
+// by a crash, is discarded when the file is opened. The file is compacted,
+// i.e. rewritten with the current data only, when the records outgrow the
+// data, so FileDB suits the data sets that fit in memory such as tests and
+// development environments.
+type FileDB struct {
+	lock sync.Mutex // serializes the writes
+	mem  *MemDB
+	path string
+	file *os.File
+	size int64 // size of the file
+	live int64 // size of the current data written as a single record
+}
+
+// NewFileDB opens the file DB at path, or, creates it if it does not exist.
+func NewFileDB(path string) (DB, error) {
+	db := &FileDB{
+		mem:  &MemDB{kv: make(map[string][]byte)},
+		path: path,
+		live: fileDBHeaderSize,
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for len(data) > int(db.size) {
+		n, err := db.replay(data[db.size:])
+		if err != nil {
+			break
+		}
+		db.size += int64(n)
+	}
+	if int(db.size) < len(data) {
+		if err := os.Truncate(path, db.size); err != nil {
+			return nil, err
+		}
+	}
+	db.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Get returns the value for the key.
+func (f *FileDB) Get(key string) ([]byte, error) {
+	return f.mem.Get(key)
+}
+
+// Set sets the value for the key.
+func (f *FileDB) Set(key string, value []byte) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if value == nil {
+		value = []byte{}
+	}
+	return f.write(appendFileDBOp(nil, key, value))
+}
+
+// Delete deletes the key.
+func (f *FileDB) Delete(key string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.write(appendFileDBOp(nil, key, nil))
+}
+
+// Has returns true if the key exists.
+func (f *FileDB) Has(key string) (bool, error) {
+	return f.mem.Has(key)
+}
+
+// Iterate calls fn for each key that has the prefix, in the key order.
+func (f *FileDB) Iterate(
+	prefix string,
+	fn func(key string, value []byte) error,
+) error {
+	return f.mem.Iterate(prefix, fn)
+}
+
+// Close closes the file. All the writes are already in the file.
+func (f *FileDB) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return f.file.Close()
+}
+
+// WriteBatch applies all the writes of the batch, and, appends them to the
+// file as a single record.
+func (f *FileDB) WriteBatch(b *Batch) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var payload []byte
+	_ = b.Replay(func(key string, value []byte) error {
+		payload = appendFileDBOp(payload, key, value)
+		return nil
+	})
+	if len(payload) == 0 {
+		return nil
+	}
+	return f.write(payload)
+}
+
+// write appends the record of the payload to the file, applies its writes,
+// and, compacts the file if the records outgrow the data.
+func (f *FileDB) write(payload []byte) error {
+	record := fileDBRecord(payload)
+	if _, err := f.file.Write(record); err != nil {
+		_ = f.file.Truncate(f.size) // the following records must be readable
+		return err
+	}
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+	f.size += int64(len(record))
+	if _, err := f.replay(record); err != nil {
+		return err
+	}
+	if f.size > fileDBCompactSize && f.size > 2*f.live {
+		return f.compact()
+	}
+	return nil
+}
+
+// replay applies the writes of the record at the beginning of data, and,
+// returns the size of the record.
+func (f *FileDB) replay(data []byte) (int, error) {
+	if len(data) < fileDBHeaderSize {
+		return 0, errCorruptRecord
+	}
+	n := binary.BigEndian.Uint32(data)
+	if uint64(len(data)-fileDBHeaderSize) < uint64(n) {
+		return 0, errCorruptRecord
+	}
+	payload := data[fileDBHeaderSize : fileDBHeaderSize+int(n)]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[4:]) {
+		return 0, errCorruptRecord
+	}
+	ops := payload
+	for len(ops) > 0 {
+		op := ops[0]
+		key, rest, ok := readFileDBBytes(ops[1:])
+		if !ok {
+			return 0, errCorruptRecord
+		}
+		ops = rest
+		switch op {
+		case fileDBSet:
+			var value []byte
+			value, ops, ok = readFileDBBytes(ops)
+			if !ok {
+				return 0, errCorruptRecord
+			}
+			f.setLive(string(key), value)
+		case fileDBDelete:
+			f.setLive(string(key), nil)
+		default:
+			return 0, errCorruptRecord
+		}
+	}
+	return fileDBHeaderSize + int(n), nil
+}
+
+// setLive writes the value for the key to the memory, and, updates the size
+// of the data. The key is deleted if the value is nil.
+func (f *FileDB) setLive(key string, value []byte) {
+	if old, err := f.mem.Get(key); err == nil {
+		f.live -= int64(len(appendFileDBOp(nil, key, old)))
+	}
+	if value == nil {
+		_ = f.mem.Delete(key)
+		return
+	}
+	_ = f.mem.Set(key, append([]byte{}, value...))
+	f.live += int64(len(appendFileDBOp(nil, key, value)))
+}
+
+// compact writes the current data as a single record to a temporary file,
+// and, renames it to the path so the file is never partially written.
+func (f *FileDB) compact() error {
+	var payload []byte
+	_ = f.mem.Iterate("", func(key string, value []byte) error {
+		payload = appendFileDBOp(payload, key, value)
+		return nil
+	})
+	record := fileDBRecord(payload)
+
+	tmp := f.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(record); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, f.path); err != nil {
+		return err
+	}
+	_ = f.file.Close()
+	f.file, err = os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	f.size = int64(len(record))
+	return nil
+}
+
+// fileDBRecord returns the record of the payload: the length and the checksum
+// of the payload followed by the payload.
+func fileDBRecord(payload []byte) []byte {
+	record := make([]byte, fileDBHeaderSize, fileDBHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record, uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:], crc32.ChecksumIEEE(payload))
+	return append(record, payload...)
+}
+
+// appendFileDBOp appends the write of the value for the key to b. The key is
+// deleted if the value is nil.
+func appendFileDBOp(b []byte, key string, value []byte) []byte {
+	if value == nil {
+		b = append(b, fileDBDelete)
+		return appendFileDBBytes(b, []byte(key))
+	}
+	b = append(b, fileDBSet)
+	b = appendFileDBBytes(b, []byte(key))
+	return appendFileDBBytes(b, value)
+}
+
+func appendFileDBBytes(b []byte, v []byte) []byte {
+	var n [binary.MaxVarintLen64]byte
+	b = append(b, n[:binary.PutUvarint(n[:], uint64(len(v)))]...)
+	return append(b, v...)
+}
+
+func readFileDBBytes(b []byte) (v, rest []byte, ok bool) {
+	n, size := binary.Uvarint(b)
+	if size <= 0 || uint64(len(b)-size) < n {
+		return nil, nil, false
+	}
+	return b[size : size+int(n)], b[size+int(n):], true
+}
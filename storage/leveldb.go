@@ -2,6 +2,7 @@ package storage
 
 import (
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 type LevelDB struct {
@@ -28,3 +29,38 @@ func (ldb *LevelDB) Set(key string, value []byte) error {
 func (ldb *LevelDB) Delete(key string) error {
 	return ldb.DB.Delete([]byte(key), nil)
 }
+
+// Has returns true if the key exists.
+func (ldb *LevelDB) Has(key string) (bool, error) {
+	return ldb.DB.Has([]byte(key), nil)
+}
+
+// Iterate calls fn for each key that has the prefix, in the key order.
+func (ldb *LevelDB) Iterate(
+	prefix string,
+	fn func(key string, value []byte) error,
+) error {
+	iter := ldb.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer iter.Release()
+	for iter.Next() {
+		value := append([]byte{}, iter.Value()...)
+		if err := fn(string(iter.Key()), value); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// WriteBatch applies all the writes of the batch atomically.
+func (ldb *LevelDB) WriteBatch(b *Batch) error {
+	batch := new(leveldb.Batch)
+	_ = b.Replay(func(key string, value []byte) error {
+		if value == nil {
+			batch.Delete([]byte(key))
+		} else {
+			batch.Put([]byte(key), value)
+		}
+		return nil
+	})
+	return ldb.Write(batch, nil)
+}
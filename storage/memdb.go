@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"strings"
+	"sync"
+)
+
+// MemDB is an in-memory DB. It's safe for concurrent use by multiple
+// goroutines.
+type MemDB struct {
+	lock sync.RWMutex
+	kv   map[string][]byte
+}
+
+// NewMemDB creates an empty MemDB.
+func NewMemDB() DB {
+	return &MemDB{kv: make(map[string][]byte)}
+}
+
+// Get returns the value for the key.
+func (m *MemDB) Get(key string) ([]byte, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	v, ok := m.kv[key]
+	if !ok {
+		return nil, NotFoundErr
+	}
+	return append([]byte{}, v...), nil
+}
+
+// Set sets the value for the key.
+func (m *MemDB) Set(key string, value []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.kv[key] = append([]byte{}, value...)
+	return nil
+}
+
+// Delete deletes the key.
+func (m *MemDB) Delete(key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.kv, key)
+	return nil
+}
+
+// Has returns true if the key exists.
+func (m *MemDB) Has(key string) (bool, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	_, ok := m.kv[key]
+	return ok, nil
+}
+
+// Iterate calls fn for each key that has the prefix, in the key order. fn is
+// called with a snapshot of the DB.
+func (m *MemDB) Iterate(
+	prefix string,
+	fn func(key string, value []byte) error,
+) error {
+	m.lock.RLock()
+	kv := make(map[string][]byte)
+	for k, v := range m.kv {
+		if strings.HasPrefix(k, prefix) {
+			kv[k] = append([]byte{}, v...)
+		}
+	}
+	m.lock.RUnlock()
+
+	for _, k := range sortedKeys(kv) {
+		if err := fn(k, kv[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close does nothing for MemDB.
+func (m *MemDB) Close() error {
+	return nil
+}
+
+// WriteBatch applies all the writes of the batch atomically.
+func (m *MemDB) WriteBatch(b *Batch) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return b.Replay(func(key string, value []byte) error {
+		if value == nil {
+			delete(m.kv, key)
+		} else {
+			m.kv[key] = append([]byte{}, value...)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+)
+
+// MerkleTree is a binary Merkle tree over the key-value pairs of a keyspace,
+// in the key order. A leaf is the hash of a key and its value, and, an inner
+// node is the hash of its two children. If a level has an odd number of
+// nodes, the last node is promoted to the next level as it is.
+type MerkleTree struct {
+	keys   []string
+	values [][]byte
+	levels [][][]byte // levels[0] is the leaves, the last level is the root
+}
+
+// MerkleProof is an inclusion proof of a key-value pair in a MerkleTree.
+type MerkleProof struct {
+	Key   string
+	Value []byte
+	Path  []MerkleProofNode // from the leaf to the root
+}
+
+// MerkleProofNode is a sibling node in the path of a MerkleProof.
+type MerkleProofNode struct {
+	Hash []byte
+	Left bool // true if the sibling is the left child
+}
+
+// NewMerkleTree builds a MerkleTree over the keys that have the prefix in db.
+func NewMerkleTree(db DB, prefix string) (*MerkleTree, error) {
+	t := &MerkleTree{}
+	var leaves [][]byte
+	err := db.Iterate(prefix, func(key string, value []byte) error {
+		t.keys = append(t.keys, key)
+		t.values = append(t.values, value)
+		leaves = append(leaves, hashLeaf(key, value))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	t.levels = append(t.levels, leaves)
+	for level := leaves; len(level) > 1; {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, hashNode(level[i], level[i+1]))
+			}
+		}
+		t.levels = append(t.levels, next)
+		level = next
+	}
+	return t, nil
+}
+
+// Root returns the root hash of the tree. The root of an empty tree is the
+// hash of no data.
+func (t *MerkleTree) Root() []byte {
+	top := t.levels[len(t.levels)-1]
+	if len(top) == 0 {
+		h := sha256.Sum256(nil)
+		return h[:]
+	}
+	return top[0]
+}
+
+// Prove returns the inclusion proof of the key. It returns NotFoundErr if the
+// tree does not have the key.
+func (t *MerkleTree) Prove(key string) (*MerkleProof, error) {
+	idx := sort.SearchStrings(t.keys, key)
+	if idx == len(t.keys) || t.keys[idx] != key {
+		return nil, NotFoundErr
+	}
+
+	p := &MerkleProof{Key: key, Value: t.values[idx]}
+	for _, level := range t.levels[:len(t.levels)-1] {
+		if idx%2 == 1 {
+			p.Path = append(p.Path, MerkleProofNode{
+				Hash: level[idx-1],
+				Left: true,
+			})
+		} else if idx+1 < len(level) {
+			p.Path = append(p.Path, MerkleProofNode{Hash: level[idx+1]})
+		}
+		idx /= 2
+	}
+	return p, nil
+}
+
+// Verify returns true if the proof proves that the tree of the root has the
+// key-value pair.
+func (p *MerkleProof) Verify(root []byte) bool {
+	h := hashLeaf(p.Key, p.Value)
+	for _, n := range p.Path {
+		if n.Left {
+			h = hashNode(n.Hash, h)
+		} else {
+			h = hashNode(h, n.Hash)
+		}
+	}
+	return bytes.Equal(h, root)
+}
+
+// hashLeaf hashes a key-value pair. The key is length-prefixed so the
+// boundary between the key and the value is unambiguous.
+func hashLeaf(key string, value []byte) []byte {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(key)))
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(n[:])
+	h.Write([]byte(key))
+	h.Write(value)
+	return h.Sum(nil)
+}
+
+// hashNode hashes two child nodes. Leaves and inner nodes have different
+// prefixes so a leaf cannot be forged as an inner node.
+func hashNode(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
@@ -0,0 +1,118 @@
+package storage_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/d5/tengo/v2/common"
+	"github.com/d5/tengo/v2/require"
+	"github.com/d5/tengo/v2/storage"
+)
+
+func TestMerkleTree(t *testing.T) {
+	db := storage.NewMemDB()
+	empty, err := storage.NewMerkleTree(db, "")
+	require.NoError(t, err)
+	_, err = empty.Prove("a")
+	require.Equal(t, storage.NotFoundErr, err)
+
+	var roots [][]byte
+	roots = append(roots, empty.Root())
+	for n := 1; n <= 9; n++ {
+		key := fmt.Sprintf("k%d", n)
+		require.NoError(t, db.Set(key, []byte(key)))
+		tree, err := storage.NewMerkleTree(db, "")
+		require.NoError(t, err)
+		root := tree.Root()
+		for _, r := range roots {
+			require.False(t, bytes.Equal(r, root))
+		}
+		roots = append(roots, root)
+
+		// every key of the tree can be proven
+		for i := 1; i <= n; i++ {
+			p, err := tree.Prove(fmt.Sprintf("k%d", i))
+			require.NoError(t, err)
+			require.True(t, p.Verify(root))
+
+			// tampered proofs
+			p.Value = []byte("x")
+			require.False(t, p.Verify(root))
+		}
+	}
+
+	// the root depends only on the contents
+	other := storage.NewMemDB()
+	for n := 9; n >= 1; n-- {
+		key := fmt.Sprintf("k%d", n)
+		require.NoError(t, other.Set(key, []byte(key)))
+	}
+	tree, err := storage.NewMerkleTree(other, "")
+	require.NoError(t, err)
+	require.Equal(t, roots[9], tree.Root())
+	p, err := tree.Prove("k1")
+	require.NoError(t, err)
+	require.False(t, p.Verify(roots[8]))
+}
+
+func TestStorage_StateRoot(t *testing.T) {
+	db := storage.NewMemDB()
+	s, err := storage.New("contract", db)
+	require.NoError(t, err)
+	_, err = s.StateRoot()
+	require.Equal(t, storage.NotFoundErr, err)
+
+	s.Begin()
+	require.NoError(t, s.SetGlobal(0, &common.Int{Value: 1}))
+	require.NoError(t, s.SetGlobal(1, &common.String{Value: "foo"}))
+	require.NoError(t, s.Commit())
+	root1, err := s.StateRoot()
+	require.NoError(t, err)
+
+	p, err := s.ProveGlobal(1)
+	require.NoError(t, err)
+	require.True(t, p.Verify(root1))
+	v, err := storage.DecodeObject(p.Value, nil)
+	require.NoError(t, err)
+	require.Equal(t, `"foo"`, v.String())
+	_, err = s.ProveGlobal(2)
+	require.Equal(t, storage.NotFoundErr, err)
+
+	// the root is not changed by the rolled back transaction
+	s.Begin()
+	require.NoError(t, s.SetGlobal(0, &common.Int{Value: 2}))
+	s.Rollback()
+	root, err := s.StateRoot()
+	require.NoError(t, err)
+	require.Equal(t, root1, root)
+
+	// nor by the other contracts
+	s2, err := storage.New("other", db)
+	require.NoError(t, err)
+	s2.Begin()
+	require.NoError(t, s2.SetGlobal(0, &common.Int{Value: 1}))
+	require.NoError(t, s2.Commit())
+	root, err = s.StateRoot()
+	require.NoError(t, err)
+	require.Equal(t, root1, root)
+	root2, err := s2.StateRoot()
+	require.NoError(t, err)
+	require.False(t, bytes.Equal(root1, root2))
+
+	s.Begin()
+	s.Begin()
+	require.NoError(t, s.SetGlobal(0, &common.Int{Value: 2}))
+	require.NoError(t, s.Commit())
+	root, err = s.StateRoot()
+	require.NoError(t, err)
+	require.Equal(t, root1, root)
+	require.NoError(t, s.Commit())
+	root, err = s.StateRoot()
+	require.NoError(t, err)
+	require.False(t, bytes.Equal(root1, root))
+	p, err = s.ProveGlobal(1)
+	require.NoError(t, err)
+	require.True(t, p.Verify(root))
+	require.False(t, p.Verify(root1))
+}
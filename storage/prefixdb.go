@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"strings"
+)
+
+// PrefixDB is a DB that isolates a keyspace of an underlying DB: all the keys
+// are prefixed when they are written to the underlying DB, and, the keys
+// outside of the keyspace are not visible.
+type PrefixDB struct {
+	db     DB
+	prefix string
+}
+
+// NewPrefixDB creates a PrefixDB on top of db.
+func NewPrefixDB(db DB, prefix string) *PrefixDB {
+	return &PrefixDB{db: db, prefix: prefix}
+}
+
+// Get returns the value for the key.
+func (p *PrefixDB) Get(key string) ([]byte, error) {
+	return p.db.Get(p.prefix + key)
+}
+
+// Set sets the value for the key.
+func (p *PrefixDB) Set(key string, value []byte) error {
+	return p.db.Set(p.prefix+key, value)
+}
+
+// Delete deletes the key.
+func (p *PrefixDB) Delete(key string) error {
+	return p.db.Delete(p.prefix + key)
+}
+
+// Has returns true if the key exists.
+func (p *PrefixDB) Has(key string) (bool, error) {
+	return p.db.Has(p.prefix + key)
+}
+
+// Iterate calls fn for each key that has the prefix, in the key order. The
+// keys are passed to fn without the prefix of the PrefixDB.
+func (p *PrefixDB) Iterate(
+	prefix string,
+	fn func(key string, value []byte) error,
+) error {
+	return p.db.Iterate(p.prefix+prefix,
+		func(key string, value []byte) error {
+			return fn(strings.TrimPrefix(key, p.prefix), value)
+		})
+}
+
+// Close does nothing as the underlying DB can be shared with other PrefixDB.
+func (p *PrefixDB) Close() error {
+	return nil
+}
+
+// WriteBatch applies all the writes of the batch atomically if the underlying
+// DB implements BatchWriter.
+func (p *PrefixDB) WriteBatch(b *Batch) error {
+	prefixed := NewBatch(p.db)
+	_ = b.Replay(func(key string, value []byte) error {
+		prefixed.writes[p.prefix+key] = value
+		return nil
+	})
+	return prefixed.Commit()
+}
@@ -5,78 +5,315 @@ import (
 	"encoding/gob"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/d5/tengo/v2/common"
+	"github.com/d5/tengo/v2/complier"
 )
 
+// DB is a key-value store that the storage persists the contracts to.
 type DB interface {
+	// Set sets the value for the key.
 	Set(key string, value []byte) error
+
+	// Get returns the value for the key. It returns NotFoundErr if the key
+	// does not exist.
 	Get(key string) ([]byte, error)
+
+	// Delete deletes the key. It's not an error to delete a key that does not
+	// exist.
+	Delete(key string) error
+
+	// Has returns true if the key exists.
+	Has(key string) (bool, error)
+
+	// Iterate calls fn for each key that has the prefix, in the key order.
+	// The iteration stops when fn returns an error, and, Iterate returns the
+	// error. fn must not modify the DB.
+	Iterate(prefix string, fn func(key string, value []byte) error) error
+
+	// Close releases the resources of the DB.
+	Close() error
 }
 
 type Storage struct {
 	Address string // 合约地址
 	db      DB
+	txs     []*Batch
+	modules *common.ModuleMap
 }
 
 var (
 	NotFoundErr = errors.New("not found")
+
+	// NoTransactionErr is returned by Commit when no transaction was begun.
+	NoTransactionErr = errors.New("no transaction")
+
+	// InvalidAddressErr is returned by New when the contract address is empty
+	// or contains '/'.
+	InvalidAddressErr = errors.New("invalid address")
 )
 
+// New creates a Storage of the contract. The keys of the contract are
+// isolated in the "contract/<address>/" keyspace of db.
 func New(contract string, db DB) (*Storage, error) {
+	if contract == "" || strings.Contains(contract, "/") {
+		return nil, InvalidAddressErr
+	}
 	return &Storage{Address: contract, db: db}, nil
 }
 
+// SaveConstants persists the constants of the contract.
 func (s *Storage) SaveConstants(consts []common.Object) error {
-	baseKey := s.Address + "_constants_"
 	for i := range consts {
-		key := fmt.Sprintf("%s%d", baseKey, i)
-		var buf bytes.Buffer
-		enc := gob.NewEncoder(&buf)
-		if err := enc.Encode(consts[i]); err != nil {
+		data, err := EncodeObject(consts[i])
+		if err != nil {
 			return err
 		}
-		if err := s.db.Set(key, buf.Bytes()); err != nil {
+		if err := s.KV().Set(constantKey(i), data); err != nil {
 			return err
 		}
 	}
-	return nil
+	return s.KV().Set("numconstants", []byte(strconv.Itoa(len(consts))))
 }
 
 func (s *Storage) SaveByteCode(codes []byte) error {
-	baseKey := s.Address + "_bytecode"
-	return s.db.Set(baseKey, codes)
+	return s.KV().Set("bytecode", codes)
 }
 
 func (s *Storage) LoadByteCode() ([]byte, error) {
-	baseKey := s.Address + "_bytecode"
-	v, err := s.db.Get(baseKey)
+	v, err := s.KV().Get("bytecode")
 	if err != nil {
 		return nil, err
 	}
 	return v, nil
 }
 
+// LoadConstants loads the constant at index.
 func (s *Storage) LoadConstants(index int) (common.Object, error) {
-	baseKey := s.Address + "_constants_"
-	key := fmt.Sprintf("%s%d", baseKey, index)
-	v, err := s.db.Get(key)
+	return s.loadConstant(index, s.modules)
+}
+
+func (s *Storage) loadConstant(
+	index int,
+	modules *common.ModuleMap,
+) (common.Object, error) {
+	v, err := s.KV().Get(constantKey(index))
+	if err != nil {
+		return nil, err
+	}
+	return DecodeObject(v, modules)
+}
+
+// SaveBytecode persists the compiled bytecode of the contract: the source
+// file set, the main function and the constants.
+func (s *Storage) SaveBytecode(bytecode *complier.Bytecode) error {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(bytecode.FileSet); err != nil {
+		return err
+	}
+	if err := s.KV().Set("fileset", buf.Bytes()); err != nil {
+		return err
+	}
+	main, err := EncodeObject(bytecode.MainFunction)
+	if err != nil {
+		return err
+	}
+	if err := s.SaveByteCode(main); err != nil {
+		return err
+	}
+	return s.SaveConstants(bytecode.Constants)
+}
+
+// LoadBytecode loads the bytecode persisted by SaveBytecode. Modules are used
+// to restore builtin module values, so the loaded bytecode can be run
+// immediately.
+func (s *Storage) LoadBytecode(
+	modules *common.ModuleMap,
+) (*complier.Bytecode, error) {
+	if modules == nil {
+		modules = common.NewModuleMap()
+	}
+	bytecode := &complier.Bytecode{}
+
+	v, err := s.KV().Get("fileset")
+	if err != nil {
+		return nil, err
+	}
+	dec := gob.NewDecoder(bytes.NewReader(v))
+	if err := dec.Decode(&bytecode.FileSet); err != nil {
+		return nil, err
+	}
+
+	v, err = s.LoadByteCode()
+	if err != nil {
+		return nil, err
+	}
+	main, err := DecodeObject(v, modules)
 	if err != nil {
 		return nil, err
 	}
-	buf := bytes.NewReader(v)
-	dec := gob.NewDecoder(buf)
-	var obj common.Object
-	err = dec.Decode(obj)
-	return obj, err
+	fn, ok := main.(*common.CompiledFunction)
+	if !ok {
+		return nil, fmt.Errorf("invalid main function: %s", main.TypeName())
+	}
+	bytecode.MainFunction = fn
+
+	v, err = s.KV().Get("numconstants")
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(string(v))
+	if err != nil {
+		return nil, err
+	}
+	bytecode.Constants = make([]common.Object, n)
+	for i := range bytecode.Constants {
+		c, err := s.loadConstant(i, modules)
+		if err != nil {
+			return nil, err
+		}
+		bytecode.Constants[i] = c
+	}
+	return bytecode, nil
 }
 
+// Begin starts a transaction. All the writes are buffered until the
+// transaction is committed or rolled back. Transactions can be nested.
+func (s *Storage) Begin() {
+	s.txs = append(s.txs, NewBatch(s.DB()))
+}
+
+// Commit writes the buffered writes of the innermost transaction to the
+// enclosing transaction, or, to the underlying DB atomically if it's the
+// outermost one. The state root of the contract is updated along with the
+// writes of the outermost transaction.
+func (s *Storage) Commit() error {
+	if len(s.txs) == 0 {
+		return NoTransactionErr
+	}
+	tx := s.txs[len(s.txs)-1]
+	if len(s.txs) == 1 && tx.Len() > 0 {
+		t, err := NewMerkleTree(s.KV(), "")
+		if err != nil {
+			return err
+		}
+		if err := tx.Set(s.rootKey(), t.Root()); err != nil {
+			return err
+		}
+	}
+	s.txs = s.txs[:len(s.txs)-1]
+	return tx.Commit()
+}
+
+// Rollback discards the buffered writes of the innermost transaction.
+func (s *Storage) Rollback() {
+	if len(s.txs) == 0 {
+		return
+	}
+	s.txs = s.txs[:len(s.txs)-1]
+}
+
+// InTransaction returns true if a transaction is in progress.
+func (s *Storage) InTransaction() bool {
+	return len(s.txs) > 0
+}
+
+// DB returns the DB that the storage currently writes to: the innermost
+// transaction if any, or the underlying DB.
+func (s *Storage) DB() DB {
+	if len(s.txs) > 0 {
+		return s.txs[len(s.txs)-1]
+	}
+	return s.db
+}
+
+// SetImports sets the modules used to restore builtin module values when
+// decoding stored objects.
+func (s *Storage) SetImports(modules *common.ModuleMap) {
+	s.modules = modules
+}
+
+// SetGlobal persists the value of the global variable at index.
 func (s *Storage) SetGlobal(index int, value common.Object) error {
-	// todo::
-	return nil
+	data, err := EncodeObject(value)
+	if err != nil {
+		return err
+	}
+	return s.KV().Set(globalKey(index), data)
 }
 
+// GetGlobal loads the value of the global variable at index. It returns
+// NotFoundErr if the global variable was never persisted.
 func (s *Storage) GetGlobal(index int) (common.Object, error) {
-	// todo::
-	return nil, nil
+	v, err := s.KV().Get(globalKey(index))
+	if err != nil {
+		return nil, err
+	}
+	return DecodeObject(v, s.modules)
+}
+
+// KV returns the keyspace of the contract in the DB that the storage
+// currently writes to.
+func (s *Storage) KV() DB {
+	return NewPrefixDB(s.DB(), "contract/"+s.Address+"/")
+}
+
+// StateRoot returns the root hash of the Merkle tree over the keyspace of the
+// contract, as of the last committed transaction. It returns NotFoundErr if
+// no transaction was committed.
+func (s *Storage) StateRoot() ([]byte, error) {
+	return s.DB().Get(s.rootKey())
+}
+
+// Prove returns the inclusion proof of the key in the keyspace of the
+// contract. The proof can be verified against the state root.
+func (s *Storage) Prove(key string) (*MerkleProof, error) {
+	t, err := NewMerkleTree(s.KV(), "")
+	if err != nil {
+		return nil, err
+	}
+	return t.Prove(key)
+}
+
+// ProveGlobal returns the inclusion proof of the global variable at index.
+// The value of the proof is the encoded object (see DecodeObject).
+func (s *Storage) ProveGlobal(index int) (*MerkleProof, error) {
+	return s.Prove(globalKey(index))
+}
+
+func (s *Storage) rootKey() string {
+	return "stateroot/" + s.Address
+}
+
+func constantKey(index int) string {
+	return fmt.Sprintf("constants/%d", index)
+}
+
+func globalKey(index int) string {
+	return fmt.Sprintf("globals/%d", index)
+}
+
+// EncodeObject encodes an object into bytes in the binary bytecode format
+// (see complier.EncodeObject). The map keys and the set elements are written
+// in the sorted order, so the same value is always encoded to the same bytes
+// and the state root does not depend on the iteration order of Go maps.
+func EncodeObject(o common.Object) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := complier.EncodeObject(&buf, o); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeObject decodes an object encoded by EncodeObject, or, by gob as the
+// older versions stored them. Modules are used to restore builtin module
+// values.
+func DecodeObject(
+	data []byte,
+	modules *common.ModuleMap,
+) (common.Object, error) {
+	return complier.DecodeObject(bytes.NewReader(data), modules)
 }
@@ -0,0 +1,194 @@
+package storage_test
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/d5/tengo/v2/common"
+	"github.com/d5/tengo/v2/complier"
+	"github.com/d5/tengo/v2/parser"
+	"github.com/d5/tengo/v2/require"
+	"github.com/d5/tengo/v2/stdlib"
+	"github.com/d5/tengo/v2/storage"
+	"github.com/d5/tengo/v2/vm"
+)
+
+func TestStorage_Globals(t *testing.T) {
+	s, err := storage.New("contract", storage.NewMemDB())
+	require.NoError(t, err)
+	s.SetImports(stdlib.GetModuleMap("math"))
+
+	_, err = s.GetGlobal(0)
+	require.Equal(t, storage.NotFoundErr, err)
+
+	values := []common.Object{
+		&common.Int{Value: 5},
+		&common.String{Value: "foo"},
+		&common.Array{Value: []common.Object{
+			common.TrueValue, common.UndefinedValue}},
+		&common.Map{Value: map[string]common.Object{
+			"a": &common.Float{Value: 1.5}}},
+		&common.Error{Value: &common.String{Value: "bar"}},
+		&common.BigInt{Value: new(big.Int).Lsh(big.NewInt(-3), 200)},
+		&common.Decimal{Value: big.NewInt(110), Scale: 2},
+		&common.ImmutableSet{Value: map[string]common.Object{
+			"b1": common.TrueValue, "i2": &common.Int{Value: 2}}},
+		&common.Instance{
+			Class: &common.Class{Name: "A", Fields: []string{"x"}},
+			Values: []common.Object{
+				&common.Int{Value: 1}}},
+		&common.Range{Start: 10, Stop: 0, Step: 3},
+	}
+	for i, v := range values {
+		require.NoError(t, s.SetGlobal(i, v))
+	}
+	for i, v := range values {
+		loaded, err := s.GetGlobal(i)
+		require.NoError(t, err)
+		require.Equal(t, v.String(), loaded.String())
+	}
+
+	// canonical singletons are restored
+	v, err := s.GetGlobal(2)
+	require.NoError(t, err)
+	require.True(t, v.(*common.Array).Value[0] == common.TrueValue)
+	require.True(t, v.(*common.Array).Value[1] == common.UndefinedValue)
+	v, err = s.GetGlobal(7)
+	require.NoError(t, err)
+	require.True(t, v.(*common.ImmutableSet).Value["b1"] == common.TrueValue)
+
+	// builtin functions and modules are restored
+	require.NoError(t, s.SetGlobal(10, common.BuiltinFuncs[0]))
+	v, err = s.GetGlobal(10)
+	require.NoError(t, err)
+	require.True(t, v == common.BuiltinFuncs[0])
+
+	mod := stdlib.GetModuleMap("math").GetBuiltinModule("math")
+	require.NoError(t, s.SetGlobal(11, mod.AsImmutableMap("math")))
+	v, err = s.GetGlobal(11)
+	require.NoError(t, err)
+	abs, err := v.IndexGet(&common.String{Value: "abs"})
+	require.NoError(t, err)
+	res, err := abs.Call(&common.Float{Value: -1})
+	require.NoError(t, err)
+	require.Equal(t, 1.0, res.(*common.Float).Value)
+}
+
+func TestStorage_Transaction(t *testing.T) {
+	db := storage.NewMemDB()
+	s, err := storage.New("contract", db)
+	require.NoError(t, err)
+	require.Equal(t, storage.NoTransactionErr, s.Commit())
+
+	s.Begin()
+	require.True(t, s.InTransaction())
+	require.NoError(t, s.SetGlobal(0, &common.Int{Value: 1}))
+	v, err := s.GetGlobal(0)
+	require.NoError(t, err)
+	require.Equal(t, "1", v.String())
+	_, err = db.Get("contract/contract/globals/0")
+	require.Equal(t, storage.NotFoundErr, err)
+
+	// nested transaction is discarded
+	s.Begin()
+	require.NoError(t, s.SetGlobal(0, &common.Int{Value: 2}))
+	require.NoError(t, s.SetGlobal(1, &common.Int{Value: 2}))
+	s.Rollback()
+	v, err = s.GetGlobal(0)
+	require.NoError(t, err)
+	require.Equal(t, "1", v.String())
+	_, err = s.GetGlobal(1)
+	require.Equal(t, storage.NotFoundErr, err)
+
+	// nested transaction is committed to the enclosing one
+	s.Begin()
+	require.NoError(t, s.SetGlobal(1, &common.Int{Value: 3}))
+	require.NoError(t, s.Commit())
+	_, err = db.Get("contract/contract/globals/1")
+	require.Equal(t, storage.NotFoundErr, err)
+
+	require.NoError(t, s.Commit())
+	require.False(t, s.InTransaction())
+	v, err = s.GetGlobal(0)
+	require.NoError(t, err)
+	require.Equal(t, "1", v.String())
+	v, err = s.GetGlobal(1)
+	require.NoError(t, err)
+	require.Equal(t, "3", v.String())
+
+	s.Begin()
+	require.NoError(t, s.SetGlobal(0, &common.Int{Value: 4}))
+	s.Rollback()
+	v, err = s.GetGlobal(0)
+	require.NoError(t, err)
+	require.Equal(t, "1", v.String())
+}
+
+func TestStorage_Bytecode(t *testing.T) {
+	modules := stdlib.GetModuleMap("math")
+	input := []byte(`
+math := import("math")
+double := func(x) { return x * 2 }
+out := double(math.abs(-21.0))`)
+	fileSet := parser.NewFileSet()
+	srcFile := fileSet.AddFile("contract", -1, len(input))
+	p := parser.NewParser(srcFile, input, nil)
+	file, err := p.ParseFile()
+	require.NoError(t, err)
+	c := complier.NewCompiler(srcFile, nil, nil, modules, nil)
+	require.NoError(t, c.Compile(file))
+	bytecode := c.Bytecode()
+	bytecode.RemoveDuplicates()
+
+	s, err := storage.New("contract", storage.NewMemDB())
+	require.NoError(t, err)
+	_, err = s.LoadBytecode(modules)
+	require.Equal(t, storage.NotFoundErr, err)
+	require.NoError(t, s.SaveBytecode(bytecode))
+
+	loaded, err := s.LoadBytecode(modules)
+	require.NoError(t, err)
+	require.Equal(t, len(bytecode.Constants), len(loaded.Constants))
+	require.Equal(t, bytecode.MainFunction.Instructions,
+		loaded.MainFunction.Instructions)
+	require.Equal(t, bytecode.FileSet.Base, loaded.FileSet.Base)
+
+	s.SetImports(modules)
+	for i, expected := range bytecode.Constants {
+		v, err := s.LoadConstants(i)
+		require.NoError(t, err)
+		require.Equal(t, expected.String(), v.String())
+	}
+
+	globals := make([]common.Object, common.GlobalsSize)
+	v := vm.NewVM(loaded, globals, -1)
+	require.NoError(t, v.Run())
+	require.Equal(t, 42.0, globals[2].(*common.Float).Value)
+}
+
+func TestStorage_Namespace(t *testing.T) {
+	db := storage.NewMemDB()
+	_, err := storage.New("", db)
+	require.Equal(t, storage.InvalidAddressErr, err)
+	_, err = storage.New("a/b", db)
+	require.Equal(t, storage.InvalidAddressErr, err)
+
+	s1, err := storage.New("a", db)
+	require.NoError(t, err)
+	s2, err := storage.New("ab", db)
+	require.NoError(t, err)
+	require.NoError(t, s1.SetGlobal(0, &common.Int{Value: 1}))
+	require.NoError(t, s2.SetGlobal(0, &common.Int{Value: 2}))
+	v, err := s1.GetGlobal(0)
+	require.NoError(t, err)
+	require.Equal(t, "1", v.String())
+
+	var keys []string
+	err = s1.KV().Iterate("", func(key string, _ []byte) error {
+		keys = append(keys, key)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(keys))
+	require.Equal(t, "globals/0", keys[0])
+}
@@ -67,6 +67,10 @@ const (
 	Semicolon    // ;
 	Colon        // :
 	Question     // ?
+	Coalesce     // ??
+	OptPeriod    // ?.
+	Pow          // **
+	PowAssign    // **=
 	_operatorEnd
 	_keywordBeg
 	Break
@@ -84,6 +88,16 @@ const (
 	In
 	Undefined
 	Import
+	Try
+	Catch
+	Finally
+	Throw
+	Switch
+	Case
+	Default
+	Yield
+	Defer
+	Class
 	_keywordEnd
 )
 
@@ -143,6 +157,10 @@ var tokens = [...]string{
 	Semicolon:    ";",
 	Colon:        ":",
 	Question:     "?",
+	Coalesce:     "??",
+	OptPeriod:    "?.",
+	Pow:          "**",
+	PowAssign:    "**=",
 	Break:        "break",
 	Continue:     "continue",
 	Else:         "else",
@@ -158,6 +176,16 @@ var tokens = [...]string{
 	In:           "in",
 	Undefined:    "undefined",
 	Import:       "import",
+	Try:          "try",
+	Catch:        "catch",
+	Finally:      "finally",
+	Throw:        "throw",
+	Switch:       "switch",
+	Case:         "case",
+	Default:      "default",
+	Yield:        "yield",
+	Defer:        "defer",
+	Class:        "class",
 }
 
 func (tok Token) String() string {
@@ -180,16 +208,20 @@ const LowestPrec = 0
 // Precedence returns the precedence for the operator token.
 func (tok Token) Precedence() int {
 	switch tok {
-	case LOr:
+	case Coalesce:
 		return 1
-	case LAnd:
+	case LOr:
 		return 2
-	case Equal, NotEqual, Less, LessEq, Greater, GreaterEq:
+	case LAnd:
 		return 3
-	case Add, Sub, Or, Xor:
+	case Equal, NotEqual, Less, LessEq, Greater, GreaterEq, In:
 		return 4
-	case Mul, Quo, Rem, Shl, Shr, And, AndNot:
+	case Add, Sub, Or, Xor:
 		return 5
+	case Mul, Quo, Rem, Shl, Shr, And, AndNot:
+		return 6
+	case Pow:
+		return 7
 	}
 	return LowestPrec
 }
@@ -0,0 +1,69 @@
+package vm
+
+import (
+	"github.com/d5/tengo/v2/common"
+)
+
+// callMethod calls the protocol method fn of an instance with args on a new
+// frame and returns its result. It returns false if the call fails.
+func (v *VM) callMethod(
+	fn common.Object,
+	args ...common.Object,
+) (common.Object, bool) {
+	ret, err := v.runStub(callStub, fn, &common.Array{Value: args})
+	if err != nil {
+		if err != common.ErrVMAborted {
+			v.err = err
+		}
+		return nil, false
+	}
+	return ret, true
+}
+
+// equals returns true if left is equal to right. The "__eq" method of the
+// instances is called if they have one. It returns false as the second value
+// if the call fails.
+func (v *VM) equals(left, right common.Object) (bool, bool) {
+	if m, recv, arg := common.EqualsMethod(left, right); m != nil {
+		ret, ok := v.callMethod(m, recv, arg)
+		return ok && !ret.IsFalsy(), ok
+	}
+	return left.Equals(right), true
+}
+
+// instanceIndex returns the field or the bound method of inst for index, or,
+// the result of the "__index" method of inst for other indexes. It returns
+// false if the call of the method fails.
+func (v *VM) instanceIndex(
+	inst *common.Instance,
+	index common.Object,
+) (common.Object, bool) {
+	if val, ok := inst.Member(index); ok {
+		return val, true
+	}
+	if m := inst.Method("__index"); m != nil {
+		return v.callMethod(m, inst, index)
+	}
+	return common.UndefinedValue, true
+}
+
+// toString returns the string representation of o. The "__str" method is
+// called for the instances that have one. It returns false if the call of
+// the method fails.
+func (v *VM) toString(o common.Object) (string, bool) {
+	if inst, ok := o.(*common.Instance); ok {
+		if m := inst.Method("__str"); m != nil {
+			ret, ok := v.callMethod(m, inst)
+			if !ok {
+				return "", false
+			}
+			return common.MethodString(ret), true
+		}
+	}
+	return o.String(), true
+}
+
+func isInstance(o common.Object) bool {
+	_, ok := o.(*common.Instance)
+	return ok
+}
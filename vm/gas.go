@@ -0,0 +1,107 @@
+package vm
+
+import (
+	"github.com/d5/tengo/v2/common"
+	"github.com/d5/tengo/v2/parser"
+)
+
+// GasSchedule is a gas cost table used by the VM to meter the execution.
+type GasSchedule struct {
+	// Opcodes is the base cost of each instruction, indexed by the opcode.
+	Opcodes [256]int64
+
+	// BuiltinCall is the extra cost of calling a builtin function.
+	BuiltinCall int64
+
+	// UserFunctionCall is the extra cost of calling a user function or any
+	// other callable object written in Go.
+	UserFunctionCall int64
+
+	// PerByte is the cost of each byte of string or bytes values returned by
+	// binary operations and function calls.
+	PerByte int64
+}
+
+// DefaultGasSchedule returns a new copy of the default gas schedule.
+func DefaultGasSchedule() *GasSchedule {
+	s := &GasSchedule{
+		BuiltinCall:      20,
+		UserFunctionCall: 40,
+		PerByte:          1,
+	}
+	for op := range parser.OpcodeNames {
+		s.Opcodes[op] = 1
+	}
+	s.Opcodes[parser.OpArray] = 3
+	s.Opcodes[parser.OpMap] = 3
+	s.Opcodes[parser.OpError] = 2
+	s.Opcodes[parser.OpImmutable] = 2
+	s.Opcodes[parser.OpSliceIndex] = 2
+	s.Opcodes[parser.OpBinaryOp] = 2
+	s.Opcodes[parser.OpContains] = 2
+	s.Opcodes[parser.OpConcat] = 2
+	s.Opcodes[parser.OpCall] = 10
+	s.Opcodes[parser.OpCallKw] = 10
+	s.Opcodes[parser.OpDefer] = 3
+	s.Opcodes[parser.OpDeferKw] = 3
+	s.Opcodes[parser.OpClass] = 5
+	s.Opcodes[parser.OpInstance] = 3
+	s.Opcodes[parser.OpClosure] = 5
+	s.Opcodes[parser.OpIteratorInit] = 3
+	s.Opcodes[parser.OpSuspend] = 0
+	return s
+}
+
+// consumeGas charges the gas and returns false if the gas limit is exceeded.
+func (v *VM) consumeGas(gas int64) bool {
+	v.gasUsed += gas
+	if v.gasLimit >= 0 && v.gasUsed > v.gasLimit {
+		v.err = common.ErrOutOfGas{Limit: v.gasLimit, Used: v.gasUsed}
+		return false
+	}
+	return true
+}
+
+// consumeSizeGas charges the gas for the size of string, bytes, big-int or
+// decimal value.
+func (v *VM) consumeSizeGas(o common.Object) bool {
+	switch o := o.(type) {
+	case *common.String:
+		return v.consumeGas(int64(len(o.Value)) * v.gas.PerByte)
+	case *common.Bytes:
+		return v.consumeGas(int64(len(o.Value)) * v.gas.PerByte)
+	case *common.BigInt:
+		n := (o.Value.BitLen() + 7) / 8
+		return v.consumeGas(int64(n) * v.gas.PerByte)
+	case *common.Decimal:
+		n := (o.Value.BitLen() + 7) / 8
+		return v.consumeGas(int64(n) * v.gas.PerByte)
+	}
+	return true
+}
+
+// GasLeft returns the gas left for the run. It returns -1 if the gas is not
+// limited.
+func (v *VM) GasLeft() int64 {
+	if v.gas == nil || v.gasLimit < 0 {
+		return -1
+	}
+	if v.gasUsed >= v.gasLimit {
+		return 0
+	}
+	return v.gasLimit - v.gasUsed
+}
+
+// UseGas charges the run with the gas used outside of the VM, e.g. by a nested
+// VM that is run by a function called from the VM. It returns
+// common.ErrOutOfGas if the gas limit is exceeded.
+func (v *VM) UseGas(gas int64) error {
+	if v.gas == nil {
+		return nil
+	}
+	v.gasUsed += gas
+	if v.gasLimit >= 0 && v.gasUsed > v.gasLimit {
+		return common.ErrOutOfGas{Limit: v.gasLimit, Used: v.gasUsed}
+	}
+	return nil
+}
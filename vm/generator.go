@@ -0,0 +1,203 @@
+package vm
+
+import (
+	"github.com/d5/tengo/v2/common"
+	"github.com/d5/tengo/v2/parser"
+)
+
+// nextStub is the function that resumes the generator at the bottom of its
+// frame, and, suspends the execution when the generator yields or returns.
+var nextStub = &common.CompiledFunction{
+	Instructions: []byte{parser.OpIteratorNext, parser.OpSuspend},
+}
+
+// Generator is the iterator returned by a call to a generator function, a
+// compiled function with yield statements. Each Next resumes the function
+// until it yields a value or returns. While it's suspended, the generator
+// keeps the instruction pointer, the stack slice, the try handlers and the
+// deferred calls of its frame, which are restored on the top of the frames
+// when it's resumed. The deferred calls run when the generator returns or
+// fails, but, not when it's abandoned while suspended.
+type Generator struct {
+	common.ObjectImpl
+	vm       *VM
+	fn       *common.CompiledFunction
+	freeVars []*common.ObjectPtr
+	ip       int
+	stack    []common.Object // locals and operands of the suspended frame
+	tries    []tryHandler    // sp relative to the base of the frame
+	defers   []deferredCall
+	index    int
+	value    common.Object
+	running  bool
+	done     bool
+	err      error
+}
+
+// TypeName returns the name of the type.
+func (g *Generator) TypeName() string {
+	return "generator"
+}
+
+func (g *Generator) String() string {
+	return "<generator>"
+}
+
+// Equals returns true if the value of the type is equal to the value of
+// another object.
+func (g *Generator) Equals(x common.Object) bool {
+	return g == x
+}
+
+// Copy returns a copy of the type.
+func (g *Generator) Copy() common.Object {
+	return g
+}
+
+// Iterate returns the generator itself.
+func (g *Generator) Iterate() common.Iterator {
+	return g
+}
+
+// CanIterate returns whether the Object can be Iterated.
+func (g *Generator) CanIterate() bool {
+	return true
+}
+
+// Next resumes the generator, and, returns true if it yields a value. The VM
+// resumes the generator directly when it's iterated by the script. Next can
+// be called by the Go functions called from the VM of the generator, and, it
+// returns false with Err set if the generator fails or the VM is not running
+// a Go function.
+func (g *Generator) Next() bool {
+	if g.done {
+		return false
+	}
+	if g.vm == nil || g.vm.calls == 0 {
+		g.err = common.ErrNotInCall
+		return false
+	}
+	ret, err := g.vm.runStub(nextStub, g)
+	if err != nil {
+		g.err = err
+		g.finish()
+		return false
+	}
+	return ret == common.TrueValue
+}
+
+// Key returns the index of the last yielded value.
+func (g *Generator) Key() common.Object {
+	return &common.Int{Value: int64(g.index - 1)}
+}
+
+// Value returns the last yielded value.
+func (g *Generator) Value() common.Object {
+	if g.value == nil {
+		return common.UndefinedValue
+	}
+	return g.value
+}
+
+// Err returns the error that stopped Next.
+func (g *Generator) Err() error {
+	return g.err
+}
+
+// finish ends the generator: it's not resumed anymore.
+func (g *Generator) finish() {
+	g.running = false
+	g.done = true
+	g.stack = nil
+	g.tries = nil
+	g.defers = nil
+}
+
+// newGenerator creates a generator for the call to the generator function fn
+// with the arguments on the top of the stack.
+func (v *VM) newGenerator(
+	fn *common.CompiledFunction,
+	numArgs int,
+) *Generator {
+	stack := make([]common.Object, fn.NumLocals)
+	copy(stack, v.stack[v.sp-numArgs:v.sp])
+	return &Generator{
+		vm:       v,
+		fn:       fn,
+		freeVars: fn.Free,
+		ip:       -1,
+		stack:    stack,
+	}
+}
+
+// resume pushes the frame of generator g on the top of the frames, and,
+// continues the execution from where it was suspended. The generator must be
+// on the top of the stack, and, it's replaced with true when the generator
+// yields a value or false when it returns. It returns false on error.
+func (v *VM) resume(g *Generator) bool {
+	if g.done {
+		v.stack[v.sp-1] = common.FalseValue
+		return true
+	}
+	if g.running {
+		v.err = common.ErrGeneratorRunning
+		return false
+	}
+	if v.framesIndex >= common.MaxFrames ||
+		v.sp+len(g.stack) >= common.StackSize {
+		v.err = common.ErrStackOverflow
+		return false
+	}
+
+	v.curFrame.ip = v.ip
+	v.curFrame = &(v.frames[v.framesIndex])
+	v.curFrame.fn = g.fn
+	v.curFrame.freeVars = g.freeVars
+	v.curFrame.basePointer = v.sp
+	v.curFrame.gen = g
+	v.curFrame.defers = g.defers
+	g.defers = nil
+	v.curInsts = g.fn.Instructions
+	v.ip = g.ip
+	v.framesIndex++
+	copy(v.stack[v.sp:], g.stack)
+	for _, h := range g.tries {
+		h.sp += v.sp
+		h.framesIndex = v.framesIndex
+		v.tries = append(v.tries, h)
+	}
+	v.sp += len(g.stack)
+	g.running = true
+	return true
+}
+
+// yield suspends the generator of the current frame with the value val, and,
+// returns to the frame that resumed the generator.
+func (v *VM) yield(val common.Object) {
+	g := v.curFrame.gen
+	base := v.curFrame.basePointer
+	g.ip = v.ip
+	g.stack = append(g.stack[:0], v.stack[base:v.sp]...)
+	g.tries = g.tries[:0]
+	i := len(v.tries)
+	for i > v.triesBase && v.tries[i-1].framesIndex == v.framesIndex {
+		i--
+	}
+	for _, h := range v.tries[i:] {
+		h.sp -= base
+		g.tries = append(g.tries, h)
+	}
+	v.tries = v.tries[:i]
+	g.defers = v.curFrame.defers
+	v.curFrame.defers = nil
+	g.value = val
+	g.index++
+	g.running = false
+
+	v.framesIndex--
+	v.curFrame = &v.frames[v.framesIndex-1]
+	v.curInsts = v.curFrame.fn.Instructions
+	v.ip = v.curFrame.ip
+	v.sp = base
+	v.stack[v.sp-1] = common.TrueValue
+}
@@ -1,41 +1,126 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
 	"sync/atomic"
 
 	"github.com/d5/tengo/v2/common"
 	"github.com/d5/tengo/v2/complier"
 	"github.com/d5/tengo/v2/parser"
+	"github.com/d5/tengo/v2/storage"
 	"github.com/d5/tengo/v2/token"
 )
 
+var canonicalNaNBits = math.Float64bits(math.NaN())
+
+// callStub is the function that calls the function at the bottom of its
+// frame with the arguments spread from the array above it, and, suspends the
+// execution when the call returns.
+var callStub = &common.CompiledFunction{
+	Instructions: append(
+		complier.MakeInstruction(parser.OpCall, 1, 1),
+		parser.OpSuspend),
+}
+
 // frame represents a function call frame.
 type frame struct {
 	fn          *common.CompiledFunction
 	freeVars    []*common.ObjectPtr
 	ip          int
 	basePointer int
+	gen         *Generator // generator running on the frame; or nil
+	defers      []deferredCall
 }
 
-// VM is a virtual machine that executes the bytecode compiled by Compiler.
-type VM struct {
-	constants   []common.Object
-	stack       [common.StackSize]common.Object
+// deferredCall is a call recorded by a defer statement. It runs the stub
+// function with the function and the arguments evaluated at the defer
+// statement as the operands.
+type deferredCall struct {
+	stub     *common.CompiledFunction
+	operands []common.Object
+}
+
+// tryHandler is an error handler pushed by a try statement.
+type tryHandler struct {
+	ip          int // position of the handler instructions
 	sp          int
-	globals     []common.Object
-	fileSet     *parser.SourceFileSet
-	frames      [common.MaxFrames]frame
 	framesIndex int
-	curFrame    *frame
-	curInsts    []byte
-	ip          int
-	aborting    int64
-	maxAllocs   int64
-	allocs      int64
-	err         error
 }
 
+// persistedGlobal is a global variable backed by the storage.
+type persistedGlobal struct {
+	value    common.Object // value at the first access during the run
+	snapshot common.Object // deep copy of value for in-place mutable types
+}
+
+func newPersistedGlobal(value common.Object) *persistedGlobal {
+	g := &persistedGlobal{value: value, snapshot: value}
+	switch value.(type) {
+	case *common.Array, *common.ImmutableArray,
+		*common.Map, *common.ImmutableMap,
+		*common.Set, *common.ImmutableSet, *common.Instance:
+		g.snapshot = value.Copy()
+	}
+	return g
+}
+
+// changed returns true if cur differs from the value at the first access.
+func (g *persistedGlobal) changed(cur common.Object) bool {
+	if g.value == nil {
+		return cur != nil
+	}
+	switch cur.(type) {
+	case *common.Array, *common.ImmutableArray,
+		*common.Map, *common.ImmutableMap,
+		*common.Set, *common.ImmutableSet, *common.Instance:
+		// elements can be mutated in place
+	default:
+		if cur == g.value {
+			return false
+		}
+	}
+	return !g.snapshot.Equals(cur)
+}
+
+// VM is a virtual machine that executes the bytecode compiled by Compiler.
+type VM struct {
+	constants     []common.Object
+	stack         [common.StackSize]common.Object
+	sp            int
+	globals       []common.Object
+	fileSet       *parser.SourceFileSet
+	frames        [common.MaxFrames]frame
+	framesIndex   int
+	curFrame      *frame
+	curInsts      []byte
+	ip            int
+	aborting      int64
+	maxAllocs     int64
+	allocs        int64
+	err           error
+	storage       *storage.Storage
+	persisted     map[int]*persistedGlobal
+	gas           *GasSchedule
+	gasLimit      int64
+	gasUsed       int64
+	deterministic bool
+	checkedArith  bool
+	calls         int // number of the running Go function calls
+	tries         []tryHandler
+	triesBase     int // first handler of the running invocation
+	temps         [common.TempGlobals]common.Object
+}
+
+// tempsBase is the first global index of the temporaries of the top-level
+// statements. The VM keeps them apart from the globals, so they are not
+// persisted and the globals can be smaller than common.GlobalsSize.
+const tempsBase = common.GlobalsSize - common.TempGlobals
+
 // NewVM creates a VM.
 func NewVM(
 	bytecode *complier.Bytecode,
@@ -61,6 +146,48 @@ func NewVM(
 	return v
 }
 
+// SetStorage enables the persistent globals mode. Global variables are loaded
+// lazily from the storage on their first access during the run, and, the
+// changed ones are written back when the run succeeds. Each run is executed in
+// a storage transaction: all the writes are committed atomically when the run
+// succeeds, or, discarded on a runtime error or Abort.
+func (v *VM) SetStorage(s *storage.Storage) {
+	v.storage = s
+}
+
+// SetGasLimit enables the gas metering. Each executed instruction is charged
+// by the schedule, and, the run fails with common.ErrOutOfGas if the gas used
+// exceeds the limit. Set limit to a negative number to meter the execution
+// without limiting it. DefaultGasSchedule is used if schedule is nil.
+func (v *VM) SetGasLimit(limit int64, schedule *GasSchedule) {
+	if schedule == nil {
+		schedule = DefaultGasSchedule()
+	}
+	v.gas = schedule
+	v.gasLimit = limit
+}
+
+// SetDeterministic enables or disables the deterministic mode. In the
+// deterministic mode, maps are iterated in sorted key order, and, NaN results
+// of operations and function calls are replaced with the canonical NaN as
+// their bits can differ between platforms.
+func (v *VM) SetDeterministic(enable bool) {
+	v.deterministic = enable
+}
+
+// SetCheckedArithmetic enables or disables the checked arithmetic mode. In
+// the checked arithmetic mode, the int add, sub, mul, quo, rem, shl, "**" and
+// negation operations fail with common.ErrIntegerOverflow instead of wrapping
+// around on overflow.
+func (v *VM) SetCheckedArithmetic(enable bool) {
+	v.checkedArith = enable
+}
+
+// GasUsed returns the gas used by the last run.
+func (v *VM) GasUsed() int64 {
+	return v.gasUsed
+}
+
 // Abort aborts the execution.
 func (v *VM) Abort() {
 	atomic.StoreInt64(&v.aborting, 1)
@@ -68,18 +195,162 @@ func (v *VM) Abort() {
 
 // Run starts the execution.
 func (v *VM) Run() (err error) {
+	_, err = v.execute(0)
+	return
+}
+
+// RunCompiled calls the compiled function fn with args, and, returns its
+// result. fn must be compiled as a part of the bytecode of the VM, as it
+// shares the globals and the constants with the main function. Like Run, the
+// call is executed in a storage transaction if the storage is set. It returns
+// UndefinedValue if the execution is aborted.
+func (v *VM) RunCompiled(
+	fn *common.CompiledFunction,
+	args ...common.Object,
+) (common.Object, error) {
+	if len(args)+2 >= common.StackSize {
+		return nil, common.ErrStackOverflow
+	}
+	main := v.frames[0].fn
+	defer func() {
+		v.frames[0].fn = main
+	}()
+	v.frames[0].fn = callStub
+	v.stack[0] = fn
+	v.stack[1] = &common.Array{Value: args}
+	aborted, err := v.execute(2)
+	if err != nil {
+		return nil, err
+	}
+	if aborted {
+		return common.UndefinedValue, nil
+	}
+	return v.stack[v.sp-1], nil
+}
+
+// Invoke calls fn with args on the VM while the VM is running a Go function,
+// and, returns its result. The call shares the frames, the stack, the
+// allocation limit, the gas and the abort of the running execution, and, a
+// runtime error of the call is returned with its stack trace. It returns
+// ErrNotInCall if the VM is not running a Go function, and, ErrVMAborted if
+// the execution is aborted during the call. Invoke must be called on the
+// goroutine of the Go function.
+func (v *VM) Invoke(
+	fn common.Object,
+	args ...common.Object,
+) (common.Object, error) {
+	if v.calls == 0 {
+		return nil, common.ErrNotInCall
+	}
+	switch fn.(type) {
+	case *common.CompiledFunction, *common.Class:
+	default:
+		if !fn.CanCall() {
+			return nil, fmt.Errorf("not callable: %s", fn.TypeName())
+		}
+		return fn.Call(args...)
+	}
+	if v.sp+len(args)+2 >= common.StackSize {
+		return nil, common.ErrStackOverflow
+	}
+	return v.runStub(callStub, fn, &common.Array{Value: args})
+}
+
+// runStub runs the stub function on a new frame above the current frame with
+// the operands on the stack, and, returns the value on the top of the stack
+// when the stub suspends the execution. It's used to call back into the
+// running VM from a Go function.
+func (v *VM) runStub(
+	stub *common.CompiledFunction,
+	operands ...common.Object,
+) (common.Object, error) {
+	if v.sp+len(operands) >= common.StackSize ||
+		v.framesIndex >= common.MaxFrames {
+		return nil, common.ErrStackOverflow
+	}
+
+	// do not let the errors of the stub unwind the frames below it
+	curFrame, ip, sp, framesIndex := v.curFrame, v.ip, v.sp, v.framesIndex
+	triesBase := v.triesBase
+	v.triesBase = len(v.tries)
+	v.curFrame.ip = v.ip
+	v.curFrame = &(v.frames[v.framesIndex])
+	v.curFrame.fn = stub
+	v.curFrame.freeVars = nil
+	v.curFrame.basePointer = v.sp
+	v.curFrame.gen = nil
+	v.curFrame.defers = nil
+	v.curInsts = stub.Instructions
+	v.ip = -1
+	v.framesIndex++
+	for _, o := range operands {
+		v.stack[v.sp] = o
+		v.sp++
+	}
+
+	v.run()
+	v.unwind(framesIndex + 1)
+
+	var ret common.Object
+	err := v.err
+	if err != nil {
+		for v.framesIndex > framesIndex+1 {
+			filePos := v.fileSet.Position(
+				v.curFrame.fn.SourcePos(v.ip - 1))
+			err = fmt.Errorf("%w\n\tat %s", err, filePos)
+			v.framesIndex--
+			v.curFrame = &v.frames[v.framesIndex-1]
+			v.ip = v.curFrame.ip
+		}
+		if v.err == common.ErrObjectAllocLimit {
+			// keep the limit exceeded even if the Go function ignores the
+			// error
+			v.allocs = 1
+		}
+		v.err = nil
+	} else if atomic.LoadInt64(&v.aborting) == 1 {
+		err = common.ErrVMAborted
+	} else {
+		ret = v.stack[v.sp-1]
+	}
+
+	v.curFrame = curFrame
+	v.curInsts = curFrame.fn.Instructions
+	v.ip = ip
+	v.sp = sp
+	v.framesIndex = framesIndex
+	v.tries = v.tries[:v.triesBase]
+	v.triesBase = triesBase
+	return ret, err
+}
+
+// execute runs the function of the first frame, with the stack pointer at sp.
+func (v *VM) execute(sp int) (aborted bool, err error) {
 	// reset VM states
-	v.sp = 0
+	v.sp = sp
 	v.curFrame = &(v.frames[0])
 	v.curInsts = v.curFrame.fn.Instructions
 	v.framesIndex = 1
 	v.ip = -1
 	v.allocs = v.maxAllocs + 1
+	v.gasUsed = 0
+	v.err = nil
+	v.calls = 0
+	v.tries = v.tries[:0]
+	v.triesBase = 0
+	if v.storage != nil {
+		v.persisted = make(map[int]*persistedGlobal)
+		v.storage.Begin()
+	}
 
 	v.run()
-	atomic.StoreInt64(&v.aborting, 0)
+	v.unwind(1)
+	aborted = atomic.SwapInt64(&v.aborting, 0) == 1
 	err = v.err
 	if err != nil {
+		if v.storage != nil {
+			v.storage.Rollback()
+		}
 		filePos := v.fileSet.Position(
 			v.curFrame.fn.SourcePos(v.ip - 1))
 		err = fmt.Errorf("Runtime Error: %w\n\tat %s",
@@ -91,15 +362,130 @@ func (v *VM) Run() (err error) {
 				v.curFrame.fn.SourcePos(v.curFrame.ip - 1))
 			err = fmt.Errorf("%w\n\tat %s", err, filePos)
 		}
-		return err
+		return aborted, err
 	}
-	return nil
+	if v.storage != nil {
+		if aborted {
+			v.storage.Rollback()
+			return aborted, nil
+		}
+		if err := v.storeGlobals(); err != nil {
+			v.storage.Rollback()
+			return aborted, err
+		}
+		return aborted, v.storage.Commit()
+	}
+	return aborted, nil
 }
 
+// run executes the instructions until the execution ends, and, recovers from
+// the runtime errors with the error handlers of try statements.
 func (v *VM) run() {
+	for {
+		v.dispatch()
+		if v.err == nil || !v.catch() {
+			return
+		}
+	}
+}
+
+// catch unwinds the frames to the innermost error handler, and, pushes the
+// error object of the runtime error for the handler. It returns false if
+// there's no handler or the error cannot be recovered from.
+func (v *VM) catch() bool {
+	if len(v.tries) == v.triesBase || !catchable(v.err) {
+		return false
+	}
+	h := v.tries[len(v.tries)-1]
+	v.unwind(h.framesIndex)
+	if !catchable(v.err) {
+		// a deferred call exceeded the limits
+		return false
+	}
+
+	var errObj *common.Error
+	var thrown common.ErrThrown
+	if errors.As(v.err, &thrown) {
+		errObj = thrown.Value
+	} else {
+		errObj = &common.Error{
+			Value: &common.String{Value: v.err.Error()},
+			Pos: v.fileSet.Position(
+				v.curFrame.fn.SourcePos(v.ip - 1)),
+		}
+	}
+
+	v.tries = v.tries[:len(v.tries)-1]
+	v.framesIndex = h.framesIndex
+	v.curFrame = &v.frames[v.framesIndex-1]
+	v.curInsts = v.curFrame.fn.Instructions
+	v.ip = h.ip - 1
+	v.sp = h.sp
+	v.stack[v.sp] = errObj
+	v.sp++
+	v.err = nil
+	return true
+}
+
+// unwind runs the deferred calls of the frames from the top down to
+// framesIndex, which are unwound by the runtime error, and, ends their
+// generators. A runtime error of a deferred call replaces the error. The
+// deferred calls do not run if the execution is aborted or exceeds the limits.
+func (v *VM) unwind(framesIndex int) {
+	for i := v.framesIndex - 1; i >= framesIndex; i-- {
+		f := &v.frames[i]
+		for len(f.defers) > 0 && v.err != nil && catchable(v.err) &&
+			atomic.LoadInt64(&v.aborting) == 0 {
+			d := f.defers[len(f.defers)-1]
+			f.defers = f.defers[:len(f.defers)-1]
+			err := v.err
+			v.err = nil
+			_, e := v.runStub(d.stub, d.operands...)
+			if e != nil && e != common.ErrVMAborted {
+				err = e
+			}
+			v.err = err
+		}
+		f.defers = nil
+		if f.gen != nil {
+			f.gen.finish()
+		}
+	}
+}
+
+// runDefers runs the deferred calls of the current frame in the reverse order
+// of the defer statements. It returns false if a call fails.
+func (v *VM) runDefers() bool {
+	f := v.curFrame
+	for len(f.defers) > 0 {
+		d := f.defers[len(f.defers)-1]
+		f.defers = f.defers[:len(f.defers)-1]
+		if _, err := v.runStub(d.stub, d.operands...); err != nil {
+			if err != common.ErrVMAborted {
+				v.err = err
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// catchable returns true if the runtime error can be recovered from by a try
+// statement. Exceeding the limits of the execution cannot be recovered from.
+func catchable(err error) bool {
+	var outOfGas common.ErrOutOfGas
+	return !errors.As(err, &outOfGas) &&
+		!errors.Is(err, common.ErrObjectAllocLimit)
+}
+
+func (v *VM) dispatch() {
 	for atomic.LoadInt64(&v.aborting) == 0 {
 		v.ip++
 
+		if v.gas != nil && !v.consumeGas(v.gas.Opcodes[v.curInsts[v.ip]]) {
+			return
+		}
+
 		switch v.curInsts[v.ip] {
 		case parser.OpConstant:
 			v.ip += 2
@@ -115,7 +501,26 @@ func (v *VM) run() {
 			right := v.stack[v.sp-1]
 			left := v.stack[v.sp-2]
 			tok := token.Token(v.curInsts[v.ip])
-			res, e := left.BinaryOp(tok, right)
+			var res common.Object
+			var e error
+			if m, recv, arg := common.OperatorMethod(
+				left, tok, right); m != nil {
+				var ok bool
+				if res, ok = v.callMethod(m, recv, arg); !ok {
+					return
+				}
+			} else if s, ok := left.(*common.String); ok &&
+				tok == token.Add && isInstance(right) {
+				str, ok := v.toString(right)
+				if !ok {
+					return
+				}
+				res, e = s.BinaryOp(tok, &common.String{Value: str})
+			} else if v.checkedArith {
+				res, e = checkedBinaryOp(left, tok, right)
+			} else {
+				res, e = left.BinaryOp(tok, right)
+			}
 			if e != nil {
 				v.sp -= 2
 				if e == common.ErrInvalidOperator {
@@ -132,14 +537,40 @@ func (v *VM) run() {
 				v.err = common.ErrObjectAllocLimit
 				return
 			}
+			if v.gas != nil && !v.consumeSizeGas(res) {
+				return
+			}
+			if v.deterministic {
+				res = canonicalNaN(res)
+			}
 
 			v.stack[v.sp-2] = res
 			v.sp--
+		case parser.OpContains:
+			right := v.stack[v.sp-1]
+			left := v.stack[v.sp-2]
+			v.sp -= 2
+			res, e := right.BinaryOp(token.In, left)
+			if e != nil {
+				if e == common.ErrInvalidOperator {
+					v.err = fmt.Errorf("invalid operation: %s in %s",
+						left.TypeName(), right.TypeName())
+					return
+				}
+				v.err = e
+				return
+			}
+			v.stack[v.sp] = res
+			v.sp++
 		case parser.OpEqual:
 			right := v.stack[v.sp-1]
 			left := v.stack[v.sp-2]
 			v.sp -= 2
-			if left.Equals(right) {
+			eq, ok := v.equals(left, right)
+			if !ok {
+				return
+			}
+			if eq {
 				v.stack[v.sp] = common.TrueValue
 			} else {
 				v.stack[v.sp] = common.FalseValue
@@ -149,7 +580,11 @@ func (v *VM) run() {
 			right := v.stack[v.sp-1]
 			left := v.stack[v.sp-2]
 			v.sp -= 2
-			if left.Equals(right) {
+			eq, ok := v.equals(left, right)
+			if !ok {
+				return
+			}
+			if eq {
 				v.stack[v.sp] = common.FalseValue
 			} else {
 				v.stack[v.sp] = common.TrueValue
@@ -186,6 +621,17 @@ func (v *VM) run() {
 				}
 				v.stack[v.sp] = res
 				v.sp++
+			case *common.BigInt:
+				var res common.Object = &common.BigInt{
+					Value: new(big.Int).Not(x.Value),
+				}
+				v.allocs--
+				if v.allocs == 0 {
+					v.err = common.ErrObjectAllocLimit
+					return
+				}
+				v.stack[v.sp] = res
+				v.sp++
 			default:
 				v.err = fmt.Errorf("invalid operation: ^%s",
 					operand.TypeName())
@@ -197,6 +643,10 @@ func (v *VM) run() {
 
 			switch x := operand.(type) {
 			case *common.Int:
+				if v.checkedArith && x.Value == math.MinInt64 {
+					v.err = common.ErrIntegerOverflow
+					return
+				}
 				var res common.Object = &common.Int{Value: -x.Value}
 				v.allocs--
 				if v.allocs == 0 {
@@ -214,6 +664,29 @@ func (v *VM) run() {
 				}
 				v.stack[v.sp] = res
 				v.sp++
+			case *common.BigInt:
+				var res common.Object = &common.BigInt{
+					Value: new(big.Int).Neg(x.Value),
+				}
+				v.allocs--
+				if v.allocs == 0 {
+					v.err = common.ErrObjectAllocLimit
+					return
+				}
+				v.stack[v.sp] = res
+				v.sp++
+			case *common.Decimal:
+				var res common.Object = &common.Decimal{
+					Value: new(big.Int).Neg(x.Value),
+					Scale: x.Scale,
+				}
+				v.allocs--
+				if v.allocs == 0 {
+					v.err = common.ErrObjectAllocLimit
+					return
+				}
+				v.stack[v.sp] = res
+				v.sp++
 			default:
 				v.err = fmt.Errorf("invalid operation: -%s",
 					operand.TypeName())
@@ -242,6 +715,14 @@ func (v *VM) run() {
 				pos := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8
 				v.ip = pos - 1
 			}
+		case parser.OpDefaultJump:
+			v.ip += 2
+			if v.stack[v.sp-1] == common.UndefinedValue {
+				v.sp--
+			} else {
+				pos := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8
+				v.ip = pos - 1
+			}
 		case parser.OpJump:
 			pos := int(v.curInsts[v.ip+2]) | int(v.curInsts[v.ip+1])<<8
 			v.ip = pos - 1
@@ -249,11 +730,27 @@ func (v *VM) run() {
 			v.ip += 2
 			v.sp--
 			globalIndex := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8
+			if globalIndex >= tempsBase {
+				v.temps[globalIndex-tempsBase] = v.stack[v.sp]
+				continue
+			}
+			if v.storage != nil {
+				if e := v.loadGlobal(globalIndex); e != nil {
+					v.err = e
+					return
+				}
+			}
 			v.globals[globalIndex] = v.stack[v.sp]
 		case parser.OpSetSelGlobal:
 			v.ip += 3
 			globalIndex := int(v.curInsts[v.ip-1]) | int(v.curInsts[v.ip-2])<<8
 			numSelectors := int(v.curInsts[v.ip])
+			if v.storage != nil {
+				if e := v.loadGlobal(globalIndex); e != nil {
+					v.err = e
+					return
+				}
+			}
 
 			// selectors and RHS value
 			selectors := make([]common.Object, numSelectors)
@@ -270,6 +767,17 @@ func (v *VM) run() {
 		case parser.OpGetGlobal:
 			v.ip += 2
 			globalIndex := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8
+			if globalIndex >= tempsBase {
+				v.stack[v.sp] = v.temps[globalIndex-tempsBase]
+				v.sp++
+				continue
+			}
+			if v.storage != nil {
+				if e := v.loadGlobal(globalIndex); e != nil {
+					v.err = e
+					return
+				}
+			}
 			val := v.globals[globalIndex]
 			v.stack[v.sp] = val
 			v.sp++
@@ -292,6 +800,38 @@ func (v *VM) run() {
 
 			v.stack[v.sp] = arr
 			v.sp++
+		case parser.OpConcat:
+			v.ip += 2
+			numParts := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8
+
+			var sb strings.Builder
+			for _, part := range v.stack[v.sp-numParts : v.sp] {
+				var str string
+				if s, ok := part.(*common.String); ok {
+					str = s.Value
+				} else if str, ok = v.toString(part); !ok {
+					return
+				}
+				if sb.Len()+len(str) > common.MaxStringLen {
+					v.err = common.ErrStringLimit
+					return
+				}
+				sb.WriteString(str)
+			}
+			v.sp -= numParts
+
+			var res common.Object = &common.String{Value: sb.String()}
+			v.allocs--
+			if v.allocs == 0 {
+				v.err = common.ErrObjectAllocLimit
+				return
+			}
+			if v.gas != nil && !v.consumeSizeGas(res) {
+				return
+			}
+
+			v.stack[v.sp] = res
+			v.sp++
 		case parser.OpMap:
 			v.ip += 2
 			numElements := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8
@@ -337,7 +877,8 @@ func (v *VM) run() {
 				v.stack[v.sp-1] = immutableArray
 			case *common.Map:
 				var immutableMap common.Object = &common.ImmutableMap{
-					Value: value.Value,
+					Value:   value.Value,
+					Entries: value.Entries,
 				}
 				v.allocs--
 				if v.allocs == 0 {
@@ -345,12 +886,32 @@ func (v *VM) run() {
 					return
 				}
 				v.stack[v.sp-1] = immutableMap
+			case *common.Set:
+				var immutableSet common.Object = &common.ImmutableSet{
+					Value: value.Value,
+				}
+				v.allocs--
+				if v.allocs == 0 {
+					v.err = common.ErrObjectAllocLimit
+					return
+				}
+				v.stack[v.sp-1] = immutableSet
 			}
 		case parser.OpIndex:
 			index := v.stack[v.sp-1]
 			left := v.stack[v.sp-2]
 			v.sp -= 2
 
+			if inst, ok := left.(*common.Instance); ok {
+				val, ok := v.instanceIndex(inst, index)
+				if !ok {
+					return
+				}
+				v.stack[v.sp] = val
+				v.sp++
+				continue
+			}
+
 			val, err := left.IndexGet(index)
 			if err != nil {
 				if err == common.ErrNotIndexable {
@@ -462,6 +1023,41 @@ func (v *VM) run() {
 				}
 				v.stack[v.sp] = val
 				v.sp++
+			case *common.Range:
+				numElements := left.Len()
+				var highIdx int64
+				if high == common.UndefinedValue {
+					highIdx = numElements
+				} else if high, ok := high.(*common.Int); ok {
+					highIdx = high.Value
+				} else {
+					v.err = fmt.Errorf("invalid slice index type: %s",
+						high.TypeName())
+					return
+				}
+				if lowIdx > highIdx {
+					v.err = fmt.Errorf("invalid slice index: %d > %d",
+						lowIdx, highIdx)
+					return
+				}
+				if lowIdx < 0 {
+					lowIdx = 0
+				} else if lowIdx > numElements {
+					lowIdx = numElements
+				}
+				if highIdx < 0 {
+					highIdx = 0
+				} else if highIdx > numElements {
+					highIdx = numElements
+				}
+				var val common.Object = left.Slice(lowIdx, highIdx)
+				v.allocs--
+				if v.allocs == 0 {
+					v.err = common.ErrObjectAllocLimit
+					return
+				}
+				v.stack[v.sp] = val
+				v.sp++
 			case *common.String:
 				numElements := int64(len(left.Value))
 				var highIdx int64
@@ -536,11 +1132,22 @@ func (v *VM) run() {
 				}
 				v.stack[v.sp] = val
 				v.sp++
+			default:
+				v.err = fmt.Errorf("not indexable: %s", left.TypeName())
+				return
 			}
-		case parser.OpCall:
+		case parser.OpCall, parser.OpCallKw:
 			numArgs := int(v.curInsts[v.ip+1])
-			spread := int(v.curInsts[v.ip+2])
-			v.ip += 2
+			var spread int
+			var keywords []common.Object
+			if v.curInsts[v.ip] == parser.OpCallKw {
+				cidx := int(v.curInsts[v.ip+3]) | int(v.curInsts[v.ip+2])<<8
+				keywords = v.constants[cidx].(*common.ImmutableArray).Value
+				v.ip += 3
+			} else {
+				spread = int(v.curInsts[v.ip+2])
+				v.ip += 2
+			}
 
 			value := v.stack[v.sp-1-numArgs]
 			if !value.CanCall() {
@@ -569,38 +1176,55 @@ func (v *VM) run() {
 				}
 			}
 
+			switch callee := value.(type) {
+			case *common.BoundMethod:
+				// the receiver is the first argument of the method
+				if fn, ok := callee.Method.(*common.CompiledFunction); ok {
+					if v.sp+1 >= common.StackSize {
+						v.err = common.ErrStackOverflow
+						return
+					}
+					base := v.sp - numArgs
+					copy(v.stack[base+1:v.sp+1], v.stack[base:v.sp])
+					v.stack[base] = callee.Receiver
+					v.stack[base-1] = fn
+					v.sp++
+					numArgs++
+					value = fn
+				}
+			case *common.Class:
+				// the class is kept on the stack for OpInstance of the
+				// constructor
+				value = callee.Init
+			}
+
 			if callee, ok := value.(*common.CompiledFunction); ok {
-				if callee.VarArgs {
-					// if the closure is variadic,
-					// roll up all variadic parameters into an array
-					realArgs := callee.NumParameters - 1
-					varArgs := numArgs - realArgs
-					if varArgs >= 0 {
-						numArgs = realArgs + 1
-						args := make([]common.Object, varArgs)
-						spStart := v.sp - varArgs
-						for i := spStart; i < v.sp; i++ {
-							args[i-spStart] = v.stack[i]
-						}
-						v.stack[spStart] = &common.Array{Value: args}
-						v.sp = spStart + 1
+				if len(keywords) > 0 || callee.VarArgs ||
+					numArgs != callee.NumParameters {
+					var ok bool
+					if numArgs, ok = v.setUpArgs(
+						callee, numArgs, keywords); !ok {
+						return
 					}
 				}
-				if numArgs != callee.NumParameters {
-					if callee.VarArgs {
-						v.err = fmt.Errorf(
-							"wrong number of arguments: want>=%d, got=%d",
-							callee.NumParameters-1, numArgs)
-					} else {
-						v.err = fmt.Errorf(
-							"wrong number of arguments: want=%d, got=%d",
-							callee.NumParameters, numArgs)
+
+				// the call to a generator function only creates the
+				// generator
+				if callee.Generator {
+					gen := v.newGenerator(callee, numArgs)
+					v.allocs--
+					if v.allocs == 0 {
+						v.err = common.ErrObjectAllocLimit
+						return
 					}
-					return
+					v.sp -= numArgs
+					v.stack[v.sp-1] = gen
+					continue
 				}
 
 				// test if it's tail-call
-				if callee == v.curFrame.fn { // recursion
+				if callee == v.curFrame.fn &&
+					len(v.curFrame.defers) == 0 { // recursion
 					nextOp := v.curInsts[v.ip+1]
 					if nextOp == parser.OpReturn ||
 						(nextOp == parser.OpPop &&
@@ -625,18 +1249,47 @@ func (v *VM) run() {
 				v.curFrame.fn = callee
 				v.curFrame.freeVars = callee.Free
 				v.curFrame.basePointer = v.sp - numArgs
+				v.curFrame.gen = nil
+				v.curFrame.defers = nil
 				v.curInsts = callee.Instructions
 				v.ip = -1
 				v.framesIndex++
 				v.sp = v.sp - numArgs + callee.NumLocals
 			} else {
+				if len(keywords) > 0 {
+					v.err = fmt.Errorf(
+						"keyword arguments not supported in call to '%s'",
+						value.TypeName())
+					return
+				}
+				if v.gas != nil {
+					callGas := v.gas.UserFunctionCall
+					if _, ok := value.(*common.BuiltinFunction); ok {
+						callGas = v.gas.BuiltinCall
+					}
+					if !v.consumeGas(callGas) {
+						return
+					}
+				}
+
 				var args []common.Object
 				args = append(args, v.stack[v.sp-numArgs:v.sp]...)
+				for i, arg := range args {
+					// the Go function can call back the compiled functions
+					if fn, ok := arg.(*common.CompiledFunction); ok {
+						args[i] = fn.Bind(v)
+					}
+				}
+				v.calls++
 				ret, e := value.Call(args...)
+				v.calls--
 				v.sp -= numArgs + 1
 
 				// runtime error
 				if e != nil {
+					if atomic.LoadInt64(&v.aborting) == 1 {
+						return
+					}
 					if e == common.ErrWrongNumArguments {
 						v.err = fmt.Errorf(
 							"wrong number of arguments in call to '%s'",
@@ -663,19 +1316,37 @@ func (v *VM) run() {
 					v.err = common.ErrObjectAllocLimit
 					return
 				}
+				if v.gas != nil && !v.consumeSizeGas(ret) {
+					return
+				}
+				if v.deterministic {
+					ret = canonicalNaN(ret)
+				}
 				v.stack[v.sp] = ret
 				v.sp++
 			}
 		case parser.OpReturn:
 			v.ip++
+			if len(v.curFrame.defers) > 0 && !v.runDefers() {
+				return
+			}
 			var retVal common.Object
 			if int(v.curInsts[v.ip]) == 1 {
 				retVal = v.stack[v.sp-1]
 			} else {
 				retVal = common.UndefinedValue
 			}
+			if gen := v.curFrame.gen; gen != nil {
+				// the returned value of a generator is discarded
+				gen.finish()
+				retVal = common.FalseValue
+			}
 			//v.sp--
 			v.framesIndex--
+			for len(v.tries) > v.triesBase &&
+				v.tries[len(v.tries)-1].framesIndex > v.framesIndex {
+				v.tries = v.tries[:len(v.tries)-1]
+			}
 			v.curFrame = &v.frames[v.framesIndex-1]
 			v.curInsts = v.curFrame.fn.Instructions
 			v.ip = v.curFrame.ip
@@ -769,6 +1440,9 @@ func (v *VM) run() {
 				NumLocals:     fn.NumLocals,
 				NumParameters: fn.NumParameters,
 				VarArgs:       fn.VarArgs,
+				ParamNames:    fn.ParamNames,
+				NumDefaults:   fn.NumDefaults,
+				Generator:     fn.Generator,
 				Free:          free,
 			}
 			v.allocs--
@@ -835,7 +1509,20 @@ func (v *VM) run() {
 				v.err = fmt.Errorf("not iterable: %s", dst.TypeName())
 				return
 			}
-			iterator = dst.Iterate()
+			if v.deterministic {
+				switch dst := dst.(type) {
+				case *common.Map:
+					iterator = common.NewSortedMapIterator(
+						dst.Value, dst.Entries)
+				case *common.ImmutableMap:
+					iterator = common.NewSortedMapIterator(
+						dst.Value, dst.Entries)
+				default:
+					iterator = dst.Iterate()
+				}
+			} else {
+				iterator = dst.Iterate()
+			}
 			v.allocs--
 			if v.allocs == 0 {
 				v.err = common.ErrObjectAllocLimit
@@ -845,11 +1532,28 @@ func (v *VM) run() {
 			v.sp++
 		case parser.OpIteratorNext:
 			iterator := v.stack[v.sp-1]
+			if gen, ok := iterator.(*Generator); ok && gen.vm == v {
+				if !v.resume(gen) {
+					return
+				}
+				continue
+			}
 			v.sp--
+			// the iterator can call back the compiled functions
+			v.calls++
 			hasMore := iterator.(common.Iterator).Next()
+			v.calls--
 			if hasMore {
 				v.stack[v.sp] = common.TrueValue
 			} else {
+				if it, ok := iterator.(common.ErrorIterator); ok &&
+					it.Err() != nil {
+					if atomic.LoadInt64(&v.aborting) == 1 {
+						return
+					}
+					v.err = it.Err()
+					return
+				}
 				v.stack[v.sp] = common.FalseValue
 			}
 			v.sp++
@@ -865,6 +1569,158 @@ func (v *VM) run() {
 			val := iterator.(common.Iterator).Value()
 			v.stack[v.sp] = val
 			v.sp++
+		case parser.OpTry:
+			v.ip += 2
+			pos := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8
+			v.tries = append(v.tries, tryHandler{
+				ip:          pos,
+				sp:          v.sp,
+				framesIndex: v.framesIndex,
+			})
+		case parser.OpPopTry:
+			v.ip++
+			v.tries = v.tries[:len(v.tries)-int(v.curInsts[v.ip])]
+		case parser.OpThrow:
+			val := v.stack[v.sp-1]
+			v.sp--
+			errObj, ok := val.(*common.Error)
+			if !ok {
+				errObj = &common.Error{Value: val}
+			}
+			if !errObj.Pos.IsValid() {
+				// keep the position of the rethrown errors
+				errObj = &common.Error{
+					Value: errObj.Value,
+					Pos: v.fileSet.Position(
+						v.curFrame.fn.SourcePos(v.ip - 1)),
+				}
+			}
+			v.err = common.ErrThrown{Value: errObj}
+			return
+		case parser.OpSwitch:
+			v.ip += 4
+			cidx := int(v.curInsts[v.ip-2]) | int(v.curInsts[v.ip-3])<<8
+			idx := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8
+			v.sp--
+			table := v.constants[cidx].(*common.ImmutableMap)
+			if key, ok := common.SwitchKey(v.stack[v.sp]); ok {
+				if c, ok := table.Value[key]; ok {
+					idx = int(c.(*common.Int).Value)
+				}
+			}
+
+			// the switch is followed by the jumps to the cases, and, the
+			// last one is to the default case
+			jmp := v.ip + 1 + idx*3
+			pos := int(v.curInsts[jmp+2]) | int(v.curInsts[jmp+1])<<8
+			v.ip = pos - 1
+		case parser.OpYield:
+			val := v.stack[v.sp-1]
+			v.sp--
+			v.yield(val)
+		case parser.OpClass:
+			v.ip += 2
+			cidx := int(v.curInsts[v.ip]) | int(v.curInsts[v.ip-1])<<8
+			names := v.constants[cidx].(*common.ImmutableArray).Value
+
+			// the methods and the constructor are bound to the VM, so they
+			// can be called by the Go functions and the protocol methods of
+			// the instances
+			numMethods := len(names) - 1
+			methods := make(map[string]common.Object, numMethods)
+			for i, m := range v.stack[v.sp-numMethods : v.sp] {
+				name := names[i+1].(*common.String).Value
+				methods[name] = m.(*common.CompiledFunction).Bind(v)
+			}
+			v.sp -= numMethods
+			init := v.stack[v.sp-1].(*common.CompiledFunction)
+			var cls common.Object = &common.Class{
+				Name:    names[0].(*common.String).Value,
+				Fields:  init.ParamNames,
+				Init:    init.Bind(v),
+				Methods: methods,
+			}
+			v.allocs--
+			if v.allocs == 0 {
+				v.err = common.ErrObjectAllocLimit
+				return
+			}
+			v.stack[v.sp-1] = cls
+		case parser.OpInstance:
+			numFields := int(v.curInsts[v.ip+1])
+			v.ip++
+			callee := v.stack[v.curFrame.basePointer-1]
+			cls, ok := callee.(*common.Class)
+			if !ok {
+				v.err = fmt.Errorf("not a class: %s", callee.TypeName())
+				return
+			}
+			values := make([]common.Object, numFields)
+			copy(values, v.stack[v.sp-numFields:v.sp])
+			v.sp -= numFields
+			var inst common.Object = &common.Instance{
+				Class:  cls,
+				Values: values,
+			}
+			v.allocs--
+			if v.allocs == 0 {
+				v.err = common.ErrObjectAllocLimit
+				return
+			}
+			v.stack[v.sp] = inst
+			v.sp++
+		case parser.OpDefer, parser.OpDeferKw:
+			numArgs := int(v.curInsts[v.ip+1])
+			var spread int
+			stub := callStub
+			if v.curInsts[v.ip] == parser.OpDeferKw {
+				// the keyword arguments are passed by the names constant
+				// of the instruction
+				cidx := int(v.curInsts[v.ip+3]) | int(v.curInsts[v.ip+2])<<8
+				stub = &common.CompiledFunction{
+					Instructions: append(complier.MakeInstruction(
+						parser.OpCallKw, numArgs, cidx), parser.OpSuspend),
+				}
+				v.ip += 3
+			} else {
+				spread = int(v.curInsts[v.ip+2])
+				v.ip += 2
+			}
+
+			value := v.stack[v.sp-1-numArgs]
+			if !value.CanCall() {
+				v.err = fmt.Errorf("not callable: %s", value.TypeName())
+				return
+			}
+
+			// the arguments are evaluated now
+			args := make([]common.Object, numArgs)
+			copy(args, v.stack[v.sp-numArgs:v.sp])
+			v.sp -= numArgs + 1
+			if spread == 1 {
+				switch arr := args[numArgs-1].(type) {
+				case *common.Array:
+					args = append(args[:numArgs-1], arr.Value...)
+				case *common.ImmutableArray:
+					args = append(args[:numArgs-1], arr.Value...)
+				default:
+					v.err = fmt.Errorf("not an array: %s", arr.TypeName())
+					return
+				}
+			}
+
+			d := deferredCall{stub: stub}
+			if stub == callStub {
+				d.operands = []common.Object{value, &common.Array{Value: args}}
+			} else {
+				d.operands = append([]common.Object{value}, args...)
+			}
+			v.allocs--
+			if v.allocs == 0 {
+				v.err = common.ErrObjectAllocLimit
+				return
+			}
+			v.curFrame.defers = append(v.curFrame.defers, d)
 		case parser.OpSuspend:
 			return
 		default:
@@ -879,6 +1735,232 @@ func (v *VM) IsStackEmpty() bool {
 	return v.sp == 0
 }
 
+// canonicalNaN replaces a NaN float value with the canonical NaN.
+func canonicalNaN(o common.Object) common.Object {
+	if f, ok := o.(*common.Float); ok && math.IsNaN(f.Value) &&
+		math.Float64bits(f.Value) != canonicalNaNBits {
+		return &common.Float{Value: math.NaN()}
+	}
+	return o
+}
+
+// checkedBinaryOp is like left.BinaryOp(tok, right) but fails on overflow if
+// both operands are int values.
+func checkedBinaryOp(
+	left common.Object,
+	tok token.Token,
+	right common.Object,
+) (common.Object, error) {
+	x, ok := left.(*common.Int)
+	if !ok {
+		return left.BinaryOp(tok, right)
+	}
+	y, ok := right.(*common.Int)
+	if !ok {
+		return left.BinaryOp(tok, right)
+	}
+	switch tok {
+	case token.Add, token.Sub, token.Mul, token.Quo, token.Rem, token.Shl,
+		token.Pow:
+		r, err := common.CheckedIntOp(tok, x.Value, y.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &common.Int{Value: r}, nil
+	}
+	return left.BinaryOp(tok, right)
+}
+
+// setUpArgs arranges the arguments of a call to the compiled function on the
+// stack in the order of the parameters: the keyword arguments are moved to
+// their parameters, the missing parameters with default values are set to
+// undefined, and, the variadic arguments are rolled up into an array. It
+// returns the number of the arguments on the stack and false on error.
+func (v *VM) setUpArgs(
+	callee *common.CompiledFunction,
+	numArgs int,
+	keywords []common.Object,
+) (int, bool) {
+	numFixed := callee.NumParameters
+	if callee.VarArgs {
+		numFixed--
+	}
+	numPositional := numArgs - len(keywords)
+	base := v.sp - numArgs
+
+	args := make([]common.Object, callee.NumParameters)
+	var varArgs []common.Object
+	if callee.VarArgs {
+		varArgs = make([]common.Object, 0)
+	}
+	for i, arg := range v.stack[base : base+numPositional] {
+		switch {
+		case i < numFixed:
+			args[i] = arg
+		case callee.VarArgs:
+			varArgs = append(varArgs, arg)
+		case callee.NumDefaults > 0:
+			v.err = fmt.Errorf(
+				"wrong number of arguments: want<=%d, got=%d",
+				numFixed, numPositional)
+			return 0, false
+		default:
+			v.err = fmt.Errorf(
+				"wrong number of arguments: want=%d, got=%d",
+				numFixed, numPositional)
+			return 0, false
+		}
+	}
+	for i, kw := range keywords {
+		name := kw.(*common.String).Value
+		idx := callee.ParamIndex(name)
+		if idx < 0 {
+			v.err = fmt.Errorf("unexpected keyword argument '%s'", name)
+			return 0, false
+		}
+		if args[idx] != nil {
+			v.err = fmt.Errorf("multiple values for parameter '%s'", name)
+			return 0, false
+		}
+		args[idx] = v.stack[base+numPositional+i]
+	}
+
+	numRequired := numFixed - callee.NumDefaults
+	for i := 0; i < numFixed; i++ {
+		if args[i] != nil {
+			continue
+		}
+		if i < numRequired {
+			if i < len(callee.ParamNames) {
+				v.err = fmt.Errorf("missing argument for parameter '%s'",
+					callee.ParamNames[i])
+			} else if callee.VarArgs {
+				v.err = fmt.Errorf(
+					"wrong number of arguments: want>=%d, got=%d",
+					numRequired, numPositional)
+			} else {
+				v.err = fmt.Errorf(
+					"wrong number of arguments: want=%d, got=%d",
+					numRequired, numPositional)
+			}
+			return 0, false
+		}
+		args[i] = common.UndefinedValue
+	}
+	if callee.VarArgs {
+		args[numFixed] = &common.Array{Value: varArgs}
+	}
+
+	copy(v.stack[base:], args)
+	v.sp = base + len(args)
+	return len(args), true
+}
+
+// loadGlobal loads the global variable at index from the storage if it's the
+// first access to the variable during the run. If the storage does not have
+// the variable, its current value is kept.
+func (v *VM) loadGlobal(index int) error {
+	if _, ok := v.persisted[index]; ok {
+		return nil
+	}
+	val, err := v.storage.GetGlobal(index)
+	if err == storage.NotFoundErr {
+		v.persisted[index] = newPersistedGlobal(v.globals[index])
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("loading global %d: %w", index, err)
+	}
+	v.bindClasses(val)
+	v.globals[index] = val
+	v.persisted[index] = newPersistedGlobal(val)
+	return nil
+}
+
+// bindClasses binds the init functions and the methods of the classes in a
+// value loaded from the storage to the VM, as OpClass does for the classes
+// created during the run.
+func (v *VM) bindClasses(o common.Object) {
+	switch o := o.(type) {
+	case *common.Class:
+		if o.Init != nil {
+			o.Init = o.Init.Bind(v)
+		}
+		for name, m := range o.Methods {
+			if fn, ok := m.(*common.CompiledFunction); ok {
+				o.Methods[name] = fn.Bind(v)
+			}
+		}
+	case *common.Instance:
+		v.bindClasses(o.Class)
+		for _, e := range o.Values {
+			v.bindClasses(e)
+		}
+	case *common.BoundMethod:
+		v.bindClasses(o.Receiver)
+		if fn, ok := o.Method.(*common.CompiledFunction); ok {
+			o.Method = fn.Bind(v)
+		}
+	case *common.Error:
+		v.bindClasses(o.Value)
+	case *common.Array:
+		for _, e := range o.Value {
+			v.bindClasses(e)
+		}
+	case *common.ImmutableArray:
+		for _, e := range o.Value {
+			v.bindClasses(e)
+		}
+	case *common.Map:
+		for _, e := range o.Value {
+			v.bindClasses(e)
+		}
+		for _, e := range o.Entries {
+			v.bindClasses(e.Value)
+		}
+	case *common.ImmutableMap:
+		for _, e := range o.Value {
+			v.bindClasses(e)
+		}
+		for _, e := range o.Entries {
+			v.bindClasses(e.Value)
+		}
+	}
+}
+
+// storeGlobals writes the changed global variables back to the storage.
+func (v *VM) storeGlobals() error {
+	indexes := make([]int, 0, len(v.persisted))
+	for index := range v.persisted {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	for _, index := range indexes {
+		val := v.globals[index]
+		switch val := val.(type) {
+		case nil:
+			continue
+		case *Generator:
+			return fmt.Errorf("storing global %d: generator cannot be stored",
+				index)
+		case *common.CompiledFunction:
+			// the updates of the captured variables cannot be detected, and,
+			// the variables would no longer be shared after a reload
+			if len(val.Free) > 0 {
+				return fmt.Errorf("storing global %d: closure cannot be stored",
+					index)
+			}
+		}
+		if !v.persisted[index].changed(val) {
+			continue
+		}
+		if err := v.storage.SetGlobal(index, val); err != nil {
+			return fmt.Errorf("storing global %d: %w", index, err)
+		}
+	}
+	return nil
+}
+
 func indexAssign(dst, src common.Object, selectors []common.Object) error {
 	numSel := len(selectors)
 	for sidx := numSel - 1; sidx > 0; sidx-- {
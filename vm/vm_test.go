@@ -450,6 +450,96 @@ a := {
 a.x.e = "bar"`, nil, "not index-assignable")
 }
 
+func TestDestructuring(t *testing.T) {
+	expectRun(t, `a, b := [1, 2]; out = a + b`, nil, 3)
+	expectRun(t, `a := 0; b := 0; a, b = [1, 2]; out = [a, b]`,
+		nil, ARR{1, 2})
+	expectRun(t, `a := 1; b := 2; a, b = [b, a]; out = [a, b]`,
+		nil, ARR{2, 1})
+	expectRun(t, `a, b, c := [1, 2]; out = [a, b, c]`,
+		nil, ARR{1, 2, common.UndefinedValue})
+	expectRun(t, `a, _, c := [1, 2, 3]; out = [a, c]`, nil, ARR{1, 3})
+	expectRun(t, `
+switch "x" {
+case string:
+	a, b := [1, 2]
+	try {
+		throw a
+	} catch {
+		[c] := [3]
+		out = [a, b, c]
+	} finally {
+		{d} := {d: 4}
+		out = append(out, d)
+	}
+}`, nil, ARR{1, 2, 3, 4}) // nested temporaries at the top level
+	expectRun(t, `a, b := immutable([1, 2]); out = [a, b]`, nil, ARR{1, 2})
+	expectRun(t, `a, b := "ab"; out = [a, b]`, nil, ARR{'a', 'b'})
+	expectRun(t, `a, b := undefined; out = [a, b]`,
+		nil, ARR{common.UndefinedValue, common.UndefinedValue})
+	expectRun(t, `m := {}; m.a, m.b = [1, 2]; out = m`,
+		nil, MAP{"a": 1, "b": 2})
+	expectRun(t, `a := [0, 0]; a[1], a[0] = [1, 2]; out = a`,
+		nil, ARR{2, 1})
+
+	// array patterns
+	expectRun(t, `[a, b] := [1, 2, 3]; out = [a, b]`, nil, ARR{1, 2})
+	expectRun(t, `[a, ...b] := [1, 2, 3]; out = [a, b]`,
+		nil, ARR{1, ARR{2, 3}})
+	expectRun(t, `[a, b, ...c] := [1]; out = [a, b, c]`,
+		nil, ARR{1, common.UndefinedValue, ARR{}})
+	expectRun(t, `[...a] := [1, 2]; out = a`, nil, ARR{1, 2})
+	expectRun(t, `[a, b = 2, c = a + 2] := [1]; out = [a, b, c]`,
+		nil, ARR{1, 2, 3})
+	expectRun(t, `[a = 1] := [undefined]; out = a`, nil, 1)
+	expectRun(t, `[a = 1] := [false]; out = a`, nil, false)
+	expectRun(t, `a := 0; b := 0; [a, ...b] = [1, 2]; out = [a, b]`,
+		nil, ARR{1, ARR{2}})
+	expectRun(t, `[a, ...b] := "abc"; out = [a, b]`,
+		nil, ARR{'a', "bc"})
+
+	// map patterns
+	expectRun(t, `{a, b} := {a: 1, b: 2, c: 3}; out = [a, b]`,
+		nil, ARR{1, 2})
+	expectRun(t, `{a: x, b: y = 2} := {a: 1}; out = [x, y]`,
+		nil, ARR{1, 2})
+	expectRun(t, `{"a b": x, c} := {"a b": 1}; out = [x, c]`,
+		nil, ARR{1, common.UndefinedValue})
+	expectRun(t, `{a, b} := immutable({a: 1, b: 2}); out = a + b`, nil, 3)
+	expectRun(t, `{a} := undefined; out = a`, nil, common.UndefinedValue)
+
+	// function scopes
+	expectRun(t, `
+f := func(p) {
+	[x, y = 10] := p
+	{name} := {name: "n"}
+	return [x, y, name]
+}
+out = f([1])`, nil, ARR{1, 10, "n"})
+	expectRun(t, `
+a := 1
+f := func() {
+	[a, b] := [2, 3]
+	return a + b
+}
+out = [a, f()]`, nil, ARR{1, 5})
+	expectRun(t, `
+f := func() {
+	a := 0
+	g := func() { [a] = [5] }
+	g()
+	return a
+}
+out = f()`, nil, 5)
+	expectRun(t, `
+out = 0
+for [i, j] := [0, 3]; i < j; i++ { out += i }`, nil, 3)
+
+	expectError(t, `a, b := 1`, nil, "not indexable")
+	expectError(t, `{a} := [1]`, nil, "invalid index type")
+	expectError(t, `[a, ...b] := undefined`, nil, "not indexable: undefined")
+}
+
 func TestBitwise(t *testing.T) {
 	expectRun(t, `out = 1 & 1`, nil, 1)
 	expectRun(t, `out = 1 & 0`, nil, 0)
@@ -753,20 +843,12 @@ func TestBuiltinFunction(t *testing.T) {
 	expectError(t, `delete(immutable([]), "")`, nil,
 		`invalid type for argument 'first'`)
 	expectError(t, `delete([], "")`, nil, `invalid type for argument 'first'`)
-	expectError(t, `delete({}, 1)`, nil, `invalid type for argument 'second'`)
-	expectError(t, `delete({}, 1.0)`, nil, `invalid type for argument 'second'`)
 	expectError(t, `delete({}, undefined)`, nil,
 		`invalid type for argument 'second'`)
 	expectError(t, `delete({}, [])`, nil, `invalid type for argument 'second'`)
 	expectError(t, `delete({}, {})`, nil, `invalid type for argument 'second'`)
 	expectError(t, `delete({}, error("err"))`, nil,
 		`invalid type for argument 'second'`)
-	expectError(t, `delete({}, bytes("str"))`, nil,
-		`invalid type for argument 'second'`)
-	expectError(t, `delete({}, char(35))`, nil,
-		`invalid type for argument 'second'`)
-	expectError(t, `delete({}, time(1257894000))`, nil,
-		`invalid type for argument 'second'`)
 	expectError(t, `delete({}, immutable({}))`, nil,
 		`invalid type for argument 'second'`)
 	expectError(t, `delete({}, immutable([]))`, nil,
@@ -778,6 +860,8 @@ func TestBuiltinFunction(t *testing.T) {
 		MAP{"key2": "2"})
 	expectRun(t, `out = [1, "2", {a: "b", c: 10}]; delete(out[2], "c")`, nil,
 		ARR{1, "2", MAP{"a": "b"}})
+	expectRun(t, `m := {a: 1}; m[1] = 2; m[1.5] = 3; delete(m, 1)
+out = string(m)`, nil, `{a: 1, 1.5: 3}`)
 
 	// splice
 	expectError(t, `splice()`, nil, common.ErrWrongNumArguments.Error())
@@ -1186,6 +1270,169 @@ func TestError(t *testing.T) {
 	expectError(t, `error([1,2,3])[1]`, nil, "invalid index on error")
 }
 
+func TestTry(t *testing.T) {
+	expectRun(t, `try { throw "boom" } catch e { out = e.value }`,
+		nil, "boom")
+	expectRun(t, `try { throw 5 } catch e { out = e.value }`, nil, 5)
+	expectRun(t, `try { throw error("x") } catch e { out = e }`,
+		nil, errorObject("x"))
+	expectRun(t, `try { throw "x" } catch { out = 1 }`, nil, 1)
+	expectRun(t, `try { out = 1 } catch e { out = 2 }`, nil, 1)
+
+	// runtime errors
+	expectRun(t, `try { a := 1 + "a" } catch e { out = e.value }`,
+		nil, "invalid operation: int + string")
+	expectRun(t, `try { a := [1, 2]; a[5] = 1 } catch e { out = e.value }`,
+		nil, "index out of bounds")
+	expectRun(t, `
+f := func(a) {}
+try { f() } catch e { out = e.value }`,
+		nil, "missing argument for parameter 'a'")
+	expectRun(t, `
+f := func() { return 1 + "a" }
+g := func() { return f() + 1 }
+try { g() } catch e { out = e.value }`,
+		nil, "invalid operation: int + string")
+	expectRun(t, `
+f := func() {
+	x := 0
+	for i := 0; i < 3; i++ {
+		try { throw i } catch e { x += e.value }
+	}
+	return x
+}
+out = f()`, nil, 3)
+	expectRun(t, `
+f := func() {
+	try { return 1 + "a" } catch e { return "caught" }
+}
+out = f()`, nil, "caught")
+
+	// positions
+	expectRun(t, `
+try {
+	a := 1 + "a"
+} catch e {
+	out = e.pos
+}`, Opts().Skip2ndPass(), "test:3:7")
+	expectRun(t, `
+try {
+	throw "x"
+} catch e {
+	out = e.pos
+}`, Opts().Skip2ndPass(), "test:3:8")
+	expectRun(t, `
+try {
+	try { throw "x" } catch e { throw e }
+} catch e {
+	out = e.pos
+}`, Opts().Skip2ndPass(), "test:3:14")
+	expectRun(t, `out = is_undefined(error("x").pos)`, nil, true)
+
+	// finally
+	expectRun(t, `out = 0; try { out = 1 } finally { out += 10 }`, nil, 11)
+	expectRun(t, `try { throw 1 } catch { out = 1 } finally { out += 10 }`,
+		nil, 11)
+	expectRun(t, `
+try {
+	try { throw "a" } catch e { throw "b" } finally { out = 1 }
+} catch e {
+	out += e.value == "b" ? 10 : 100
+}`, nil, 11)
+	expectRun(t, `
+try {
+	try { throw "a" } finally { out = 1 }
+} catch e {
+	out += e.value == "a" ? 10 : 100
+}`, nil, 11)
+	expectRun(t, `
+x := 0
+f := func() { try { return 1 } finally { x = 5 } }
+out = f() + x`, nil, 6)
+	expectRun(t, `
+f := func() {
+	x := 1
+	try { return x } finally { x = 2 }
+}
+out = f()`, nil, 1)
+	expectRun(t, `
+f := func() {
+	try { return 1 } finally { return 2 }
+}
+out = f()`, nil, 2)
+	expectRun(t, `
+f := func() {
+	try {
+		try { return 1 } finally { out = 10 }
+	} finally {
+		out += 20
+	}
+}
+f()`, nil, 30)
+	expectRun(t, `
+out = 0
+for i := 0; i < 5; i++ {
+	try {
+		if i == 1 { continue }
+		if i == 3 { break }
+		out += i
+	} finally {
+		out += 10
+	}
+}`, nil, 42)
+	expectRun(t, `
+out = 0
+for i := 0; i < 3; i++ {
+	try {
+		for j := 0; j < 3; j++ {
+			try { if j == 1 { break } } finally { out += 1 }
+		}
+		throw i
+	} catch e {
+		out += 10
+	}
+}`, nil, 36)
+
+	// uncaught
+	expectError(t, `throw "boom"`, nil, "Runtime Error: boom\n\tat test:1:7")
+	expectError(t, `try { throw "boom" } finally { a := 1 }`,
+		nil, "Runtime Error: boom")
+	expectError(t, `
+try {
+	throw "a"
+} catch e {
+	throw "b"
+}`, nil, "Runtime Error: b")
+	expectError(t, `
+try {
+	a := []
+	for { a = append(a, 1) }
+} catch e {}`, Opts().MaxAllocs(100), "allocation limit exceeded")
+
+	// callbacks from Go functions
+	apply := &common.UserFunction{
+		Name: "apply",
+		Value: func(args ...common.Object) (common.Object, error) {
+			return args[0].Call(args[1:]...)
+		},
+	}
+	opts := Opts().Symbol("apply", apply).Skip2ndPass()
+	expectRun(t, `try { apply(func() { throw "x" }) } catch e { out = e.value }`,
+		opts, "x")
+	expectRun(t, `
+out = apply(func() {
+	try { throw "x" } catch e { return e.value + "y" }
+})`, opts, "xy")
+	expectRun(t, `
+try {
+	apply(func() {
+		try { return 1 + "a" } finally { out = 1 }
+	})
+} catch e {
+	out += 10
+}`, opts, 11)
+}
+
 func TestFloat(t *testing.T) {
 	expectRun(t, `out = 0.0`, nil, 0.0)
 	expectRun(t, `out = -10.3`, nil, -10.3)
@@ -1196,6 +1443,69 @@ func TestFloat(t *testing.T) {
 	expectRun(t, `out = -5.0 + +5.0`, nil, 0.0)
 }
 
+func TestBigInt(t *testing.T) {
+	expectRun(t, `out = string(big_int("9223372036854775807") + 1)`,
+		nil, "9223372036854775808")
+	expectRun(t, `out = string(2 * big_int(2) ** 100)`,
+		nil, "2535301200456458802993406410752")
+	expectRun(t, `a := big_int(10); a *= a; out = string(a)`, nil, "100")
+	expectRun(t, `out = big_int(5) == 5`, nil, true)
+	expectRun(t, `out = 5 == big_int(5)`, nil, true)
+	expectRun(t, `out = big_int(5) < 6`, nil, true)
+	expectRun(t, `out = 6 <= big_int(5)`, nil, false)
+	expectRun(t, `out = int(big_int("42"))`, nil, 42)
+	expectRun(t, `out = int(big_int("9223372036854775808"), -1)`, nil, -1)
+	expectRun(t, `out = string(big_int(-2.9))`, nil, "-2")
+	expectRun(t, `out = big_int("1.5")`, nil, common.UndefinedValue)
+	expectRun(t, `out = big_int("x", 0)`, nil, 0)
+	expectRun(t, `out = is_big_int(big_int(1))`, nil, true)
+	expectRun(t, `out = is_big_int(1)`, nil, false)
+	expectRun(t, `out = type_name(big_int(1))`, nil, "big-int")
+	expectRun(t, `out = big_int(0) ? 1 : 2`, nil, 2)
+	expectRun(t, `out = string(-big_int("9223372036854775808"))`,
+		nil, "-9223372036854775808")
+	expectRun(t, `a := big_int(-5); out = string(-a)`, nil, "5")
+	expectRun(t, `out = string(^big_int(5))`, nil, "-6")
+	expectRun(t, `out = string(^big_int(-1))`, nil, "0")
+	expectRun(t, `out = format("%d %x %#X %08d %+d", big_int(255),
+big_int(255), big_int(255), big_int(-255), big_int(1))`,
+		nil, "255 ff 0XFF -0000255 +1")
+
+	expectError(t, `big_int(1) / 0`, nil, "division by zero")
+	expectError(t, `big_int(1) + 1.0`, nil,
+		"invalid operation: big-int + float")
+}
+
+func TestDecimal(t *testing.T) {
+	expectRun(t, `out = string(decimal("1.10") + decimal("2.205"))`,
+		nil, "3.305")
+	expectRun(t, `out = string(decimal("0.1") + decimal("0.2"))`,
+		nil, "0.3")
+	expectRun(t, `out = string(decimal(0.1) * 3)`, nil, "0.3")
+	expectRun(t, `out = string(decimal(10) / 4)`, nil, "2.5")
+	expectRun(t, `out = string(1 / decimal(3))`,
+		nil, "0.333333333333333333")
+	expectRun(t, `out = string(decimal("1.5") + big_int(1))`, nil, "2.5")
+	expectRun(t, `out = decimal("1.10") == decimal("1.1")`, nil, true)
+	expectRun(t, `out = decimal("2.00") == 2`, nil, true)
+	expectRun(t, `out = decimal("0.5") < 1`, nil, true)
+	expectRun(t, `out = float(decimal("1.25"))`, nil, 1.25)
+	expectRun(t, `out = int(decimal("-1.75"))`, nil, -1)
+	expectRun(t, `out = string(-decimal("1.10"))`, nil, "-1.10")
+	expectRun(t, `out = -decimal("-2.5") == decimal("2.5")`, nil, true)
+	expectRun(t, `out = decimal("abc")`, nil, common.UndefinedValue)
+	expectRun(t, `out = is_decimal(decimal(1))`, nil, true)
+	expectRun(t, `out = type_name(decimal(1))`, nil, "decimal")
+	expectRun(t, `out = format("%v %f %.1f %.3f %8.2f", decimal("1.25"),
+decimal("1.25"), decimal("1.25"), decimal("-1.25"), decimal("3"))`,
+		nil, "1.25 1.25 1.2 -1.250     3.00")
+
+	expectError(t, `decimal(1) / decimal("0.0")`, nil, "division by zero")
+	expectError(t, `decimal(1) * 1.5`, nil,
+		"invalid operation: decimal * float")
+	expectError(t, `^decimal(1)`, nil, "invalid operation: ^decimal")
+}
+
 func TestForIn(t *testing.T) {
 	// array
 	expectRun(t, `out = 0; for x in [1, 2, 3] { out += x }`,
@@ -1228,6 +1538,447 @@ func TestForIn(t *testing.T) {
 		nil, "abde")
 }
 
+func TestDefer(t *testing.T) {
+	expectRun(t, `
+out = []
+f := func() {
+	defer func() { out = append(out, "a") }()
+	defer func() { out = append(out, "b") }()
+	out = append(out, "body")
+}
+f()`, nil, ARR{"body", "b", "a"})
+	expectRun(t, `
+out = []
+f := func() {
+	for i := 0; i < 3; i++ {
+		defer func(x) { out = append(out, x) }(i)
+	}
+	return "ret"
+}
+r := f()
+out = append(out, r)`, nil, ARR{2, 1, 0, "ret"})
+
+	// the arguments are evaluated at the defer statement
+	expectRun(t, `
+out = []
+f := func(a) {
+	defer func(x, ...y) { out = append(out, x, y) }(a, [a, a]...)
+	a = 2
+	defer func(x, y = 0) { out = append(out, [x, y]) }(y: a, x: 1)
+	arr := [1]
+	defer func(x) { out = append(out, x) }(arr)
+	arr[0] = 3
+}
+f(1)`, nil, ARR{ARR{3}, ARR{1, 2}, 1, ARR{1, 1}})
+	expectRun(t, `
+m := {a: 1, b: 2}
+f := func() { defer delete(m, "a") }
+f()
+out = m`, nil, MAP{"b": 2})
+
+	// the deferred calls do not change the returned value
+	expectRun(t, `
+f := func() {
+	x := 1
+	defer func() { x = 2 }()
+	return x
+}
+out = f()`, nil, 1)
+
+	// recursion
+	expectRun(t, `
+out = []
+f := undefined
+f = func(n) {
+	if n == 0 { return 0 }
+	defer func() { out = append(out, n) }()
+	return f(n - 1)
+}
+f(3)`, nil, ARR{1, 2, 3})
+
+	// runtime errors
+	expectRun(t, `
+out = []
+f := func() {
+	defer func() { out = append(out, "deferred") }()
+	x := 1 + "a"
+	out = append(out, "unreachable")
+}
+try { f() } catch e { out = append(out, e.value) }`,
+		nil, ARR{"deferred", "invalid operation: int + string"})
+	expectRun(t, `
+out = []
+g := func() {
+	defer func() { out = append(out, "g") }()
+	throw "bad"
+}
+f := func() {
+	defer func() { out = append(out, "f") }()
+	g()
+}
+try { f() } catch e { out = append(out, e.value) }`,
+		nil, ARR{"g", "f", "bad"})
+	expectRun(t, `
+out = []
+f := func() {
+	defer func() { out = append(out, "first") }()
+	defer func() { throw "deferred" }()
+	throw "body"
+}
+try { f() } catch e { out = append(out, e.value) }`,
+		nil, ARR{"first", "deferred"})
+	expectRun(t, `
+out = []
+f := func() {
+	defer func() { out = append(out, "first") }()
+	defer func() { throw "deferred" }()
+	return 1
+}
+try { f() } catch e { out = append(out, e.value) }`,
+		nil, ARR{"first", "deferred"})
+	expectRun(t, `
+out = []
+f := func() {
+	try {
+		defer func() { out = append(out, "deferred") }()
+		throw "bad"
+	} catch e {
+		out = append(out, e.value)
+	}
+	out = append(out, "end")
+}
+f()`, nil, ARR{"bad", "end", "deferred"})
+
+	// generators keep the deferred calls while they are suspended
+	expectRun(t, `
+out = []
+g := func() {
+	defer func() { out = append(out, "done") }()
+	yield 1
+	yield 2
+}
+for x in g() { out = append(out, x) }`, nil, ARR{1, 2, "done"})
+
+	// but they don't run if the generator is abandoned before the end
+	expectRun(t, `
+out = []
+g := func() {
+	defer func() { out = append(out, "done") }()
+	yield 1
+	yield 2
+}
+for x in g() { out = append(out, x); break }`, nil, ARR{1})
+	expectRun(t, `
+out = []
+g := func() {
+	defer func() { out = append(out, "done") }()
+	yield 1
+	yield 2
+}
+it := g()
+for x in it { out = append(out, x); break }
+for x in it { out = append(out, x) }`, nil, ARR{1, 2, "done"})
+	expectRun(t, `
+out = []
+g := func() {
+	defer func() { out = append(out, "done") }()
+	yield 1
+	throw "bad"
+}
+try {
+	for x in g() { out = append(out, x) }
+} catch e {
+	out = append(out, e.value)
+}`, nil, ARR{1, "done", "bad"})
+
+	expectError(t, `
+out := []
+f := func() { defer func() { out = append(out, 1 + "a") }() }
+f()`, nil, "Runtime Error: invalid operation: int + string\n\tat test:3:48\n"+
+		"\tat test:3:6\n\tat test:4:1")
+	expectError(t, `func() { defer 1() }()`, nil, "not callable: int")
+	expectError(t, `func() { defer len([1], 2) }()`, nil,
+		"wrong number of arguments in call to 'builtin-function:len'")
+	expectError(t, `defer len([])`, nil,
+		"defer not allowed outside function")
+
+	// Go functions can call the functions with the deferred calls
+	opts := Opts().Symbol("call", &common.UserFunction{
+		Name: "call",
+		Value: func(args ...common.Object) (common.Object, error) {
+			return args[0].Call()
+		},
+	}).Skip2ndPass()
+	expectRun(t, `
+out = []
+call(func() {
+	defer func() { out = append(out, "deferred") }()
+	out = append(out, "body")
+})`, opts, ARR{"body", "deferred"})
+}
+
+func TestClass(t *testing.T) {
+	expectRun(t, `
+class Point(x, y = 0) {
+	func norm2(self) { return self.x * self.x + self.y * self.y }
+}
+p := Point(3, 4)
+out = [type_name(p), type_name(Point), p.x, p.y, p.norm2(), Point(7).y]`,
+		nil, ARR{"Point", "class", 3, 4, 25, 0})
+	expectRun(t, `
+class Point(x, y) {}
+p := Point(y: 2, x: 1)
+out = [p.x, p.y]`, nil, ARR{1, 2})
+	expectRun(t, `
+class Bag(name, ...items) {
+	func size(self) { return len(self.items) }
+}
+b := Bag("a", 1, 2, 3)
+out = [b.name, b.size()]`, nil, ARR{"a", 3})
+
+	// methods can change the fields through the receiver
+	expectRun(t, `
+class Counter(n = 0) {
+	func inc(self, by = 1) { self.n += by; return self }
+}
+c := Counter()
+c.inc().inc(by: 10)
+c.n *= 2
+out = c.n`, nil, 22)
+
+	// bound methods keep their receiver
+	expectRun(t, `
+class Counter(n = 0) {
+	func inc(self) { self.n++; return self.n }
+}
+c := Counter()
+f := c.inc
+f()
+out = [f(), type_name(f), string(f)]`, nil, ARR{2, "method", "<method Counter.inc>"})
+
+	// missing members are undefined
+	expectRun(t, `
+class A(x) {}
+out = is_undefined(A(1).y)`, nil, true)
+
+	// instances are copied with their fields
+	expectRun(t, `
+class A(x) {}
+a := A([1])
+b := copy(a)
+b.x[0] = 2
+out = [a.x, b.x]`, nil, ARR{ARR{1}, ARR{2}})
+
+	// local classes can refer to themselves
+	expectRun(t, `
+f := func() {
+	class Node(val, next = undefined) {
+		func len(self) {
+			if is_undefined(self.next) { return 1 }
+			return 1 + self.next.len()
+		}
+	}
+	return Node(1, Node(2, Node(3))).len()
+}
+out = f()`, nil, 3)
+
+	// protocol methods
+	expectRun(t, `
+class V(x, y) {
+	func __add(self, o) { return V(self.x + o.x, self.y + o.y) }
+	func __eq(self, o) { return self.x == o.x }
+	func __lt(self, o) { return self.x < o.x }
+	func __str(self) { return "V(" + string(self.x) + ", " + string(self.y) + ")" }
+}
+a := V(1, 2)
+b := V(3, 4)
+out = [string(a + b), f"${a}", "v=" + a, a == V(1, 0), a != b, a < b, a > b, b > a]`,
+		nil, ARR{"V(4, 6)", "V(1, 2)", "v=V(1, 2)", true, true, true, false, true})
+	expectRun(t, `
+class Grid(w, ...cells) {
+	func __index(self, i) { return self.cells[i] }
+}
+g := Grid(2, "a", "b")
+out = [g[1], g.w, g["w"]]`, nil, ARR{"b", 2, 2})
+	expectRun(t, `
+class A(x) {}
+out = [A(1) == A(1), A(1) == A(2), string(A("a"))]`,
+		nil, ARR{true, false, `A{x: "a"}`})
+	expectRun(t, `
+a := func() { class A(x) { func f(self) { return 1 } }; return A(0) }()
+b := func() { class A(x) { func f(self) { return 2 } }; return A(0) }()
+c := func() { class A(x) { func g(self) { return 1 } }; return A(0) }()
+out = [a == a, a == b, a == c]`, nil, ARR{true, false, false})
+
+	expectError(t, `
+class A(x) {}
+a := A(1)
+a.y = 2`, nil, "unknown field 'y' of A")
+	expectError(t, `
+class A(x) {}
+A(1) + 1`, nil, "invalid operation: A + int")
+	expectError(t, `class A(x) { func f() {} }`, nil,
+		"method 'f' has no receiver parameter")
+	expectError(t, `class A(x) { func x(self) {} }`, nil,
+		"'x' redeclared in this class")
+
+	// Go functions can call the classes and the bound methods
+	opts := Opts().Symbol("call", &common.UserFunction{
+		Name: "call",
+		Value: func(args ...common.Object) (common.Object, error) {
+			return args[0].Call(args[1:]...)
+		},
+	}).Skip2ndPass()
+	expectRun(t, `
+class A(x) {
+	func add(self, y) { return self.x + y }
+}
+a := call(A, 1)
+out = [a.x, call(a.add, 2)]`, opts, ARR{1, 3})
+}
+
+func TestGenerator(t *testing.T) {
+	expectRun(t, `
+gen := func(n) {
+	for i := 0; i < n; i++ {
+		yield i * 10
+	}
+	return "ignored"
+}
+out = []
+for i, x in gen(3) {
+	out = append(out, [i, x])
+}`, nil, ARR{ARR{0, 0}, ARR{1, 10}, ARR{2, 20}})
+	expectRun(t, `out = type_name(func() { yield 1 }())`, nil, "generator")
+	expectRun(t, `out = is_iterable(func() { yield 1 }())`, nil, true)
+	expectRun(t, `out = []; for x in func() { yield }() { out = append(out, x) }`,
+		nil, ARR{common.UndefinedValue})
+	expectRun(t, `out = 0; for x in func() { return 1; yield 2 }() { out = x }`,
+		nil, 0)
+
+	// the body does not run until the first iteration
+	expectRun(t, `
+out = 0
+g := func() { out = 1; yield 2 }()
+out += 10`, nil, 10)
+
+	// infinite generator
+	expectRun(t, `
+fib := func() {
+	[a, b] := [0, 1]
+	for {
+		yield a
+		[a, b] = [b, a + b]
+	}
+}
+out = []
+for x in fib() {
+	if x > 50 { break }
+	out = append(out, x)
+}`, nil, ARR{0, 1, 1, 2, 3, 5, 8, 13, 21, 34})
+
+	// resuming the same generator
+	expectRun(t, `
+counter := func(start) {
+	for {
+		yield start
+		start++
+	}
+}
+c := counter(5)
+out = []
+for x in c { if x == 6 { break } }
+for x in c { out = append(out, x); if x == 8 { break } }`, nil, ARR{7, 8})
+
+	// nested generators and closures
+	expectRun(t, `
+evens := func(n) {
+	for i := 0; i < n; i += 2 { yield i }
+}
+add := func(gen, d) {
+	for x in gen { yield func() { return x + d } }
+}
+out = []
+for f in add(evens(5), 100) { out = append(out, f()) }`, nil, ARR{100, 102, 104})
+	expectRun(t, `
+gen := func(n) {
+	if n > 0 {
+		yield n
+		for x in gen(n - 1) { yield x }
+	}
+}
+out = []
+for x in gen(3) { out = append(out, x) }`, nil, ARR{3, 2, 1})
+
+	// try statements in the generator
+	expectRun(t, `
+g := func() {
+	try {
+		yield 1
+		throw "boom"
+	} catch e {
+		yield e.value
+	} finally {
+		yield 3
+	}
+}
+out = []
+for x in g() { out = append(out, x) }`, nil, ARR{1, "boom", 3})
+	expectRun(t, `
+g := func() { yield 1; throw "bad" }
+out = []
+try {
+	for x in g() { out = append(out, x) }
+} catch e {
+	out = append(out, e.value)
+}`, nil, ARR{1, "bad"})
+
+	// the generator fails after a runtime error
+	expectRun(t, `
+g := func() { yield 1; x := 1 + "a"; yield 2 }()
+out = []
+try {
+	for x in g { out = append(out, x) }
+} catch e {}
+for x in g { out = append(out, x) }`, nil, ARR{1})
+
+	expectError(t, `for x in func() { yield 1 + "a" }() {}`, nil,
+		"Runtime Error: invalid operation: int + string\n\tat test:1:25\n"+
+			"\tat test:1:1")
+	expectError(t, `
+g := undefined
+g = func() { for x in g { yield x } }()
+for x in g {}`, nil, "generator already running")
+	expectError(t, `yield 1`, nil, "yield not allowed outside function")
+
+	// Go functions can iterate the generators
+	collect := &common.UserFunction{
+		Name: "collect",
+		Value: func(args ...common.Object) (common.Object, error) {
+			it := args[0].(common.Iterator)
+			var elems []common.Object
+			for it.Next() {
+				elems = append(elems, it.Value())
+			}
+			if g, ok := it.(*vm.Generator); ok && g.Err() != nil {
+				return nil, g.Err()
+			}
+			return &common.Array{Value: elems}, nil
+		},
+	}
+	opts := Opts().Symbol("collect", collect).Skip2ndPass()
+	expectRun(t, `out = collect(func() { yield 1; yield 2 }())`,
+		opts, ARR{1, 2})
+	expectRun(t, `
+g := func() { yield 1; yield collect(func() { yield 2 }()) }
+out = collect(g())`, opts, ARR{1, ARR{2}})
+	expectError(t, `collect(func() { yield 1 + "a" }())`, opts,
+		"Runtime Error: invalid operation: int + string\n\tat test:1:24")
+	g := &vm.Generator{}
+	require.False(t, g.Next())
+	require.Equal(t, common.ErrNotInCall, g.Err())
+}
+
 func TestFor(t *testing.T) {
 	expectRun(t, `
 	out = 0
@@ -1489,10 +2240,10 @@ func TestFunction(t *testing.T) {
 		nil, ARR{"a", ARR{}, 7})
 
 	expectError(t, `f := func(a, b, ...x) { return [a, b, x]; }; f();`, nil,
-		"Runtime Error: wrong number of arguments: want>=2, got=0\n\tat test:1:46")
+		"Runtime Error: missing argument for parameter 'a'\n\tat test:1:46")
 
 	expectError(t, `f := func(a, b, ...x) { return [a, b, x]; }; f(1);`, nil,
-		"Runtime Error: wrong number of arguments: want>=2, got=1\n\tat test:1:46")
+		"Runtime Error: missing argument for parameter 'b'\n\tat test:1:46")
 
 	expectRun(t, `f := func(x) { return x; }; out = f(5);`, nil, 5)
 	expectRun(t, `f := func(x) { return x * 2; }; out = f(5);`, nil, 10)
@@ -1656,9 +2407,9 @@ func TestFunction(t *testing.T) {
 	expectError(t, `func() { return 1; }(1)`,
 		nil, "wrong number of arguments")
 	expectError(t, `func(a) { return a; }()`,
-		nil, "wrong number of arguments")
+		nil, "missing argument for parameter 'a'")
 	expectError(t, `func(a, b) { return a + b; }(1)`,
-		nil, "wrong number of arguments")
+		nil, "missing argument for parameter 'b'")
 
 	expectRun(t, `
 		f1 := func(a) {
@@ -1806,6 +2557,119 @@ out = (func() {
 	`, nil, 2)
 }
 
+func TestFunctionDefaults(t *testing.T) {
+	expectRun(t, `f := func(a, b = 10) { return [a, b] }; out = f(1)`,
+		nil, ARR{1, 10})
+	expectRun(t, `f := func(a, b = 10) { return [a, b] }; out = f(1, 2)`,
+		nil, ARR{1, 2})
+	expectRun(t, `f := func(a = 1) { return a }; out = f(undefined)`,
+		nil, 1)
+	expectRun(t, `f := func(a, b = a * 2) { return [a, b] }; out = f(3)`,
+		nil, ARR{3, 6})
+	expectRun(t, `
+x := 5
+f := func(a = x) { return a }
+x = 6
+out = f()`, nil, 6)
+	expectRun(t, `
+f := func(a, b = 1, ...c) { return [a, b, c] }
+out = [f(1), f(1, 2), f(1, 2, 3, 4)]`,
+		nil, ARR{ARR{1, 1, ARR{}}, ARR{1, 2, ARR{}}, ARR{1, 2, ARR{3, 4}}})
+	expectRun(t, `
+f := func(a, b = 1) { return a + b }
+out = f([5]...)`, nil, 6)
+
+	// tail call
+	expectRun(t, `
+f := func(n, acc = 0) {
+	if n == 0 { return acc }
+	return f(n - 1, acc + n)
+}
+out = f(100)`, nil, 5050)
+
+	// closures
+	expectRun(t, `
+f := func(x) { return func(a, b = x) { return a + b } }
+out = f(10)(1)`, nil, 11)
+
+	expectError(t, `func(a, b = 1) {}()`,
+		nil, "Runtime Error: missing argument for parameter 'a'")
+	expectError(t, `func(a, b = 1) {}(1, 2, 3)`,
+		nil, "Runtime Error: wrong number of arguments: want<=2, got=3")
+}
+
+func TestKeywordArgs(t *testing.T) {
+	expectRun(t, `f := func(a, b) { return a - b }; out = f(b: 1, a: 10)`,
+		nil, 9)
+	expectRun(t, `
+f := func(a, b = 2, c = 3) { return [a, b, c] }
+out = [f(1, c: 30), f(c: 30, a: 10), f(1, 20, c: 30)]`,
+		nil, ARR{ARR{1, 2, 30}, ARR{10, 2, 30}, ARR{1, 20, 30}})
+	expectRun(t, `
+f := func(a, limit = 10, ...rest) { return [a, limit, rest] }
+out = f(1, limit: 5)`, nil, ARR{1, 5, ARR{}})
+	expectRun(t, `
+m := {f: func(x, y = 0) { return x * 10 + y }}
+out = m.f(y: 2, x: 1)`, nil, 12)
+
+	expectError(t, `func(a, b) {}(1, c: 2)`,
+		nil, "Runtime Error: unexpected keyword argument 'c'")
+	expectError(t, `func(a, b) {}(1, a: 2)`,
+		nil, "Runtime Error: multiple values for parameter 'a'")
+	expectError(t, `func(a, b) {}(a: 2)`,
+		nil, "Runtime Error: missing argument for parameter 'b'")
+	expectError(t, `func(a, ...b) {}(1, b: 2)`,
+		nil, "Runtime Error: unexpected keyword argument 'b'")
+	expectError(t, `len(a: 1)`, nil, "Runtime Error: keyword arguments "+
+		"not supported in call to 'builtin-function:len'")
+}
+
+func TestOptionalChain(t *testing.T) {
+	expectRun(t, `m := {a: {b: [1, {c: 2}]}}; out = m?.a?.b[1].c`, nil, 2)
+	expectRun(t, `m := {}; out = m.a?.b[1].c`, nil, common.UndefinedValue)
+	expectRun(t, `m := {}; out = m.a?.b.c.d()`, nil, common.UndefinedValue)
+	expectRun(t, `a := undefined; out = a?.[0]`, nil, common.UndefinedValue)
+	expectRun(t, `a := undefined; out = a?.[1:]`, nil, common.UndefinedValue)
+	expectRun(t, `a := [1, 2, 3]; out = a?.[1:]`, nil, ARR{2, 3})
+	expectRun(t, `m := {f: func(x) { return x * 2 }}; out = m?.f(2)`, nil, 4)
+	expectRun(t, `a := undefined; out = [a?.b, a?.[0], 1]`,
+		nil, ARR{common.UndefinedValue, common.UndefinedValue, 1})
+
+	// "?" followed by "[" is a ternary expression
+	expectRun(t, `c := true; out = c ?[1, 2] : [3]`, nil, ARR{1, 2})
+	expectRun(t, `c := false; out = c?[1]:[3]`, nil, ARR{3})
+
+	// only undefined short-circuits
+	expectError(t, `a := 0; a?.b`, nil, "not indexable")
+	expectError(t, `a := {b: 1}; a?.b.c`, nil, "not indexable")
+
+	// the index of the skipped link is not evaluated
+	expectRun(t, `
+n := 0
+f := func() { n++; return "k" }
+a := undefined
+a?.[f()]
+out = n`, nil, 0)
+}
+
+func TestNullCoalescing(t *testing.T) {
+	expectRun(t, `out = undefined ?? 1`, nil, 1)
+	expectRun(t, `out = 0 ?? 1`, nil, 0)
+	expectRun(t, `out = false ?? 1`, nil, false)
+	expectRun(t, `out = "" ?? 1`, nil, "")
+	expectRun(t, `out = undefined ?? undefined ?? 3`, nil, 3)
+	expectRun(t, `m := {}; out = m.a?.b ?? "default"`, nil, "default")
+	expectRun(t, `out = undefined ?? false || true`, nil, true)
+	expectRun(t, `out = 1 + 2 ?? 5`, nil, 3)
+
+	// the right side is not evaluated if not needed
+	expectRun(t, `
+n := 0
+f := func() { n++; return 1 }
+a := 5 ?? f()
+out = [a, n]`, nil, ARR{5, 0})
+}
+
 func TestBlocksInGlobalScope(t *testing.T) {
 	expectRun(t, `
 f := undefined
@@ -2079,6 +2943,33 @@ func TestImmutable(t *testing.T) {
 		nil, "not index-assignable")
 }
 
+func TestIn(t *testing.T) {
+	expectRun(t, `out = 2 in [1, 2, 3]`, nil, true)
+	expectRun(t, `out = 4 in [1, 2, 3]`, nil, false)
+	expectRun(t, `out = "2" in [1, 2, 3]`, nil, false)
+	expectRun(t, `out = [1] in [[1], 2]`, nil, true)
+	expectRun(t, `out = 1 in immutable([1])`, nil, true)
+	expectRun(t, `out = "a" in {a: 1}`, nil, true)
+	expectRun(t, `out = "b" in {a: 1}`, nil, false)
+	expectRun(t, `out = 1 in {"1": 1}`, nil, false)
+	expectRun(t, `out = "a" in immutable({a: 1})`, nil, true)
+	expectRun(t, `out = "ell" in "hello"`, nil, true)
+	expectRun(t, `out = 'h' in "hello"`, nil, true)
+	expectRun(t, `out = "x" in "hello"`, nil, false)
+	expectRun(t, `out = 1 < 2 in [true]`, nil, true)
+	expectRun(t, `out = 1 in [2] == false`, nil, true)
+	expectRun(t, `
+out = 0
+for x in [1, 2, 3] {
+	if x in [1, 3] {
+		out += x
+	}
+}`, nil, 4)
+
+	expectError(t, `1 in 2`, nil, "invalid operation: int in int")
+	expectError(t, `1 in "hello"`, nil, "invalid operation: int in string")
+}
+
 func TestIncDec(t *testing.T) {
 	expectRun(t, `out = 0; out++`, nil, 1)
 	expectRun(t, `out = 0; out--`, nil, -1)
@@ -2422,6 +3313,30 @@ func TestInteger(t *testing.T) {
 
 	expectRun(t, `out = 9 + '0'`, nil, '9')
 	expectRun(t, `out = '9' - 5`, nil, '4')
+
+	expectError(t, `1 / 0`, nil, "Runtime Error: division by zero")
+	expectError(t, `a := 1; a %= 0`, nil, "Runtime Error: division by zero")
+	expectRun(t, `try { a := 1 / 0 } catch e { out = e.value }`, nil,
+		"division by zero")
+}
+
+func TestPow(t *testing.T) {
+	expectRun(t, `out = 2 ** 10`, nil, 1024)
+	expectRun(t, `out = 3 ** 0`, nil, 1)
+	expectRun(t, `out = 0 ** 0`, nil, 1)
+	expectRun(t, `out = -2 ** 3`, nil, -8)
+	expectRun(t, `out = (-2) ** 63`, nil, math.MinInt64)
+	expectRun(t, `out = 2 ** 3 ** 2`, nil, 512)
+	expectRun(t, `out = 2 * 3 ** 2`, nil, 18)
+	expectRun(t, `out = 2 ** 64`, nil, 0) // wraps around
+	expectRun(t, `out = 2.0 ** 3`, nil, 8.0)
+	expectRun(t, `out = 4 ** 0.5`, nil, 2.0)
+	expectRun(t, `out = 2.0 ** -1.0`, nil, 0.5)
+	expectRun(t, `out = 3; out **= 3`, nil, 27)
+	expectRun(t, `a := [2]; a[0] **= 2; out = a[0]`, nil, 4)
+
+	expectError(t, `2 ** -1`, nil, "negative exponent")
+	expectError(t, `"a" ** 2`, nil, "invalid operation: string ** int")
 }
 
 type StringArrayIterator struct {
@@ -2565,6 +3480,32 @@ out = m["foo"](2) + m["foo"](3)
 		nil, 5)
 	expectRun(t, `func() { m1 := {k1: 1, k2: "foo"}; m2 := m1; m2.k1 = 3; out = m1.k1 }()`,
 		nil, 3)
+
+	// non-string keys
+	expectRun(t, `
+m := {}
+m[1] = "int"; m["1"] = "string"; m['1'] = "char"; m[true] = "bool"
+m[1.5] = "float"; m[bytes("1")] = "bytes"; m[time(1)] = "time"
+out = [len(m), m[1], m["1"], m['1'], m[true], m[1.5], m[bytes("1")],
+	m[time(1)], m[2], m[false]]`, nil, ARR{7, "int", "string", "char",
+		"bool", "float", "bytes", "time", common.UndefinedValue,
+		common.UndefinedValue})
+	expectRun(t, `m := {}; m[-0.0] = 1; m[0.0] += 1; out = [len(m), m[0.0]]`,
+		nil, ARR{1, 2})
+	expectRun(t, `m := {a: 1}; m[1] = 2; out = [1 in m, "1" in m, [] in m]`,
+		nil, ARR{true, false, false})
+	expectRun(t, `m := {a: 1}; m[1] = 2; m[true] = [3]; out = string(m)`,
+		nil, `{a: 1, true: [3], 1: 2}`)
+	expectRun(t, `
+m1 := {a: 1}; m1[1] = [2]
+m2 := copy(m1)
+m2[1][0] = 3
+im := immutable(m1)
+out = [m1 == m2, m1[1], m2[1], im[1], im == m1, 1 in im]`,
+		nil, ARR{false, ARR{2}, ARR{3}, ARR{2}, true, true})
+	expectError(t, `m := {}; m[[]] = 1`, nil, "invalid index type")
+	expectError(t, `m := {}; m[0.0 / 0.0] = 1`, nil, "invalid index type")
+	expectError(t, `m := {}; x := m[undefined]`, nil, "invalid index type")
 }
 
 func TestBuiltin(t *testing.T) {
@@ -2879,6 +3820,49 @@ func testAllocsLimit(t *testing.T, src string, limit int64) {
 	}
 }
 
+func TestRange(t *testing.T) {
+	expectRun(t, `out = range(0, 5)`, nil,
+		&common.Range{Start: 0, Stop: 5, Step: 1})
+	expectRun(t, `out = 0; for x in range(0, 5) { out += x }`, nil, 10)
+	expectRun(t, `out = []; for i, x in range(10, 0, 4) { out = append(out, [i, x]) }`,
+		nil, ARR{ARR{0, 10}, ARR{1, 6}, ARR{2, 2}})
+	expectRun(t, `out = len(range(0, 10, 3))`, nil, 4)
+	expectRun(t, `out = len(range(0, 1 << 62))`, nil, 1<<62)
+	expectRun(t, `out = range(0, 1 << 62)[1 << 61]`, nil, 1<<61)
+	expectRun(t, `out = range(0, 10, 3)[4]`, nil, common.UndefinedValue)
+	expectRun(t, `out = range(0, 10, 3)[1:3]`, nil,
+		&common.Range{Start: 3, Stop: 9, Step: 3})
+	expectRun(t, `out = range(0, 10, 3)[2:]`, nil,
+		&common.Range{Start: 6, Stop: 10, Step: 3})
+	expectRun(t, `out = range(5, 0)[3:9]`, nil,
+		&common.Range{Start: 2, Stop: 0, Step: 1})
+	expectRun(t, `out = 6 in range(0, 10, 3)`, nil, true)
+	expectRun(t, `out = 7 in range(0, 10, 3)`, nil, false)
+	expectRun(t, `out = range(0, 3) == range(0, 4)[:3]`, nil, true)
+	expectRun(t, `out = is_range(range(0, 3)) && !is_range([0, 1, 2])`,
+		nil, true)
+	expectRun(t, `out = range(0, 0) ? 1 : 2`, nil, 2)
+
+	// ranges are used like the arrays they used to be
+	expectRun(t, `out = append(range(0, 3), 9)`, nil, ARR{0, 1, 2, 9})
+	expectRun(t, `out = range(0, 3) == [0, 1, 2]`, nil, true)
+	expectRun(t, `out = [0, 1, 2] == range(0, 3)`, nil, true)
+	expectRun(t, `out = immutable([2, 1]) == range(2, 0)`, nil, true)
+	expectRun(t, `out = range(0, 3) == [0, 1]`, nil, false)
+	expectRun(t, `out = range(0, 1) == ["0"]`, nil, false)
+	expectRun(t, `out = range(0, 2) + [5]`, nil, ARR{0, 1, 5})
+	expectRun(t, `out = [5] + range(0, 2)`, nil, ARR{5, 0, 1})
+	expectRun(t, `out = range(0, 2) + range(3, 1)`, nil, ARR{0, 1, 3, 2})
+	expectRun(t, `out = immutable([5]) + range(0, 1)`, nil, ARR{5, 0})
+	expectRun(t, `out = [] + range(0, 0)`, nil, ARR{})
+	expectRun(t, `a := [] + range(0, 3); a[0] = 5; out = a`, nil, ARR{5, 1, 2})
+	expectRun(t, `out = is_array(range(0, 3))`, nil, false)
+
+	expectError(t, `range(0, 2) + 1`, nil, "invalid operation: range + int")
+	expectError(t, `range(0, 10)[2:1]`, nil, "invalid slice index: 2 > 1")
+	expectError(t, `range(0, 10)["a"]`, nil, "invalid index type")
+}
+
 func TestReturn(t *testing.T) {
 	expectRun(t, `out = func() { return 10; }()`, nil, 10)
 	expectRun(t, `out = func() { return 10; return 9; }()`, nil, 10)
@@ -3105,6 +4089,77 @@ func() {
 		nil, "not index-assignable")
 }
 
+func TestSet(t *testing.T) {
+	expectRun(t, `out = string(set(3, 1, 2, 1))`, nil, "set(1, 2, 3)")
+	expectRun(t, `out = string(set("b", 2, 'x', "a", true, 1))`,
+		nil, `set(true, x, 1, 2, "a", "b")`)
+	expectRun(t, `out = string(set())`, nil, "set()")
+	expectRun(t, `out = len(set(1, 2, 2, "2"))`, nil, 3)
+	expectRun(t, `out = type_name(set())`, nil, "set")
+	expectRun(t, `out = is_set(set(1))`, nil, true)
+	expectRun(t, `out = is_set([1])`, nil, false)
+	expectRun(t, `out = set() ? 1 : 2`, nil, 2)
+	expectRun(t, `out = set(0) ? 1 : 2`, nil, 1)
+	expectRun(t, `a := [1, 2, 2, 3]; out = len(set(a...))`, nil, 3)
+
+	// set operators
+	expectRun(t, `out = string(set(1, 2) | set(2, 3))`, nil, "set(1, 2, 3)")
+	expectRun(t, `out = string(set(1, 2) & set(2, 3))`, nil, "set(2)")
+	expectRun(t, `out = string(set(1, 2) - set(2, 3))`, nil, "set(1)")
+	expectRun(t, `out = string(set(1, 2) ^ set(2, 3))`, nil, "set(1, 3)")
+	expectRun(t, `s := set(1); s |= set(2); out = string(s)`, nil, "set(1, 2)")
+	expectRun(t, `out = set(1, 2) == set(2, 1)`, nil, true)
+	expectRun(t, `out = set(1, 2) == set(1)`, nil, false)
+	expectRun(t, `out = set(1) == set("1")`, nil, false)
+	expectRun(t, `out = set(1) == [1]`, nil, false)
+
+	// membership
+	expectRun(t, `out = 1 in set(1, 2)`, nil, true)
+	expectRun(t, `out = 3 in set(1, 2)`, nil, false)
+	expectRun(t, `out = "1" in set(1, 2)`, nil, false)
+	expectRun(t, `out = [1] in set(1, 2)`, nil, false)
+	expectRun(t, `out = bytes("a") in set(bytes("a"))`, nil, true)
+	expectRun(t, `out = !(1 in set(1))`, nil, false)
+	expectRun(t, `out = 1 + 1 in set(2)`, nil, true)
+
+	// iteration
+	expectRun(t, `
+out = 0
+for x in set(1, 2, 3) {
+	out += x
+}`, nil, 6)
+	expectRun(t, `
+out = []
+for i, x in set("c", "a", "b") {
+	out = append(out, string(i) + x)
+}`, nil, ARR{"0a", "1b", "2c"})
+
+	// delete and copy
+	expectRun(t, `s := set(1, 2); delete(s, 1); out = string(s)`,
+		nil, "set(2)")
+	expectRun(t, `s := set(1, 2); delete(s, 3); delete(s, [1]); out = len(s)`,
+		nil, 2)
+	expectRun(t, `s1 := set(1, 2); s2 := copy(s1); delete(s1, 1); out = len(s2)`,
+		nil, 2)
+
+	// immutable set
+	expectRun(t, `out = type_name(immutable(set(1)))`, nil, "immutable-set")
+	expectRun(t, `out = is_immutable_set(immutable(set(1)))`, nil, true)
+	expectRun(t, `out = is_set(immutable(set(1)))`, nil, false)
+	expectRun(t, `out = 1 in immutable(set(1))`, nil, true)
+	expectRun(t, `out = len(immutable(set(1, 2)))`, nil, 2)
+	expectRun(t, `out = immutable(set(1)) == set(1)`, nil, true)
+	expectRun(t, `out = type_name(immutable(set(1)) | set(2))`, nil, "set")
+	expectRun(t, `out = type_name(copy(immutable(set(1))))`, nil, "set")
+
+	expectError(t, `set(1, [2])`, nil,
+		"invalid type for argument 'elems[1]'")
+	expectError(t, `delete(immutable(set(1)), 1)`, nil,
+		"invalid type for argument 'first'")
+	expectError(t, `set(1) | [1]`, nil, "invalid operation: set | array")
+	expectError(t, `set(1) + set(2)`, nil, "invalid operation: set + set")
+}
+
 func TestSourceModules(t *testing.T) {
 	testEnumModule(t, `out = enum.key(0, 20)`, 0)
 	testEnumModule(t, `out = enum.key(10, 20)`, 10)
@@ -3355,6 +4410,74 @@ out = x.chunk([1, 2, 3, 4, 5, 6], 2)
 x := import("enum")
 out = x.at([1, 2, 3], 0) 
 `, Opts().Stdlib(), 1)
+
+	expectRun(t, `
+x := import("enum")
+out = x.map(range(3, 0), func(_, v) { return v * 2 })
+`, Opts().Stdlib(), ARR{6, 4, 2})
+}
+
+func TestIter(t *testing.T) {
+	expectRun(t, `
+iter := import("iter")
+out = []
+for x in iter.map(iter.filter(range(0, 10), func(x) { return x % 3 == 0 }),
+	func(x) { return x * x }) {
+	out = append(out, x)
+}`, Opts().Stdlib(), ARR{0, 9, 36, 81})
+	expectRun(t, `
+iter := import("iter")
+out = []
+for i, x in iter.take(iter.filter(range(0, 1 << 62), func(x) { return x % 2 }), 3) {
+	out = append(out, [i, x])
+}`, Opts().Stdlib(), ARR{ARR{0, 1}, ARR{1, 3}, ARR{2, 5}})
+	expectRun(t, `
+iter := import("iter")
+out = []
+for x in iter.zip([1, 2, 3], "ab", iter.enumerate({b: 2, a: 1})) {
+	out = append(out, x)
+}`, Opts().Stdlib(), ARR{
+		ARR{1, 'a', ARR{0, 1}},
+		ARR{2, 'b', ARR{1, 2}},
+	})
+	expectRun(t, `
+iter := import("iter")
+out = []
+for x in iter.chain(range(0, 2), [], immutable([5]), iter.take("xyz", 1)) {
+	out = append(out, x)
+}`, Opts().Stdlib(), ARR{0, 1, 5, 'x'})
+
+	// iterables start over from their sources
+	expectRun(t, `
+iter := import("iter")
+m := iter.map([1, 2], func(x) { return x + 1 })
+out = []
+for x in m { out = append(out, x) }
+for x in m { out = append(out, x) }`, Opts().Stdlib(), ARR{2, 3, 2, 3})
+
+	// builtin functions and generators
+	expectRun(t, `
+iter := import("iter")
+gen := func() { yield "a"; yield "bc" }
+out = []
+for x in iter.map(gen(), len) { out = append(out, x) }`,
+		Opts().Stdlib(), ARR{1, 2})
+
+	expectError(t, `
+iter := import("iter")
+for x in iter.map([1, 2], func(x) { return x / 0 }) {}`,
+		Opts().Stdlib(), "division by zero")
+	expectError(t, `
+iter := import("iter")
+gen := func() { yield 1; throw "boom" }
+for x in iter.enumerate(gen()) {}`,
+		Opts().Stdlib(), "boom")
+	expectError(t, `import("iter").map(1, len)`,
+		Opts().Stdlib(), "invalid type for argument 'first'")
+	expectError(t, `import("iter").filter([], 1)`,
+		Opts().Stdlib(), "invalid type for argument 'second'")
+	expectError(t, `import("iter").zip([], 1)`,
+		Opts().Stdlib(), "invalid type for argument 'args[1]'")
 }
 
 func TestVMStackOverflow(t *testing.T) {
@@ -3460,6 +4583,193 @@ func TestString(t *testing.T) {
 	expectError(t, `1 + "foo"`, nil, "invalid operation")
 
 	expectError(t, `"foo" - "bar"`, nil, "invalid operation")
+
+	// interpolation
+	expectRun(t, `a := "World"; out = f"Hello ${a}!"`, nil, "Hello World!")
+	expectRun(t, `a := 1; b := 2; out = f"${a} + ${b} = ${a + b}"`,
+		nil, "1 + 2 = 3")
+	expectRun(t, `out = f"${1.5} ${true} ${'X'} ${undefined} ${[1, "a"]}"`,
+		nil, `1.5 true X <undefined> [1, "a"]`)
+	expectRun(t, `m := {a: "x"}; out = f"${m["a"]}${ {b: 1}.b }"`, nil, "x1")
+	expectRun(t, `a := 1; out = f"${f"${a}" + "2"}3"`, nil, "123")
+	expectRun(t, `out = f"\${a} \"\t\""`, nil, "${a} \"\t\"")
+	expectRun(t, `out = f""`, nil, "")
+	expectRun(t, `f := func(x) { return f"<${x}>" }; out = f(1) + f("a")`,
+		nil, "<1><a>")
+
+	common.MaxStringLen = 9
+	expectError(t, `a := "12345"; f"${a}${a}"`,
+		nil, "exceeding string size limit")
+	common.MaxStringLen = 2147483647
+}
+
+func TestSwitch(t *testing.T) {
+	// jump table
+	expectRun(t, `switch 2 { case 1: out = 1; case 2, 3: out = 2 }`, nil, 2)
+	expectRun(t, `switch "b" { case "a": out = 1; case "b": out = 2 }`,
+		nil, 2)
+	expectRun(t, `switch 4 { case 1: out = 1; default: out = 3 }`, nil, 3)
+	expectRun(t, `out = 1; switch 4 { case 1: out = 2 }`, nil, 1)
+	expectRun(t, `switch "1" { case 1: out = 1; case "1": out = 2 }`,
+		nil, 2)
+	expectRun(t, `switch 1.0 { case 1: out = 1; default: out = 2 }`, nil, 2)
+	expectRun(t, `switch [1] { case 1: out = 1; default: out = 2 }`, nil, 2)
+	expectRun(t, `switch 1 { default: out = 3; case 1: out = 1 }`, nil, 1)
+	expectRun(t, `
+f := func(x) {
+	switch x {
+	case 1, 2:
+		return "small"
+	case 10:
+		return "ten"
+	}
+	return "other"
+}
+out = [f(1), f(2), f(10), f(3), f("1")]`,
+		nil, ARR{"small", "small", "ten", "other", "other"})
+
+	// cases tested one by one
+	expectRun(t, `a := 2; switch a * 2 { case a + 2: out = 1 }`, nil, 1)
+	expectRun(t, `
+f := func(x) {
+	switch x {
+	case [1, 2]:
+		return "array"
+	case {a: 1}:
+		return "map"
+	case undefined:
+		return "undefined"
+	default:
+		return "default"
+	}
+}
+out = [f([1, 2]), f({a: 1}), f(undefined), f([1])]`,
+		nil, ARR{"array", "map", "undefined", "default"})
+
+	// guards
+	expectRun(t, `
+f := func(x, y) {
+	switch x {
+	case 1, 2 if y > 0:
+		return "positive"
+	case 1, 2:
+		return "other"
+	}
+}
+out = [f(1, 1), f(2, -1), f(3, 1)]`,
+		nil, ARR{"positive", "other", common.UndefinedValue})
+
+	// type patterns
+	expectRun(t, `
+f := func(x) {
+	switch x {
+	case int, float:
+		return "number"
+	case string if len(x) > 0:
+		return "string"
+	case bool, char, bytes, time:
+		return "other"
+	}
+	return "none"
+}
+out = [f(1), f(1.5), f("a"), f(""), f(true), f('a'), f(bytes(1)), f([])]`,
+		nil, ARR{"number", "number", "string", "none", "other", "other",
+			"other", "none"})
+	expectRun(t, `
+f := func(x) {
+	int := 1
+	switch x { case int: return "one" }
+}
+out = [f(1), f(2)]`, nil, ARR{"one", common.UndefinedValue})
+
+	// no tag
+	expectRun(t, `
+x := 5
+switch {
+case x < 0:
+	out = "negative"
+case x < 10, x > 100:
+	out = "small or large"
+default:
+	out = "medium"
+}`, nil, "small or large")
+	expectRun(t, `switch x := 1; { case x > 0: out = x }`, nil, 1)
+	expectRun(t, `switch { case 0, "", undefined: out = 1 }`, nil,
+		common.UndefinedValue)
+
+	// break leaves the switch, and, continue the loop
+	expectRun(t, `
+out = 0
+for i := 0; i < 5; i++ {
+	switch i {
+	case 1:
+		continue
+	case 3:
+		break
+	default:
+		out += 10
+	}
+	out += i
+}`, nil, 39)
+	expectRun(t, `
+out = 0
+for x in [1, "a", 2.5] {
+	switch x {
+	case int:
+		if x > 0 {
+			break
+		}
+		out = -1
+	default:
+		continue
+	}
+	out += 1
+}`, nil, 1)
+
+	// scopes
+	expectRun(t, `
+x := 1
+switch x := 2; x {
+case 2:
+	x := 3
+	out = x
+}
+out += x`, nil, 4)
+	expectRun(t, `
+f := func() {
+	a := 1
+	switch a {
+	case 1:
+		b := a + 1
+		switch b { case 2: return b * 10 }
+	}
+}
+out = f()`, nil, 20)
+
+	// try statements
+	expectRun(t, `
+out = 0
+for i := 0; i < 2; i++ {
+	switch i {
+	case 0:
+		try { break } finally { out += 1 }
+	}
+	out += 10
+}`, nil, 21)
+	expectRun(t, `
+f := func(x) {
+	switch x {
+	case 1:
+		throw "one"
+	}
+}
+try { f(1) } catch e { out = e.value }`, nil, "one")
+
+	expectError(t, `switch 1 { case 1: case 1: }`, nil, "duplicate case 1")
+	expectError(t, `switch 1 { case a: }`, nil,
+		"unresolved reference 'a'")
+	expectError(t, `switch {}; break`, nil,
+		"break not allowed outside loop")
 }
 
 func TestTailCall(t *testing.T) {
@@ -3624,7 +4934,328 @@ func TestSpread(t *testing.T) {
 	expectError(t, `func(a) {}([1, 2]...)`, nil,
 		"Runtime Error: wrong number of arguments: want=1, got=2")
 	expectError(t, `func(a, b, c) {}([1, 2]...)`, nil,
-		"Runtime Error: wrong number of arguments: want=3, got=2")
+		"Runtime Error: missing argument for parameter 'c'")
+}
+
+func TestGas(t *testing.T) {
+	run := func(
+		input string,
+		limit int64,
+		schedule *vm.GasSchedule,
+	) (*vm.VM, error) {
+		file := parse(t, input)
+		symTable := complier.NewSymbolTable()
+		c := complier.NewCompiler(file.InputFile, symTable, nil, nil, nil)
+		require.NoError(t, c.Compile(file))
+		v := vm.NewVM(c.Bytecode(), nil, -1)
+		v.SetGasLimit(limit, schedule)
+		return v, v.Run()
+	}
+
+	// 2 CONST, 1 BINARYOP, 1 SETG
+	schedule := &vm.GasSchedule{}
+	for op := range schedule.Opcodes {
+		schedule.Opcodes[op] = 1
+	}
+	schedule.Opcodes[parser.OpSuspend] = 0
+	v, err := run(`a := 1 + 2`, -1, schedule)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), v.GasUsed())
+	v, err = run(`a := 1 + 2`, 4, schedule)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), v.GasUsed())
+	v, err = run(`a := 1 + 2`, 3, schedule)
+	require.True(t, errors.As(err, &common.ErrOutOfGas{}))
+	require.Equal(t, int64(4), v.GasUsed())
+
+	// builtin and user function calls
+	schedule.BuiltinCall = 10
+	schedule.UserFunctionCall = 100
+	v, err = run(`a := len("")`, -1, schedule)
+	require.NoError(t, err)
+	require.Equal(t, int64(14), v.GasUsed())
+
+	// string and bytes sizes
+	schedule.PerByte = 2
+	v, err = run(`a := "foo" + "bar"`, -1, schedule)
+	require.NoError(t, err)
+	require.Equal(t, int64(16), v.GasUsed())
+	v, err = run(`a := bytes(5)`, -1, schedule)
+	require.NoError(t, err)
+	require.Equal(t, int64(24), v.GasUsed())
+
+	// infinite loop is bounded
+	var outOfGas common.ErrOutOfGas
+	_, err = run(`for {}`, 1000, nil)
+	require.True(t, errors.As(err, &outOfGas))
+	require.Equal(t, int64(1000), outOfGas.Limit)
+	_, err = run(`f := func() { return f() }; f()`, 1000, nil)
+	require.True(t, errors.As(err, &outOfGas))
+
+	// running out of gas cannot be caught
+	_, err = run(`try { for {} } catch e {}`, 1000, nil)
+	require.True(t, errors.As(err, &outOfGas))
+}
+
+func TestDeterministic(t *testing.T) {
+	run := func(
+		input string,
+		modules *common.ModuleMap,
+	) ([]common.Object, error) {
+		file := parse(t, input)
+		symTable := complier.NewSymbolTable()
+		c := complier.NewCompiler(file.InputFile, symTable, nil, modules, nil)
+		c.EnableDeterministic(true)
+		if err := c.Compile(file); err != nil {
+			return nil, err
+		}
+		globals := make([]common.Object, common.GlobalsSize)
+		v := vm.NewVM(c.Bytecode(), globals, -1)
+		v.SetDeterministic(true)
+		return globals, v.Run()
+	}
+
+	// map iteration is in sorted key order
+	for i := 0; i < 10; i++ {
+		globals, err := run(`
+m := {d: 4, b: 2, a: 1, e: 5, c: 3}
+out := ""
+for k, v in m { out += k + string(v) }`, nil)
+		require.NoError(t, err)
+		require.Equal(t, "a1b2c3d4e5", globals[1].(*common.String).Value)
+	}
+
+	// string keys are iterated before the other keys ordered by type and value
+	for i := 0; i < 10; i++ {
+		globals, err := run(`
+m := {b: 2, a: 1}
+m[4] = 4; m[3] = 3; m['c'] = 5; m[true] = 6
+out := ""
+for k, v in m { out += string(k) + string(v) }`, nil)
+		require.NoError(t, err)
+		require.Equal(t, "a1b2true6c53344",
+			globals[1].(*common.String).Value)
+	}
+
+	// non-deterministic modules are rejected
+	mods := common.NewModuleMap()
+	mods.Add("rand", &common.BuiltinModule{
+		Attrs:            map[string]common.Object{},
+		NonDeterministic: true,
+	})
+	mods.Add("math", &common.BuiltinModule{
+		Attrs: map[string]common.Object{},
+	})
+	_, err := run(`rand := import("rand")`, mods)
+	require.Error(t, err)
+	require.True(t, strings.Contains(err.Error(),
+		"module 'rand' not allowed in deterministic mode"))
+	_, err = run(`math := import("math")`, mods)
+	require.NoError(t, err)
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	run := func(input string) (common.Object, error) {
+		file := parse(t, input)
+		symTable := complier.NewSymbolTable()
+		c := complier.NewCompiler(file.InputFile, symTable, nil, nil, nil)
+		if err := c.Compile(file); err != nil {
+			return nil, err
+		}
+		globals := make([]common.Object, common.GlobalsSize)
+		v := vm.NewVM(c.Bytecode(), globals, -1)
+		v.SetCheckedArithmetic(true)
+		return globals[0], v.Run()
+	}
+
+	for _, input := range []string{
+		`a := 9223372036854775807; a + 1`,
+		`a := -9223372036854775807; a - 2`,
+		`a := 9223372036854775807; a++`,
+		`a := -9223372036854775807 - 1; a -= 1`,
+		`a := 4611686018427387904; a * 2`,
+		`a := -9223372036854775807 - 1; a * -1`,
+		`a := -1; a * (-9223372036854775807 - 1)`,
+		`a := 1; a << 63`,
+		`a := 3; a << 62`,
+		`a := 1; a << 64`,
+		`a := 1; a << -1`,
+		`a := 2; a ** 63`,
+		`a := 10; a ** 19`,
+		`a := -9223372036854775807 - 1; -a`,
+		`a := -9223372036854775807 - 1; a / -1`,
+		`a := -9223372036854775807 - 1; a /= -1`,
+		`a := -9223372036854775807 - 1; a % -1`,
+	} {
+		_, err := run(input)
+		require.True(t, errors.Is(err, common.ErrIntegerOverflow), input)
+	}
+
+	for input, expected := range map[string]int64{
+		`a := 9223372036854775806; a += 1`:    math.MaxInt64,
+		`a := -9223372036854775807; a -= 1`:   math.MinInt64,
+		`a := -4611686018427387904; a *= 2`:   math.MinInt64,
+		`a := -1; a <<= 63`:                   math.MinInt64,
+		`a := 0; a <<= 100`:                   0,
+		`a := -2; a **= 63`:                   math.MinInt64,
+		`a := 10; a **= 18`:                   1000000000000000000,
+		`a := 9223372036854775807; a /= -1`:   -math.MaxInt64,
+		`a := 9223372036854775807; a >>= 62`:  1,
+		`a := 9223372036854775807; a %= 1000`: 807,
+		`a := 9223372036854775807; a |= 1`:    math.MaxInt64,
+		`a := 9223372036854775807; a &^= 7`:   math.MaxInt64 - 7,
+		`a := 9223372036854775807; a ^= a`:    0,
+		`a := 9223372036854775807; a &= 1`:    1,
+		`a := -9223372036854775807; a = -a`:   math.MaxInt64,
+		`a := 9223372036854775807; a %= -1`:   0,
+	} {
+		res, err := run(input)
+		require.NoError(t, err, input)
+		require.Equal(t, expected, res.(*common.Int).Value, input)
+	}
+
+	// float operations are not checked
+	res, err := run(`a := 1.7976931348623157e308; a *= 2`)
+	require.NoError(t, err)
+	require.True(t, math.IsInf(res.(*common.Float).Value, 1))
+}
+
+func TestVM_RunCompiled(t *testing.T) {
+	file := parse(t, `
+a := 10
+f := func(x, y) { a += x; return a * y }
+g := func(...args) { return len(args) }`)
+	symTable := complier.NewSymbolTable()
+	c := complier.NewCompiler(file.InputFile, symTable, nil, nil, nil)
+	require.NoError(t, c.Compile(file))
+	globals := make([]common.Object, common.GlobalsSize)
+	v := vm.NewVM(c.Bytecode(), globals, -1)
+	require.NoError(t, v.Run())
+
+	f := globals[1].(*common.CompiledFunction)
+	res, err := v.RunCompiled(f, &common.Int{Value: 5}, &common.Int{Value: 2})
+	require.NoError(t, err)
+	require.Equal(t, int64(30), res.(*common.Int).Value)
+	require.Equal(t, int64(15), globals[0].(*common.Int).Value)
+
+	g := globals[2].(*common.CompiledFunction)
+	res, err = v.RunCompiled(g, common.TrueValue, common.FalseValue)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), res.(*common.Int).Value)
+
+	_, err = v.RunCompiled(f, &common.Int{Value: 5})
+	require.Error(t, err)
+	_, err = v.RunCompiled(f, &common.String{Value: "a"}, &common.Int{Value: 1})
+	require.Error(t, err)
+
+	// main function can be run again
+	require.NoError(t, v.Run())
+	require.Equal(t, int64(10), globals[0].(*common.Int).Value)
+}
+
+func TestVM_Invoke(t *testing.T) {
+	apply := &common.UserFunction{
+		Name: "apply",
+		Value: func(args ...common.Object) (common.Object, error) {
+			return args[0].Call(args[1:]...)
+		},
+	}
+	attempt := &common.UserFunction{
+		Name: "attempt",
+		Value: func(args ...common.Object) (common.Object, error) {
+			res, err := args[0].Call()
+			if err != nil {
+				return &common.String{Value: err.Error()}, nil
+			}
+			return res, nil
+		},
+	}
+	opts := Opts().Symbol("apply", apply).Symbol("attempt", attempt).Skip2ndPass()
+
+	expectRun(t, `out = apply(func(a, b) { return a + b }, 1, 2)`, opts, 3)
+	expectRun(t, `out = apply(func(...a) { return len(a) }, 1, 2, 3)`,
+		opts, 3)
+	expectRun(t, `x := 10; apply(func(a) { x += a }, 5); out = x`, opts, 15)
+	expectRun(t, `
+f := func() {
+	y := 1
+	apply(func(a) { y = a }, 5)
+	return y
+}
+out = f()`, opts, 5)
+	expectRun(t, `
+out = apply(func(a) {
+	return apply(func(b) { return a * b }, 3)
+}, 7)`, opts, 21)
+	expectRun(t, `
+out = apply(func(a) {
+	return apply(apply, func(b) { return a + b }, 3)
+}, 7)`, opts, 10)
+	expectRun(t, `out = apply(len, [1, 2])`, opts, 2)
+
+	expectError(t, `apply(func(a) {}, 1, 2)`, opts,
+		"Runtime Error: wrong number of arguments: want=1, got=2\n\tat test:1:1")
+	expectError(t, `
+f := func() {
+	return 1 + "a"
+}
+apply(f)`, opts,
+		"Runtime Error: invalid operation: int + string\n\tat test:3:9\n"+
+			"\tat test:5:1")
+	expectRun(t, `out = attempt(func() { return 1 + "a" })`,
+		opts, "invalid operation: int + string\n\tat test:1:31")
+	expectRun(t, `attempt(func() { return 1 + "a" }); out = 5`, opts, 5)
+	expectError(t, `
+a := []
+apply(func() { for i := 0; i < 100; i++ { a = append(a, i) } })`,
+		opts.MaxAllocs(50), "allocation limit exceeded")
+	expectError(t, `
+a := []
+attempt(func() { for i := 0; i < 100; i++ { a = append(a, i) } })
+a = append(a, 1)`,
+		opts.MaxAllocs(50), "allocation limit exceeded")
+
+	_, err := (&common.CompiledFunction{}).Call()
+	require.Equal(t, common.ErrNotBound, err)
+
+	// gas and abort are shared with the running execution
+	var v *vm.VM
+	var callErr error
+	run := func(input string) error {
+		file := parse(t, input)
+		symTable := complier.NewSymbolTable()
+		symTable.Define("attempt")
+		symTable.Define("abort")
+		c := complier.NewCompiler(file.InputFile, symTable, nil, nil, nil)
+		require.NoError(t, c.Compile(file))
+		globals := make([]common.Object, common.GlobalsSize)
+		globals[0] = &common.UserFunction{
+			Name: "attempt",
+			Value: func(args ...common.Object) (common.Object, error) {
+				_, callErr = args[0].Call()
+				return nil, nil
+			},
+		}
+		globals[1] = &common.UserFunction{
+			Name: "abort",
+			Value: func(args ...common.Object) (common.Object, error) {
+				v.Abort()
+				return nil, nil
+			},
+		}
+		v = vm.NewVM(c.Bytecode(), globals, -1)
+		v.SetGasLimit(1000, nil)
+		return v.Run()
+	}
+	err = run(`attempt(func() { for {} })`)
+	require.True(t, errors.As(callErr, &common.ErrOutOfGas{}))
+	require.True(t, errors.As(err, &common.ErrOutOfGas{}))
+	err = run(`attempt(func() { abort(); for {} }); for {}`)
+	require.NoError(t, err)
+	require.Equal(t, common.ErrVMAborted, callErr)
+
+	_, err = v.Invoke(&common.CompiledFunction{})
+	require.Equal(t, common.ErrNotInCall, err)
 }
 
 func expectRun(
@@ -3976,6 +5607,8 @@ func objectZeroCopy(o common.Object) common.Object {
 		return &common.ImmutableArray{}
 	case *common.ImmutableMap:
 		return &common.ImmutableMap{}
+	case *common.Range:
+		return &common.Range{}
 	case nil:
 		panic("nil")
 	default: